@@ -2,17 +2,186 @@ package config
 
 import (
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Config is the service configuration. TrustedProxies are the addresses and
+// CIDRs of the reverse proxies whose X-Forwarded-For and X-Real-IP headers
+// give the client address, by default no proxy is trusted and the client is
+// the peer of the connection.
 type Config struct {
-	Addresss   string `yaml:"address"`
-	Port       string `yaml:"port"`
-	DSN        string `yaml:"dsn"`
-	LogLevel   string `yaml:"log_level"`
-	AdminToken string `yaml:"admin_token"`
-	UploadPath string `yaml:"upload_path"`
+	Addresss       string   `yaml:"address"`
+	Port           string   `yaml:"port"`
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	DSN            string   `yaml:"dsn"`
+	LogLevel       string   `yaml:"log_level"`
+	SecretKey      string   `yaml:"secret_key"`
+	AdminToken     string   `yaml:"admin_token"`
+	UploadPath     string   `yaml:"upload_path"`
+	Session        Session  `yaml:"session"`
+	JWT            JWT      `yaml:"jwt"`
+	Password       Password `yaml:"password"`
+	Invite         Invite   `yaml:"invite"`
+	Policy         Policy   `yaml:"policy"`
+	TOTP           TOTP     `yaml:"totp"`
+	OIDC           OIDC     `yaml:"oidc"`
+	LDAP           LDAP     `yaml:"ldap"`
+	Lockout        Lockout  `yaml:"lockout"`
+	Events         Events   `yaml:"events"`
+}
+
+// Session holds the token lifetimes. AccessTTL is the idle timeout of an
+// access token, every use pushes it forward up to MaxTTL after login.
+type Session struct {
+	AccessTTL       time.Duration `yaml:"access_ttl"`
+	MaxTTL          time.Duration `yaml:"max_ttl"`
+	RefreshTTL      time.Duration `yaml:"refresh_ttl"`
+	JanitorInterval time.Duration `yaml:"janitor_interval"`
+}
+
+// JWT switches access tokens to signed JWTs verified without a database
+// lookup. HS256 signs with SecretKey, EdDSA with the Ed25519 key pair in
+// PEM files; the public key is derived when only the private one is set.
+// Revoked tokens are remembered by jti and the deny-list answers are cached
+// for DenyCacheTTL.
+type JWT struct {
+	Enabled        bool          `yaml:"enabled"`
+	Algorithm      string        `yaml:"algorithm"`
+	Issuer         string        `yaml:"issuer"`
+	PrivateKeyFile string        `yaml:"private_key_file"`
+	PublicKeyFile  string        `yaml:"public_key_file"`
+	DenyCacheTTL   time.Duration `yaml:"deny_cache_ttl"`
+}
+
+// Password holds how long an issued password reset token stays valid and
+// how passwords are hashed.
+type Password struct {
+	ResetTTL time.Duration `yaml:"reset_ttl"`
+	Argon2   Argon2        `yaml:"argon2"`
+}
+
+// Argon2 are the argon2id parameters of new password hashes, Memory in KiB.
+// Stored hashes with other parameters, and bcrypt ones, are replaced on the
+// next login.
+type Argon2 struct {
+	Memory      uint32 `yaml:"memory"`
+	Iterations  uint32 `yaml:"iterations"`
+	Parallelism uint8  `yaml:"parallelism"`
+	SaltLength  uint32 `yaml:"salt_length"`
+	KeyLength   uint32 `yaml:"key_length"`
+}
+
+// Invite holds how long an invite stays valid when the admin sets no
+// expiry.
+type Invite struct {
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// Policy is what logins and passwords of new users and new passwords must
+// look like.
+type Policy struct {
+	Login    LoginPolicy    `yaml:"login"`
+	Password PasswordPolicy `yaml:"password"`
+}
+
+// LoginPolicy allows letters, digits and the AllowedSpecials characters.
+// MaxLength can not exceed 50, the length of users.login. Forbidden
+// substrings are compared without case.
+type LoginPolicy struct {
+	MinLength           int      `yaml:"min_length"`
+	MaxLength           int      `yaml:"max_length"`
+	AllowedSpecials     string   `yaml:"allowed_specials"`
+	ForbiddenSubstrings []string `yaml:"forbidden_substrings"`
+}
+
+// PasswordPolicy counts letters, uppercase and lowercase letters, digits and
+// specials, anything else. ForbidLogin refuses passwords containing the
+// login. BreachedDir is a local copy of a k-anonymity breached password
+// list, one <prefix>.txt file of SHA-1 suffixes per 5 hex prefix as the Pwned
+// Passwords range API serves them; empty turns the check off.
+type PasswordPolicy struct {
+	MinLength           int      `yaml:"min_length"`
+	MaxLength           int      `yaml:"max_length"`
+	MinLetters          int      `yaml:"min_letters"`
+	MinUpper            int      `yaml:"min_upper"`
+	MinLower            int      `yaml:"min_lower"`
+	MinDigits           int      `yaml:"min_digits"`
+	MinSpecials         int      `yaml:"min_specials"`
+	ForbidLogin         bool     `yaml:"forbid_login"`
+	ForbiddenSubstrings []string `yaml:"forbidden_substrings"`
+	BreachedDir         string   `yaml:"breached_dir"`
+}
+
+// TOTP is the second factor setup. Issuer names the account in
+// authenticator apps, a login challenge is valid for ChallengeTTL.
+type TOTP struct {
+	Issuer       string        `yaml:"issuer"`
+	ChallengeTTL time.Duration `yaml:"challenge_ttl"`
+}
+
+// Lockout is the brute-force policy of password logins. Every failure of a
+// login doubles the wait before the next attempt, from BaseDelay up to
+// MaxDelay; MaxFailures failures within Window lock the login out for
+// Duration. A client address is locked out after IPMaxFailures.
+type Lockout struct {
+	MaxFailures   int           `yaml:"max_failures"`
+	IPMaxFailures int           `yaml:"ip_max_failures"`
+	BaseDelay     time.Duration `yaml:"base_delay"`
+	MaxDelay      time.Duration `yaml:"max_delay"`
+	Duration      time.Duration `yaml:"duration"`
+	Window        time.Duration `yaml:"window"`
+}
+
+// Events is how long the event log keeps an event once webhooks have been
+// queued for it. A sync cursor older than the purged events is refused and
+// the client has to sync again from a snapshot.
+type Events struct {
+	Retention     time.Duration `yaml:"retention"`
+	PurgeInterval time.Duration `yaml:"purge_interval"`
+}
+
+// OIDC enables single sign-on through an OpenID Connect provider found by
+// Issuer discovery. Users are matched by the provider subject, then with
+// LinkClaim set by that claim against users.email when LinkVerifiedClaim is
+// true, then by the LoginClaim against users.login and, with AutoProvision,
+// created on first login. With RoleMapping set, the role follows the GroupsClaim on every
+// login: a group mapped to admin makes an admin, anything else a user.
+type OIDC struct {
+	Enabled           bool              `yaml:"enabled"`
+	Issuer            string            `yaml:"issuer"`
+	ClientID          string            `yaml:"client_id"`
+	ClientSecret      string            `yaml:"client_secret"`
+	RedirectURL       string            `yaml:"redirect_url"`
+	Scopes            []string          `yaml:"scopes"`
+	LoginClaim        string            `yaml:"login_claim"`
+	GroupsClaim       string            `yaml:"groups_claim"`
+	RoleMapping       map[string]string `yaml:"role_mapping"`
+	AutoProvision     bool              `yaml:"auto_provision"`
+	LinkClaim         string            `yaml:"link_claim"`
+	LinkVerifiedClaim string            `yaml:"link_verified_claim"`
+	StateTTL          time.Duration     `yaml:"state_ttl"`
+}
+
+// LDAP checks passwords against a directory after the local ones. The user
+// entry is searched under BaseDN by ObjectClass and LoginAttribute, bound to
+// with BindDN when set, and its GroupAttribute values are group DNs mapped to
+// roles by GroupMapping. URL is ldap:// or ldaps://, StartTLS upgrades an
+// ldap:// connection.
+type LDAP struct {
+	Enabled            bool              `yaml:"enabled"`
+	URL                string            `yaml:"url"`
+	StartTLS           bool              `yaml:"start_tls"`
+	InsecureSkipVerify bool              `yaml:"insecure_skip_verify"`
+	BindDN             string            `yaml:"bind_dn"`
+	BindPassword       string            `yaml:"bind_password"`
+	BaseDN             string            `yaml:"base_dn"`
+	ObjectClass        string            `yaml:"object_class"`
+	LoginAttribute     string            `yaml:"login_attribute"`
+	GroupAttribute     string            `yaml:"group_attribute"`
+	GroupMapping       map[string]string `yaml:"group_mapping"`
+	Timeout            time.Duration     `yaml:"timeout"`
 }
 
 func NewConfig(path string) (*Config, error) {
@@ -28,5 +197,188 @@ func NewConfig(path string) (*Config, error) {
 		return nil, err
 	}
 
+	cfg.Session.setDefaults()
+	cfg.JWT.setDefaults()
+	cfg.Password.setDefaults()
+	cfg.Invite.setDefaults()
+	cfg.Policy.setDefaults()
+	cfg.TOTP.setDefaults()
+	cfg.OIDC.setDefaults()
+	cfg.LDAP.setDefaults()
+	cfg.Lockout.setDefaults()
+	cfg.Events.setDefaults()
+
 	return cfg, nil
 }
+
+func (inst *Session) setDefaults() {
+	if inst.AccessTTL <= 0 {
+		inst.AccessTTL = 30 * time.Minute
+	}
+
+	if inst.MaxTTL < inst.AccessTTL {
+		inst.MaxTTL = max(24*time.Hour, inst.AccessTTL)
+	}
+
+	if inst.RefreshTTL <= 0 {
+		inst.RefreshTTL = 30 * 24 * time.Hour
+	}
+
+	if inst.JanitorInterval <= 0 {
+		inst.JanitorInterval = 10 * time.Minute
+	}
+}
+
+func (inst *JWT) setDefaults() {
+	if inst.Algorithm == "" {
+		inst.Algorithm = "HS256"
+	}
+
+	if inst.Issuer == "" {
+		inst.Issuer = "docs"
+	}
+
+	if inst.DenyCacheTTL <= 0 {
+		inst.DenyCacheTTL = 30 * time.Second
+	}
+}
+
+func (inst *Password) setDefaults() {
+	if inst.ResetTTL <= 0 {
+		inst.ResetTTL = time.Hour
+	}
+
+	inst.Argon2.setDefaults()
+}
+
+func (inst *Argon2) setDefaults() {
+	if inst.Memory == 0 {
+		inst.Memory = 64 * 1024
+	}
+
+	if inst.Iterations == 0 {
+		inst.Iterations = 3
+	}
+
+	if inst.Parallelism == 0 {
+		inst.Parallelism = 2
+	}
+
+	if inst.SaltLength < 16 {
+		inst.SaltLength = 16
+	}
+
+	if inst.KeyLength < 16 {
+		inst.KeyLength = 32
+	}
+}
+
+func (inst *Invite) setDefaults() {
+	if inst.TTL <= 0 {
+		inst.TTL = 7 * 24 * time.Hour
+	}
+}
+
+func (inst *Policy) setDefaults() {
+	if inst.Login.MinLength <= 0 {
+		inst.Login.MinLength = 8
+	}
+
+	if inst.Login.MaxLength <= 0 || inst.Login.MaxLength > 50 {
+		inst.Login.MaxLength = 50
+	}
+
+	if inst.Password.MinLength <= 0 {
+		inst.Password.MinLength = 8
+	}
+
+	if inst.Password.MaxLength < inst.Password.MinLength {
+		inst.Password.MaxLength = max(256, inst.Password.MinLength)
+	}
+}
+
+func (inst *TOTP) setDefaults() {
+	if inst.Issuer == "" {
+		inst.Issuer = "docs"
+	}
+
+	if inst.ChallengeTTL <= 0 {
+		inst.ChallengeTTL = 5 * time.Minute
+	}
+}
+
+func (inst *OIDC) setDefaults() {
+	if len(inst.Scopes) == 0 {
+		inst.Scopes = []string{"openid", "profile", "email"}
+	}
+
+	if inst.LoginClaim == "" {
+		inst.LoginClaim = "preferred_username"
+	}
+
+	if inst.GroupsClaim == "" {
+		inst.GroupsClaim = "groups"
+	}
+
+	if inst.LinkVerifiedClaim == "" {
+		inst.LinkVerifiedClaim = "email_verified"
+	}
+
+	if inst.StateTTL <= 0 {
+		inst.StateTTL = 10 * time.Minute
+	}
+}
+
+func (inst *LDAP) setDefaults() {
+	if inst.ObjectClass == "" {
+		inst.ObjectClass = "person"
+	}
+
+	if inst.LoginAttribute == "" {
+		inst.LoginAttribute = "uid"
+	}
+
+	if inst.GroupAttribute == "" {
+		inst.GroupAttribute = "memberOf"
+	}
+
+	if inst.Timeout <= 0 {
+		inst.Timeout = 10 * time.Second
+	}
+}
+
+func (inst *Lockout) setDefaults() {
+	if inst.MaxFailures <= 0 {
+		inst.MaxFailures = 5
+	}
+
+	if inst.IPMaxFailures <= 0 {
+		inst.IPMaxFailures = 50
+	}
+
+	if inst.BaseDelay <= 0 {
+		inst.BaseDelay = time.Second
+	}
+
+	if inst.MaxDelay < inst.BaseDelay {
+		inst.MaxDelay = max(time.Minute, inst.BaseDelay)
+	}
+
+	if inst.Duration <= 0 {
+		inst.Duration = 15 * time.Minute
+	}
+
+	if inst.Window <= 0 {
+		inst.Window = 15 * time.Minute
+	}
+}
+
+func (inst *Events) setDefaults() {
+	if inst.Retention <= 0 {
+		inst.Retention = 30 * 24 * time.Hour
+	}
+
+	if inst.PurgeInterval <= 0 {
+		inst.PurgeInterval = time.Hour
+	}
+}
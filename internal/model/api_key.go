@@ -0,0 +1,61 @@
+package model
+
+import (
+	"net/netip"
+	"time"
+)
+
+// APIKey is a long-lived access token of a service account, stored by the
+// SHA-256 of the key. Prefix is the start of the key, kept to tell keys
+// apart. Token is only set when the key is created, UserLogin and UserRole
+// when it is used.
+type APIKey struct {
+	UUID       string
+	Hash       string
+	Prefix     string
+	Token      string
+	Name       string
+	UserUUID   string
+	UserLogin  string
+	UserRole   string
+	Scopes     []string
+	AllowedIPs []string
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreateAt   time.Time
+}
+
+// AllowsIP reports whether the key may be used from ip, an empty allowlist
+// allows any address.
+func (inst *APIKey) AllowsIP(ip string) bool {
+	if len(inst.AllowedIPs) == 0 {
+		return true
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, allowed := range inst.AllowedIPs {
+		prefix, err := netip.ParsePrefix(allowed)
+		if err == nil && prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Principal returns the caller the key authenticates.
+func (inst *APIKey) Principal() *Principal {
+	return &Principal{
+		SessionUUID: inst.UUID,
+		UserUUID:    inst.UserUUID,
+		Login:       inst.UserLogin,
+		Role:        inst.UserRole,
+		Scopes:      inst.Scopes,
+		APIKey:      true,
+	}
+}
@@ -1,5 +1,12 @@
 package model
 
+import "time"
+
+// AuthToken is the result of a login. When the user has a second factor
+// only Challenge is set, it is exchanged with a code for the tokens.
 type AuthToken struct {
-	AccessToken string
+	AccessToken  string
+	RefreshToken string
+	Challenge    string
+	ExpiresAt    time.Time
 }
@@ -0,0 +1,87 @@
+package model
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ChangeUpsert = "upsert"
+	ChangeDelete = "delete"
+)
+
+// ChangeCursor is a position in the change log. Changes are ordered by the
+// inserting transaction and then by event ID. While a sync snapshot is paged
+// Document is the last document sent, the log position is where the changes
+// continue once the snapshot is complete.
+type ChangeCursor struct {
+	TxID     uint64
+	ID       int64
+	Document string
+}
+
+var errInvalidCursor = errors.New("invalid change cursor")
+
+// String encodes the cursor into the opaque form handed to clients.
+func (inst ChangeCursor) String() string {
+	if inst.Document != "" {
+		return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d.%d.%s", inst.TxID, inst.ID, inst.Document))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(fmt.Appendf(nil, "%d.%d", inst.TxID, inst.ID))
+}
+
+// After reports whether the cursor is past other.
+func (inst ChangeCursor) After(other ChangeCursor) bool {
+	return inst.TxID > other.TxID || inst.TxID == other.TxID && inst.ID > other.ID
+}
+
+// ParseChangeCursor decodes a cursor produced by ChangeCursor.String.
+func ParseChangeCursor(value string) (ChangeCursor, error) {
+	var cursor ChangeCursor
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+
+	txID, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return cursor, errInvalidCursor
+	}
+	id, cursor.Document, _ = strings.Cut(id, ".")
+
+	if cursor.TxID, err = strconv.ParseUint(txID, 10, 64); err != nil {
+		return cursor, errInvalidCursor
+	}
+
+	if cursor.ID, err = strconv.ParseInt(id, 10, 64); err != nil || cursor.ID < 0 {
+		return cursor, errInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// Change is one entry of a delta sync. Delete changes are tombstones, the
+// document was removed or is no longer shared with the caller.
+type Change struct {
+	Type         string
+	Event        string
+	Actor        string
+	DocumentUUID string
+	Document     *Document
+	CreateAt     time.Time
+}
+
+// ChangeSet is a page of changes. Snapshot is set when Changes hold the full
+// document set of the caller rather than the changes after a cursor.
+type ChangeSet struct {
+	Changes  []Change
+	Cursor   ChangeCursor
+	HasMore  bool
+	Snapshot bool
+}
@@ -0,0 +1,7 @@
+package model
+
+// Client describes where a request came from.
+type Client struct {
+	IP        string
+	UserAgent string
+}
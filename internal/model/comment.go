@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// Comment is a note on a document. Replies point to their parent, only
+// thread roots can be resolved.
+type Comment struct {
+	UUID         string
+	DocumentUUID string
+	ParentUUID   *string
+	UserLogin    string
+	Body         string
+	Anchor       *CommentAnchor
+	Resolved     bool
+	ResolvedBy   *string
+	ResolvedAt   *time.Time
+	CreateAt     time.Time
+	UpdateAt     time.Time
+}
+
+// CommentAnchor ties a comment to a place in the document: a page and/or a
+// character range, Quote keeps the anchored text.
+type CommentAnchor struct {
+	Page  *int   `json:"page,omitempty"`
+	Start *int   `json:"start,omitempty"`
+	End   *int   `json:"end,omitempty"`
+	Quote string `json:"quote,omitempty"`
+}
+
+func (inst *CommentAnchor) Empty() bool {
+	return inst.Page == nil && inst.Start == nil && inst.End == nil && inst.Quote == ""
+}
+
+// CommentPatch changes the body and/or the anchor, an empty anchor removes it.
+type CommentPatch struct {
+	Body   *string
+	Anchor *CommentAnchor
+}
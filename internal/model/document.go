@@ -11,4 +11,9 @@ type Document struct {
 	CreateAt time.Time
 	Grant    []string
 	Path     string
+	Version  int
+	JSON     map[string]any
+	Size     int64
+	Hash     string
+	Lock     *Lock
 }
@@ -5,4 +5,9 @@ type DocumentFilterData struct {
 	FiltredField string
 	FiltredValue string
 	Limit        int
+
+	// NamePrefix keeps the documents whose name starts with it, FileOnly
+	// the ones with a file
+	NamePrefix string
+	FileOnly   bool
 }
@@ -0,0 +1,12 @@
+package model
+
+// DocumentPatch is a JSON merge patch over the mutable document fields.
+// Nil fields are left untouched. JSON is merged into the stored JSON,
+// a pointer to a nil map removes it.
+type DocumentPatch struct {
+	Name   *string
+	Mime   *string
+	Public *bool
+	Grant  *[]string
+	JSON   *map[string]any
+}
@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+const (
+	EventDocumentCreated = "document.created"
+	EventDocumentUpdated = "document.updated"
+	EventDocumentDeleted = "document.deleted"
+	EventDocumentShared  = "document.shared"
+
+	EventCommentCreated  = "comment.created"
+	EventCommentUpdated  = "comment.updated"
+	EventCommentDeleted  = "comment.deleted"
+	EventCommentResolved = "comment.resolved"
+)
+
+// Event is a document lifecycle change. Grant holds the logins allowed to
+// see it, Data carries event specific details. ID and TxID are the position
+// in the event log and Payload its stored JSON form, all set once persisted.
+type Event struct {
+	ID       int64
+	TxID     uint64
+	UUID     string
+	Type     string
+	Actor    string
+	Document *Document
+	Grant    []string
+	Data     map[string]any
+	Payload  []byte
+	CreateAt time.Time
+}
+
+// Cursor returns the position of the event in the event log.
+func (inst *Event) Cursor() ChangeCursor {
+	return ChangeCursor{TxID: inst.TxID, ID: inst.ID}
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// Invite lets up to MaxUses people register until it expires or is revoked,
+// with the role of the invite. A non-empty Login is the only login it
+// registers. Stored by the SHA-256 of the code, Code is only set when the
+// invite is created.
+//
+// Invites carry no pre-assigned groups: the service has no user groups, a
+// grant is always given to a single login.
+type Invite struct {
+	UUID        string
+	Hash        string
+	Code        string
+	Login       string
+	Role        string
+	MaxUses     int
+	Uses        int
+	CreateBy    string
+	ExpiresAt   time.Time
+	RevokedAt   *time.Time
+	CreateAt    time.Time
+	Redemptions []InviteRedemption
+}
+
+// InviteRedemption records a user registered with an invite.
+type InviteRedemption struct {
+	UserUUID  string
+	UserLogin string
+	CreateAt  time.Time
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type Lock struct {
+	DocumentUUID string
+	UserLogin    string
+	ExpiresAt    time.Time
+	CreateAt     time.Time
+}
+
+func (inst *Lock) Expired() bool {
+	return time.Now().After(inst.ExpiresAt)
+}
@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// Kinds of LoginFailure keys.
+const (
+	LoginFailureLogin = "login"
+	LoginFailureIP    = "ip"
+)
+
+// LoginFailure counts the failed logins of a login or an IP address since
+// the window of the lockout policy last restarted. Logins are refused until
+// BlockedUntil, Locked tells a lockout from a short delay.
+type LoginFailure struct {
+	Kind          string
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	BlockedUntil  *time.Time
+	Locked        bool
+}
+
+// RetryAfter returns how long logins stay refused, zero when they are not.
+func (inst *LoginFailure) RetryAfter(now time.Time) time.Duration {
+	if inst.BlockedUntil == nil || !inst.BlockedUntil.After(now) {
+		return 0
+	}
+
+	return inst.BlockedUntil.Sub(now)
+}
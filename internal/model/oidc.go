@@ -0,0 +1,30 @@
+package model
+
+import "time"
+
+// OIDCState is a login started at the identity provider, stored by the
+// SHA-256 of the state parameter until the provider redirects back.
+type OIDCState struct {
+	Hash         string
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time
+	CreateAt     time.Time
+}
+
+// OIDCRedirect sends the browser to the identity provider. State is also
+// kept in a cookie of the browser until ExpiresAt, the callback is only
+// accepted from the browser that started the login.
+type OIDCRedirect struct {
+	URL       string
+	State     string
+	ExpiresAt time.Time
+}
+
+// Identity links the subject of an identity provider to a user.
+type Identity struct {
+	Issuer   string
+	Subject  string
+	UserUUID string
+	CreateAt time.Time
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// PasswordReset is a single-use token to set a new password, stored by the
+// SHA-256 of the token. Token is only set when it is issued.
+type PasswordReset struct {
+	Hash      string
+	Token     string
+	UserUUID  string
+	UserLogin string
+	CreateBy  string
+	ExpiresAt time.Time
+	CreateAt  time.Time
+	UsedAt    *time.Time
+}
@@ -0,0 +1,31 @@
+package model
+
+import "slices"
+
+// Principal is the authenticated caller of a request. SessionUUID identifies
+// the credential it came with: the session, the jti of a JWT or the API key.
+// Scopes nil means every scope of the role.
+type Principal struct {
+	SessionUUID string
+	UserUUID    string
+	Login       string
+	Role        string
+	FamilyUUID  string
+	Scopes      []string
+	APIKey      bool
+}
+
+// IsAdmin reports whether the caller is an admin and the credential allows
+// acting as one.
+func (inst *Principal) IsAdmin() bool {
+	return inst.Role == RoleAdmin && inst.HasScope(ScopeAdmin)
+}
+
+// HasScope reports whether the credential grants the scope.
+func (inst *Principal) HasScope(scope string) bool {
+	if inst.Scopes == nil {
+		return slices.Contains(RoleScopes(inst.Role), scope)
+	}
+
+	return slices.Contains(inst.Scopes, scope)
+}
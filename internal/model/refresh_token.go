@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+// RefreshToken is stored by the SHA-256 of the token. Every refresh uses the
+// token up and issues the next one of the same family, presenting a used
+// token again revokes the whole family.
+type RefreshToken struct {
+	Hash        string
+	FamilyUUID  string
+	SessionUUID string
+	UserUUID    string
+	UserLogin   string
+	ExpiresAt   time.Time
+	CreateAt    time.Time
+	UsedAt      *time.Time
+	Revoked     bool
+}
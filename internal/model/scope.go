@@ -0,0 +1,21 @@
+package model
+
+const (
+	ScopeDocsRead   = "docs:read"
+	ScopeDocsWrite  = "docs:write"
+	ScopeDocsDelete = "docs:delete"
+	ScopeAdmin      = "admin"
+)
+
+// Scopes are all the known scopes.
+var Scopes = []string{ScopeDocsRead, ScopeDocsWrite, ScopeDocsDelete, ScopeAdmin}
+
+// RoleScopes returns every scope a user of the role holds.
+func RoleScopes(role string) []string {
+	scopes := []string{ScopeDocsRead, ScopeDocsWrite, ScopeDocsDelete}
+	if role == RoleAdmin {
+		scopes = append(scopes, ScopeAdmin)
+	}
+
+	return scopes
+}
@@ -2,9 +2,41 @@ package model
 
 import "time"
 
+// Session is an access token. ExpiresAt slides forward by IdleTTL on use but
+// never past MaxExpiresAt. Sessions issued with a refresh token share its
+// FamilyUUID, the family is what a user sees as one login on a device and
+// carries the IP and user agent it was last used from. Scopes limit what the
+// token may do, nil means every scope of the user. For a JWT the UUID is its
+// jti and the session is Stateless: only its family is stored.
 type Session struct {
-	UUID      string
-	UserUUID  string
-	UserLogin string
-	ExpiresAt time.Time
+	UUID         string
+	UserUUID     string
+	UserLogin    string
+	UserRole     string
+	FamilyUUID   string
+	IdleTTL      time.Duration
+	ExpiresAt    time.Time
+	MaxExpiresAt time.Time
+	CreateAt     time.Time
+	LastSeenAt   time.Time
+	IP           string
+	UserAgent    string
+	Scopes       []string
+	Stateless    bool
+}
+
+func (inst *Session) IsAdmin() bool {
+	return inst.UserRole == RoleAdmin
+}
+
+// Principal returns the caller the session authenticates.
+func (inst *Session) Principal() *Principal {
+	return &Principal{
+		SessionUUID: inst.UUID,
+		UserUUID:    inst.UserUUID,
+		Login:       inst.UserLogin,
+		Role:        inst.UserRole,
+		FamilyUUID:  inst.FamilyUUID,
+		Scopes:      inst.Scopes,
+	}
 }
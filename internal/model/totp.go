@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// TOTP is the second factor of a user. It is pending until the first code is
+// verified. LastStep is the last time step a code was accepted for, codes of
+// that step or earlier are refused.
+type TOTP struct {
+	UserUUID  string
+	Secret    string
+	Enabled   bool
+	LastStep  int64
+	CreateAt  time.Time
+	EnabledAt *time.Time
+}
+
+// TOTPEnrollment is what an authenticator app is set up with.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// LoginChallenge is handed out by a login with a correct password when the
+// user has TOTP enabled, it is exchanged with a code for a session. Stored
+// by the SHA-256 of the token.
+type LoginChallenge struct {
+	Hash      string
+	UserUUID  string
+	Attempts  int
+	ExpiresAt time.Time
+	CreateAt  time.Time
+}
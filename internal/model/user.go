@@ -1,11 +1,79 @@
 package model
 
+import "time"
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// Sources of accounts, the backend that created a user and checks its
+// password. Identity providers only log in to accounts they created.
+const (
+	UserSourceLocal = "local"
+	UserSourceOIDC  = "oidc"
+	UserSourceLDAP  = "ldap"
+)
+
 type User struct {
-	UUID     string `gorm:"type:uuid;primaryKey;default:gen_random_uuid();column:uuid"`
-	Login    string `gom:"type:text;not null;cloumn:login"`
-	Password string `gorm:"type:text;not null;column:password"`
+	UUID       string     `gorm:"type:uuid;primaryKey;default:gen_random_uuid();column:uuid"`
+	Login      string     `gom:"type:text;not null;cloumn:login"`
+	Password   string     `gorm:"type:text;not null;column:password"`
+	Role       string     `gorm:"type:text;not null;column:role"`
+	Source     string     `gorm:"type:varchar(10);not null;column:source"`
+	DisabledAt *time.Time `gorm:"type:timestamptz;column:disabled_at"`
+	CreateAt   time.Time  `gorm:"type:timestamptz;not null;column:create_at"`
+
+	// profile, empty when not set; AvatarUUID is an image document
+	DisplayName string `gorm:"type:varchar(100);column:display_name"`
+	Email       string `gorm:"type:varchar(254);column:email"`
+	Locale      string `gorm:"type:varchar(35);column:locale"`
+	AvatarUUID  string `gorm:"type:uuid;column:avatar_uuid"`
 }
 
 func (inst User) TableName() string {
 	return "users"
 }
+
+// Disabled users can not log in and their sessions and API keys are not
+// accepted.
+func (inst *User) Disabled() bool {
+	return inst.DisabledAt != nil
+}
+
+// ValidRole reports whether role is one users can have.
+func ValidRole(role string) bool {
+	return role == RoleUser || role == RoleAdmin
+}
+
+// ProfilePatch holds the profile fields to change, nil ones are kept and
+// empty ones cleared.
+type ProfilePatch struct {
+	DisplayName *string
+	Email       *string
+	Locale      *string
+	AvatarUUID  *string
+}
+
+// DocumentHandover is what happens to the documents only a disabled or
+// deleted user has a grant on: the grants move to TransferTo or, with
+// Delete, the documents are deleted.
+type DocumentHandover struct {
+	TransferTo string
+	Delete     bool
+}
+
+// Set reports whether a handover was chosen.
+func (inst DocumentHandover) Set() bool {
+	return inst.TransferTo != "" || inst.Delete
+}
+
+// UserFilter narrows the user list, Search matches part of the login and a
+// nil Disabled lists both enabled and disabled users.
+type UserFilter struct {
+	Search   string
+	Role     string
+	Disabled *bool
+	Limit    int
+	Offset   int
+}
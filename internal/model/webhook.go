@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type Webhook struct {
+	UUID      string
+	UserLogin string
+	URL       string
+	Secret    string
+	Events    []string
+	Active    bool
+	CreateAt  time.Time
+}
+
+type WebhookDelivery struct {
+	UUID          string
+	WebhookUUID   string
+	EventUUID     string
+	Event         string
+	Payload       []byte
+	Status        string
+	Attempts      int
+	ResponseCode  *int
+	LastError     *string
+	NextAttemptAt time.Time
+	CreateAt      time.Time
+	DeliveredAt   *time.Time
+	URL           string
+	Secret        string
+}
@@ -3,26 +3,92 @@ package repository
 import (
 	"context"
 	"docs/internal/model"
+	"time"
 )
 
 type SessionRepository interface {
 	GetSessionByUUID(ctx context.Context, uuid string) (*model.Session, error)
 	CreateSession(ctx context.Context, session *model.Session) error
 	DeleteSession(ctx context.Context, uuid string) error
+	CreateSessionWithRefresh(ctx context.Context, session *model.Session, refresh *model.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, hash string, next func(used *model.RefreshToken) (*model.Session, *model.RefreshToken, error)) error
+	RevokeFamily(ctx context.Context, familyUUID string) error
+	RevokeUserFamilies(ctx context.Context, login, keepFamilyUUID string) (int64, error)
+	ListSessionFamilies(ctx context.Context, login string) ([]model.Session, error)
+	GetSessionFamily(ctx context.Context, familyUUID string) (*model.Session, error)
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+	DeleteExpired(ctx context.Context) (int64, int64, error)
 }
 
 type UserRepository interface {
 	GetUserByUUID(ctx context.Context, uuid string) (*model.User, error)
 	GetUserByLogin(ctx context.Context, login string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+	GetUsersByLogins(ctx context.Context, logins []string) ([]model.User, error)
+	ListUsers(ctx context.Context, filter *model.UserFilter) ([]model.User, error)
 	CreateUser(ctx context.Context, user *model.User) error
+	CreateFirstAdmin(ctx context.Context, user *model.User) error
+	UpdatePassword(ctx context.Context, uuid, password string) error
+	UpdateRole(ctx context.Context, uuid, role string, audit *model.AuditEvent) error
+	UpdateProfile(ctx context.Context, user *model.User) error
+	ListSoleDocuments(ctx context.Context, login string) ([]model.Document, error)
+	SetUserDisabled(ctx context.Context, uuid string, disabled bool, handover model.DocumentHandover, announce func([]model.Document) ([]*model.Event, []*model.AuditEvent, error)) ([]model.Document, error)
+	DeleteUser(ctx context.Context, uuid string, handover model.DocumentHandover, announce func([]model.Document) ([]*model.Event, []*model.AuditEvent, error)) ([]model.Document, error)
+}
+
+type LoginFailureRepository interface {
+	GetLoginFailure(ctx context.Context, kind, key string) (*model.LoginFailure, error)
+	ReserveLoginAttempt(ctx context.Context, kind, key string, reserve func(failure *model.LoginFailure) error) (*model.LoginFailure, error)
+	ReleaseLoginAttempt(ctx context.Context, kind, key string, blockedUntil *time.Time) error
+	ResetLoginFailures(ctx context.Context, kind, key string) (bool, error)
+	PurgeLoginFailures(ctx context.Context, before time.Time) (int64, error)
+}
+
+type OIDCRepository interface {
+	CreateOIDCState(ctx context.Context, state *model.OIDCState) error
+	ConsumeOIDCState(ctx context.Context, hash string) (*model.OIDCState, error)
+	GetIdentity(ctx context.Context, issuer, subject string) (*model.Identity, error)
+	HasIdentity(ctx context.Context, userUUID string) (bool, error)
+	CreateIdentity(ctx context.Context, identity *model.Identity) error
+}
+
+type TOTPRepository interface {
+	GetTOTP(ctx context.Context, userUUID string) (*model.TOTP, error)
+	SavePendingTOTP(ctx context.Context, totp *model.TOTP) error
+	EnableTOTP(ctx context.Context, userUUID string, step int64, recoveryHashes []string) error
+	DeleteTOTP(ctx context.Context, userUUID string) error
+	UseTOTPStep(ctx context.Context, userUUID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userUUID, hash string) (bool, error)
+	CreateLoginChallenge(ctx context.Context, challenge *model.LoginChallenge) error
+	AttemptLoginChallenge(ctx context.Context, hash string, maxAttempts int) (*model.LoginChallenge, error)
+	DeleteLoginChallenge(ctx context.Context, hash string) error
+}
+
+type PasswordResetRepository interface {
+	CreatePasswordReset(ctx context.Context, reset *model.PasswordReset) error
+	GetPasswordReset(ctx context.Context, hash string) (*model.PasswordReset, error)
+	ConsumePasswordReset(ctx context.Context, hash, password string) (*model.PasswordReset, error)
+}
+
+type InviteRepository interface {
+	CreateInvite(ctx context.Context, invite *model.Invite) error
+	ListInvites(ctx context.Context) ([]model.Invite, error)
+	RevokeInvite(ctx context.Context, uuid string) error
+	RedeemInvite(ctx context.Context, hash string, user *model.User) (*model.Invite, error)
 }
 
 type DocumentRepository interface {
-	CreateDocsWithGrant(ctx context.Context, document *model.Document) error
+	CreateDocsWithGrant(ctx context.Context, document *model.Document, audit *model.AuditEvent, events ...*model.Event) error
 	GetDocumentWithGrantByUUID(ctx context.Context, uuid string) (*model.Document, error)
 	GetDocumentByUUID(ctx context.Context, uuid string) (*model.Document, error)
 	ListDocuments(ctx context.Context, data *model.DocumentFilterData) ([]model.Document, error)
-	DeleteDocument(ctx context.Context, uuid string) error
+	ListDocumentsByLogin(ctx context.Context, login, after string, limit int) ([]model.Document, error)
+	UpdateDocumentWithGrant(ctx context.Context, document *model.Document, version int, login string, audit *model.AuditEvent, events ...*model.Event) error
+	UpdateDocumentContent(ctx context.Context, document *model.Document, version int, login string, apply func() error, audit *model.AuditEvent, events ...*model.Event) error
+	ListDocumentPaths(ctx context.Context) ([]model.Document, error)
+	UpdateDocumentPath(ctx context.Context, uuid, path string) error
+	DeleteDocument(ctx context.Context, uuid, login string, audit *model.AuditEvent, events ...*model.Event) error
 }
 
 type GrantRepository interface {
@@ -30,3 +96,53 @@ type GrantRepository interface {
 	GetGrantByDocumentUUID(ctx context.Context, uuid string) (*model.Grant, error)
 	GetGrantByLoginAndDocUUID(ctx context.Context, uuid, login string) (*model.Grant, error)
 }
+
+type APIKeyRepository interface {
+	CreateAPIKey(ctx context.Context, key *model.APIKey) error
+	GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	ListAPIKeys(ctx context.Context, userUUID string) ([]model.APIKey, error)
+	TouchAPIKey(ctx context.Context, uuid string) error
+	DeleteAPIKey(ctx context.Context, userUUID, uuid string) error
+}
+
+type LockRepository interface {
+	GetLockByDocumentUUID(ctx context.Context, uuid string) (*model.Lock, error)
+	AcquireLock(ctx context.Context, lock *model.Lock, audit *model.AuditEvent) error
+	DeleteLock(ctx context.Context, uuid, login string, audit *model.AuditEvent) error
+	ForceDeleteLock(ctx context.Context, uuid string, audit *model.AuditEvent) error
+}
+
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook *model.Webhook) error
+	GetWebhookByUUID(ctx context.Context, uuid string) (*model.Webhook, error)
+	ListWebhooks(ctx context.Context, login string) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, uuid string) error
+	CreateDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error
+	QueueEventDeliveries(ctx context.Context, limit int) (int, error)
+	GetDeliveryByUUID(ctx context.Context, uuid string) (*model.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, webhookUUID, status string, limit int) ([]model.WebhookDelivery, error)
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error
+}
+
+type EventRepository interface {
+	ListEvents(ctx context.Context, after model.ChangeCursor, login string, limit int) ([]model.Event, error)
+	ListChanges(ctx context.Context, cursor model.ChangeCursor, login string, limit int) ([]model.Event, error)
+	ChangeHead(ctx context.Context) (model.ChangeCursor, error)
+	PurgeEvents(ctx context.Context, before time.Time) (int64, error)
+	PurgeHorizon(ctx context.Context) (model.ChangeCursor, error)
+	Listen(ctx context.Context, notify func()) error
+}
+
+type AuditRepository interface {
+	AppendAuditEvent(ctx context.Context, event *model.AuditEvent) error
+	ListAuditEvents(ctx context.Context, filter *model.AuditFilter) ([]model.AuditEvent, error)
+}
+
+type CommentRepository interface {
+	CreateComment(ctx context.Context, comment *model.Comment, audit *model.AuditEvent, events ...*model.Event) error
+	GetCommentByUUID(ctx context.Context, uuid string) (*model.Comment, error)
+	ListComments(ctx context.Context, documentUUID string) ([]model.Comment, error)
+	UpdateComment(ctx context.Context, comment *model.Comment, audit *model.AuditEvent, events ...*model.Event) error
+	DeleteComment(ctx context.Context, uuid string, audit *model.AuditEvent, events ...*model.Event) error
+}
@@ -0,0 +1,127 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type APIKey struct {
+	pool *pgxpool.Pool
+}
+
+func NewAPIKey(pool *pgxpool.Pool) *APIKey {
+	return &APIKey{
+		pool: pool,
+	}
+}
+
+func (inst *APIKey) CreateAPIKey(ctx context.Context, key *model.APIKey) error {
+	sql := `INSERT INTO api_keys (uuid, hash, prefix, name, user_uuid, scopes, allowed_ips, expires_at, create_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+
+	_, err := inst.pool.Exec(
+		ctx,
+		sql,
+		key.UUID,
+		key.Hash,
+		key.Prefix,
+		key.Name,
+		key.UserUUID,
+		key.Scopes,
+		key.AllowedIPs,
+		key.ExpiresAt,
+		key.CreateAt,
+	)
+
+	return err
+}
+
+// GetAPIKeyByHash returns a live key with the login and role of its user,
+// expired keys and keys of disabled users are not found.
+func (inst *APIKey) GetAPIKeyByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	key := &model.APIKey{}
+	sql := `SELECT k.uuid, k.hash, k.prefix, k.name, k.user_uuid, u.login, u.role, k.scopes, k.allowed_ips, k.expires_at, k.last_used_at, k.create_at
+	FROM api_keys k JOIN users u ON u.uuid = k.user_uuid
+	WHERE k.hash = $1 AND (k.expires_at IS NULL OR k.expires_at > now()) AND u.disabled_at IS NULL`
+
+	if err := inst.pool.QueryRow(ctx, sql, hash).Scan(
+		&key.UUID,
+		&key.Hash,
+		&key.Prefix,
+		&key.Name,
+		&key.UserUUID,
+		&key.UserLogin,
+		&key.UserRole,
+		&key.Scopes,
+		&key.AllowedIPs,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.CreateAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ListAPIKeys returns the keys of the user, expired ones included, newest
+// first.
+func (inst *APIKey) ListAPIKeys(ctx context.Context, userUUID string) ([]model.APIKey, error) {
+	sql := `SELECT uuid, prefix, name, user_uuid, scopes, allowed_ips, expires_at, last_used_at, create_at
+	FROM api_keys WHERE user_uuid = $1 ORDER BY create_at DESC`
+
+	rows, err := inst.pool.Query(ctx, sql, userUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key := model.APIKey{}
+		if err := rows.Scan(
+			&key.UUID,
+			&key.Prefix,
+			&key.Name,
+			&key.UserUUID,
+			&key.Scopes,
+			&key.AllowedIPs,
+			&key.ExpiresAt,
+			&key.LastUsedAt,
+			&key.CreateAt,
+		); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// TouchAPIKey records that the key was just used.
+func (inst *APIKey) TouchAPIKey(ctx context.Context, uuid string) error {
+	_, err := inst.pool.Exec(ctx, `UPDATE api_keys SET last_used_at = now() WHERE uuid = $1`, uuid)
+	return err
+}
+
+// DeleteAPIKey removes a key of the user, keys of other users are not found.
+func (inst *APIKey) DeleteAPIKey(ctx context.Context, userUUID, uuid string) error {
+	tag, err := inst.pool.Exec(ctx, `DELETE FROM api_keys WHERE uuid = $1 AND user_uuid = $2`, uuid, userUUID)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return utils.ErrorNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// auditChainLock is the advisory lock key serializing appends to the chain.
+const auditChainLock = 0x61756469742d6c6f
+
+const (
+	auditColumns     = `id, uuid, actor, session, ip, user_agent, action, target, document_uuid, outcome, detail, create_at, prev_hash, hash`
+	auditReadColumns = `id, uuid, actor, session, ip, user_agent, action, target, document_uuid, outcome, detail, create_at, '', ''`
+)
+
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type Audit struct {
+	pool *pgxpool.Pool
+}
+
+func NewAudit(pool *pgxpool.Pool) *Audit {
+	return &Audit{
+		pool: pool,
+	}
+}
+
+// AppendAuditEvent stores the event on its own. Reads go to audit_reads
+// without taking the chain lock, everything else is sealed onto the chain.
+func (inst *Audit) AppendAuditEvent(ctx context.Context, event *model.AuditEvent) error {
+	if event.Read() {
+		return insertAuditRead(ctx, inst.pool, event)
+	}
+
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := appendAuditEvents(ctx, tx, event); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// appendAuditEvents seals the events onto the chain in tx, so they commit or
+// roll back with the change they record. The advisory lock serializes the
+// appends of all instances until tx ends, call it last in the transaction.
+// Nil events are skipped.
+func appendAuditEvents(ctx context.Context, tx pgx.Tx, events ...*model.AuditEvent) error {
+	locked := false
+	for _, event := range events {
+		if event == nil {
+			continue
+		}
+
+		if event.Read() {
+			if err := insertAuditRead(ctx, tx, event); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !locked {
+			if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, int64(auditChainLock)); err != nil {
+				return err
+			}
+			locked = true
+		}
+
+		var prevHash string
+		if err := tx.QueryRow(ctx, `SELECT hash FROM audit_events ORDER BY id DESC LIMIT 1`).Scan(&prevHash); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+
+		event.Seal(prevHash)
+
+		sql := `INSERT INTO audit_events
+		(uuid, actor, session, ip, user_agent, action, target, document_uuid, outcome, detail, create_at, prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		RETURNING id`
+
+		if err := tx.QueryRow(
+			ctx,
+			sql,
+			event.UUID,
+			event.Actor,
+			event.Session,
+			event.IP,
+			event.UserAgent,
+			event.Action,
+			event.Target,
+			event.DocumentUUID,
+			event.Outcome,
+			event.Detail,
+			event.CreateAt,
+			event.PrevHash,
+			event.Hash,
+		).Scan(&event.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// insertAuditRead stores a read in audit_reads, outside of the chain.
+func insertAuditRead(ctx context.Context, db rowQuerier, event *model.AuditEvent) error {
+	sql := `INSERT INTO audit_reads
+	(uuid, actor, session, ip, user_agent, action, target, document_uuid, outcome, detail, create_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	RETURNING id`
+
+	return db.QueryRow(
+		ctx,
+		sql,
+		event.UUID,
+		event.Actor,
+		event.Session,
+		event.IP,
+		event.UserAgent,
+		event.Action,
+		event.Target,
+		event.DocumentUUID,
+		event.Outcome,
+		event.Detail,
+		event.CreateAt,
+	).Scan(&event.ID)
+}
+
+// ListAuditEvents returns the events matching the filter in log order,
+// starting after filter.After: reads from audit_reads with filter.Reads,
+// the chain otherwise.
+func (inst *Audit) ListAuditEvents(ctx context.Context, filter *model.AuditFilter) ([]model.AuditEvent, error) {
+	conditions := []string{"id > $1"}
+	values := []any{filter.After}
+
+	add := func(condition string, value any) {
+		values = append(values, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(values)))
+	}
+
+	if filter.Actor != "" {
+		add("actor = $%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.DocumentUUID != "" {
+		add("document_uuid = $%d", filter.DocumentUUID)
+	}
+	if filter.Outcome != "" {
+		add("outcome = $%d", filter.Outcome)
+	}
+	if filter.From != nil {
+		add("create_at >= $%d", *filter.From)
+	}
+	if filter.To != nil {
+		add("create_at < $%d", *filter.To)
+	}
+
+	columns, table := auditColumns, "audit_events"
+	if filter.Reads {
+		columns, table = auditReadColumns, "audit_reads"
+	}
+
+	values = append(values, filter.Limit)
+	sql := fmt.Sprintf(
+		`SELECT %s FROM %s WHERE %s ORDER BY id LIMIT $%d`,
+		columns,
+		table,
+		strings.Join(conditions, " AND "),
+		len(values),
+	)
+
+	rows, err := inst.pool.Query(ctx, sql, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]model.AuditEvent, 0)
+	for rows.Next() {
+		event := model.AuditEvent{}
+		if err := rows.Scan(
+			&event.ID,
+			&event.UUID,
+			&event.Actor,
+			&event.Session,
+			&event.IP,
+			&event.UserAgent,
+			&event.Action,
+			&event.Target,
+			&event.DocumentUUID,
+			&event.Outcome,
+			&event.Detail,
+			&event.CreateAt,
+			&event.PrevHash,
+			&event.Hash,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
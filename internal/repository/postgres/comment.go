@@ -0,0 +1,187 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const commentColumns = `uuid, document_uuid, parent_uuid, user_login, body, anchor, resolved, resolved_by, resolved_at, create_at, update_at`
+
+type Comment struct {
+	pool *pgxpool.Pool
+}
+
+func NewComment(pool *pgxpool.Pool) *Comment {
+	return &Comment{
+		pool: pool,
+	}
+}
+
+// CreateComment stores the comment and logs the audit event and the events
+// in one transaction.
+func (inst *Comment) CreateComment(ctx context.Context, comment *model.Comment, audit *model.AuditEvent, events ...*model.Event) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `INSERT INTO comments (` + commentColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+
+	if _, err := tx.Exec(
+		ctx,
+		sql,
+		comment.UUID,
+		comment.DocumentUUID,
+		comment.ParentUUID,
+		comment.UserLogin,
+		comment.Body,
+		comment.Anchor,
+		comment.Resolved,
+		comment.ResolvedBy,
+		comment.ResolvedAt,
+		comment.CreateAt,
+		comment.UpdateAt,
+	); err != nil {
+		return err
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return err
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (inst *Comment) GetCommentByUUID(ctx context.Context, uuid string) (*model.Comment, error) {
+	sql := `SELECT ` + commentColumns + ` FROM comments WHERE uuid = $1`
+
+	comment, err := inst.scanComment(inst.pool.QueryRow(ctx, sql, uuid))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// ListComments returns every comment of the document, oldest first.
+func (inst *Comment) ListComments(ctx context.Context, documentUUID string) ([]model.Comment, error) {
+	sql := `SELECT ` + commentColumns + ` FROM comments WHERE document_uuid = $1 ORDER BY create_at, uuid`
+
+	rows, err := inst.pool.Query(ctx, sql, documentUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := make([]model.Comment, 0)
+	for rows.Next() {
+		comment, err := inst.scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, *comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// UpdateComment stores the comment and logs the audit event and the events
+// in one transaction.
+func (inst *Comment) UpdateComment(ctx context.Context, comment *model.Comment, audit *model.AuditEvent, events ...*model.Event) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `UPDATE comments
+	SET body = $1, anchor = $2, resolved = $3, resolved_by = $4, resolved_at = $5, update_at = $6
+	WHERE uuid = $7`
+
+	tag, err := tx.Exec(
+		ctx,
+		sql,
+		comment.Body,
+		comment.Anchor,
+		comment.Resolved,
+		comment.ResolvedBy,
+		comment.ResolvedAt,
+		comment.UpdateAt,
+		comment.UUID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return utils.ErrorNotFound
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return err
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteComment removes the comment with its replies and logs the audit
+// event and the events in one transaction.
+func (inst *Comment) DeleteComment(ctx context.Context, uuid string, audit *model.AuditEvent, events ...*model.Event) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM comments WHERE uuid = $1`, uuid); err != nil {
+		return err
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return err
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (inst *Comment) scanComment(row pgx.Row) (*model.Comment, error) {
+	comment := &model.Comment{}
+	if err := row.Scan(
+		&comment.UUID,
+		&comment.DocumentUUID,
+		&comment.ParentUUID,
+		&comment.UserLogin,
+		&comment.Body,
+		&comment.Anchor,
+		&comment.Resolved,
+		&comment.ResolvedBy,
+		&comment.ResolvedAt,
+		&comment.CreateAt,
+		&comment.UpdateAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
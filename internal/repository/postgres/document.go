@@ -24,7 +24,9 @@ func NewDocument(log *zap.Logger, pool *pgxpool.Pool) *Document {
 	return &Document{log, pool}
 }
 
-func (inst *Document) CreateDocsWithGrant(ctx context.Context, document *model.Document) error {
+// CreateDocsWithGrant stores the document with its grant, the audit event
+// and the events announcing it in one transaction.
+func (inst *Document) CreateDocsWithGrant(ctx context.Context, document *model.Document, audit *model.AuditEvent, events ...*model.Event) error {
 	tx, err := inst.pool.Begin(ctx)
 	if err != nil {
 		return err
@@ -40,6 +42,16 @@ func (inst *Document) CreateDocsWithGrant(ctx context.Context, document *model.D
 		return err
 	}
 
+	if err := insertEvents(ctx, tx, events); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
 	return tx.Commit(ctx)
 }
 
@@ -62,10 +74,14 @@ func (inst *Document) GetDocumentWithGrantByUUID(ctx context.Context, uuid strin
 			public    bool
 			createAt  time.Time
 			path      string
+			version   int
+			jsonData  map[string]any
+			size      int64
+			hash      string
 			userLogin *string
 		)
 
-		if err := rows.Scan(&uuid, &name, &mime, &file, &public, &createAt, &path, &userLogin); err != nil {
+		if err := rows.Scan(&uuid, &name, &mime, &file, &public, &createAt, &path, &version, &jsonData, &size, &hash, &userLogin); err != nil {
 			return nil, fmt.Errorf("scan failed: %w", err)
 		}
 
@@ -78,6 +94,10 @@ func (inst *Document) GetDocumentWithGrantByUUID(ctx context.Context, uuid strin
 				Public:   public,
 				CreateAt: createAt,
 				Path:     path,
+				Version:  version,
+				JSON:     jsonData,
+				Size:     size,
+				Hash:     hash,
 			}
 		}
 
@@ -122,6 +142,10 @@ func (inst *Document) ListDocuments(ctx context.Context, data *model.DocumentFil
 			&document.Public,
 			&document.CreateAt,
 			&document.Path,
+			&document.Version,
+			&document.JSON,
+			&document.Size,
+			&document.Hash,
 			&document.Grant,
 		); err != nil {
 			return nil, err
@@ -133,14 +157,249 @@ func (inst *Document) ListDocuments(ctx context.Context, data *model.DocumentFil
 	return documents, nil
 }
 
-func (inst *Document) DeleteDocument(ctx context.Context, uuid string) error {
-	if _, err := inst.pool.Exec(ctx, `DELETE FROM documents WHERE uuid = $1`, uuid); err != nil {
+// ListDocumentsByLogin returns up to limit documents granted to login after
+// the after document, in uuid order, with their full grant lists. An empty
+// after starts from the first document.
+func (inst *Document) ListDocumentsByLogin(ctx context.Context, login, after string, limit int) ([]model.Document, error) {
+	sql := `SELECT
+		documents.uuid,
+		documents.name,
+		documents.mime,
+		documents.file,
+		documents.public,
+		documents.create_at,
+		documents.path,
+		documents.version,
+		documents.json,
+		documents.size,
+		documents.hash,
+		array_remove(array_agg(document_grants.user_login), NULL)
+	FROM documents
+	LEFT JOIN document_grants ON documents.uuid = document_uuid
+	WHERE documents.uuid IN (SELECT document_uuid FROM document_grants WHERE user_login = $1)
+		AND ($2 = '' OR documents.uuid > NULLIF($2, '')::uuid)
+	GROUP BY documents.uuid
+	ORDER BY documents.uuid
+	LIMIT $3;`
+
+	rows, err := inst.pool.Query(ctx, sql, login, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := make([]model.Document, 0)
+	for rows.Next() {
+		document := model.Document{}
+		if err := rows.Scan(
+			&document.UUID,
+			&document.Name,
+			&document.Mime,
+			&document.File,
+			&document.Public,
+			&document.CreateAt,
+			&document.Path,
+			&document.Version,
+			&document.JSON,
+			&document.Size,
+			&document.Hash,
+			&document.Grant,
+		); err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, rows.Err()
+}
+
+// UpdateDocumentWithGrant stores the document when it is still at version
+// and not locked by another login than login, together with the audit event
+// and the events announcing the change.
+func (inst *Document) UpdateDocumentWithGrant(ctx context.Context, document *model.Document, version int, login string, audit *model.AuditEvent, events ...*model.Event) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkDocumentLock(ctx, tx, document.UUID, login); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE documents
+		SET name = $1, mime = $2, public = $3, json = $4, version = version + 1
+		WHERE uuid = $5 AND version = $6;`,
+		document.Name,
+		document.Mime,
+		document.Public,
+		document.JSON,
+		document.UUID,
+		version,
+	)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		tx.Rollback(ctx)
+		return utils.ErrorVersionMismatch
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM document_grants WHERE document_uuid = $1`, document.UUID); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := inst.insertGrant(tx, ctx, document.UUID, document.Grant); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	document.Version = version + 1
+
+	return nil
+}
+
+// UpdateDocumentContent stores the new content metadata, the audit event and
+// the events when the document is still at version and not locked by another
+// login than login. apply is called inside the transaction, after the row is
+// updated and before commit, so the file on disk and the row change together.
+func (inst *Document) UpdateDocumentContent(ctx context.Context, document *model.Document, version int, login string, apply func() error, audit *model.AuditEvent, events ...*model.Event) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkDocumentLock(ctx, tx, document.UUID, login); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE documents
+		SET mime = $1, file = $2, size = $3, hash = $4, path = $5, version = version + 1
+		WHERE uuid = $6 AND version = $7;`,
+		document.Mime,
+		document.File,
+		document.Size,
+		document.Hash,
+		document.Path,
+		document.UUID,
+		version,
+	)
+	if err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		tx.Rollback(ctx)
+		return utils.ErrorVersionMismatch
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := apply(); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	document.Version = version + 1
+
+	return nil
+}
+
+// ListDocumentPaths returns the uuid, file flag and path of every document.
+func (inst *Document) ListDocumentPaths(ctx context.Context) ([]model.Document, error) {
+	rows, err := inst.pool.Query(ctx, `SELECT uuid, file, COALESCE(path, '') FROM documents`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := make([]model.Document, 0)
+	for rows.Next() {
+		document := model.Document{}
+		if err := rows.Scan(&document.UUID, &document.File, &document.Path); err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, rows.Err()
+}
+
+func (inst *Document) UpdateDocumentPath(ctx context.Context, uuid, path string) error {
+	if _, err := inst.pool.Exec(ctx, `UPDATE documents SET path = $2 WHERE uuid = $1`, uuid, path); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// DeleteDocument removes the document and logs the audit event and the
+// events in one transaction, unless another login than login holds a lock on
+// it.
+func (inst *Document) DeleteDocument(ctx context.Context, uuid, login string, audit *model.AuditEvent, events ...*model.Event) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := checkDocumentLock(ctx, tx, uuid, login); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM documents WHERE uuid = $1`, uuid); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
 func (inst *Document) selectDocument(ctx context.Context, uuid string) (*model.Document, error) {
 	sql := `SELECT 
 		documents.uuid,
@@ -149,7 +408,11 @@ func (inst *Document) selectDocument(ctx context.Context, uuid string) (*model.D
 		documents.file,
 		documents.public,
 		documents.create_at,
-		documents.path
+		documents.path,
+		documents.version,
+		documents.json,
+		documents.size,
+		documents.hash
 	FROM documents WHERE uuid = $1;
 	`
 	document := &model.Document{}
@@ -164,6 +427,10 @@ func (inst *Document) selectDocument(ctx context.Context, uuid string) (*model.D
 		&document.Public,
 		&document.CreateAt,
 		&document.Path,
+		&document.Version,
+		&document.JSON,
+		&document.Size,
+		&document.Hash,
 	); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, utils.ErrorNotFound
@@ -180,8 +447,8 @@ func (inst *Document) insertDocument(tx pgx.Tx, ctx context.Context, document *m
 	if _, err := tx.Exec(
 		ctx,
 		`INSERT INTO documents
-		(uuid, name, mime, file, public, create_at, path)
-		VALUES ($1, $2, $3, $4, $5, $6, $7);`,
+		(uuid, name, mime, file, public, create_at, path, version, json, size, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11);`,
 		document.UUID,
 		document.Name,
 		document.Mime,
@@ -189,6 +456,10 @@ func (inst *Document) insertDocument(tx pgx.Tx, ctx context.Context, document *m
 		document.Public,
 		document.CreateAt,
 		document.Path,
+		document.Version,
+		document.JSON,
+		document.Size,
+		document.Hash,
 	); err != nil {
 		return err
 	}
@@ -198,6 +469,10 @@ func (inst *Document) insertDocument(tx pgx.Tx, ctx context.Context, document *m
 func (inst *Document) insertGrant(tx pgx.Tx, ctx context.Context, documentUUID string, grant []string) error {
 	const errorForiengKeyCode = "23503"
 
+	if len(grant) == 0 {
+		return nil
+	}
+
 	sql, values := inst.buildInsertGrantQuery(documentUUID, grant)
 
 	inst.log.Debug("insert sql", zap.String("sql", sql))
@@ -278,7 +553,20 @@ func (inst *Document) listFilters(sql string, data *model.DocumentFilterData) (s
 		numFilter++
 	}
 
-	if numFilter == 1 {
+	if data.NamePrefix != "" {
+		filterPlaceholders = append(
+			filterPlaceholders,
+			fmt.Sprintf(`(documents.name LIKE $%d || '%%')`, numFilter),
+		)
+		filterValues = append(filterValues, escapeLike(data.NamePrefix))
+		numFilter++
+	}
+
+	if data.FileOnly {
+		filterPlaceholders = append(filterPlaceholders, "(documents.file)")
+	}
+
+	if len(filterPlaceholders) == 0 {
 		sql = fmt.Sprintf(sql, "", fmt.Sprintf("LIMIT %d", data.Limit))
 	} else {
 		sql = fmt.Sprintf(
@@ -300,6 +588,10 @@ func (inst *Document) selectWithLimitQuery() string {
 		documents.public,
 		documents.create_at,
 		documents.path,
+		documents.version,
+		documents.json,
+		documents.size,
+		documents.hash,
 		array_remove(array_agg(document_grants.user_login), NULL)
 	FROM documents
 	LEFT JOIN document_grants ON documents.uuid = document_uuid 
@@ -311,7 +603,8 @@ func (inst *Document) selectWithLimitQuery() string {
 		documents.file,
 		documents.public,
 		documents.create_at,
-		documents.path
+		documents.path,
+		documents.version
 	%s;`
 }
 
@@ -325,6 +618,10 @@ func (inst *Document) selectWithGrantQuery() string {
 		documents.public,
 		documents.create_at,
 		documents.path,
+		documents.version,
+		documents.json,
+		documents.size,
+		documents.hash,
 		document_grants.user_login
 	from documents
 	LEFT JOIN document_grants ON documents.uuid = document_uuid
@@ -0,0 +1,216 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// EventChannel is the notification channel the events trigger signals on.
+const EventChannel = "docs_events"
+
+type Event struct {
+	pool *pgxpool.Pool
+}
+
+func NewEvent(pool *pgxpool.Pool) *Event {
+	return &Event{
+		pool: pool,
+	}
+}
+
+// insertEvents appends the events to the log in tx and sets their IDs, so
+// they commit or roll back with the change they announce. Listeners are
+// signalled by the trigger once tx commits.
+func insertEvents(ctx context.Context, tx pgx.Tx, events []*model.Event) error {
+	sql := `INSERT INTO events (uuid, type, actor, document_uuid, visibility, payload, create_at)
+	VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+	RETURNING id`
+
+	for _, event := range events {
+		var documentUUID *string
+		if event.Document != nil {
+			documentUUID = &event.Document.UUID
+		}
+
+		grant := event.Grant
+		if grant == nil {
+			grant = []string{}
+		}
+
+		if err := tx.QueryRow(
+			ctx,
+			sql,
+			event.UUID,
+			event.Type,
+			event.Actor,
+			documentUUID,
+			grant,
+			event.Payload,
+			event.CreateAt,
+		).Scan(&event.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListEvents returns up to limit events after the cursor in (txid, id)
+// order, held back like in ListChanges. With a login only the events visible
+// to it are returned.
+func (inst *Event) ListEvents(ctx context.Context, after model.ChangeCursor, login string, limit int) ([]model.Event, error) {
+	sql := `SELECT id, txid::text::bigint, uuid, type, COALESCE(actor, ''), visibility, payload, create_at FROM events
+	WHERE (txid, id) > ($1::text::xid8, $2)
+		AND txid < pg_snapshot_xmin(pg_current_snapshot())
+		AND ($3 = '' OR $3 = ANY(visibility))
+	ORDER BY txid, id
+	LIMIT $4`
+
+	rows, err := inst.pool.Query(ctx, sql, strconv.FormatUint(after.TxID, 10), after.ID, login, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]model.Event, 0)
+	for rows.Next() {
+		event := model.Event{}
+		if err := rows.Scan(
+			&event.ID,
+			&event.TxID,
+			&event.UUID,
+			&event.Type,
+			&event.Actor,
+			&event.Grant,
+			&event.Payload,
+			&event.CreateAt,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// ListChanges returns up to limit document events visible to login after
+// the cursor, in (txid, id) order. Events of transactions that may still be
+// running are held back, so a later page never misses an earlier committed
+// event.
+func (inst *Event) ListChanges(ctx context.Context, cursor model.ChangeCursor, login string, limit int) ([]model.Event, error) {
+	sql := `SELECT id, txid::text::bigint, uuid, type, COALESCE(actor, ''), visibility, payload, create_at FROM events
+	WHERE (txid, id) > ($1::text::xid8, $2)
+		AND txid < pg_snapshot_xmin(pg_current_snapshot())
+		AND $3 = ANY(visibility)
+		AND type LIKE 'document.%'
+	ORDER BY txid, id
+	LIMIT $4`
+
+	rows, err := inst.pool.Query(ctx, sql, strconv.FormatUint(cursor.TxID, 10), cursor.ID, login, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]model.Event, 0)
+	for rows.Next() {
+		event := model.Event{}
+		if err := rows.Scan(
+			&event.ID,
+			&event.TxID,
+			&event.UUID,
+			&event.Type,
+			&event.Actor,
+			&event.Grant,
+			&event.Payload,
+			&event.CreateAt,
+		); err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
+
+// ChangeHead returns the cursor before every change not yet committed.
+func (inst *Event) ChangeHead(ctx context.Context) (model.ChangeCursor, error) {
+	var cursor model.ChangeCursor
+	sql := `SELECT pg_snapshot_xmin(pg_current_snapshot())::text::bigint`
+
+	if err := inst.pool.QueryRow(ctx, sql).Scan(&cursor.TxID); err != nil {
+		return cursor, err
+	}
+
+	return cursor, nil
+}
+
+// Listen holds a connection subscribed to EventChannel and calls notify once
+// the subscription is set up and then on every notification. It returns when
+// ctx is done or the connection fails.
+func (inst *Event) Listen(ctx context.Context, notify func()) error {
+	conn, err := inst.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{EventChannel}.Sanitize()); err != nil {
+		return err
+	}
+
+	notify()
+
+	for {
+		if _, err := conn.Conn().WaitForNotification(ctx); err != nil {
+			// the connection may be mid-wait, never hand it back to the pool
+			conn.Conn().Close(context.Background())
+			return err
+		}
+
+		notify()
+	}
+}
+
+// PurgeEvents deletes the events created before before that the webhook
+// relay has passed, and moves the purge horizon to the last one deleted.
+func (inst *Event) PurgeEvents(ctx context.Context, before time.Time) (int64, error) {
+	var count int64
+	sql := `WITH purged AS (
+		DELETE FROM events USING event_relays
+		WHERE event_relays.name = $2
+			AND events.create_at < $1
+			AND (events.txid, events.id) <= (event_relays.txid, event_relays.id)
+		RETURNING events.txid, events.id
+	), last AS (
+		SELECT txid, id FROM purged ORDER BY txid DESC, id DESC LIMIT 1
+	), horizon AS (
+		UPDATE event_purges SET txid = last.txid, event_id = last.id
+		FROM last
+		WHERE (event_purges.txid, event_purges.event_id) < (last.txid, last.id)
+	)
+	SELECT count(*) FROM purged`
+
+	if err := inst.pool.QueryRow(ctx, sql, before, webhookRelay).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// PurgeHorizon returns the cursor of the last purged event.
+func (inst *Event) PurgeHorizon(ctx context.Context) (model.ChangeCursor, error) {
+	var cursor model.ChangeCursor
+	sql := `SELECT txid::text::bigint, event_id FROM event_purges`
+
+	if err := inst.pool.QueryRow(ctx, sql).Scan(&cursor.TxID, &cursor.ID); err != nil {
+		return cursor, err
+	}
+
+	return cursor, nil
+}
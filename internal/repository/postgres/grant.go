@@ -52,6 +52,8 @@ func (inst *Grant) GetGrantByDocumentUUID(ctx context.Context, uuid string) (*mo
 	return grant, nil
 }
 
+// GetGrantByLoginAndDocUUID returns the grant of login on the document, the
+// document uuid comes first despite the name.
 func (inst *Grant) GetGrantByLoginAndDocUUID(ctx context.Context, uuid, login string) (*model.Grant, error) {
 	grant := &model.Grant{}
 	sql := `SELECT document_uuid, user_login FROM document_grants WHERE document_uuid = $1 AND user_login = $2`
@@ -0,0 +1,175 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const inviteColumns = `uuid, hash, COALESCE(login, ''), role, max_uses, uses, create_by, expires_at, revoked_at, create_at`
+
+type Invite struct {
+	pool *pgxpool.Pool
+}
+
+func NewInvite(pool *pgxpool.Pool) *Invite {
+	return &Invite{
+		pool: pool,
+	}
+}
+
+func (inst *Invite) CreateInvite(ctx context.Context, invite *model.Invite) error {
+	sql := `INSERT INTO invites (uuid, hash, login, role, max_uses, create_by, expires_at, create_at)
+	VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8)`
+
+	if _, err := inst.pool.Exec(
+		ctx,
+		sql,
+		invite.UUID,
+		invite.Hash,
+		invite.Login,
+		invite.Role,
+		invite.MaxUses,
+		invite.CreateBy,
+		invite.ExpiresAt,
+		invite.CreateAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ListInvites returns every invite, newest first, with the users that
+// redeemed it.
+func (inst *Invite) ListInvites(ctx context.Context) ([]model.Invite, error) {
+	rows, err := inst.pool.Query(ctx, `SELECT `+inviteColumns+` FROM invites ORDER BY create_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invites := make([]model.Invite, 0)
+	index := map[string]int{}
+	for rows.Next() {
+		invite, err := inst.scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[invite.UUID] = len(invites)
+		invites = append(invites, *invite)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sql := `SELECT invite_uuid, user_uuid, user_login, create_at FROM invite_redemptions ORDER BY create_at`
+	rows, err = inst.pool.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var inviteUUID string
+		redemption := model.InviteRedemption{}
+		if err := rows.Scan(&inviteUUID, &redemption.UserUUID, &redemption.UserLogin, &redemption.CreateAt); err != nil {
+			return nil, err
+		}
+
+		if i, ok := index[inviteUUID]; ok {
+			invites[i].Redemptions = append(invites[i].Redemptions, redemption)
+		}
+	}
+
+	return invites, rows.Err()
+}
+
+// RevokeInvite stops the invite from being redeemed, it stays listed.
+func (inst *Invite) RevokeInvite(ctx context.Context, uuid string) error {
+	sql := `UPDATE invites SET revoked_at = COALESCE(revoked_at, now()) WHERE uuid = $1`
+
+	tag, err := inst.pool.Exec(ctx, sql, uuid)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return utils.ErrorNotFound
+	}
+
+	return nil
+}
+
+// RedeemInvite uses up one use of a live invite and creates the user with
+// its role in the same transaction. Revoked, expired, used up and unknown
+// invites, and invites bound to another login, are not found.
+func (inst *Invite) RedeemInvite(ctx context.Context, hash string, user *model.User) (*model.Invite, error) {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `UPDATE invites SET uses = uses + 1
+	WHERE hash = $1 AND revoked_at IS NULL AND expires_at > now() AND uses < max_uses
+		AND (login IS NULL OR login = $2)
+	RETURNING ` + inviteColumns
+
+	invite, err := inst.scanInvite(tx.QueryRow(ctx, sql, hash, user.Login))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	user.Role = invite.Role
+	sql = `INSERT INTO users (uuid, login, password, role) VALUES ($1, $2, $3, $4) RETURNING create_at`
+	if err := tx.QueryRow(ctx, sql, user.UUID, user.Login, user.Password, user.Role).Scan(&user.CreateAt); err != nil {
+		const errorDublocateKeyCode = "23505"
+		if pgerr, ok := err.(*pgconn.PgError); ok && pgerr.Code == errorDublocateKeyCode {
+			return nil, utils.ErrorLoginAlradyExists
+		}
+		return nil, err
+	}
+
+	sql = `INSERT INTO invite_redemptions (invite_uuid, user_uuid, user_login, create_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(ctx, sql, invite.UUID, user.UUID, user.Login, user.CreateAt); err != nil {
+		return nil, err
+	}
+
+	invite.Redemptions = []model.InviteRedemption{{
+		UserUUID:  user.UUID,
+		UserLogin: user.Login,
+		CreateAt:  user.CreateAt,
+	}}
+
+	return invite, tx.Commit(ctx)
+}
+
+func (inst *Invite) scanInvite(row pgx.Row) (*model.Invite, error) {
+	invite := &model.Invite{}
+	if err := row.Scan(
+		&invite.UUID,
+		&invite.Hash,
+		&invite.Login,
+		&invite.Role,
+		&invite.MaxUses,
+		&invite.Uses,
+		&invite.CreateBy,
+		&invite.ExpiresAt,
+		&invite.RevokedAt,
+		&invite.CreateAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return invite, nil
+}
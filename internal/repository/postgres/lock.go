@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type Lock struct {
+	pool *pgxpool.Pool
+}
+
+func NewLock(pool *pgxpool.Pool) *Lock {
+	return &Lock{
+		pool: pool,
+	}
+}
+
+func (inst *Lock) GetLockByDocumentUUID(ctx context.Context, uuid string) (*model.Lock, error) {
+	lock := &model.Lock{}
+	sql := `SELECT document_uuid, user_login, expires_at, create_at FROM document_locks WHERE document_uuid = $1 AND expires_at > now()`
+
+	if err := inst.pool.QueryRow(ctx, sql, uuid).Scan(
+		&lock.DocumentUUID,
+		&lock.UserLogin,
+		&lock.ExpiresAt,
+		&lock.CreateAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// AcquireLock takes the lock or extends it when the same login already holds
+// it, and appends the audit event with it. A live lock of another login is
+// left as is and ErrorLocked is returned. The document row is share locked
+// first, so a lock is never taken while a write checked under
+// checkDocumentLock is still uncommitted.
+func (inst *Lock) AcquireLock(ctx context.Context, lock *model.Lock, audit *model.AuditEvent) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := tx.QueryRow(ctx, `SELECT uuid FROM documents WHERE uuid = $1 FOR SHARE`, lock.DocumentUUID).Scan(new(string)); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return utils.ErrorNotFound
+		}
+		return err
+	}
+
+	sql := `INSERT INTO document_locks (document_uuid, user_login, expires_at, create_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (document_uuid) DO UPDATE
+	SET user_login = EXCLUDED.user_login,
+		expires_at = EXCLUDED.expires_at,
+		create_at = CASE
+			WHEN document_locks.user_login = EXCLUDED.user_login THEN document_locks.create_at
+			ELSE EXCLUDED.create_at
+		END
+	WHERE document_locks.user_login = EXCLUDED.user_login OR document_locks.expires_at <= now()
+	RETURNING create_at`
+
+	if err := tx.QueryRow(ctx, sql, lock.DocumentUUID, lock.UserLogin, lock.ExpiresAt, lock.CreateAt).Scan(
+		&lock.CreateAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return utils.ErrorLocked
+		}
+		return err
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteLock releases the lock of login on the document with the audit
+// event. A lock that expired and was taken by someone else meanwhile is left
+// alone and ErrorNotFound is returned.
+func (inst *Lock) DeleteLock(ctx context.Context, uuid, login string, audit *model.AuditEvent) error {
+	return inst.deleteLock(ctx, `DELETE FROM document_locks WHERE document_uuid = $1 AND user_login = $2`, audit, uuid, login)
+}
+
+// ForceDeleteLock releases the lock on the document whoever holds it, for
+// admins forcing a document open.
+func (inst *Lock) ForceDeleteLock(ctx context.Context, uuid string, audit *model.AuditEvent) error {
+	return inst.deleteLock(ctx, `DELETE FROM document_locks WHERE document_uuid = $1`, audit, uuid)
+}
+
+func (inst *Lock) deleteLock(ctx context.Context, sql string, audit *model.AuditEvent, args ...any) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return utils.ErrorNotFound
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// checkDocumentLock locks the document row for a write by login and fails
+// with ErrorLocked while another login holds a live lock on it. It runs in
+// the transaction of the write, AcquireLock waits for the row, so the lock
+// can't be taken between the check and the commit. A missing document is
+// left to the write.
+func checkDocumentLock(ctx context.Context, tx pgx.Tx, uuid, login string) error {
+	if _, err := tx.Exec(ctx, `SELECT uuid FROM documents WHERE uuid = $1 FOR UPDATE`, uuid); err != nil {
+		return err
+	}
+
+	var (
+		holder    string
+		expiresAt time.Time
+	)
+	sql := `SELECT user_login, expires_at FROM document_locks WHERE document_uuid = $1 AND user_login <> $2 AND expires_at > now()`
+
+	if err := tx.QueryRow(ctx, sql, uuid, login).Scan(&holder, &expiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	return fmt.Errorf("%w by %s until %s", utils.ErrorLocked, holder, expiresAt.Format(time.RFC3339))
+}
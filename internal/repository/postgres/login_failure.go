@@ -0,0 +1,123 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type LoginFailure struct {
+	pool *pgxpool.Pool
+}
+
+func NewLoginFailure(pool *pgxpool.Pool) *LoginFailure {
+	return &LoginFailure{
+		pool: pool,
+	}
+}
+
+func (inst *LoginFailure) GetLoginFailure(ctx context.Context, kind, key string) (*model.LoginFailure, error) {
+	failure := &model.LoginFailure{}
+	sql := `SELECT kind, key, failures, last_failure_at, blocked_until, locked FROM login_failures WHERE kind = $1 AND key = $2`
+
+	if err := inst.pool.QueryRow(ctx, sql, kind, key).Scan(
+		&failure.Kind,
+		&failure.Key,
+		&failure.Failures,
+		&failure.LastFailureAt,
+		&failure.BlockedUntil,
+		&failure.Locked,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return failure, nil
+}
+
+// ReserveLoginAttempt counts a login attempt before its password is
+// checked. The row of the key stays locked while reserve judges it, so
+// parallel attempts see each other: reserve refuses the attempt with an
+// error, or sets the count and block it is stored with.
+func (inst *LoginFailure) ReserveLoginAttempt(ctx context.Context, kind, key string, reserve func(failure *model.LoginFailure) error) (*model.LoginFailure, error) {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `INSERT INTO login_failures (kind, key, failures, last_failure_at) VALUES ($1, $2, 0, now()) ON CONFLICT (kind, key) DO NOTHING`
+	if _, err := tx.Exec(ctx, sql, kind, key); err != nil {
+		return nil, err
+	}
+
+	failure := &model.LoginFailure{}
+	sql = `SELECT kind, key, failures, last_failure_at, blocked_until, locked FROM login_failures WHERE kind = $1 AND key = $2 FOR UPDATE`
+
+	if err := tx.QueryRow(ctx, sql, kind, key).Scan(
+		&failure.Kind,
+		&failure.Key,
+		&failure.Failures,
+		&failure.LastFailureAt,
+		&failure.BlockedUntil,
+		&failure.Locked,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := reserve(failure); err != nil {
+		return nil, err
+	}
+
+	sql = `UPDATE login_failures SET failures = $3, last_failure_at = $4, blocked_until = $5, locked = $6 WHERE kind = $1 AND key = $2`
+	if _, err := tx.Exec(ctx, sql, kind, key, failure.Failures, failure.LastFailureAt, failure.BlockedUntil, failure.Locked); err != nil {
+		return nil, err
+	}
+
+	return failure, tx.Commit(ctx)
+}
+
+// ReleaseLoginAttempt takes back a reserved attempt that didn't fail on
+// the password. blockedUntil is the block the attempt set, if any; it is
+// lifted only while it is still the block of the key, one set by a later
+// attempt stays.
+func (inst *LoginFailure) ReleaseLoginAttempt(ctx context.Context, kind, key string, blockedUntil *time.Time) error {
+	sql := `UPDATE login_failures SET
+		failures = GREATEST(failures - 1, 0),
+		blocked_until = CASE WHEN blocked_until = $3 THEN NULL ELSE blocked_until END,
+		locked = CASE WHEN blocked_until = $3 THEN FALSE ELSE locked END
+	WHERE kind = $1 AND key = $2`
+	_, err := inst.pool.Exec(ctx, sql, kind, key, blockedUntil)
+
+	return err
+}
+
+// ResetLoginFailures forgets the failures of the key and lifts its block.
+func (inst *LoginFailure) ResetLoginFailures(ctx context.Context, kind, key string) (bool, error) {
+	tag, err := inst.pool.Exec(ctx, `DELETE FROM login_failures WHERE kind = $1 AND key = $2`, kind, key)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// PurgeLoginFailures removes the keys without a failure since before that
+// are no longer blocked.
+func (inst *LoginFailure) PurgeLoginFailures(ctx context.Context, before time.Time) (int64, error) {
+	sql := `DELETE FROM login_failures WHERE last_failure_at < $1 AND (blocked_until IS NULL OR blocked_until < now())`
+
+	tag, err := inst.pool.Exec(ctx, sql, before)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
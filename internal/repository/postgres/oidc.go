@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type OIDC struct {
+	pool *pgxpool.Pool
+}
+
+func NewOIDC(pool *pgxpool.Pool) *OIDC {
+	return &OIDC{
+		pool: pool,
+	}
+}
+
+// CreateOIDCState stores a started login, expired ones are purged on the way.
+func (inst *OIDC) CreateOIDCState(ctx context.Context, state *model.OIDCState) error {
+	if _, err := inst.pool.Exec(ctx, `DELETE FROM oidc_states WHERE expires_at <= now()`); err != nil {
+		return err
+	}
+
+	sql := `INSERT INTO oidc_states (hash, nonce, code_verifier, expires_at, create_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := inst.pool.Exec(ctx, sql, state.Hash, state.Nonce, state.CodeVerifier, state.ExpiresAt, state.CreateAt)
+
+	return err
+}
+
+// ConsumeOIDCState removes and returns a live state, so a redirect can be
+// used once. Expired and unknown states are not found.
+func (inst *OIDC) ConsumeOIDCState(ctx context.Context, hash string) (*model.OIDCState, error) {
+	state := &model.OIDCState{}
+	sql := `DELETE FROM oidc_states WHERE hash = $1
+	RETURNING hash, nonce, code_verifier, expires_at, create_at`
+
+	if err := inst.pool.QueryRow(ctx, sql, hash).Scan(
+		&state.Hash,
+		&state.Nonce,
+		&state.CodeVerifier,
+		&state.ExpiresAt,
+		&state.CreateAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	if !state.ExpiresAt.After(time.Now()) {
+		return nil, utils.ErrorNotFound
+	}
+
+	return state, nil
+}
+
+func (inst *OIDC) GetIdentity(ctx context.Context, issuer, subject string) (*model.Identity, error) {
+	identity := &model.Identity{}
+	sql := `SELECT issuer, subject, user_uuid, create_at FROM user_identities WHERE issuer = $1 AND subject = $2`
+
+	if err := inst.pool.QueryRow(ctx, sql, issuer, subject).Scan(
+		&identity.Issuer,
+		&identity.Subject,
+		&identity.UserUUID,
+		&identity.CreateAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return identity, nil
+}
+
+// HasIdentity reports whether the user is linked to any provider subject.
+func (inst *OIDC) HasIdentity(ctx context.Context, userUUID string) (bool, error) {
+	var exists bool
+	sql := `SELECT EXISTS (SELECT 1 FROM user_identities WHERE user_uuid = $1)`
+
+	if err := inst.pool.QueryRow(ctx, sql, userUUID).Scan(&exists); err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+func (inst *OIDC) CreateIdentity(ctx context.Context, identity *model.Identity) error {
+	sql := `INSERT INTO user_identities (issuer, subject, user_uuid, create_at) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (issuer, subject) DO NOTHING`
+	_, err := inst.pool.Exec(ctx, sql, identity.Issuer, identity.Subject, identity.UserUUID, identity.CreateAt)
+
+	return err
+}
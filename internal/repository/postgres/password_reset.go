@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PasswordReset struct {
+	pool *pgxpool.Pool
+}
+
+func NewPasswordReset(pool *pgxpool.Pool) *PasswordReset {
+	return &PasswordReset{
+		pool: pool,
+	}
+}
+
+// CreatePasswordReset stores the reset token, earlier unused tokens of the
+// user stop working. Expired tokens are purged on the way.
+func (inst *PasswordReset) CreatePasswordReset(ctx context.Context, reset *model.PasswordReset) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `DELETE FROM password_reset_tokens WHERE (user_uuid = $1 AND used_at IS NULL) OR expires_at <= now()`
+	if _, err := tx.Exec(ctx, sql, reset.UserUUID); err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO password_reset_tokens (hash, user_uuid, user_login, create_by, expires_at, create_at)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+
+	if _, err := tx.Exec(
+		ctx,
+		sql,
+		reset.Hash,
+		reset.UserUUID,
+		reset.UserLogin,
+		reset.CreateBy,
+		reset.ExpiresAt,
+		reset.CreateAt,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPasswordReset returns a live reset token, used, expired and unknown
+// tokens are not found.
+func (inst *PasswordReset) GetPasswordReset(ctx context.Context, hash string) (*model.PasswordReset, error) {
+	reset := &model.PasswordReset{}
+	sql := `SELECT hash, user_uuid, user_login, create_by, expires_at, create_at, used_at
+	FROM password_reset_tokens
+	WHERE hash = $1 AND used_at IS NULL AND expires_at > now()`
+
+	if err := inst.pool.QueryRow(ctx, sql, hash).Scan(
+		&reset.Hash,
+		&reset.UserUUID,
+		&reset.UserLogin,
+		&reset.CreateBy,
+		&reset.ExpiresAt,
+		&reset.CreateAt,
+		&reset.UsedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return reset, nil
+}
+
+// ConsumePasswordReset uses up a live reset token and sets the password of
+// its user in the same transaction. Used, expired and unknown tokens are not
+// found.
+func (inst *PasswordReset) ConsumePasswordReset(ctx context.Context, hash, password string) (*model.PasswordReset, error) {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	reset := &model.PasswordReset{}
+	sql := `UPDATE password_reset_tokens SET used_at = now()
+	WHERE hash = $1 AND used_at IS NULL AND expires_at > now()
+	RETURNING hash, user_uuid, user_login, create_by, expires_at, create_at, used_at`
+
+	if err := tx.QueryRow(ctx, sql, hash).Scan(
+		&reset.Hash,
+		&reset.UserUUID,
+		&reset.UserLogin,
+		&reset.CreateBy,
+		&reset.ExpiresAt,
+		&reset.CreateAt,
+		&reset.UsedAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE users SET password = $2 WHERE uuid = $1`, reset.UserUUID, password); err != nil {
+		return nil, err
+	}
+
+	return reset, tx.Commit(ctx)
+}
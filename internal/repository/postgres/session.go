@@ -3,10 +3,18 @@ package postgres
 import (
 	"context"
 	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// sessionTouchSlack keeps sliding renewal from writing the row on every request.
+const sessionTouchSlack = time.Minute
+
 type Session struct {
 	pool *pgxpool.Pool
 }
@@ -17,36 +25,421 @@ func NewSession(pool *pgxpool.Pool) *Session {
 	}
 }
 
+// GetSessionByUUID returns a live session and slides its expiry forward by
+// its idle ttl, capped by the max expiry. Expired sessions are not found.
 func (inst *Session) GetSessionByUUID(ctx context.Context, uuid string) (*model.Session, error) {
 	session := &model.Session{}
-	sql := `SELECT uuid, user_uuid, user_login, expires_at FROM sessions WHERE uuid = $1`
+	sql := `WITH touched AS (
+		UPDATE sessions SET expires_at = LEAST(now() + idle_ttl, max_expires_at)
+		WHERE uuid = $1
+			AND expires_at > now()
+			AND expires_at < LEAST(now() + idle_ttl, max_expires_at) - make_interval(secs => $2)
+		RETURNING uuid, expires_at
+	), seen AS (
+		UPDATE session_families SET last_seen_at = now()
+		FROM sessions
+		WHERE sessions.uuid = $1
+			AND sessions.expires_at > now()
+			AND session_families.uuid = sessions.family_uuid
+			AND session_families.last_seen_at < now() - make_interval(secs => $2)
+	)
+	SELECT
+		sessions.uuid,
+		sessions.user_uuid,
+		sessions.user_login,
+		users.role,
+		COALESCE(sessions.family_uuid::text, ''),
+		EXTRACT(EPOCH FROM sessions.idle_ttl)::bigint,
+		COALESCE(touched.expires_at, sessions.expires_at),
+		sessions.max_expires_at,
+		sessions.create_at
+	FROM sessions
+	JOIN users ON users.uuid = sessions.user_uuid
+	LEFT JOIN touched ON touched.uuid = sessions.uuid
+	WHERE sessions.uuid = $1 AND sessions.expires_at > now() AND users.disabled_at IS NULL`
 
-	if err := inst.pool.QueryRow(ctx, sql, uuid).Scan(
+	var idleTTL int64
+	if err := inst.pool.QueryRow(ctx, sql, uuid, sessionTouchSlack.Seconds()).Scan(
 		&session.UUID,
 		&session.UserUUID,
 		&session.UserLogin,
+		&session.UserRole,
+		&session.FamilyUUID,
+		&idleTTL,
 		&session.ExpiresAt,
+		&session.MaxExpiresAt,
+		&session.CreateAt,
 	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
 		return nil, err
 	}
+	session.IdleTTL = time.Duration(idleTTL) * time.Second
 
 	return session, nil
 }
 
 func (inst *Session) CreateSession(ctx context.Context, session *model.Session) error {
-	sql := `INSERT INTO sessions (uuid, user_uuid, user_login, expires_at) VALUEs ($1, $2, $3, $4)`
+	return inst.insertSession(ctx, inst.pool, session)
+}
 
-	if _, err := inst.pool.Exec(ctx, sql, session.UUID, session.UserUUID, session.UserLogin, session.ExpiresAt); err != nil {
+func (inst *Session) DeleteSession(ctx context.Context, uuid string) error {
+	sql := `DELETE FROM sessions WHERE uuid = $1`
+
+	if _, err := inst.pool.Exec(ctx, sql, uuid); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (inst *Session) DeleteSession(ctx context.Context, uuid string) error {
-	sql := `DELETE FROM session WHERE uuid = $1`
+// CreateSessionWithRefresh starts the family of the session and stores the
+// session together with the refresh token issued for it. A stateless session
+// stores its family and the refresh token only.
+func (inst *Session) CreateSessionWithRefresh(ctx context.Context, session *model.Session, refresh *model.RefreshToken) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
 
-	if _, err := inst.pool.Exec(ctx, sql, uuid); err != nil {
+	sql := `INSERT INTO session_families (uuid, user_uuid, user_login, ip, user_agent, create_at, last_seen_at, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $6, $7)`
+
+	if _, err := tx.Exec(
+		ctx,
+		sql,
+		session.FamilyUUID,
+		session.UserUUID,
+		session.UserLogin,
+		session.IP,
+		session.UserAgent,
+		session.CreateAt,
+		refresh.ExpiresAt,
+	); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	if !session.Stateless {
+		if err := inst.insertSession(ctx, tx, session); err != nil {
+			tx.Rollback(ctx)
+			return err
+		}
+	}
+
+	if err := inst.insertRefreshToken(ctx, tx, refresh); err != nil {
+		tx.Rollback(ctx)
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RotateRefreshToken uses up the refresh token with the given hash and
+// stores the session and refresh token returned by next in its place, the
+// session of the used token is ended and the family is marked as seen from
+// the client of the new session. A stateless session is not stored. A token
+// presented a second time revokes its whole family and ErrorRefreshReused
+// is returned.
+func (inst *Session) RotateRefreshToken(ctx context.Context, hash string, next func(used *model.RefreshToken) (*model.Session, *model.RefreshToken, error)) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	used := &model.RefreshToken{}
+	sql := `SELECT hash, family_uuid, COALESCE(session_uuid::text, ''), user_uuid, user_login, expires_at, create_at, used_at, revoked
+	FROM refresh_tokens WHERE hash = $1 FOR UPDATE`
+
+	if err := tx.QueryRow(ctx, sql, hash).Scan(
+		&used.Hash,
+		&used.FamilyUUID,
+		&used.SessionUUID,
+		&used.UserUUID,
+		&used.UserLogin,
+		&used.ExpiresAt,
+		&used.CreateAt,
+		&used.UsedAt,
+		&used.Revoked,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return utils.ErrorAuthFailed
+		}
+		return err
+	}
+
+	if used.Revoked || time.Now().After(used.ExpiresAt) {
+		return utils.ErrorAuthFailed
+	}
+
+	if used.UsedAt != nil {
+		if err := inst.revokeFamily(ctx, tx, used.FamilyUUID); err != nil {
+			return err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+		return utils.ErrorRefreshReused
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET used_at = now() WHERE hash = $1`, hash); err != nil {
+		return err
+	}
+
+	if used.SessionUUID != "" {
+		if _, err := tx.Exec(ctx, `DELETE FROM sessions WHERE uuid = $1`, used.SessionUUID); err != nil {
+			return err
+		}
+	}
+
+	session, refresh, err := next(used)
+	if err != nil {
+		return err
+	}
+
+	if !session.Stateless {
+		if err := inst.insertSession(ctx, tx, session); err != nil {
+			return err
+		}
+	}
+
+	if err := inst.insertRefreshToken(ctx, tx, refresh); err != nil {
+		return err
+	}
+
+	sql = `UPDATE session_families SET ip = $2, user_agent = $3, last_seen_at = $4, expires_at = $5 WHERE uuid = $1`
+
+	if _, err := tx.Exec(ctx, sql, session.FamilyUUID, session.IP, session.UserAgent, session.CreateAt, refresh.ExpiresAt); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListSessionFamilies returns the live families of the login, most recently
+// seen first. ExpiresAt is when the family can no longer be refreshed.
+func (inst *Session) ListSessionFamilies(ctx context.Context, login string) ([]model.Session, error) {
+	sql := `SELECT uuid, user_uuid, user_login, ip, user_agent, create_at, last_seen_at, expires_at
+	FROM session_families
+	WHERE user_login = $1 AND expires_at > now()
+	ORDER BY last_seen_at DESC`
+
+	rows, err := inst.pool.Query(ctx, sql, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	families := make([]model.Session, 0)
+	for rows.Next() {
+		family, err := inst.scanFamily(rows)
+		if err != nil {
+			return nil, err
+		}
+		families = append(families, *family)
+	}
+
+	return families, rows.Err()
+}
+
+func (inst *Session) GetSessionFamily(ctx context.Context, familyUUID string) (*model.Session, error) {
+	sql := `SELECT uuid, user_uuid, user_login, ip, user_agent, create_at, last_seen_at, expires_at
+	FROM session_families
+	WHERE uuid = $1 AND expires_at > now()`
+
+	family, err := inst.scanFamily(inst.pool.QueryRow(ctx, sql, familyUUID))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return family, nil
+}
+
+// RevokeFamily ends every session of the family and revokes its refresh
+// tokens. The access tokens issued with them are put on the deny-list, which
+// is what ends stateless tokens.
+func (inst *Session) RevokeFamily(ctx context.Context, familyUUID string) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := inst.revokeFamily(ctx, tx, familyUUID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// RevokeUserFamilies ends every session family of the login except keep and
+// returns how many were ended.
+func (inst *Session) RevokeUserFamilies(ctx context.Context, login, keepFamilyUUID string) (int64, error) {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `SELECT DISTINCT family_uuid::text FROM refresh_tokens
+	WHERE user_login = $1 AND family_uuid::text <> $2 AND NOT revoked AND expires_at > now()`
+
+	rows, err := tx.Query(ctx, sql, login, keepFamilyUUID)
+	if err != nil {
+		return 0, err
+	}
+
+	families, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, err
+	}
+
+	for _, familyUUID := range families {
+		if err := inst.revokeFamily(ctx, tx, familyUUID); err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(families)), tx.Commit(ctx)
+}
+
+// RevokeToken puts the jti on the deny-list until the token expires.
+func (inst *Session) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	sql := `INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`
+
+	if _, err := inst.pool.Exec(ctx, sql, jti, expiresAt); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (inst *Session) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	sql := `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`
+
+	if err := inst.pool.QueryRow(ctx, sql, jti).Scan(&revoked); err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// DeleteExpired purges expired sessions and returns how many were removed,
+// and how many expired refresh tokens and deny-list entries.
+func (inst *Session) DeleteExpired(ctx context.Context) (int64, int64, error) {
+	sessions, err := inst.pool.Exec(ctx, `DELETE FROM sessions WHERE expires_at <= now()`)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	tokens, err := inst.pool.Exec(ctx, `DELETE FROM refresh_tokens WHERE expires_at <= now()`)
+	if err != nil {
+		return sessions.RowsAffected(), 0, err
+	}
+
+	revoked, err := inst.pool.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= now()`)
+	if err != nil {
+		return sessions.RowsAffected(), tokens.RowsAffected(), err
+	}
+
+	if _, err := inst.pool.Exec(ctx, `DELETE FROM session_families WHERE expires_at <= now()`); err != nil {
+		return sessions.RowsAffected(), tokens.RowsAffected() + revoked.RowsAffected(), err
+	}
+
+	return sessions.RowsAffected(), tokens.RowsAffected() + revoked.RowsAffected(), nil
+}
+
+func (inst *Session) revokeFamily(ctx context.Context, tx pgx.Tx, familyUUID string) error {
+	sql := `INSERT INTO revoked_tokens (jti, expires_at)
+	SELECT session_uuid::text, MAX(expires_at) FROM refresh_tokens
+	WHERE family_uuid = $1 AND session_uuid IS NOT NULL AND NOT revoked
+	GROUP BY session_uuid
+	ON CONFLICT (jti) DO NOTHING`
+
+	if _, err := tx.Exec(ctx, sql, familyUUID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE refresh_tokens SET revoked = TRUE WHERE family_uuid = $1`, familyUUID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM sessions WHERE family_uuid = $1`, familyUUID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM session_families WHERE uuid = $1`, familyUUID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (inst *Session) scanFamily(row pgx.Row) (*model.Session, error) {
+	family := &model.Session{}
+	if err := row.Scan(
+		&family.FamilyUUID,
+		&family.UserUUID,
+		&family.UserLogin,
+		&family.IP,
+		&family.UserAgent,
+		&family.CreateAt,
+		&family.LastSeenAt,
+		&family.ExpiresAt,
+	); err != nil {
+		return nil, err
+	}
+
+	return family, nil
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+func (inst *Session) insertSession(ctx context.Context, db execer, session *model.Session) error {
+	sql := `INSERT INTO sessions (uuid, user_uuid, user_login, family_uuid, idle_ttl, expires_at, max_expires_at, create_at)
+	VALUES ($1, $2, $3, NULLIF($4, '')::uuid, make_interval(secs => $5), $6, $7, $8)`
+
+	if _, err := db.Exec(
+		ctx,
+		sql,
+		session.UUID,
+		session.UserUUID,
+		session.UserLogin,
+		session.FamilyUUID,
+		session.IdleTTL.Seconds(),
+		session.ExpiresAt,
+		session.MaxExpiresAt,
+		session.CreateAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (inst *Session) insertRefreshToken(ctx context.Context, db execer, refresh *model.RefreshToken) error {
+	sql := `INSERT INTO refresh_tokens (hash, family_uuid, session_uuid, user_uuid, user_login, expires_at, create_at)
+	VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7)`
+
+	if _, err := db.Exec(
+		ctx,
+		sql,
+		refresh.Hash,
+		refresh.FamilyUUID,
+		refresh.SessionUUID,
+		refresh.UserUUID,
+		refresh.UserLogin,
+		refresh.ExpiresAt,
+		refresh.CreateAt,
+	); err != nil {
 		return err
 	}
 
@@ -0,0 +1,187 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type TOTP struct {
+	pool *pgxpool.Pool
+}
+
+func NewTOTP(pool *pgxpool.Pool) *TOTP {
+	return &TOTP{
+		pool: pool,
+	}
+}
+
+func (inst *TOTP) GetTOTP(ctx context.Context, userUUID string) (*model.TOTP, error) {
+	totp := &model.TOTP{}
+	sql := `SELECT user_uuid, secret, enabled, last_step, create_at, enabled_at FROM user_totp WHERE user_uuid = $1`
+
+	if err := inst.pool.QueryRow(ctx, sql, userUUID).Scan(
+		&totp.UserUUID,
+		&totp.Secret,
+		&totp.Enabled,
+		&totp.LastStep,
+		&totp.CreateAt,
+		&totp.EnabledAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return totp, nil
+}
+
+// SavePendingTOTP stores a new secret waiting for verification, replacing a
+// pending one. An enabled TOTP is left alone and ErrorTOTPEnabled returned.
+func (inst *TOTP) SavePendingTOTP(ctx context.Context, totp *model.TOTP) error {
+	sql := `INSERT INTO user_totp (user_uuid, secret, create_at) VALUES ($1, $2, $3)
+	ON CONFLICT (user_uuid) DO UPDATE SET secret = EXCLUDED.secret, create_at = EXCLUDED.create_at, last_step = 0
+	WHERE NOT user_totp.enabled`
+
+	tag, err := inst.pool.Exec(ctx, sql, totp.UserUUID, totp.Secret, totp.CreateAt)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return utils.ErrorTOTPEnabled
+	}
+
+	return nil
+}
+
+// EnableTOTP turns the pending TOTP on at the verified step and replaces the
+// recovery codes of the user.
+func (inst *TOTP) EnableTOTP(ctx context.Context, userUUID string, step int64, recoveryHashes []string) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `UPDATE user_totp SET enabled = TRUE, enabled_at = now(), last_step = $2
+	WHERE user_uuid = $1 AND NOT enabled`
+
+	tag, err := tx.Exec(ctx, sql, userUUID, step)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return utils.ErrorTOTPEnabled
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_uuid = $1`, userUUID); err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryHashes {
+		if _, err := tx.Exec(ctx, `INSERT INTO totp_recovery_codes (hash, user_uuid) VALUES ($1, $2)`, hash, userUUID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// DeleteTOTP turns the second factor off and drops the recovery codes.
+func (inst *TOTP) DeleteTOTP(ctx context.Context, userUUID string) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM totp_recovery_codes WHERE user_uuid = $1`, userUUID); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM user_totp WHERE user_uuid = $1`, userUUID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseTOTPStep records the step a code was accepted for. It reports false
+// when a code of that step or a later one was already accepted.
+func (inst *TOTP) UseTOTPStep(ctx context.Context, userUUID string, step int64) (bool, error) {
+	sql := `UPDATE user_totp SET last_step = $2 WHERE user_uuid = $1 AND enabled AND last_step < $2`
+
+	tag, err := inst.pool.Exec(ctx, sql, userUUID, step)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode uses up an unused recovery code of the user.
+func (inst *TOTP) UseRecoveryCode(ctx context.Context, userUUID, hash string) (bool, error) {
+	sql := `UPDATE totp_recovery_codes SET used_at = now() WHERE hash = $1 AND user_uuid = $2 AND used_at IS NULL`
+
+	tag, err := inst.pool.Exec(ctx, sql, hash, userUUID)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// CreateLoginChallenge stores the challenge, expired ones are purged on the
+// way.
+func (inst *TOTP) CreateLoginChallenge(ctx context.Context, challenge *model.LoginChallenge) error {
+	if _, err := inst.pool.Exec(ctx, `DELETE FROM login_challenges WHERE expires_at <= now()`); err != nil {
+		return err
+	}
+
+	sql := `INSERT INTO login_challenges (hash, user_uuid, expires_at, create_at) VALUES ($1, $2, $3, $4)`
+
+	if _, err := inst.pool.Exec(ctx, sql, challenge.Hash, challenge.UserUUID, challenge.ExpiresAt, challenge.CreateAt); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AttemptLoginChallenge counts an attempt on a live challenge that has
+// attempts left and returns it. Other challenges are not found.
+func (inst *TOTP) AttemptLoginChallenge(ctx context.Context, hash string, maxAttempts int) (*model.LoginChallenge, error) {
+	challenge := &model.LoginChallenge{}
+	sql := `UPDATE login_challenges SET attempts = attempts + 1
+	WHERE hash = $1 AND expires_at > now() AND attempts < $2
+	RETURNING hash, user_uuid, attempts, expires_at, create_at`
+
+	if err := inst.pool.QueryRow(ctx, sql, hash, maxAttempts).Scan(
+		&challenge.Hash,
+		&challenge.UserUUID,
+		&challenge.Attempts,
+		&challenge.ExpiresAt,
+		&challenge.CreateAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+func (inst *TOTP) DeleteLoginChallenge(ctx context.Context, hash string) error {
+	if _, err := inst.pool.Exec(ctx, `DELETE FROM login_challenges WHERE hash = $1`, hash); err != nil {
+		return err
+	}
+
+	return nil
+}
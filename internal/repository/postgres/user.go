@@ -5,12 +5,17 @@ import (
 	"docs/internal/model"
 	"docs/internal/utils"
 	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+const userColumns = `uuid, login, password, role, source, disabled_at, create_at,
+	COALESCE(display_name, ''), COALESCE(email, ''), COALESCE(locale, ''), COALESCE(avatar_uuid::text, '')`
+
 type User struct {
 	pool *pgxpool.Pool
 }
@@ -22,9 +27,9 @@ func NewUser(pool *pgxpool.Pool) *User {
 }
 
 func (inst *User) GetUserByUUID(ctx context.Context, uuid string) (*model.User, error) {
-	var user = &model.User{}
-	sql := `SELECT uuid, login, password FROM users WHERE uuid = $1;`
-	if err := inst.pool.QueryRow(ctx, sql, uuid).Scan(&user.UUID, &user.Login, &user.Password); err != nil {
+	sql := `SELECT ` + userColumns + ` FROM users WHERE uuid = $1;`
+	user, err := inst.scanUser(inst.pool.QueryRow(ctx, sql, uuid))
+	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
 			return nil, utils.ErrorNotFound
@@ -35,9 +40,9 @@ func (inst *User) GetUserByUUID(ctx context.Context, uuid string) (*model.User,
 }
 
 func (inst *User) GetUserByLogin(ctx context.Context, login string) (*model.User, error) {
-	var user = &model.User{}
-	sql := `SELECT * FROM users WHERE login = $1;`
-	if err := inst.pool.QueryRow(ctx, sql, login).Scan(&user.UUID, &user.Login, &user.Password); err != nil {
+	sql := `SELECT ` + userColumns + ` FROM users WHERE login = $1;`
+	user, err := inst.scanUser(inst.pool.QueryRow(ctx, sql, login))
+	if err != nil {
 		switch {
 		case errors.Is(err, pgx.ErrNoRows):
 			return nil, utils.ErrorNotFound
@@ -47,16 +52,466 @@ func (inst *User) GetUserByLogin(ctx context.Context, login string) (*model.User
 	return user, nil
 }
 
+// GetUserByEmail returns the user with the email, compared without case.
+func (inst *User) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	sql := `SELECT ` + userColumns + ` FROM users WHERE lower(email) = lower($1);`
+	user, err := inst.scanUser(inst.pool.QueryRow(ctx, sql, email))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUsersByLogins returns the users of the logins that exist, in no
+// particular order.
+func (inst *User) GetUsersByLogins(ctx context.Context, logins []string) ([]model.User, error) {
+	rows, err := inst.pool.Query(ctx, `SELECT `+userColumns+` FROM users WHERE login = ANY($1)`, logins)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]model.User, 0, len(logins))
+	for rows.Next() {
+		user, err := inst.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
+// ListUsers returns the users matching the filter ordered by login.
+func (inst *User) ListUsers(ctx context.Context, filter *model.UserFilter) ([]model.User, error) {
+	conditions := []string{"TRUE"}
+	values := []any{}
+
+	add := func(condition string, value any) {
+		values = append(values, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(values)))
+	}
+
+	if filter.Search != "" {
+		add(`login ILIKE '%%' || $%d || '%%'`, escapeLike(filter.Search))
+	}
+	if filter.Role != "" {
+		add("role = $%d", filter.Role)
+	}
+	if filter.Disabled != nil {
+		add("(disabled_at IS NOT NULL) = $%d", *filter.Disabled)
+	}
+
+	values = append(values, filter.Limit, filter.Offset)
+	sql := fmt.Sprintf(
+		`SELECT %s FROM users WHERE %s ORDER BY login LIMIT $%d OFFSET $%d`,
+		userColumns,
+		strings.Join(conditions, " AND "),
+		len(values)-1,
+		len(values),
+	)
+
+	rows, err := inst.pool.Query(ctx, sql, values...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]model.User, 0)
+	for rows.Next() {
+		user, err := inst.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+
+	return users, rows.Err()
+}
+
 func (inst *User) CreateUser(ctx context.Context, user *model.User) error {
-	sql := `INSERT INTO users (uuid, login, password) VALUES ($1, $2, $3)`
-	_, err := inst.pool.Exec(ctx, sql, user.UUID, user.Login, user.Password)
+	if user.Role == "" {
+		user.Role = model.RoleUser
+	}
+
+	if user.Source == "" {
+		user.Source = model.UserSourceLocal
+	}
+
+	sql := `INSERT INTO users (uuid, login, password, role, source) VALUES ($1, $2, $3, $4, $5) RETURNING create_at`
+	err := inst.pool.QueryRow(ctx, sql, user.UUID, user.Login, user.Password, user.Role, user.Source).Scan(&user.CreateAt)
+	if err != nil {
+		const errorDublocateKeyCode = "23505"
+		if pgerr, ok := err.(*pgconn.PgError); ok && pgerr.Code == errorDublocateKeyCode {
+			return utils.ErrorLoginAlradyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+// CreateFirstAdmin creates user as an admin while there is no admin yet,
+// ErrorAdminExists otherwise.
+func (inst *User) CreateFirstAdmin(ctx context.Context, user *model.User) error {
+	user.Role = model.RoleAdmin
+
+	sql := `INSERT INTO users (uuid, login, password, role)
+	SELECT $1, $2, $3, $4
+	WHERE NOT EXISTS (SELECT 1 FROM users WHERE role = $4)
+	RETURNING create_at`
+
+	err := inst.pool.QueryRow(ctx, sql, user.UUID, user.Login, user.Password, user.Role).Scan(&user.CreateAt)
 	if err != nil {
 		const errorDublocateKeyCode = "23505"
 		if pgerr, ok := err.(*pgconn.PgError); ok && pgerr.Code == errorDublocateKeyCode {
 			return utils.ErrorLoginAlradyExists
 		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			return utils.ErrorAdminExists
+		}
 		return err
 	}
 
 	return nil
 }
+
+func (inst *User) UpdatePassword(ctx context.Context, uuid, password string) error {
+	sql := `UPDATE users SET password = $2 WHERE uuid = $1`
+
+	tag, err := inst.pool.Exec(ctx, sql, uuid, password)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return utils.ErrorNotFound
+	}
+
+	return nil
+}
+
+// UpdateRole sets the role of the user and appends the audit event in one
+// transaction.
+func (inst *User) UpdateRole(ctx context.Context, uuid, role string, audit *model.AuditEvent) error {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `UPDATE users SET role = $2 WHERE uuid = $1`, uuid, role)
+	if err != nil {
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return utils.ErrorNotFound
+	}
+
+	if err := appendAuditEvents(ctx, tx, audit); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UpdateProfile stores the profile fields of user, empty ones as NULL.
+func (inst *User) UpdateProfile(ctx context.Context, user *model.User) error {
+	sql := `UPDATE users SET
+		display_name = NULLIF($2, ''),
+		email = NULLIF($3, ''),
+		locale = NULLIF($4, ''),
+		avatar_uuid = NULLIF($5, '')::uuid
+	WHERE uuid = $1`
+
+	tag, err := inst.pool.Exec(ctx, sql, user.UUID, user.DisplayName, user.Email, user.Locale, user.AvatarUUID)
+	if err != nil {
+		const (
+			errorDublocateKeyCode = "23505"
+			errorForeignKeyCode   = "23503"
+		)
+		if pgerr, ok := err.(*pgconn.PgError); ok {
+			switch pgerr.Code {
+			case errorDublocateKeyCode:
+				return utils.ErrorEmailExists
+			case errorForeignKeyCode:
+				return fmt.Errorf("%w: avatar document not found", utils.ErrorInvalidProfile)
+			}
+		}
+		return err
+	}
+
+	if tag.RowsAffected() == 0 {
+		return utils.ErrorNotFound
+	}
+
+	return nil
+}
+
+// ListSoleDocuments returns the documents only login has a grant on, the
+// ones nobody could reach once the user is gone.
+func (inst *User) ListSoleDocuments(ctx context.Context, login string) ([]model.Document, error) {
+	return inst.selectSoleDocuments(ctx, inst.pool, login)
+}
+
+// SetUserDisabled disables or enables the user. Disabling deactivates the
+// webhooks of the user and hands the documents only the user has a grant on
+// over in the same transaction and returns them, without a handover they
+// fail it with ErrorSoleDocuments. The events and audit events announce
+// builds for them, none included, are logged in the transaction too.
+func (inst *User) SetUserDisabled(ctx context.Context, uuid string, disabled bool, handover model.DocumentHandover, announce func([]model.Document) ([]*model.Event, []*model.AuditEvent, error)) ([]model.Document, error) {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	sql := `UPDATE users SET disabled_at = CASE WHEN $2 THEN COALESCE(disabled_at, now()) END WHERE uuid = $1 RETURNING login`
+
+	var login string
+	if err := tx.QueryRow(ctx, sql, uuid, disabled).Scan(&login); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	var documents []model.Document
+	if disabled {
+		if documents, err = inst.handOverDocuments(ctx, tx, login, handover); err != nil {
+			return nil, err
+		}
+
+		if err := inst.deactivateWebhooks(ctx, tx, login); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := inst.announceHandover(ctx, tx, documents, announce); err != nil {
+		return nil, err
+	}
+
+	return documents, tx.Commit(ctx)
+}
+
+// DeleteUser removes the user along with its sessions, keys and grants. The
+// documents only the user has a grant on are handed over in the same
+// transaction and returned, without a handover they fail the delete with
+// ErrorSoleDocuments. The events and audit events announce builds for them,
+// none included, are logged in the transaction too.
+func (inst *User) DeleteUser(ctx context.Context, uuid string, handover model.DocumentHandover, announce func([]model.Document) ([]*model.Event, []*model.AuditEvent, error)) ([]model.Document, error) {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// the row lock keeps new grants of the login out until commit
+	var login string
+	if err := tx.QueryRow(ctx, `SELECT login FROM users WHERE uuid = $1 FOR UPDATE`, uuid).Scan(&login); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	documents, err := inst.handOverDocuments(ctx, tx, login, handover)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `DELETE FROM users WHERE uuid = $1`, uuid); err != nil {
+		return nil, err
+	}
+
+	if err := inst.announceHandover(ctx, tx, documents, announce); err != nil {
+		return nil, err
+	}
+
+	return documents, tx.Commit(ctx)
+}
+
+// deactivateWebhooks stops the webhooks of login and gives up their pending
+// deliveries, enabling the user again doesn't start them.
+func (inst *User) deactivateWebhooks(ctx context.Context, tx pgx.Tx, login string) error {
+	sql := `UPDATE webhooks SET active = FALSE WHERE user_login = $1`
+	if _, err := tx.Exec(ctx, sql, login); err != nil {
+		return err
+	}
+
+	sql = `UPDATE webhook_deliveries SET status = $2, last_error = 'webhook deactivated'
+	WHERE status = $3 AND webhook_uuid IN (SELECT uuid FROM webhooks WHERE user_login = $1)`
+	_, err := tx.Exec(ctx, sql, login, model.DeliveryDead, model.DeliveryPending)
+
+	return err
+}
+
+// handOverDocuments moves the grants of login on the documents only it has
+// a grant on to handover.TransferTo, or deletes those documents.
+func (inst *User) handOverDocuments(ctx context.Context, tx pgx.Tx, login string, handover model.DocumentHandover) ([]model.Document, error) {
+	// lock every document of the login first, so that grants other users
+	// lose meanwhile are seen when the sole ones are selected below
+	sql := `SELECT uuid FROM documents
+	WHERE uuid IN (SELECT document_uuid FROM document_grants WHERE user_login = $1)
+	FOR UPDATE`
+	if _, err := tx.Exec(ctx, sql, login); err != nil {
+		return nil, err
+	}
+
+	documents, err := inst.selectSoleDocuments(ctx, tx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(documents) == 0 {
+		return documents, nil
+	}
+
+	uuids := make([]string, 0, len(documents))
+	for _, document := range documents {
+		uuids = append(uuids, document.UUID)
+	}
+
+	switch {
+	case handover.Delete:
+		if _, err := tx.Exec(ctx, `DELETE FROM documents WHERE uuid = ANY($1)`, uuids); err != nil {
+			return nil, err
+		}
+	case handover.TransferTo != "":
+		sql = `INSERT INTO document_grants (document_uuid, user_login)
+		SELECT document_uuid, $2 FROM unnest($1::uuid[]) AS document_uuid`
+		if _, err := tx.Exec(ctx, sql, uuids, handover.TransferTo); err != nil {
+			const errorForeignKeyCode = "23503"
+			if pgerr, ok := err.(*pgconn.PgError); ok && pgerr.Code == errorForeignKeyCode {
+				return nil, fmt.Errorf("%w: transfer_to user not found", utils.ErrorInvalidHandover)
+			}
+			return nil, err
+		}
+
+		sql = `DELETE FROM document_grants WHERE user_login = $1 AND document_uuid = ANY($2)`
+		if _, err := tx.Exec(ctx, sql, login, uuids); err != nil {
+			return nil, err
+		}
+
+		// a disabled user keeps its row, its locks must not block the new grantee
+		sql = `DELETE FROM document_locks WHERE user_login = $1 AND document_uuid = ANY($2)`
+		if _, err := tx.Exec(ctx, sql, login, uuids); err != nil {
+			return nil, err
+		}
+
+		// the grant list is part of the version clients hold
+		if _, err := tx.Exec(ctx, `UPDATE documents SET version = version + 1 WHERE uuid = ANY($1)`, uuids); err != nil {
+			return nil, err
+		}
+
+		for i := range documents {
+			documents[i].Grant = []string{handover.TransferTo}
+			documents[i].Version++
+		}
+	default:
+		return nil, fmt.Errorf("%w: %d documents", utils.ErrorSoleDocuments, len(documents))
+	}
+
+	return documents, nil
+}
+
+// announceHandover logs the events and the audit events announce builds for
+// the handed over documents in tx.
+func (inst *User) announceHandover(ctx context.Context, tx pgx.Tx, documents []model.Document, announce func([]model.Document) ([]*model.Event, []*model.AuditEvent, error)) error {
+	events, audits, err := announce(documents)
+	if err != nil {
+		return err
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return err
+	}
+
+	return appendAuditEvents(ctx, tx, audits...)
+}
+
+func (inst *User) selectSoleDocuments(ctx context.Context, db querier, login string) ([]model.Document, error) {
+	sql := `SELECT
+		documents.uuid,
+		documents.name,
+		documents.mime,
+		documents.file,
+		documents.public,
+		documents.create_at,
+		documents.path,
+		documents.version,
+		documents.size,
+		documents.hash
+	FROM documents
+	JOIN document_grants ON document_grants.document_uuid = documents.uuid
+	WHERE document_grants.user_login = $1 AND NOT EXISTS (
+		SELECT 1 FROM document_grants other
+		WHERE other.document_uuid = documents.uuid AND other.user_login <> $1
+	)
+	ORDER BY documents.create_at`
+
+	rows, err := db.Query(ctx, sql, login)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	documents := make([]model.Document, 0)
+	for rows.Next() {
+		document := model.Document{Grant: []string{login}}
+		if err := rows.Scan(
+			&document.UUID,
+			&document.Name,
+			&document.Mime,
+			&document.File,
+			&document.Public,
+			&document.CreateAt,
+			&document.Path,
+			&document.Version,
+			&document.Size,
+			&document.Hash,
+		); err != nil {
+			return nil, err
+		}
+		documents = append(documents, document)
+	}
+
+	return documents, rows.Err()
+}
+
+func (inst *User) scanUser(row pgx.Row) (*model.User, error) {
+	user := &model.User{}
+	if err := row.Scan(
+		&user.UUID,
+		&user.Login,
+		&user.Password,
+		&user.Role,
+		&user.Source,
+		&user.DisabledAt,
+		&user.CreateAt,
+		&user.DisplayName,
+		&user.Email,
+		&user.Locale,
+		&user.AvatarUUID,
+	); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// escapeLike makes value match itself in a LIKE pattern.
+func escapeLike(value string) string {
+	return likeEscaper.Replace(value)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
@@ -0,0 +1,355 @@
+package postgres
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// webhookRelay is the event_relays row of the webhook deliveries.
+const webhookRelay = "webhooks"
+
+type Webhook struct {
+	pool *pgxpool.Pool
+}
+
+func NewWebhook(pool *pgxpool.Pool) *Webhook {
+	return &Webhook{
+		pool: pool,
+	}
+}
+
+func (inst *Webhook) CreateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	sql := `INSERT INTO webhooks (uuid, user_login, url, secret, events, active, create_at) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	if _, err := inst.pool.Exec(
+		ctx,
+		sql,
+		webhook.UUID,
+		webhook.UserLogin,
+		webhook.URL,
+		webhook.Secret,
+		webhook.Events,
+		webhook.Active,
+		webhook.CreateAt,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (inst *Webhook) GetWebhookByUUID(ctx context.Context, uuid string) (*model.Webhook, error) {
+	webhook := &model.Webhook{}
+	sql := `SELECT uuid, user_login, url, secret, events, active, create_at FROM webhooks WHERE uuid = $1`
+
+	if err := inst.pool.QueryRow(ctx, sql, uuid).Scan(
+		&webhook.UUID,
+		&webhook.UserLogin,
+		&webhook.URL,
+		&webhook.Secret,
+		&webhook.Events,
+		&webhook.Active,
+		&webhook.CreateAt,
+	); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, utils.ErrorNotFound
+		}
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+// ListWebhooks returns the webhooks of login, or every webhook when login is empty.
+func (inst *Webhook) ListWebhooks(ctx context.Context, login string) ([]model.Webhook, error) {
+	sql := `SELECT uuid, user_login, url, secret, events, active, create_at FROM webhooks
+	WHERE $1 = '' OR user_login = $1
+	ORDER BY create_at`
+
+	rows, err := inst.pool.Query(ctx, sql, login)
+	if err != nil {
+		return nil, err
+	}
+
+	return inst.scanWebhooks(rows)
+}
+
+// QueueEventDeliveries queues the next limit events of the log after the
+// webhooks relay cursor for every active webhook subscribed to them whose
+// owner is not disabled and is an admin or could see them and still holds a
+// grant to the document (a deleted document has none left), and moves the
+// cursor past them. Events
+// are read in (txid, id) order up to the oldest running transaction, like
+// the change log. The cursor row is locked, while another instance relays
+// nothing is queued. It returns the number of events handed on.
+func (inst *Webhook) QueueEventDeliveries(ctx context.Context, limit int) (int, error) {
+	tx, err := inst.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var from model.ChangeCursor
+	sql := `SELECT txid::text::bigint, id FROM event_relays WHERE name = $1 FOR UPDATE SKIP LOCKED`
+	if err := tx.QueryRow(ctx, sql, webhookRelay).Scan(&from.TxID, &from.ID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	var (
+		to    model.ChangeCursor
+		count int
+	)
+	sql = `SELECT txid::text::bigint, id, count(*) OVER () FROM (
+		SELECT txid, id FROM events
+		WHERE (txid, id) > ($1::text::xid8, $2) AND txid < pg_snapshot_xmin(pg_current_snapshot())
+		ORDER BY txid, id
+		LIMIT $3
+	) AS page
+	ORDER BY txid DESC, id DESC
+	LIMIT 1`
+	if err := tx.QueryRow(ctx, sql, strconv.FormatUint(from.TxID, 10), from.ID, limit).Scan(&to.TxID, &to.ID, &count); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	sql = `INSERT INTO webhook_deliveries
+	(uuid, webhook_uuid, event_uuid, event, payload, status, attempts, next_attempt_at, create_at)
+	SELECT gen_random_uuid(), webhooks.uuid, events.uuid, events.type, events.payload, $5, 0, now(), now()
+	FROM events
+	JOIN webhooks ON webhooks.active AND events.type = ANY(webhooks.events)
+	JOIN users ON users.login = webhooks.user_login AND users.disabled_at IS NULL
+	WHERE (events.txid, events.id) > ($1::text::xid8, $2) AND (events.txid, events.id) <= ($3::text::xid8, $4)
+		AND (users.role = $6 OR webhooks.user_login = ANY(events.visibility) AND (
+			events.document_uuid IS NULL
+			OR NOT EXISTS (SELECT 1 FROM documents WHERE documents.uuid = events.document_uuid)
+			OR EXISTS (
+				SELECT 1 FROM document_grants
+				WHERE document_grants.document_uuid = events.document_uuid AND document_grants.user_login = webhooks.user_login
+			)
+		))
+	ORDER BY events.txid, events.id`
+	if _, err := tx.Exec(
+		ctx,
+		sql,
+		strconv.FormatUint(from.TxID, 10),
+		from.ID,
+		strconv.FormatUint(to.TxID, 10),
+		to.ID,
+		model.DeliveryPending,
+		model.RoleAdmin,
+	); err != nil {
+		return 0, err
+	}
+
+	sql = `UPDATE event_relays SET txid = $2::text::xid8, id = $3 WHERE name = $1`
+	if _, err := tx.Exec(ctx, sql, webhookRelay, strconv.FormatUint(to.TxID, 10), to.ID); err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit(ctx)
+}
+
+func (inst *Webhook) DeleteWebhook(ctx context.Context, uuid string) error {
+	sql := `DELETE FROM webhooks WHERE uuid = $1`
+
+	if _, err := inst.pool.Exec(ctx, sql, uuid); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (inst *Webhook) CreateDeliveries(ctx context.Context, deliveries []model.WebhookDelivery) error {
+	batch := &pgx.Batch{}
+	for _, delivery := range deliveries {
+		batch.Queue(
+			`INSERT INTO webhook_deliveries
+			(uuid, webhook_uuid, event_uuid, event, payload, status, attempts, next_attempt_at, create_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			delivery.UUID,
+			delivery.WebhookUUID,
+			delivery.EventUUID,
+			delivery.Event,
+			string(delivery.Payload),
+			delivery.Status,
+			delivery.Attempts,
+			delivery.NextAttemptAt,
+			delivery.CreateAt,
+		)
+	}
+
+	return inst.pool.SendBatch(ctx, batch).Close()
+}
+
+func (inst *Webhook) GetDeliveryByUUID(ctx context.Context, uuid string) (*model.WebhookDelivery, error) {
+	sql := inst.selectDeliveryQuery() + ` WHERE webhook_deliveries.uuid = $1`
+
+	rows, err := inst.pool.Query(ctx, sql, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries, err := inst.scanDeliveries(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(deliveries) == 0 {
+		return nil, utils.ErrorNotFound
+	}
+
+	return &deliveries[0], nil
+}
+
+// ListDeliveries returns the delivery log of a webhook, newest first. An
+// empty status returns every delivery.
+func (inst *Webhook) ListDeliveries(ctx context.Context, webhookUUID, status string, limit int) ([]model.WebhookDelivery, error) {
+	sql := inst.selectDeliveryQuery() + `
+	WHERE webhook_deliveries.webhook_uuid = $1 AND ($2 = '' OR webhook_deliveries.status = $2)
+	ORDER BY webhook_deliveries.create_at DESC
+	LIMIT $3`
+
+	rows, err := inst.pool.Query(ctx, sql, webhookUUID, status, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return inst.scanDeliveries(rows)
+}
+
+// ClaimDueDeliveries leases pending deliveries of active webhooks whose time
+// has come. The lease pushes next_attempt_at forward, so other instances skip
+// them and a crashed worker's deliveries are picked up again once it runs
+// out.
+func (inst *Webhook) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]model.WebhookDelivery, error) {
+	sql := `WITH due AS (
+		SELECT webhook_deliveries.uuid FROM webhook_deliveries
+		JOIN webhooks ON webhooks.uuid = webhook_deliveries.webhook_uuid AND webhooks.active
+		WHERE webhook_deliveries.status = $1 AND webhook_deliveries.next_attempt_at <= now()
+		ORDER BY webhook_deliveries.next_attempt_at
+		LIMIT $2
+		FOR UPDATE OF webhook_deliveries SKIP LOCKED
+	)
+	UPDATE webhook_deliveries SET next_attempt_at = now() + make_interval(secs => $3)
+	FROM due, webhooks
+	WHERE webhook_deliveries.uuid = due.uuid AND webhooks.uuid = webhook_deliveries.webhook_uuid
+	RETURNING ` + inst.deliveryColumns()
+
+	rows, err := inst.pool.Query(ctx, sql, model.DeliveryPending, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	return inst.scanDeliveries(rows)
+}
+
+func (inst *Webhook) UpdateDelivery(ctx context.Context, delivery *model.WebhookDelivery) error {
+	sql := `UPDATE webhook_deliveries
+	SET status = $1, attempts = $2, response_code = $3, last_error = $4, next_attempt_at = $5, delivered_at = $6
+	WHERE uuid = $7`
+
+	if _, err := inst.pool.Exec(
+		ctx,
+		sql,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.ResponseCode,
+		delivery.LastError,
+		delivery.NextAttemptAt,
+		delivery.DeliveredAt,
+		delivery.UUID,
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (inst *Webhook) scanWebhooks(rows pgx.Rows) ([]model.Webhook, error) {
+	defer rows.Close()
+
+	webhooks := make([]model.Webhook, 0)
+	for rows.Next() {
+		webhook := model.Webhook{}
+		if err := rows.Scan(
+			&webhook.UUID,
+			&webhook.UserLogin,
+			&webhook.URL,
+			&webhook.Secret,
+			&webhook.Events,
+			&webhook.Active,
+			&webhook.CreateAt,
+		); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+func (inst *Webhook) scanDeliveries(rows pgx.Rows) ([]model.WebhookDelivery, error) {
+	defer rows.Close()
+
+	deliveries := make([]model.WebhookDelivery, 0)
+	for rows.Next() {
+		delivery := model.WebhookDelivery{}
+		if err := rows.Scan(
+			&delivery.UUID,
+			&delivery.WebhookUUID,
+			&delivery.EventUUID,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.ResponseCode,
+			&delivery.LastError,
+			&delivery.NextAttemptAt,
+			&delivery.CreateAt,
+			&delivery.DeliveredAt,
+			&delivery.URL,
+			&delivery.Secret,
+		); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, rows.Err()
+}
+
+func (inst *Webhook) selectDeliveryQuery() string {
+	return `SELECT ` + inst.deliveryColumns() + `
+	FROM webhook_deliveries
+	JOIN webhooks ON webhooks.uuid = webhook_deliveries.webhook_uuid`
+}
+
+func (inst *Webhook) deliveryColumns() string {
+	return `
+		webhook_deliveries.uuid,
+		webhook_deliveries.webhook_uuid,
+		webhook_deliveries.event_uuid,
+		webhook_deliveries.event,
+		webhook_deliveries.payload,
+		webhook_deliveries.status,
+		webhook_deliveries.attempts,
+		webhook_deliveries.response_code,
+		webhook_deliveries.last_error,
+		webhook_deliveries.next_attempt_at,
+		webhook_deliveries.create_at,
+		webhook_deliveries.delivered_at,
+		webhooks.url,
+		webhooks.secret`
+}
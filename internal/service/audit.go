@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	auditPageSize = 1000
+	auditTimeout  = 10 * time.Second
+)
+
+// Audit writes the audit log and serves it to admins.
+type Audit struct {
+	log       *zap.Logger
+	auditRepo repository.AuditRepository
+}
+
+func NewAudit(log *zap.Logger, auditRepo repository.AuditRepository) *Audit {
+	return &Audit{
+		log:       log,
+		auditRepo: auditRepo,
+	}
+}
+
+// Stamp fills the request client and time of the event. A write passes the
+// stamped event of its success to the repository, which appends it in the
+// transaction of the change.
+func (inst *Audit) Stamp(ctx context.Context, event *model.AuditEvent) *model.AuditEvent {
+	client := utils.ClientFromContext(ctx)
+
+	event.UUID = uuid.NewString()
+	event.IP = client.IP
+	event.UserAgent = client.UserAgent
+	// postgres keeps microseconds, the hash must survive the round trip
+	event.CreateAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	return event
+}
+
+// Record stamps the event and appends it on its own before returning. Reads,
+// failures and actions without a transaction of their own are recorded this
+// way. The append outlives a cancelled request, a failed one is returned so
+// the audited call fails rather than going unrecorded.
+func (inst *Audit) Record(ctx context.Context, event *model.AuditEvent) error {
+	inst.Stamp(ctx, event)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), auditTimeout)
+	defer cancel()
+
+	if err := inst.auditRepo.AppendAuditEvent(ctx, event); err != nil {
+		inst.log.Error(
+			"append audit event",
+			zap.String("action", event.Action),
+			zap.String("actor", event.Actor),
+			zap.Error(err),
+		)
+		return fmt.Errorf("%w: %s", utils.ErrorAuditUnavailable, err.Error())
+	}
+
+	return nil
+}
+
+func (inst *Audit) ListAuditEvents(ctx context.Context, principal *model.Principal, filter *model.AuditFilter) ([]model.AuditEvent, error) {
+	if err := inst.checkAdmin(principal); err != nil {
+		return nil, err
+	}
+
+	return inst.auditRepo.ListAuditEvents(ctx, filter)
+}
+
+// VerifyAuditLog walks the whole chain and reports the first row whose hash
+// or link to the previous row does not match.
+func (inst *Audit) VerifyAuditLog(ctx context.Context, principal *model.Principal) (*model.AuditVerification, error) {
+	if err := inst.checkAdmin(principal); err != nil {
+		return nil, err
+	}
+
+	result := &model.AuditVerification{Valid: true}
+	filter := &model.AuditFilter{Limit: auditPageSize}
+	prevHash := ""
+
+	for {
+		events, err := inst.auditRepo.ListAuditEvents(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range events {
+			result.Checked++
+
+			if event.PrevHash != prevHash || event.ComputeHash() != event.Hash {
+				result.Valid = false
+				result.BrokenID = event.ID
+				return result, nil
+			}
+
+			prevHash = event.Hash
+			filter.After = event.ID
+		}
+
+		if len(events) < auditPageSize {
+			return result, nil
+		}
+	}
+}
+
+func (inst *Audit) checkAdmin(principal *model.Principal) error {
+	if !principal.IsAdmin() {
+		return utils.ErrorNoAccess
+	}
+
+	return nil
+}
+
+// auditResult is the outcome of an audited call, err unless only recording
+// it failed.
+func auditResult(err, auditErr error) error {
+	if err != nil {
+		return err
+	}
+
+	return auditErr
+}
+
+// newAuditEvent builds an audit event, err decides the outcome.
+func newAuditEvent(action, actor, sessionUUID, documentUUID string, err error) *model.AuditEvent {
+	event := &model.AuditEvent{
+		Actor:        actor,
+		Session:      sessionDigest(sessionUUID),
+		Action:       action,
+		DocumentUUID: documentUUID,
+		Outcome:      model.AuditSuccess,
+	}
+
+	if err != nil {
+		event.Outcome = model.AuditFailure
+		event.Detail = err.Error()
+	}
+
+	return event
+}
+
+// sessionDigest identifies a session in the audit log without exposing its
+// token.
+func sessionDigest(sessionUUID string) string {
+	if sessionUUID == "" {
+		return ""
+	}
+
+	sum := sha256.Sum256([]byte(sessionUUID))
+	return hex.EncodeToString(sum[:8])
+}
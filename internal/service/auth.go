@@ -2,72 +2,316 @@ package service
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"docs/internal/model"
 	"docs/internal/repository"
 	"docs/internal/utils"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
+// SessionOptions are the token lifetimes, see config.Session, the second
+// factor setup, see config.TOTP, and the brute-force policy.
+type SessionOptions struct {
+	AccessTTL       time.Duration
+	MaxTTL          time.Duration
+	RefreshTTL      time.Duration
+	JanitorInterval time.Duration
+	TOTPIssuer      string
+	ChallengeTTL    time.Duration
+	Lockout         LockoutOptions
+}
+
 type Auth struct {
-	log         *zap.Logger
-	sessionRepo repository.SessionRepository
-	userRepo    repository.UserRepository
+	log           *zap.Logger
+	sessionRepo   repository.SessionRepository
+	userRepo      repository.UserRepository
+	totpRepo      repository.TOTPRepository
+	apiKeyRepo    repository.APIKeyRepository
+	authenticator Authenticator
+	failureRepo   repository.LoginFailureRepository
+	auditor       Auditor
+	options       SessionOptions
+	jwt           *JWT
 }
 
-func NewAuth(log *zap.Logger, sessRepo repository.SessionRepository, userRepo repository.UserRepository) *Auth {
+// NewAuth issues session access tokens, or signed JWTs when jwt is set.
+func NewAuth(log *zap.Logger, sessRepo repository.SessionRepository, userRepo repository.UserRepository, totpRepo repository.TOTPRepository, apiKeyRepo repository.APIKeyRepository, authenticator Authenticator, failureRepo repository.LoginFailureRepository, auditor Auditor, options SessionOptions, jwt *JWT) *Auth {
 	return &Auth{
-		log:         log,
-		sessionRepo: sessRepo,
-		userRepo:    userRepo,
+		log:           log,
+		sessionRepo:   sessRepo,
+		userRepo:      userRepo,
+		totpRepo:      totpRepo,
+		apiKeyRepo:    apiKeyRepo,
+		authenticator: authenticator,
+		failureRepo:   failureRepo,
+		auditor:       auditor,
+		options:       options,
+		jwt:           jwt,
 	}
 }
 
-func (inst *Auth) Login(ctx context.Context, login, password string) (*model.AuthToken, error) {
-	user, err := inst.userRepo.GetUserByLogin(ctx, login)
-	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, utils.ErrorAuthFailed
+func (inst *Auth) Login(ctx context.Context, login, password string) (token *model.AuthToken, err error) {
+	defer func() {
+		var sessionUUID string
+		if token != nil {
+			sessionUUID = token.AccessToken
 		}
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditLogin, login, sessionUUID, "", err)))
+	}()
+
+	attempts, err := inst.reserveAttempt(ctx, login, utils.ClientFromContext(ctx).IP)
+	if err != nil {
 		return nil, err
 	}
 
-	if err := inst.validatePassword(password, user.Password); err != nil {
+	user, err := inst.authenticator.Authenticate(ctx, login, password)
+	if err != nil {
+		inst.finishAttempt(ctx, login, attempts, err)
+		return nil, err
+	}
+
+	token, err = inst.loginUser(ctx, user)
+	if err == nil && token.Challenge != "" {
+		// the password was right but the login is not over, the failures
+		// of the login stay until the second factor passes
+		inst.releaseAttempts(ctx, attempts)
+		return token, nil
+	}
+
+	inst.finishAttempt(ctx, login, attempts, nil)
+
+	return token, err
+}
+
+// loginUser finishes a login whose first factor passed: users with TOTP get
+// a challenge, everyone else a session.
+func (inst *Auth) loginUser(ctx context.Context, user *model.User) (*model.AuthToken, error) {
+	if user.Disabled() {
+		return nil, utils.ErrorUserDisabled
+	}
+
+	totp, err := inst.totpRepo.GetTOTP(ctx, user.UUID)
+	switch {
+	case err == nil && totp.Enabled:
+		return inst.createChallenge(ctx, user)
+	case err != nil && !errors.Is(err, utils.ErrorNotFound):
+		return nil, err
+	}
+
+	return inst.createSession(ctx, user)
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token pair.
+func (inst *Auth) Refresh(ctx context.Context, refreshToken string) (token *model.AuthToken, err error) {
+	var actor, sessionUUID string
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditRefresh, actor, sessionUUID, "", err)))
+	}()
+
+	if refreshToken == "" {
 		return nil, utils.ErrorAuthFailed
 	}
 
-	return inst.createSession(ctx, user.UUID, user.Login)
+	err = inst.sessionRepo.RotateRefreshToken(ctx, hashToken(refreshToken), func(used *model.RefreshToken) (*model.Session, *model.RefreshToken, error) {
+		actor = used.UserLogin
+
+		// The role is read again so that a JWT never outlives a role change
+		// by more than one access token lifetime.
+		user, err := inst.userRepo.GetUserByUUID(ctx, used.UserUUID)
+		if err != nil {
+			return nil, nil, utils.ErrorAuthFailed
+		}
+
+		session, refresh, next, err := inst.newSession(ctx, user, used.FamilyUUID)
+		if err != nil {
+			return nil, nil, err
+		}
+		token, sessionUUID = next, next.AccessToken
+
+		return session, refresh, nil
+	})
+	if err != nil {
+		if errors.Is(err, utils.ErrorRefreshReused) {
+			inst.log.Warn("refresh token reuse detected")
+		}
+		return nil, err
+	}
+
+	return token, nil
 }
 
-func (inst *Auth) Logout(ctx context.Context, token string) error {
+// Logout ends the session, its refresh tokens are revoked along with it.
+func (inst *Auth) Logout(ctx context.Context, token string) (err error) {
+	var actor string
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditLogout, actor, token, "", err)))
+	}()
+
 	session, err := inst.sessionRepo.GetSessionByUUID(ctx, token)
 	if err != nil {
 		return utils.ErrorNotFound
 	}
+	actor = session.UserLogin
+
+	if session.FamilyUUID != "" {
+		return inst.sessionRepo.RevokeFamily(ctx, session.FamilyUUID)
+	}
 
 	return inst.sessionRepo.DeleteSession(ctx, session.UUID)
 }
 
-func (inst *Auth) validatePassword(received, actual string) error {
-	return bcrypt.CompareHashAndPassword([]byte(actual), []byte(received))
+// Authenticate resolves an access token into the principal it stands for.
+func (inst *Auth) Authenticate(ctx context.Context, token string) (*model.Principal, error) {
+	if token == "" {
+		return nil, utils.ErrorAuthFailed
+	}
+
+	if IsAPIKey(token) {
+		return inst.authenticateAPIKey(ctx, token)
+	}
+
+	session, err := inst.sessionRepo.GetSessionByUUID(ctx, token)
+	if err != nil {
+		return nil, utils.ErrorAuthFailed
+	}
+
+	return session.Principal(), nil
 }
 
-func (inst *Auth) createSession(ctx context.Context, userUUID, userLogin string) (*model.AuthToken, error) {
-	sessionUUID := uuid.NewString()
+// Run purges expired sessions, refresh tokens and stale login failures
+// until ctx is done.
+func (inst *Auth) Run(ctx context.Context) {
+	ticker := time.NewTicker(inst.options.JanitorInterval)
+	defer ticker.Stop()
 
-	if err := inst.sessionRepo.CreateSession(ctx, &model.Session{
-		UUID:      sessionUUID,
-		UserUUID:  userUUID,
-		UserLogin: userLogin,
-	}); err != nil {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sessions, tokens, err := inst.sessionRepo.DeleteExpired(ctx)
+		if err != nil {
+			inst.log.Error("purge expired sessions", zap.Error(err))
+			continue
+		}
+
+		inst.log.Debug("purged expired sessions", zap.Int64("sessions", sessions), zap.Int64("refresh_tokens", tokens))
+
+		failures, err := inst.failureRepo.PurgeLoginFailures(ctx, time.Now().Add(-inst.options.Lockout.Window))
+		if err != nil {
+			inst.log.Error("purge login failures", zap.Error(err))
+			continue
+		}
+
+		inst.log.Debug("purged login failures", zap.Int64("login_failures", failures))
+	}
+}
+
+func (inst *Auth) createSession(ctx context.Context, user *model.User) (*model.AuthToken, error) {
+	session, refresh, token, err := inst.newSession(ctx, user, uuid.NewString())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := inst.sessionRepo.CreateSessionWithRefresh(ctx, session, refresh); err != nil {
 		return nil, err
 	}
 
-	return &model.AuthToken{
-		AccessToken: sessionUUID,
-	}, nil
+	return token, nil
+}
+
+// newSession builds an access session of the family and the refresh token
+// issued with it, recording the client of the request. In JWT mode the
+// access token is signed instead and the session is stateless.
+func (inst *Auth) newSession(ctx context.Context, user *model.User, familyUUID string) (*model.Session, *model.RefreshToken, *model.AuthToken, error) {
+	if user.Disabled() {
+		return nil, nil, nil, utils.ErrorUserDisabled
+	}
+
+	now := time.Now()
+	client := utils.ClientFromContext(ctx)
+	session := &model.Session{
+		UUID:         uuid.NewString(),
+		UserUUID:     user.UUID,
+		UserLogin:    user.Login,
+		UserRole:     user.Role,
+		FamilyUUID:   familyUUID,
+		IdleTTL:      inst.options.AccessTTL,
+		ExpiresAt:    now.Add(inst.options.AccessTTL),
+		MaxExpiresAt: now.Add(inst.options.MaxTTL),
+		CreateAt:     now,
+		LastSeenAt:   now,
+		IP:           client.IP,
+		UserAgent:    client.UserAgent,
+	}
+
+	refreshToken, err := generateToken()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	refresh := &model.RefreshToken{
+		Hash:        hashToken(refreshToken),
+		FamilyUUID:  familyUUID,
+		SessionUUID: session.UUID,
+		UserUUID:    user.UUID,
+		UserLogin:   user.Login,
+		ExpiresAt:   now.Add(inst.options.RefreshTTL),
+		CreateAt:    now,
+	}
+
+	token := &model.AuthToken{
+		AccessToken:  session.UUID,
+		RefreshToken: refreshToken,
+		ExpiresAt:    session.ExpiresAt,
+	}
+
+	if inst.jwt == nil {
+		return session, refresh, token, nil
+	}
+
+	accessToken, err := inst.jwt.Sign(&jwtClaims{
+		ID:        session.UUID,
+		Subject:   user.UUID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: session.ExpiresAt.Unix(),
+		Login:     user.Login,
+		Role:      user.Role,
+		Scope:     strings.Join(model.RoleScopes(user.Role), " "),
+		Family:    familyUUID,
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	token.AccessToken = accessToken
+	session.Stateless = true
+
+	return session, refresh, token, nil
+}
+
+// generateToken returns a random url-safe token. It fails rather than hand
+// out a token the system random source could not fill.
+func generateToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken is how tokens are stored, only their SHA-256 is kept.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// apiKeyPrefix starts every API key, it tells keys from session tokens.
+	apiKeyPrefix = "dk_"
+	// apiKeyPrefixLen is how much of a key is kept to identify it.
+	apiKeyPrefixLen = len(apiKeyPrefix) + 8
+	// apiKeyNameMaxLen matches api_keys.name.
+	apiKeyNameMaxLen = 100
+)
+
+// IsAPIKey reports whether the token looks like an API key.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+// CreateAPIKey issues a key of the principal with a subset of its scopes. The
+// plain key is returned once in Token. API keys can not create keys.
+func (inst *Auth) CreateAPIKey(ctx context.Context, principal *model.Principal, key *model.APIKey) (_ *model.APIKey, err error) {
+	defer func() {
+		event := newAuditEvent(model.AuditAPIKeyCreate, principal.Login, principal.SessionUUID, "", err)
+		if key != nil {
+			event.Target = key.UUID
+		}
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if principal.APIKey {
+		return nil, utils.ErrorNoAccess
+	}
+
+	if err := inst.validateAPIKey(principal, key); err != nil {
+		return nil, err
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token := apiKeyPrefix + secret
+	key.UUID = uuid.NewString()
+	key.Token = token
+	key.Hash = hashToken(token)
+	key.Prefix = token[:apiKeyPrefixLen]
+	key.UserUUID = principal.UserUUID
+	key.UserLogin = principal.Login
+	key.CreateAt = time.Now()
+
+	if err := inst.apiKeyRepo.CreateAPIKey(ctx, key); err != nil {
+		inst.log.Error("create api key", zap.String("login", principal.Login), zap.Error(err))
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func (inst *Auth) ListAPIKeys(ctx context.Context, principal *model.Principal) ([]model.APIKey, error) {
+	if principal.APIKey {
+		return nil, utils.ErrorNoAccess
+	}
+
+	return inst.apiKeyRepo.ListAPIKeys(ctx, principal.UserUUID)
+}
+
+// RevokeAPIKey deletes a key of the principal, it stops working at once.
+func (inst *Auth) RevokeAPIKey(ctx context.Context, principal *model.Principal, keyUUID string) (err error) {
+	defer func() {
+		event := newAuditEvent(model.AuditAPIKeyRevoke, principal.Login, principal.SessionUUID, "", err)
+		event.Target = keyUUID
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if principal.APIKey {
+		return utils.ErrorNoAccess
+	}
+
+	if err := uuid.Validate(keyUUID); err != nil {
+		return utils.ErrorNotFound
+	}
+
+	return inst.apiKeyRepo.DeleteAPIKey(ctx, principal.UserUUID, keyUUID)
+}
+
+// authenticateAPIKey resolves a key used from the client address of ctx and
+// records its use.
+func (inst *Auth) authenticateAPIKey(ctx context.Context, token string) (*model.Principal, error) {
+	key, err := inst.apiKeyRepo.GetAPIKeyByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil, utils.ErrorAuthFailed
+	}
+
+	if !key.AllowsIP(utils.ClientFromContext(ctx).IP) {
+		return nil, utils.ErrorAuthFailed
+	}
+
+	if err := inst.apiKeyRepo.TouchAPIKey(ctx, key.UUID); err != nil {
+		inst.log.Warn("touch api key", zap.String("prefix", key.Prefix), zap.Error(err))
+	}
+
+	return key.Principal(), nil
+}
+
+// validateAPIKey checks the requested name, scopes, expiry and allowlist and
+// normalizes the allowlist to prefixes.
+func (inst *Auth) validateAPIKey(principal *model.Principal, key *model.APIKey) error {
+	key.Name = strings.TrimSpace(key.Name)
+	if key.Name == "" || len(key.Name) > apiKeyNameMaxLen {
+		return fmt.Errorf("%w: name must be 1 to %d characters", utils.ErrorInvalidAPIKey, apiKeyNameMaxLen)
+	}
+
+	if len(key.Scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", utils.ErrorInvalidAPIKey)
+	}
+
+	for _, scope := range key.Scopes {
+		if !slices.Contains(model.Scopes, scope) {
+			return fmt.Errorf("%w: unknown scope %q", utils.ErrorInvalidAPIKey, scope)
+		}
+		if !principal.HasScope(scope) {
+			return fmt.Errorf("%w: scope %q is not granted to you", utils.ErrorInvalidAPIKey, scope)
+		}
+	}
+	slices.Sort(key.Scopes)
+	key.Scopes = slices.Compact(key.Scopes)
+
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: expires_at must be in the future", utils.ErrorInvalidAPIKey)
+	}
+
+	allowed := make([]string, 0, len(key.AllowedIPs))
+	for _, ip := range key.AllowedIPs {
+		prefix, err := parseIPPrefix(ip)
+		if err != nil {
+			return fmt.Errorf("%w: bad allowed ip %q", utils.ErrorInvalidAPIKey, ip)
+		}
+		allowed = append(allowed, prefix.String())
+	}
+	key.AllowedIPs = allowed
+
+	return nil
+}
+
+// parseIPPrefix accepts an address or a CIDR, an address is a prefix of its
+// full length.
+func parseIPPrefix(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
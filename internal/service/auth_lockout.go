@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// LockoutOptions is the brute-force policy, see config.Lockout.
+type LockoutOptions struct {
+	MaxFailures   int
+	IPMaxFailures int
+	BaseDelay     time.Duration
+	MaxDelay      time.Duration
+	Duration      time.Duration
+	Window        time.Duration
+}
+
+// reserveAttempt counts a login attempt against its login and client
+// address before the password is checked, and refuses it while either is
+// blocked. A blocked client costs no password hashing, and parallel
+// attempts can't all slip in before the first failure is recorded.
+//
+// The attempt is counted as failed up front: each one of a login delays the
+// next twice as long, MaxFailures within the window lock it out for
+// Duration; an address is only locked out, after IPMaxFailures. finishAttempt
+// settles the attempt once the password is checked.
+func (inst *Auth) reserveAttempt(ctx context.Context, login, ip string) ([]lockoutAttempt, error) {
+	options := inst.options.Lockout
+	attempts := make([]lockoutAttempt, 0, 2)
+
+	for _, key := range lockoutKeys(login, ip) {
+		// the block this attempt sets, a release lifts only that one
+		var blocked *time.Time
+		failure, err := inst.failureRepo.ReserveLoginAttempt(ctx, key.kind, key.key, func(failure *model.LoginFailure) error {
+			now := time.Now()
+			if retryAfter := failure.RetryAfter(now); retryAfter > 0 {
+				return &utils.RetryAfterError{Err: utils.ErrorTooManyAttempts, After: retryAfter}
+			}
+
+			if failure.LastFailureAt.Before(now.Add(-options.Window)) {
+				failure.Failures, failure.Locked = 0, false
+			}
+			failure.Failures++
+			failure.LastFailureAt = now
+
+			limit := options.MaxFailures
+			if key.kind == model.LoginFailureIP {
+				limit = options.IPMaxFailures
+			}
+
+			var until time.Time
+			switch {
+			case failure.Failures >= limit:
+				until, failure.Locked = now.Add(options.Duration), true
+			case key.kind == model.LoginFailureLogin:
+				until = now.Add(min(options.BaseDelay<<min(failure.Failures-1, 30), options.MaxDelay))
+			default:
+				return nil
+			}
+			failure.BlockedUntil, blocked = &until, &until
+
+			return nil
+		})
+		if err != nil {
+			// the keys reserved so far were not tried
+			inst.releaseAttempts(ctx, attempts)
+			return nil, err
+		}
+
+		attempts = append(attempts, lockoutAttempt{lockoutKey: key, failures: failure.Failures, locked: failure.Locked, blockedUntil: blocked})
+	}
+
+	return attempts, nil
+}
+
+// finishAttempt settles the attempts reserved for a login by the outcome of
+// the password or second factor check. A failed one keeps them and audits every lockout
+// it caused. A success forgets the failures of the login and takes back the
+// one of the address, one known password must not clear a spraying client.
+// Any other error, the password was not judged, takes them all back.
+func (inst *Auth) finishAttempt(ctx context.Context, login string, attempts []lockoutAttempt, err error) {
+	switch {
+	case errors.Is(err, utils.ErrorAuthFailed):
+		for _, attempt := range attempts {
+			if !attempt.locked {
+				continue
+			}
+
+			inst.log.Warn("login locked out", zap.String("kind", attempt.kind), zap.String("key", attempt.key), zap.Int("failures", attempt.failures))
+			event := newAuditEvent(model.AuditLoginLockout, login, "", "", nil)
+			event.Target = attempt.kind + ":" + attempt.key
+			// the login fails anyway, Record logs a failed append
+			inst.auditor.Record(ctx, event)
+		}
+	case err == nil:
+		for _, attempt := range attempts {
+			if attempt.kind == model.LoginFailureLogin {
+				if _, err := inst.failureRepo.ResetLoginFailures(ctx, attempt.kind, attempt.key); err != nil {
+					inst.log.Error("reset login failures", zap.Error(err))
+				}
+				continue
+			}
+			inst.releaseAttempts(ctx, []lockoutAttempt{attempt})
+		}
+	default:
+		inst.releaseAttempts(ctx, attempts)
+	}
+}
+
+func (inst *Auth) releaseAttempts(ctx context.Context, attempts []lockoutAttempt) {
+	for _, attempt := range attempts {
+		if err := inst.failureRepo.ReleaseLoginAttempt(ctx, attempt.kind, attempt.key, attempt.blockedUntil); err != nil {
+			inst.log.Error("release login attempt", zap.String("kind", attempt.kind), zap.Error(err))
+		}
+	}
+}
+
+// UnlockLogin lifts the lockout or delay of a login, admin only.
+func (inst *Auth) UnlockLogin(ctx context.Context, principal *model.Principal, login string) (err error) {
+	defer func() {
+		event := newAuditEvent(model.AuditLoginUnlock, principal.Login, principal.SessionUUID, "", err)
+		event.Target = login
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if !principal.IsAdmin() {
+		return utils.ErrorNoAccess
+	}
+
+	if _, err := inst.failureRepo.ResetLoginFailures(ctx, model.LoginFailureLogin, login); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type lockoutKey struct {
+	kind string
+	key  string
+}
+
+// lockoutAttempt is a reserved attempt, the count it brought its key to and
+// the block it set.
+type lockoutAttempt struct {
+	lockoutKey
+	failures     int
+	locked       bool
+	blockedUntil *time.Time
+}
+
+// lockoutKeys are what a login attempt is counted against, requests without
+// a client address only against the login.
+func lockoutKeys(login, ip string) []lockoutKey {
+	keys := []lockoutKey{{kind: model.LoginFailureLogin, key: login}}
+	if ip != "" {
+		keys = append(keys, lockoutKey{kind: model.LoginFailureIP, key: ip})
+	}
+
+	return keys
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+
+	"go.uber.org/zap"
+)
+
+// ListSessions returns the logins of the user, one per session family. An
+// empty login means the principal's own, other users need an admin.
+func (inst *Auth) ListSessions(ctx context.Context, principal *model.Principal, login string) ([]model.Session, error) {
+	login, err := inst.sessionsOwner(principal, login)
+	if err != nil {
+		return nil, err
+	}
+
+	return inst.sessionRepo.ListSessionFamilies(ctx, login)
+}
+
+// RevokeSession logs the user out of one session family.
+func (inst *Auth) RevokeSession(ctx context.Context, principal *model.Principal, login, familyUUID string) (err error) {
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditSessionRevoke, principal.Login, principal.SessionUUID, "", err)))
+	}()
+
+	login, err = inst.sessionsOwner(principal, login)
+	if err != nil {
+		return err
+	}
+
+	family, err := inst.sessionRepo.GetSessionFamily(ctx, familyUUID)
+	if err != nil {
+		return err
+	}
+
+	if family.UserLogin != login {
+		return utils.ErrorNotFound
+	}
+
+	return inst.sessionRepo.RevokeFamily(ctx, familyUUID)
+}
+
+// RevokeOtherSessions logs the user out everywhere except the session of the
+// principal and returns how many session families were ended.
+func (inst *Auth) RevokeOtherSessions(ctx context.Context, principal *model.Principal, login string) (revoked int, err error) {
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditSessionRevoke, principal.Login, principal.SessionUUID, "", err)))
+	}()
+
+	login, err = inst.sessionsOwner(principal, login)
+	if err != nil {
+		return 0, err
+	}
+
+	keep := ""
+	if login == principal.Login {
+		keep = principal.FamilyUUID
+	}
+
+	count, err := inst.sessionRepo.RevokeUserFamilies(ctx, login, keep)
+	if err != nil {
+		inst.log.Error("revoke session families", zap.String("login", login), zap.Error(err))
+		return 0, err
+	}
+
+	return int(count), nil
+}
+
+func (inst *Auth) sessionsOwner(principal *model.Principal, login string) (string, error) {
+	if login == "" || login == principal.Login {
+		return principal.Login, nil
+	}
+
+	if !principal.IsAdmin() {
+		return "", utils.ErrorNoAccess
+	}
+
+	return login, nil
+}
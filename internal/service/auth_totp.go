@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"time"
+)
+
+const (
+	// recoveryCodeCount is how many recovery codes enabling TOTP hands out.
+	recoveryCodeCount = 10
+	// challengeAttempts bounds the codes tried against one login challenge,
+	// across challenges they count against the lockout of the login.
+	challengeAttempts = 5
+)
+
+// LoginTOTP exchanges a login challenge and a TOTP or recovery code for a
+// session. The challenge stops working after a few wrong codes, and every
+// wrong code is a failed attempt of the login like a wrong password: new
+// challenges don't get the login new tries.
+func (inst *Auth) LoginTOTP(ctx context.Context, challengeToken, code string) (token *model.AuthToken, err error) {
+	var actor, sessionUUID string
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditLoginTOTP, actor, sessionUUID, "", err)))
+	}()
+
+	if challengeToken == "" {
+		return nil, utils.ErrorAuthFailed
+	}
+
+	hash := hashToken(challengeToken)
+	challenge, err := inst.totpRepo.AttemptLoginChallenge(ctx, hash, challengeAttempts)
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return nil, utils.ErrorAuthFailed
+		}
+		return nil, err
+	}
+
+	user, err := inst.userRepo.GetUserByUUID(ctx, challenge.UserUUID)
+	if err != nil {
+		return nil, utils.ErrorAuthFailed
+	}
+	actor = user.Login
+
+	attempts, err := inst.reserveAttempt(ctx, user.Login, utils.ClientFromContext(ctx).IP)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := inst.checkSecondFactor(ctx, user.UUID, code)
+	if err == nil && !ok {
+		err = utils.ErrorAuthFailed
+	}
+	inst.finishAttempt(ctx, user.Login, attempts, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := inst.totpRepo.DeleteLoginChallenge(ctx, hash); err != nil {
+		return nil, err
+	}
+
+	if token, err = inst.createSession(ctx, user); err != nil {
+		return nil, err
+	}
+	sessionUUID = token.AccessToken
+
+	return token, nil
+}
+
+// EnrollTOTP creates a new secret for the principal. It stays pending until
+// VerifyTOTP, enrolling again replaces a pending secret.
+func (inst *Auth) EnrollTOTP(ctx context.Context, principal *model.Principal) (*model.TOTPEnrollment, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := inst.totpRepo.SavePendingTOTP(ctx, &model.TOTP{
+		UserUUID: principal.UserUUID,
+		Secret:   secret,
+		CreateAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return &model.TOTPEnrollment{
+		Secret: secret,
+		URI:    totpURI(inst.options.TOTPIssuer, principal.Login, secret),
+	}, nil
+}
+
+// VerifyTOTP turns the pending second factor on with a first valid code and
+// returns the recovery codes, they are shown only this once.
+func (inst *Auth) VerifyTOTP(ctx context.Context, principal *model.Principal, code string) (_ []string, err error) {
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditTOTPEnable, principal.Login, principal.SessionUUID, "", err)))
+	}()
+
+	totp, err := inst.totpRepo.GetTOTP(ctx, principal.UserUUID)
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return nil, utils.ErrorTOTPNotEnrolled
+		}
+		return nil, err
+	}
+
+	if totp.Enabled {
+		return nil, utils.ErrorTOTPEnabled
+	}
+
+	step, ok := matchTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return nil, utils.ErrorInvalidOTP
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		if codes[i], err = newRecoveryCode(); err != nil {
+			return nil, err
+		}
+		hashes[i] = hashToken(codes[i])
+	}
+
+	if err := inst.totpRepo.EnableTOTP(ctx, principal.UserUUID, step, hashes); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTOTP turns the second factor off, a valid TOTP or recovery code is
+// required.
+func (inst *Auth) DisableTOTP(ctx context.Context, principal *model.Principal, code string) (err error) {
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditTOTPDisable, principal.Login, principal.SessionUUID, "", err)))
+	}()
+
+	ok, err := inst.checkSecondFactor(ctx, principal.UserUUID, code)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return utils.ErrorInvalidOTP
+	}
+
+	return inst.totpRepo.DeleteTOTP(ctx, principal.UserUUID)
+}
+
+// checkSecondFactor accepts a TOTP code of a step not used before or an
+// unused recovery code, which is used up.
+func (inst *Auth) checkSecondFactor(ctx context.Context, userUUID, code string) (bool, error) {
+	totp, err := inst.totpRepo.GetTOTP(ctx, userUUID)
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return false, utils.ErrorTOTPNotEnrolled
+		}
+		return false, err
+	}
+
+	if !totp.Enabled {
+		return false, utils.ErrorTOTPNotEnrolled
+	}
+
+	if step, ok := matchTOTP(totp.Secret, code, time.Now()); ok {
+		return inst.totpRepo.UseTOTPStep(ctx, userUUID, step)
+	}
+
+	return inst.totpRepo.UseRecoveryCode(ctx, userUUID, hashToken(normalizeRecoveryCode(code)))
+}
+
+// createChallenge starts the second step of a login.
+func (inst *Auth) createChallenge(ctx context.Context, user *model.User) (*model.AuthToken, error) {
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	challenge := &model.LoginChallenge{
+		Hash:      hashToken(token),
+		UserUUID:  user.UUID,
+		ExpiresAt: now.Add(inst.options.ChallengeTTL),
+		CreateAt:  now,
+	}
+
+	if err := inst.totpRepo.CreateLoginChallenge(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	return &model.AuthToken{
+		Challenge: token,
+		ExpiresAt: challenge.ExpiresAt,
+	}, nil
+}
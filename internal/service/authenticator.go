@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"errors"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// Authenticator checks the login and password of Auth.Login and returns the
+// user they belong to. Wrong credentials are ErrorAuthFailed.
+type Authenticator interface {
+	Authenticate(ctx context.Context, login, password string) (*model.User, error)
+}
+
+// PasswordAuthenticator checks the password hash stored with the user. A
+// bcrypt hash, or one with outdated argon2id parameters, is replaced by a
+// current one once the password matched it.
+type PasswordAuthenticator struct {
+	log             *zap.Logger
+	userRepo        repository.UserRepository
+	hasher          *PasswordHasher
+	unknownUserHash func() string
+}
+
+func NewPasswordAuthenticator(log *zap.Logger, userRepo repository.UserRepository, hasher *PasswordHasher) *PasswordAuthenticator {
+	return &PasswordAuthenticator{
+		log:      log,
+		userRepo: userRepo,
+		hasher:   hasher,
+		// checked against for logins that don't exist
+		unknownUserHash: sync.OnceValue(func() string {
+			// without a hash the check fails fast, but it fails
+			secret, err := generateToken()
+			if err != nil {
+				log.Error("generate unknown user secret", zap.Error(err))
+				return ""
+			}
+			hash, _ := hasher.Hash(secret)
+			return hash
+		}),
+	}
+}
+
+func (inst *PasswordAuthenticator) Authenticate(ctx context.Context, login, password string) (*model.User, error) {
+	user, err := inst.userRepo.GetUserByLogin(ctx, login)
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			// spend the time of a real check, so timing doesn't tell
+			// which logins exist
+			inst.hasher.Compare(inst.unknownUserHash(), password)
+			return nil, utils.ErrorAuthFailed
+		}
+		return nil, err
+	}
+
+	if err := inst.hasher.Compare(user.Password, password); err != nil {
+		return nil, utils.ErrorAuthFailed
+	}
+
+	inst.rehash(ctx, user, password)
+
+	return user, nil
+}
+
+// rehash upgrades the stored hash of a matched password. A failure only
+// leaves the old hash in place, the login goes on.
+func (inst *PasswordAuthenticator) rehash(ctx context.Context, user *model.User, password string) {
+	if !inst.hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	hash, err := inst.hasher.Hash(password)
+	if err != nil {
+		inst.log.Error("rehash password", zap.String("login", user.Login), zap.Error(err))
+		return
+	}
+
+	if err := inst.userRepo.UpdatePassword(ctx, user.UUID, hash); err != nil {
+		inst.log.Error("rehash password", zap.String("login", user.Login), zap.Error(err))
+		return
+	}
+	user.Password = hash
+
+	inst.log.Info("password rehashed", zap.String("login", user.Login))
+}
+
+// Authenticators tries each authenticator in turn, the first to accept the
+// credentials wins. An unknown user is not a reason to stop, the next
+// authenticator may know it.
+type Authenticators []Authenticator
+
+func (inst Authenticators) Authenticate(ctx context.Context, login, password string) (*model.User, error) {
+	for _, authenticator := range inst {
+		user, err := authenticator.Authenticate(ctx, login, password)
+		switch {
+		case err == nil:
+			return user, nil
+		case errors.Is(err, utils.ErrorAuthFailed), errors.Is(err, utils.ErrorNotFound):
+			continue
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, utils.ErrorAuthFailed
+}
+
+// mapRole returns admin when one of the groups maps to it, otherwise user.
+func mapRole(groups []string, mapping map[string]string) string {
+	for _, group := range groups {
+		if mapping[group] == model.RoleAdmin {
+			return model.RoleAdmin
+		}
+	}
+
+	return model.RoleUser
+}
+
+// syncRole stores role as the role of an externally managed user.
+func syncRole(ctx context.Context, log *zap.Logger, userRepo repository.UserRepository, user *model.User, role string) error {
+	if role == user.Role {
+		return nil
+	}
+
+	if err := userRepo.UpdateRole(ctx, user.UUID, role, nil); err != nil {
+		return err
+	}
+	log.Info("role changed by directory groups", zap.String("login", user.Login), zap.String("role", role))
+	user.Role = role
+
+	return nil
+}
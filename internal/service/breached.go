@@ -0,0 +1,67 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// breachedPrefixLen is how much of the SHA-1 names a range file.
+const breachedPrefixLen = 5
+
+// BreachedPasswords looks passwords up in a local copy of a k-anonymity
+// breached password list, as the Pwned Passwords range API serves it: the
+// file <dir>/<first 5 hex of the SHA-1>.txt holds lines of the remaining 35
+// hex and a count, SUFFIX:COUNT, or the suffix alone. A missing file has no
+// breached passwords, padding lines with a count of 0 are skipped.
+type BreachedPasswords struct {
+	dir string
+}
+
+func NewBreachedPasswords(dir string) (*BreachedPasswords, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("breached passwords: %w", err)
+	}
+
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached passwords: %s is not a directory", dir)
+	}
+
+	return &BreachedPasswords{
+		dir: dir,
+	}, nil
+}
+
+func (inst *BreachedPasswords) Breached(ctx context.Context, password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:breachedPrefixLen], hash[breachedPrefixLen:]
+
+	file, err := os.Open(filepath.Join(inst.dir, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lineSuffix, count, found := strings.Cut(line, ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return !found || strings.TrimLeft(count, "0") != "", nil
+		}
+	}
+
+	return false, scanner.Err()
+}
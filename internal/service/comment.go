@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const MaxCommentLength = 10000
+
+// eventComment is the comment part of a comment event payload.
+type eventComment struct {
+	ID         string               `json:"id"`
+	ParentID   *string              `json:"parent_id,omitempty"`
+	Login      string               `json:"login"`
+	Body       string               `json:"body,omitempty"`
+	Anchor     *model.CommentAnchor `json:"anchor,omitempty"`
+	Resolved   bool                 `json:"resolved"`
+	ResolvedBy *string              `json:"resolved_by,omitempty"`
+}
+
+// Comment manages the discussion threads of documents. Everyone with a grant
+// on the document can read, write and resolve comments, only the author can
+// edit a comment and only the author or an admin can delete it.
+type Comment struct {
+	log         *zap.Logger
+	commentRepo repository.CommentRepository
+	docsRepo    repository.DocumentRepository
+	grantRepo   repository.GrantRepository
+	auditor     Auditor
+}
+
+func NewComment(log *zap.Logger, commentRepo repository.CommentRepository, docsRepo repository.DocumentRepository, grantRepo repository.GrantRepository, auditor Auditor) *Comment {
+	return &Comment{
+		log:         log,
+		commentRepo: commentRepo,
+		docsRepo:    docsRepo,
+		grantRepo:   grantRepo,
+		auditor:     auditor,
+	}
+}
+
+func (inst *Comment) ListComments(ctx context.Context, documentUUID string, principal *model.Principal) (_ []model.Comment, err error) {
+	var actor string
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditCommentList, actor, principal.SessionUUID, documentUUID, err)))
+	}()
+
+	actor = principal.Login
+
+	if err := inst.checkAccess(ctx, documentUUID, principal); err != nil {
+		return nil, err
+	}
+
+	return inst.commentRepo.ListComments(ctx, documentUUID)
+}
+
+func (inst *Comment) CreateComment(ctx context.Context, documentUUID string, principal *model.Principal, comment *model.Comment) (err error) {
+	var actor string
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditCommentCreate, actor, principal.SessionUUID, documentUUID, err))
+		}
+	}()
+
+	actor = principal.Login
+
+	if err := inst.checkAccess(ctx, documentUUID, principal); err != nil {
+		return err
+	}
+
+	if err := inst.validateBody(comment.Body); err != nil {
+		return err
+	}
+
+	if err := inst.validateAnchor(comment.Anchor); err != nil {
+		return err
+	}
+
+	if comment.ParentUUID != nil {
+		parent, err := inst.commentRepo.GetCommentByUUID(ctx, *comment.ParentUUID)
+		if err != nil {
+			if errors.Is(err, utils.ErrorNotFound) {
+				return fmt.Errorf("%w: parent comment not found", utils.ErrorInvalidComment)
+			}
+			return err
+		}
+
+		if parent.DocumentUUID != documentUUID {
+			return fmt.Errorf("%w: parent comment belongs to another document", utils.ErrorInvalidComment)
+		}
+	}
+
+	now := time.Now()
+	comment.UUID = uuid.NewString()
+	comment.DocumentUUID = documentUUID
+	comment.UserLogin = principal.Login
+	comment.Resolved = false
+	comment.ResolvedBy = nil
+	comment.ResolvedAt = nil
+	comment.CreateAt = now
+	comment.UpdateAt = now
+
+	event, err := inst.newCommentEvent(ctx, model.EventCommentCreated, principal.Login, comment)
+	if err != nil {
+		return err
+	}
+
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditCommentCreate, actor, principal.SessionUUID, documentUUID, nil))
+	if err := inst.commentRepo.CreateComment(ctx, comment, audit, event); err != nil {
+		inst.log.Error("create comment", zap.String("document", documentUUID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+func (inst *Comment) UpdateComment(ctx context.Context, documentUUID, commentUUID string, principal *model.Principal, patch *model.CommentPatch) (_ *model.Comment, err error) {
+	var actor string
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditCommentUpdate, actor, principal.SessionUUID, documentUUID, err))
+		}
+	}()
+
+	actor = principal.Login
+
+	if err := inst.checkAccess(ctx, documentUUID, principal); err != nil {
+		return nil, err
+	}
+
+	comment, err := inst.fetchComment(ctx, documentUUID, commentUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.UserLogin != principal.Login {
+		return nil, utils.ErrorNoAccess
+	}
+
+	if patch.Body != nil {
+		if err := inst.validateBody(*patch.Body); err != nil {
+			return nil, err
+		}
+		comment.Body = *patch.Body
+	}
+
+	if patch.Anchor != nil {
+		if patch.Anchor.Empty() {
+			comment.Anchor = nil
+		} else {
+			if err := inst.validateAnchor(patch.Anchor); err != nil {
+				return nil, err
+			}
+			comment.Anchor = patch.Anchor
+		}
+	}
+
+	comment.UpdateAt = time.Now()
+
+	event, err := inst.newCommentEvent(ctx, model.EventCommentUpdated, principal.Login, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditCommentUpdate, actor, principal.SessionUUID, documentUUID, nil))
+	if err := inst.commentRepo.UpdateComment(ctx, comment, audit, event); err != nil {
+		inst.log.Error("update comment", zap.String("uuid", commentUUID), zap.Error(err))
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// DeleteComment removes the comment together with its replies.
+func (inst *Comment) DeleteComment(ctx context.Context, documentUUID, commentUUID string, principal *model.Principal) (err error) {
+	var actor string
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditCommentDelete, actor, principal.SessionUUID, documentUUID, err))
+		}
+	}()
+
+	actor = principal.Login
+
+	if err := inst.checkAccess(ctx, documentUUID, principal); err != nil {
+		return err
+	}
+
+	comment, err := inst.fetchComment(ctx, documentUUID, commentUUID)
+	if err != nil {
+		return err
+	}
+
+	if comment.UserLogin != principal.Login && !principal.IsAdmin() {
+		return utils.ErrorNoAccess
+	}
+
+	event, err := inst.newCommentEvent(ctx, model.EventCommentDeleted, principal.Login, comment)
+	if err != nil {
+		return err
+	}
+
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditCommentDelete, actor, principal.SessionUUID, documentUUID, nil))
+	if err := inst.commentRepo.DeleteComment(ctx, commentUUID, audit, event); err != nil {
+		inst.log.Error("delete comment", zap.String("uuid", commentUUID), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// ResolveComment resolves or reopens a thread.
+func (inst *Comment) ResolveComment(ctx context.Context, documentUUID, commentUUID string, principal *model.Principal, resolved bool) (_ *model.Comment, err error) {
+	var actor string
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditCommentResolve, actor, principal.SessionUUID, documentUUID, err))
+		}
+	}()
+
+	actor = principal.Login
+
+	if err := inst.checkAccess(ctx, documentUUID, principal); err != nil {
+		return nil, err
+	}
+
+	comment, err := inst.fetchComment(ctx, documentUUID, commentUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.ParentUUID != nil {
+		return nil, fmt.Errorf("%w: only a thread root can be resolved", utils.ErrorInvalidComment)
+	}
+
+	if comment.Resolved == resolved {
+		return comment, nil
+	}
+
+	now := time.Now()
+	comment.Resolved = resolved
+	comment.ResolvedBy = nil
+	comment.ResolvedAt = nil
+	if resolved {
+		comment.ResolvedBy = &principal.Login
+		comment.ResolvedAt = &now
+	}
+	comment.UpdateAt = now
+
+	event, err := inst.newCommentEvent(ctx, model.EventCommentResolved, principal.Login, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditCommentResolve, actor, principal.SessionUUID, documentUUID, nil))
+	if err := inst.commentRepo.UpdateComment(ctx, comment, audit, event); err != nil {
+		inst.log.Error("resolve comment", zap.String("uuid", commentUUID), zap.Error(err))
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (inst *Comment) checkAccess(ctx context.Context, documentUUID string, principal *model.Principal) error {
+	if _, err := inst.grantRepo.GetGrantByLoginAndDocUUID(ctx, documentUUID, principal.Login); err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return utils.ErrorNoAccess
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (inst *Comment) fetchComment(ctx context.Context, documentUUID, commentUUID string) (*model.Comment, error) {
+	comment, err := inst.commentRepo.GetCommentByUUID(ctx, commentUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.DocumentUUID != documentUUID {
+		return nil, utils.ErrorNotFound
+	}
+
+	return comment, nil
+}
+
+func (inst *Comment) validateBody(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return fmt.Errorf("%w: body can't be empty", utils.ErrorInvalidComment)
+	}
+
+	if utf8.RuneCountInString(body) > MaxCommentLength {
+		return fmt.Errorf("%w: body can't be longer than %d characters", utils.ErrorInvalidComment, MaxCommentLength)
+	}
+
+	return nil
+}
+
+func (inst *Comment) validateAnchor(anchor *model.CommentAnchor) error {
+	if anchor == nil {
+		return nil
+	}
+
+	if anchor.Page != nil && *anchor.Page < 1 {
+		return fmt.Errorf("%w: anchor page starts at 1", utils.ErrorInvalidComment)
+	}
+
+	if (anchor.Start == nil) != (anchor.End == nil) {
+		return fmt.Errorf("%w: anchor range needs both start and end", utils.ErrorInvalidComment)
+	}
+
+	if anchor.Start != nil && (*anchor.Start < 0 || *anchor.End < *anchor.Start) {
+		return fmt.Errorf("%w: invalid anchor range", utils.ErrorInvalidComment)
+	}
+
+	return nil
+}
+
+// newCommentEvent builds a comment event for everyone who can see the
+// document, it is logged with the comment change.
+func (inst *Comment) newCommentEvent(ctx context.Context, eventType, actor string, comment *model.Comment) (*model.Event, error) {
+	document, err := inst.docsRepo.GetDocumentWithGrantByUUID(ctx, comment.DocumentUUID)
+	if err != nil {
+		inst.log.Error("get document for comment event", zap.String("uuid", comment.DocumentUUID), zap.Error(err))
+		return nil, err
+	}
+
+	return newEvent(eventType, actor, document, document.Grant, map[string]any{
+		"comment": eventComment{
+			ID:         comment.UUID,
+			ParentID:   comment.ParentUUID,
+			Login:      comment.UserLogin,
+			Body:       comment.Body,
+			Anchor:     comment.Anchor,
+			Resolved:   comment.Resolved,
+			ResolvedBy: comment.ResolvedBy,
+		},
+	})
+}
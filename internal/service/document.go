@@ -1,16 +1,20 @@
 package service
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
 	"docs/internal/model"
 	"docs/internal/repository"
 	"docs/internal/utils"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -19,7 +23,7 @@ import (
 
 const (
 	DocKeyFormat  = "doc:%s"
-	DocsKeyFormat = "docs:%s:%s:%s:%d" // login:field:value:limit
+	DocsKeyFormat = "docs:%s:%s:%s:%d:%s:%t" // login:field:value:limit:prefix:file
 
 	TagDocFormat       = "doc:%s"
 	TagUserFormat      = "user:%s"
@@ -31,40 +35,55 @@ const (
 )
 
 type Document struct {
-	log         *zap.Logger
-	cache       Cacher
-	grantRepo   repository.GrantRepository
-	sessionRepo repository.SessionRepository
-	docsRepo    repository.DocumentRepository
-	uploadPath  string
+	log        *zap.Logger
+	cache      Cacher
+	grantRepo  repository.GrantRepository
+	docsRepo   repository.DocumentRepository
+	lockRepo   repository.LockRepository
+	auditor    Auditor
+	uploadPath string
 }
 
-func NewDocument(log *zap.Logger, uploadPath string, grantRepo repository.GrantRepository, docsRepo repository.DocumentRepository, sessionRepo repository.SessionRepository, cache Cacher) *Document {
+func NewDocument(log *zap.Logger, uploadPath string, grantRepo repository.GrantRepository, docsRepo repository.DocumentRepository, lockRepo repository.LockRepository, cache Cacher, auditor Auditor) *Document {
 	return &Document{
-		log:         log,
-		docsRepo:    docsRepo,
-		uploadPath:  uploadPath,
-		sessionRepo: sessionRepo,
-		grantRepo:   grantRepo,
-		cache:       cache,
+		log:        log,
+		docsRepo:   docsRepo,
+		uploadPath: uploadPath,
+		grantRepo:  grantRepo,
+		lockRepo:   lockRepo,
+		cache:      cache,
+		auditor:    auditor,
 	}
 }
 
-func (inst *Document) AddDocument(ctx context.Context, document *model.Document, file *multipart.FileHeader) error {
+func (inst *Document) AddDocument(ctx context.Context, principal *model.Principal, document *model.Document, content io.Reader) (err error) {
 	inst.fielDocument(document)
 
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditDocumentCreate, principal.Login, principal.SessionUUID, document.UUID, err))
+		}
+	}()
+
 	if document.File {
-		if file == nil {
+		if content == nil {
 			return utils.ErrorEmptyFile
 		}
 
-		if err := inst.saveFile(document.Name, file); err != nil {
+		if err := inst.saveFile(document, content); err != nil {
 			return err
 		}
 	}
 
-	if err := inst.docsRepo.CreateDocsWithGrant(ctx, document); err != nil {
-		os.Remove(inst.uploadPath + document.Name)
+	event, err := newEvent(model.EventDocumentCreated, principal.Login, document, document.Grant, nil)
+	if err != nil {
+		os.Remove(document.Path)
+		return err
+	}
+
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditDocumentCreate, principal.Login, principal.SessionUUID, document.UUID, nil))
+	if err := inst.docsRepo.CreateDocsWithGrant(ctx, document, audit, event); err != nil {
+		os.Remove(document.Path)
 		return err
 	}
 
@@ -73,14 +92,15 @@ func (inst *Document) AddDocument(ctx context.Context, document *model.Document,
 	return nil
 }
 
-func (inst *Document) GetDocument(ctx context.Context, uuid, sessionUUID string) (*model.Document, error) {
-	var err error
-	session, err := inst.sessionRepo.GetSessionByUUID(ctx, sessionUUID)
-	if err != nil {
-		return nil, utils.ErrorAuthFailed
-	}
+func (inst *Document) GetDocument(ctx context.Context, uuid string, principal *model.Principal) (_ *model.Document, err error) {
+	var actor string
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditDocumentRead, actor, principal.SessionUUID, uuid, err)))
+	}()
+
+	actor = principal.Login
 
-	_, err = inst.grantRepo.GetGrantByLoginAndDocUUID(ctx, uuid, session.UserLogin)
+	_, err = inst.grantRepo.GetGrantByLoginAndDocUUID(ctx, uuid, principal.Login)
 	if err != nil {
 		if errors.Is(err, utils.ErrorNotFound) {
 			return nil, utils.ErrorNoAccess
@@ -91,7 +111,7 @@ func (inst *Document) GetDocument(ctx context.Context, uuid, sessionUUID string)
 	document := inst.fetchDocumentFromCache(uuid)
 	if document != nil {
 		inst.log.Debug("fetch document from cache")
-		return document, nil
+		return inst.withActiveLock(document), nil
 	}
 
 	inst.log.Debug("document not found in cache")
@@ -101,6 +121,10 @@ func (inst *Document) GetDocument(ctx context.Context, uuid, sessionUUID string)
 		return nil, err
 	}
 
+	if document.Lock, err = inst.fetchLock(ctx, uuid); err != nil {
+		return nil, err
+	}
+
 	inst.cache.Put(
 		fmt.Sprintf(DocKeyFormat, document.UUID),
 		document,
@@ -108,13 +132,16 @@ func (inst *Document) GetDocument(ctx context.Context, uuid, sessionUUID string)
 		inst.documentTags(document),
 	)
 
-	return document, nil
+	return inst.withActiveLock(document), nil
 }
 
-func (inst *Document) ListDocuments(ctx context.Context, sessionUUID string, data *model.DocumentFilterData) ([]model.Document, error) {
-	if _, err := inst.sessionRepo.GetSessionByUUID(ctx, sessionUUID); err != nil {
-		return nil, utils.ErrorAuthFailed
-	}
+func (inst *Document) ListDocuments(ctx context.Context, principal *model.Principal, data *model.DocumentFilterData) (_ []model.Document, err error) {
+	var actor string
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditDocumentList, actor, principal.SessionUUID, "", err)))
+	}()
+
+	actor = principal.Login
 
 	documents := inst.fetchDocumentsFromCache(data)
 	if documents != nil {
@@ -124,13 +151,13 @@ func (inst *Document) ListDocuments(ctx context.Context, sessionUUID string, dat
 
 	inst.log.Debug("document not found in cache")
 
-	documents, err := inst.docsRepo.ListDocuments(ctx, data)
+	documents, err = inst.docsRepo.ListDocuments(ctx, data)
 	if err != nil {
 		return nil, err
 	}
 
 	inst.cache.Put(
-		fmt.Sprintf(DocsKeyFormat, data.Login, data.FiltredField, data.FiltredValue, data.Limit),
+		inst.docsKey(data),
 		documents,
 		1*time.Minute,
 		inst.documentsTags(documents, data),
@@ -139,14 +166,151 @@ func (inst *Document) ListDocuments(ctx context.Context, sessionUUID string, dat
 	return documents, nil
 }
 
-func (inst *Document) DeleteDocument(ctx context.Context, uuid, sessionUUID string) error {
-	_, err := inst.sessionRepo.GetSessionByUUID(ctx, sessionUUID)
+func (inst *Document) UpdateDocument(ctx context.Context, uuid string, principal *model.Principal, version int, patch *model.DocumentPatch) (_ *model.Document, err error) {
+	var actor string
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditDocumentUpdate, actor, principal.SessionUUID, uuid, err))
+		}
+	}()
+
+	actor = principal.Login
+
+	_, err = inst.grantRepo.GetGrantByLoginAndDocUUID(ctx, uuid, principal.Login)
 	if err != nil {
-		inst.log.Error("get session", zap.String("uuid", sessionUUID), zap.Error(err))
-		return utils.ErrorAuthFailed
+		if errors.Is(err, utils.ErrorNotFound) {
+			return nil, utils.ErrorNoAccess
+		}
+		return nil, err
 	}
 
-	_, err = inst.grantRepo.GetGrantByLoginAndDocUUID(ctx, uuid, sessionUUID)
+	document, err := inst.docsRepo.GetDocumentWithGrantByUUID(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if document.Version != version {
+		return nil, utils.ErrorVersionMismatch
+	}
+
+	old := *document
+
+	if err := inst.applyPatch(document, patch); err != nil {
+		return nil, err
+	}
+
+	// the events carry the version the update commits
+	document.Version = version + 1
+
+	var events []*model.Event
+	if patch.Name != nil || patch.Mime != nil || patch.Public != nil || patch.JSON != nil {
+		event, err := newEvent(model.EventDocumentUpdated, principal.Login, document, document.Grant, nil)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	if added, removed := inst.grantDiff(old.Grant, document.Grant); len(added) > 0 || len(removed) > 0 {
+		event, err := newEvent(model.EventDocumentShared, principal.Login, document, slices.Concat(document.Grant, removed), map[string]any{
+			"added":   added,
+			"removed": removed,
+		})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditDocumentUpdate, actor, principal.SessionUUID, uuid, nil))
+	if err := inst.docsRepo.UpdateDocumentWithGrant(ctx, document, version, principal.Login, audit, events...); err != nil {
+		inst.log.Error("update document", zap.String("uuid", uuid), zap.Error(err))
+		return nil, err
+	}
+
+	go inst.invalidateDocument(&old, document)
+
+	return document, nil
+}
+
+func (inst *Document) ReplaceContent(ctx context.Context, uuid string, principal *model.Principal, version int, mime string, content io.Reader) (_ *model.Document, err error) {
+	var actor string
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditDocumentReplace, actor, principal.SessionUUID, uuid, err))
+		}
+	}()
+
+	actor = principal.Login
+
+	_, err = inst.grantRepo.GetGrantByLoginAndDocUUID(ctx, uuid, principal.Login)
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return nil, utils.ErrorNoAccess
+		}
+		return nil, err
+	}
+
+	// fail before streaming the upload, the write checks the lock again
+	if err := inst.checkLock(ctx, uuid, principal.Login); err != nil {
+		return nil, err
+	}
+
+	document, err := inst.docsRepo.GetDocumentWithGrantByUUID(ctx, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	if document.Version != version {
+		return nil, utils.ErrorVersionMismatch
+	}
+
+	old := *document
+
+	document.Mime = mime
+	document.File = true
+	document.Path = inst.filePath(uuid)
+
+	tmpPath, err := inst.writeTempFile(document, content)
+	if err != nil {
+		inst.log.Error("write temp file", zap.String("uuid", uuid), zap.Error(err))
+		return nil, err
+	}
+
+	// the event carries the version the update commits
+	document.Version = version + 1
+
+	event, err := newEvent(model.EventDocumentUpdated, principal.Login, document, document.Grant, nil)
+	if err != nil {
+		os.Remove(tmpPath)
+		return nil, err
+	}
+
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditDocumentReplace, actor, principal.SessionUUID, uuid, nil))
+	if err := inst.docsRepo.UpdateDocumentContent(ctx, document, version, principal.Login, func() error {
+		return os.Rename(tmpPath, document.Path)
+	}, audit, event); err != nil {
+		os.Remove(tmpPath)
+		inst.log.Error("update document content", zap.String("uuid", uuid), zap.Error(err))
+		return nil, err
+	}
+
+	go inst.invalidateDocument(&old, document)
+
+	return document, nil
+}
+
+func (inst *Document) DeleteDocument(ctx context.Context, uuid string, principal *model.Principal) (err error) {
+	var actor string
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditDocumentDelete, actor, principal.SessionUUID, uuid, err))
+		}
+	}()
+
+	actor = principal.Login
+
+	_, err = inst.grantRepo.GetGrantByLoginAndDocUUID(ctx, uuid, principal.Login)
 	if err != nil {
 		if errors.Is(err, utils.ErrorNotFound) {
 			return utils.ErrorNoAccess
@@ -154,21 +318,30 @@ func (inst *Document) DeleteDocument(ctx context.Context, uuid, sessionUUID stri
 		return err
 	}
 
-	document, err := inst.docsRepo.GetDocumentByUUID(ctx, uuid)
+	document, err := inst.docsRepo.GetDocumentWithGrantByUUID(ctx, uuid)
 	if err != nil {
 		inst.log.Error("get document from db", zap.String("uuid", uuid), zap.Error(err))
 		return err
 	}
 
-	if err := inst.removeFile(document.Path); err != nil {
-		inst.log.Error("remove file", zap.String("path", document.Path), zap.Error(err))
+	event, err := newEvent(model.EventDocumentDeleted, principal.Login, document, document.Grant, nil)
+	if err != nil {
+		return err
 	}
 
-	if err := inst.docsRepo.DeleteDocument(ctx, uuid); err != nil {
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditDocumentDelete, actor, principal.SessionUUID, uuid, nil))
+	if err := inst.docsRepo.DeleteDocument(ctx, uuid, principal.Login, audit, event); err != nil {
 		inst.log.Error("delete document", zap.String("uuid", uuid), zap.Error(err))
 		return err
 	}
 
+	// only once the row is gone, a refused delete keeps its file
+	if document.File {
+		if err := inst.removeFile(document.Path); err != nil {
+			inst.log.Error("remove file", zap.String("path", document.Path), zap.Error(err))
+		}
+	}
+
 	go inst.invalidateDocument(document)
 
 	return nil
@@ -177,42 +350,221 @@ func (inst *Document) DeleteDocument(ctx context.Context, uuid, sessionUUID stri
 func (inst *Document) fielDocument(doc *model.Document) {
 	doc.CreateAt = time.Now()
 	doc.UUID = uuid.NewString()
-	doc.Path = inst.uploadPath + "/" + filepath.Base(doc.Name)
+	doc.Path = inst.filePath(doc.UUID)
+	doc.Version = 1
 }
 
-func (inst *Document) saveFile(name string, file *multipart.FileHeader) error {
-	if file == nil {
-		return nil
+func (inst *Document) applyPatch(doc *model.Document, patch *model.DocumentPatch) error {
+	if patch.Name != nil {
+		if *patch.Name == "" {
+			return fmt.Errorf("%w: name can't be empty", utils.ErrorInvalidPatch)
+		}
+		doc.Name = *patch.Name
+	}
+
+	if patch.Mime != nil {
+		if *patch.Mime == "" {
+			return fmt.Errorf("%w: mime can't be empty", utils.ErrorInvalidPatch)
+		}
+		doc.Mime = *patch.Mime
 	}
 
-	src, err := file.Open()
+	if patch.Public != nil {
+		doc.Public = *patch.Public
+	}
+
+	if patch.Grant != nil {
+		if len(*patch.Grant) == 0 {
+			return fmt.Errorf("%w: grant can't be empty", utils.ErrorInvalidGrant)
+		}
+		doc.Grant = *patch.Grant
+	}
+
+	if patch.JSON != nil {
+		if *patch.JSON == nil {
+			doc.JSON = nil
+		} else {
+			// an object patch always merges into an object
+			doc.JSON, _ = inst.mergeJSON(doc.JSON, *patch.JSON).(map[string]any)
+		}
+	}
+
+	return nil
+}
+
+// mergeJSON applies patch to target following RFC 7396: an object patch is
+// merged key by key with null removing the key, any other patch replaces
+// target.
+func (inst *Document) mergeJSON(target, patch any) any {
+	patchObject, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	targetObject, _ := target.(map[string]any)
+	merged := make(map[string]any, len(targetObject))
+	for key, value := range targetObject {
+		merged[key] = value
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(merged, key)
+			continue
+		}
+
+		merged[key] = inst.mergeJSON(merged[key], value)
+	}
+
+	return merged
+}
+
+func (inst *Document) saveFile(document *model.Document, src io.Reader) error {
+	tmpPath, err := inst.writeTempFile(document, src)
 	if err != nil {
 		return err
 	}
-	defer src.Close()
 
-	if err = os.MkdirAll(filepath.Dir(inst.uploadPath), 0750); err != nil {
+	if err := os.Rename(tmpPath, document.Path); err != nil {
+		os.Remove(tmpPath)
 		return err
 	}
 
-	out, err := os.Create(inst.uploadPath + "/" + filepath.Base(name))
+	return nil
+}
+
+// writeTempFile streams src into a temporary file next to the uploads and
+// fills the size, hash and, when unknown, the mime of the document. The
+// caller renames the file into place or removes it.
+func (inst *Document) writeTempFile(document *model.Document, src io.Reader) (string, error) {
+	if err := os.MkdirAll(inst.uploadPath, 0750); err != nil {
+		return "", err
+	}
+
+	reader := bufio.NewReader(src)
+	if document.Mime == "" || document.Mime == "application/octet-stream" {
+		head, _ := reader.Peek(512)
+		document.Mime = http.DetectContentType(head)
+	}
+
+	out, err := os.CreateTemp(inst.uploadPath, ".upload-*")
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, src)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), reader)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
-		return err
+		os.Remove(out.Name())
+		return "", err
 	}
 
-	return nil
+	document.Size = size
+	document.Hash = hex.EncodeToString(hash.Sum(nil))
+
+	return out.Name(), nil
 }
 
 func (inst *Document) removeFile(path string) error {
 	return os.Remove(path)
 }
 
+// filePath is where the content of a document is stored. Every document
+// has its own file, whatever its name.
+func (inst *Document) filePath(documentUUID string) string {
+	return filepath.Join(inst.uploadPath, documentUUID)
+}
+
+// MigrateFilePaths moves documents stored under their base name, a file
+// documents with the same name shared, to their own file. Shared files are
+// copied so that every document keeps its current content, they are removed
+// once no document refers to them.
+func (inst *Document) MigrateFilePaths(ctx context.Context) error {
+	documents, err := inst.docsRepo.ListDocumentPaths(ctx)
+	if err != nil {
+		return err
+	}
+
+	legacy := map[string]bool{}
+	for _, document := range documents {
+		path := inst.filePath(document.UUID)
+		if document.Path == path {
+			continue
+		}
+
+		if document.File {
+			if err := inst.copyFile(document.Path, path); err != nil {
+				inst.log.Warn("migrate document file", zap.String("uuid", document.UUID), zap.String("path", document.Path), zap.Error(err))
+				// keep the old file, the document still refers to it
+				legacy[document.Path] = false
+				continue
+			}
+		}
+
+		if err := inst.docsRepo.UpdateDocumentPath(ctx, document.UUID, path); err != nil {
+			os.Remove(path)
+			return err
+		}
+
+		if document.File {
+			if _, seen := legacy[document.Path]; !seen {
+				legacy[document.Path] = true
+			}
+		}
+	}
+
+	for path, unused := range legacy {
+		if !unused {
+			continue
+		}
+		if err := inst.removeFile(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			inst.log.Warn("remove migrated file", zap.String("path", path), zap.Error(err))
+		}
+	}
+
+	return nil
+}
+
+func (inst *Document) copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(inst.uploadPath, 0750); err != nil {
+		return err
+	}
+
+	out, err := os.CreateTemp(inst.uploadPath, ".upload-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(out.Name(), dst)
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return err
+	}
+
+	return nil
+}
+
 func (inst *Document) fetchDocumentFromCache(uuid string) *model.Document {
 	value, exists := inst.cache.Get(
 		fmt.Sprintf(DocKeyFormat, uuid),
@@ -230,11 +582,7 @@ func (inst *Document) fetchDocumentFromCache(uuid string) *model.Document {
 }
 
 func (inst *Document) fetchDocumentsFromCache(data *model.DocumentFilterData) []model.Document {
-	value, exists := inst.cache.Get(
-		fmt.Sprintf(
-			DocsKeyFormat, data.Login, data.FiltredField, data.FiltredValue, data.Limit,
-		),
-	)
+	value, exists := inst.cache.Get(inst.docsKey(data))
 	if !exists {
 		return nil
 	}
@@ -247,13 +595,40 @@ func (inst *Document) fetchDocumentsFromCache(data *model.DocumentFilterData) []
 	return nil
 }
 
-func (inst *Document) invalidateDocument(document *model.Document) {
-	inst.cache.InvalidateByTags(inst.documentTags(document))
+func (inst *Document) docsKey(data *model.DocumentFilterData) string {
+	return fmt.Sprintf(DocsKeyFormat, data.Login, data.FiltredField, data.FiltredValue, data.Limit, data.NamePrefix, data.FileOnly)
+}
+
+// grantDiff returns the logins present only in after and only in before.
+func (inst *Document) grantDiff(before, after []string) ([]string, []string) {
+	added := make([]string, 0)
+	for _, login := range after {
+		if !slices.Contains(before, login) {
+			added = append(added, login)
+		}
+	}
+
+	removed := make([]string, 0)
+	for _, login := range before {
+		if !slices.Contains(after, login) {
+			removed = append(removed, login)
+		}
+	}
+
+	return added, removed
+}
+
+func (inst *Document) invalidateDocument(documents ...*model.Document) {
+	for _, document := range documents {
+		inst.cache.InvalidateByTags(inst.documentTags(document))
+		inst.cache.InvalidateByTags(inst.filterTags(document))
+	}
 	inst.cache.CleanExpired()
 }
 
 func (inst *Document) documentTags(document *model.Document) []string {
 	tags := []string{
+		fmt.Sprintf(TagDocFormat, document.UUID),
 		fmt.Sprintf(TagFileNameFormat, document.Name),
 		fmt.Sprintf(TagMimeFormat, document.Mime),
 		fmt.Sprintf(TagIsFileFormat, document.File),
@@ -268,9 +643,26 @@ func (inst *Document) documentTags(document *model.Document) []string {
 	return tags
 }
 
+// filterTags returns the tags of cached lists filtered by one of the
+// document fields, so lists the document enters after an update are
+// dropped as well as the ones it leaves.
+func (inst *Document) filterTags(document *model.Document) []string {
+	return []string{
+		fmt.Sprintf(TagFilterFormat, "name", document.Name),
+		fmt.Sprintf(TagFilterFormat, "id", document.UUID),
+		fmt.Sprintf(TagFilterFormat, "mime", document.Mime),
+		fmt.Sprintf(TagFilterFormat, "file", document.File),
+		fmt.Sprintf(TagFilterFormat, "publuc", document.Public),
+	}
+}
+
 func (inst *Document) documentsTags(documents []model.Document, listData *model.DocumentFilterData) []string {
 	tags := []string{
-		fmt.Sprintf("filter:%s:%v", listData.FiltredField, listData.FiltredValue),
+		fmt.Sprintf(TagFilterFormat, listData.FiltredField, listData.FiltredValue),
+	}
+	// a new document of the login enters lists that did not hold it yet
+	if listData.Login != "" {
+		tags = append(tags, fmt.Sprintf(TagUserLoginFormat, listData.Login))
 	}
 
 	for _, document := range documents {
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultLockTTL = 15 * time.Minute
+	MaxLockTTL     = 24 * time.Hour
+)
+
+// LockDocument checks the document out for the session login. Locking an
+// already held lock again extends it.
+func (inst *Document) LockDocument(ctx context.Context, uuid string, principal *model.Principal, ttl time.Duration) (_ *model.Lock, err error) {
+	var actor string
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditDocumentLock, actor, principal.SessionUUID, uuid, err))
+		}
+	}()
+
+	actor = principal.Login
+
+	_, err = inst.grantRepo.GetGrantByLoginAndDocUUID(ctx, uuid, principal.Login)
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return nil, utils.ErrorNoAccess
+		}
+		return nil, err
+	}
+
+	if ttl == 0 {
+		ttl = DefaultLockTTL
+	}
+
+	if ttl < 0 || ttl > MaxLockTTL {
+		return nil, fmt.Errorf("%w: ttl should be between 1s and %s", utils.ErrorInvalidTTL, MaxLockTTL)
+	}
+
+	now := time.Now()
+	lock := &model.Lock{
+		DocumentUUID: uuid,
+		UserLogin:    principal.Login,
+		ExpiresAt:    now.Add(ttl),
+		CreateAt:     now,
+	}
+
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditDocumentLock, actor, principal.SessionUUID, uuid, nil))
+	if err := inst.lockRepo.AcquireLock(ctx, lock, audit); err != nil {
+		if !errors.Is(err, utils.ErrorLocked) {
+			inst.log.Error("acquire lock", zap.String("uuid", uuid), zap.Error(err))
+		}
+		return nil, err
+	}
+
+	go inst.cache.InvalidateByTag(fmt.Sprintf(TagDocFormat, uuid))
+
+	return lock, nil
+}
+
+// UnlockDocument checks the document in. Only the holder may release the
+// lock, unless an admin forces it.
+func (inst *Document) UnlockDocument(ctx context.Context, uuid string, principal *model.Principal, force bool) (err error) {
+	var actor string
+	defer func() {
+		if err != nil {
+			inst.auditor.Record(ctx, newAuditEvent(model.AuditDocumentUnlock, actor, principal.SessionUUID, uuid, err))
+		}
+	}()
+
+	actor = principal.Login
+
+	if force && !principal.IsAdmin() {
+		return utils.ErrorNoAccess
+	}
+
+	lock, err := inst.lockRepo.GetLockByDocumentUUID(ctx, uuid)
+	if err != nil {
+		return err
+	}
+
+	if lock.UserLogin != principal.Login && !force {
+		return fmt.Errorf("%w by %s", utils.ErrorLocked, lock.UserLogin)
+	}
+
+	audit := inst.auditor.Stamp(ctx, newAuditEvent(model.AuditDocumentUnlock, actor, principal.SessionUUID, uuid, nil))
+	if force {
+		if err := inst.lockRepo.ForceDeleteLock(ctx, uuid, audit); err != nil {
+			inst.log.Error("force delete lock", zap.String("uuid", uuid), zap.Error(err))
+			return err
+		}
+		inst.log.Info("lock forced open", zap.String("uuid", uuid), zap.String("holder", lock.UserLogin), zap.String("admin", principal.Login))
+	} else if err := inst.lockRepo.DeleteLock(ctx, uuid, principal.Login, audit); err != nil {
+		// expired and taken by someone else since it was read
+		if !errors.Is(err, utils.ErrorNotFound) {
+			inst.log.Error("delete lock", zap.String("uuid", uuid), zap.Error(err))
+		}
+		return err
+	}
+
+	go inst.cache.InvalidateByTag(fmt.Sprintf(TagDocFormat, uuid))
+
+	return nil
+}
+
+// checkLock rejects writes to a document locked by another login early. It
+// is a read ahead of the write, the repository checks again in the write
+// transaction.
+func (inst *Document) checkLock(ctx context.Context, uuid, login string) error {
+	lock, err := inst.fetchLock(ctx, uuid)
+	if err != nil {
+		return err
+	}
+
+	if lock != nil && lock.UserLogin != login {
+		return fmt.Errorf("%w by %s until %s", utils.ErrorLocked, lock.UserLogin, lock.ExpiresAt.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+func (inst *Document) fetchLock(ctx context.Context, uuid string) (*model.Lock, error) {
+	lock, err := inst.lockRepo.GetLockByDocumentUUID(ctx, uuid)
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// withActiveLock hides a lock that expired while the document sat in cache.
+func (inst *Document) withActiveLock(document *model.Document) *model.Document {
+	if document.Lock == nil || !document.Lock.Expired() {
+		return document
+	}
+
+	unlocked := *document
+	unlocked.Lock = nil
+
+	return &unlocked
+}
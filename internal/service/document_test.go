@@ -0,0 +1,64 @@
+package service
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// TestMergeJSON runs the examples of RFC 7396 Appendix A.
+func TestMergeJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		patch  string
+		want   string
+	}{
+		{name: "replace a member", target: `{"a":"b"}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "add a member", target: `{"a":"b"}`, patch: `{"b":"c"}`, want: `{"a":"b","b":"c"}`},
+		{name: "remove the only member", target: `{"a":"b"}`, patch: `{"a":null}`, want: `{}`},
+		{name: "remove a member", target: `{"a":"b","b":"c"}`, patch: `{"a":null}`, want: `{"b":"c"}`},
+		{name: "array replaced by a string", target: `{"a":["b"]}`, patch: `{"a":"c"}`, want: `{"a":"c"}`},
+		{name: "string replaced by an array", target: `{"a":"c"}`, patch: `{"a":["b"]}`, want: `{"a":["b"]}`},
+		{name: "nested merge", target: `{"a":{"b":"c"}}`, patch: `{"a":{"b":"d","c":null}}`, want: `{"a":{"b":"d"}}`},
+		{name: "arrays are not merged", target: `{"a":[{"b":"c"}]}`, patch: `{"a":[1]}`, want: `{"a":[1]}`},
+		{name: "array patch", target: `["a","b"]`, patch: `["c","d"]`, want: `["c","d"]`},
+		{name: "array patch over an object", target: `{"a":"b"}`, patch: `["c"]`, want: `["c"]`},
+		{name: "null patch", target: `{"a":"foo"}`, patch: `null`, want: `null`},
+		{name: "string patch", target: `{"a":"foo"}`, patch: `"bar"`, want: `"bar"`},
+		{name: "null in the target is kept", target: `{"e":null}`, patch: `{"a":1}`, want: `{"a":1,"e":null}`},
+		{name: "object patch over an array", target: `[1,2]`, patch: `{"a":"b","c":null}`, want: `{"a":"b"}`},
+		{name: "null in a new object is dropped", target: `{}`, patch: `{"a":{"bb":{"ccc":null}}}`, want: `{"a":{"bb":{}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := (&Document{}).mergeJSON(decodeJSON(t, tt.target), decodeJSON(t, tt.patch))
+			if want := decodeJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("mergeJSON(%s, %s) = %v, want %s", tt.target, tt.patch, got, tt.want)
+			}
+		})
+	}
+}
+
+func decodeJSON(t *testing.T, raw string) any {
+	t.Helper()
+
+	var value any
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		t.Fatalf("decode %s: %v", raw, err)
+	}
+
+	return value
+}
+
+func TestMergeJSONKeepsTarget(t *testing.T) {
+	target := map[string]any{"a": "b", "c": map[string]any{"d": "e"}}
+
+	(&Document{}).mergeJSON(target, map[string]any{"a": nil, "c": map[string]any{"d": nil}})
+
+	want := map[string]any{"a": "b", "c": map[string]any{"d": "e"}}
+	if !reflect.DeepEqual(target, want) {
+		t.Errorf("target = %v, want %v", target, want)
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"docs/internal/model"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// eventPayload is the JSON form of an event sent to subscribers.
+type eventPayload struct {
+	ID       string         `json:"id"`
+	Type     string         `json:"type"`
+	Actor    string         `json:"actor,omitempty"`
+	CreateAt time.Time      `json:"create_at"`
+	Document eventDocument  `json:"document"`
+	Data     map[string]any `json:"data,omitempty"`
+}
+
+type eventDocument struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name,omitempty"`
+	Mime     string         `json:"mime,omitempty"`
+	File     bool           `json:"file"`
+	Public   bool           `json:"public"`
+	CreateAt time.Time      `json:"create_at"`
+	Version  int            `json:"version,omitempty"`
+	Size     int64          `json:"size,omitempty"`
+	Hash     string         `json:"hash,omitempty"`
+	Grant    []string       `json:"grant,omitempty"`
+	JSON     map[string]any `json:"json,omitempty"`
+}
+
+// newEvent builds an event with its payload, taken from document as it is
+// now. The event is logged in the transaction of the change it announces.
+func newEvent(eventType, actor string, document *model.Document, grant []string, data map[string]any) (*model.Event, error) {
+	event := &model.Event{
+		UUID:     uuid.NewString(),
+		Type:     eventType,
+		Actor:    actor,
+		Document: document,
+		Grant:    grant,
+		Data:     data,
+		CreateAt: time.Now(),
+	}
+
+	payload, err := json.Marshal(newEventPayload(event))
+	if err != nil {
+		return nil, err
+	}
+	event.Payload = payload
+
+	return event, nil
+}
+
+func newEventPayload(event *model.Event) *eventPayload {
+	payload := &eventPayload{
+		ID:       event.UUID,
+		Type:     event.Type,
+		Actor:    event.Actor,
+		CreateAt: event.CreateAt,
+		Data:     event.Data,
+	}
+
+	if document := event.Document; document != nil {
+		payload.Document = eventDocument{
+			ID:       document.UUID,
+			Name:     document.Name,
+			Mime:     document.Mime,
+			File:     document.File,
+			Public:   document.Public,
+			CreateAt: document.CreateAt,
+			Version:  document.Version,
+			Size:     document.Size,
+			Hash:     document.Hash,
+			Grant:    document.Grant,
+			JSON:     document.JSON,
+		}
+	}
+
+	return payload
+}
@@ -3,24 +3,127 @@ package service
 import (
 	"context"
 	"docs/internal/model"
-	"mime/multipart"
+	"io"
 	"time"
 )
 
 type AuthService interface {
 	Login(ctx context.Context, login, password string) (*model.AuthToken, error)
+	LoginTOTP(ctx context.Context, challenge, code string) (*model.AuthToken, error)
+	Refresh(ctx context.Context, refreshToken string) (*model.AuthToken, error)
 	Logout(ctx context.Context, token string) error
+	Authenticate(ctx context.Context, token string) (*model.Principal, error)
+}
+
+type SSOService interface {
+	StartOIDC(ctx context.Context) (*model.OIDCRedirect, error)
+	LoginOIDC(ctx context.Context, code, state, browserState string) (*model.AuthToken, error)
+}
+
+type TOTPService interface {
+	EnrollTOTP(ctx context.Context, principal *model.Principal) (*model.TOTPEnrollment, error)
+	VerifyTOTP(ctx context.Context, principal *model.Principal, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, principal *model.Principal, code string) error
+}
+
+type APIKeyService interface {
+	CreateAPIKey(ctx context.Context, principal *model.Principal, key *model.APIKey) (*model.APIKey, error)
+	ListAPIKeys(ctx context.Context, principal *model.Principal) ([]model.APIKey, error)
+	RevokeAPIKey(ctx context.Context, principal *model.Principal, keyUUID string) error
+}
+
+type LockoutService interface {
+	UnlockLogin(ctx context.Context, principal *model.Principal, login string) error
+}
+
+type SessionService interface {
+	ListSessions(ctx context.Context, principal *model.Principal, login string) ([]model.Session, error)
+	RevokeSession(ctx context.Context, principal *model.Principal, login, familyUUID string) error
+	RevokeOtherSessions(ctx context.Context, principal *model.Principal, login string) (int, error)
 }
 
 type RegistrationService interface {
 	Register(ctx context.Context, token, login, password string) error
+	RegisterInvite(ctx context.Context, code, login, password string) error
+}
+
+type InviteService interface {
+	CreateInvite(ctx context.Context, principal *model.Principal, invite *model.Invite) (*model.Invite, error)
+	ListInvites(ctx context.Context, principal *model.Principal) ([]model.Invite, error)
+	RevokeInvite(ctx context.Context, principal *model.Principal, inviteUUID string) error
+}
+
+type UserService interface {
+	ListUsers(ctx context.Context, principal *model.Principal, filter *model.UserFilter) ([]model.User, error)
+	GetUser(ctx context.Context, principal *model.Principal, login string) (*model.User, error)
+	CreateUser(ctx context.Context, principal *model.Principal, login, password, role string) (*model.User, error)
+	ListSoleDocuments(ctx context.Context, principal *model.Principal, login string) ([]model.Document, error)
+	SetUserDisabled(ctx context.Context, principal *model.Principal, login string, disabled bool, handover model.DocumentHandover) error
+	DeleteUser(ctx context.Context, principal *model.Principal, login string, handover model.DocumentHandover) error
+	ChangeRole(ctx context.Context, principal *model.Principal, login, role string) error
+}
+
+type ProfileService interface {
+	GetProfile(ctx context.Context, principal *model.Principal) (*model.User, error)
+	UpdateProfile(ctx context.Context, principal *model.Principal, patch *model.ProfilePatch) (*model.User, error)
+	GetAvatar(ctx context.Context, login string) (*model.Document, error)
+	ListProfiles(ctx context.Context, logins []string) (map[string]model.User, error)
+}
+
+type PasswordService interface {
+	ChangePassword(ctx context.Context, principal *model.Principal, oldPassword, newPassword string) error
+	IssuePasswordReset(ctx context.Context, principal *model.Principal, login string) (*model.PasswordReset, error)
+	ResetPassword(ctx context.Context, token, password string) error
 }
 
 type DocumentService interface {
-	AddDocument(ctx context.Context, document *model.Document, file *multipart.FileHeader) error
-	GetDocument(ctx context.Context, uuid, token string) (*model.Document, error)
-	ListDocuments(ctx context.Context, token string, data *model.DocumentFilterData) ([]model.Document, error)
-	DeleteDocument(ctx context.Context, uuid, token string) error
+	AddDocument(ctx context.Context, principal *model.Principal, document *model.Document, content io.Reader) error
+	GetDocument(ctx context.Context, uuid string, principal *model.Principal) (*model.Document, error)
+	ListDocuments(ctx context.Context, principal *model.Principal, data *model.DocumentFilterData) ([]model.Document, error)
+	UpdateDocument(ctx context.Context, uuid string, principal *model.Principal, version int, patch *model.DocumentPatch) (*model.Document, error)
+	ReplaceContent(ctx context.Context, uuid string, principal *model.Principal, version int, mime string, content io.Reader) (*model.Document, error)
+	DeleteDocument(ctx context.Context, uuid string, principal *model.Principal) error
+	LockDocument(ctx context.Context, uuid string, principal *model.Principal, ttl time.Duration) (*model.Lock, error)
+	UnlockDocument(ctx context.Context, uuid string, principal *model.Principal, force bool) error
+}
+
+type WebhookService interface {
+	CreateWebhook(ctx context.Context, principal *model.Principal, webhook *model.Webhook) error
+	ListWebhooks(ctx context.Context, principal *model.Principal) ([]model.Webhook, error)
+	DeleteWebhook(ctx context.Context, principal *model.Principal, webhookUUID string) error
+	ListDeliveries(ctx context.Context, principal *model.Principal, webhookUUID, status string, limit int) ([]model.WebhookDelivery, error)
+	ReplayDelivery(ctx context.Context, principal *model.Principal, webhookUUID, deliveryUUID string) (*model.WebhookDelivery, error)
+}
+
+type StreamService interface {
+	Subscribe(ctx context.Context, principal *model.Principal, token string, after model.ChangeCursor) (*Subscription, error)
+}
+
+type CommentService interface {
+	ListComments(ctx context.Context, documentUUID string, principal *model.Principal) ([]model.Comment, error)
+	CreateComment(ctx context.Context, documentUUID string, principal *model.Principal, comment *model.Comment) error
+	UpdateComment(ctx context.Context, documentUUID, commentUUID string, principal *model.Principal, patch *model.CommentPatch) (*model.Comment, error)
+	DeleteComment(ctx context.Context, documentUUID, commentUUID string, principal *model.Principal) error
+	ResolveComment(ctx context.Context, documentUUID, commentUUID string, principal *model.Principal, resolved bool) (*model.Comment, error)
+}
+
+type SyncService interface {
+	Changes(ctx context.Context, principal *model.Principal, cursor string, limit int) (*model.ChangeSet, error)
+}
+
+type AuditService interface {
+	ListAuditEvents(ctx context.Context, principal *model.Principal, filter *model.AuditFilter) ([]model.AuditEvent, error)
+	VerifyAuditLog(ctx context.Context, principal *model.Principal) (*model.AuditVerification, error)
+}
+
+type Auditor interface {
+	Stamp(ctx context.Context, event *model.AuditEvent) *model.AuditEvent
+	Record(ctx context.Context, event *model.AuditEvent) error
+}
+
+// EventRelay hands the event log on, Wake tells it new events were logged.
+type EventRelay interface {
+	Wake()
 }
 
 type Cacher interface {
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// inviteCodePrefix starts every invite code.
+	inviteCodePrefix = "inv_"
+	// inviteMaxUses bounds how many people one invite registers.
+	inviteMaxUses = 1000
+)
+
+// CreateInvite issues an invite, admin only. The role defaults to user,
+// MaxUses to a single use and the expiry to the configured invite TTL. The
+// plain code is returned once in Code.
+func (inst *Registration) CreateInvite(ctx context.Context, principal *model.Principal, invite *model.Invite) (_ *model.Invite, err error) {
+	defer func() {
+		event := newAuditEvent(model.AuditInviteCreate, principal.Login, principal.SessionUUID, "", err)
+		event.Target = invite.UUID
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if !principal.IsAdmin() {
+		return nil, utils.ErrorNoAccess
+	}
+
+	now := time.Now()
+	if invite.Role == "" {
+		invite.Role = model.RoleUser
+	}
+	if invite.MaxUses == 0 {
+		invite.MaxUses = 1
+	}
+	if invite.ExpiresAt.IsZero() {
+		invite.ExpiresAt = now.Add(inst.options.InviteTTL)
+	}
+
+	if err := inst.validateInvite(invite, now); err != nil {
+		return nil, err
+	}
+
+	secret, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	code := inviteCodePrefix + secret
+	invite.UUID = uuid.NewString()
+	invite.Code = code
+	invite.Hash = hashToken(code)
+	invite.Uses = 0
+	invite.CreateBy = principal.Login
+	invite.CreateAt = now
+
+	if err := inst.inviteRepo.CreateInvite(ctx, invite); err != nil {
+		inst.log.Error("create invite", zap.String("login", principal.Login), zap.Error(err))
+		return nil, err
+	}
+
+	return invite, nil
+}
+
+// ListInvites returns every invite with who redeemed it, admin only.
+func (inst *Registration) ListInvites(ctx context.Context, principal *model.Principal) ([]model.Invite, error) {
+	if !principal.IsAdmin() {
+		return nil, utils.ErrorNoAccess
+	}
+
+	return inst.inviteRepo.ListInvites(ctx)
+}
+
+// RevokeInvite stops an invite from registering anyone else, admin only.
+func (inst *Registration) RevokeInvite(ctx context.Context, principal *model.Principal, inviteUUID string) (err error) {
+	defer func() {
+		event := newAuditEvent(model.AuditInviteRevoke, principal.Login, principal.SessionUUID, "", err)
+		event.Target = inviteUUID
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if !principal.IsAdmin() {
+		return utils.ErrorNoAccess
+	}
+
+	if err := uuid.Validate(inviteUUID); err != nil {
+		return utils.ErrorNotFound
+	}
+
+	return inst.inviteRepo.RevokeInvite(ctx, inviteUUID)
+}
+
+// RegisterInvite creates a user with the role of the invite code. The login
+// and password follow the policy.
+func (inst *Registration) RegisterInvite(ctx context.Context, code, login, password string) (err error) {
+	var inviteUUID string
+	defer func() {
+		event := newAuditEvent(model.AuditInviteRedeem, login, "", "", err)
+		event.Target = inviteUUID
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if code == "" {
+		return utils.ErrorInvalidInvite
+	}
+
+	if err := inst.policy.ValidateLogin(login); err != nil {
+		return err
+	}
+
+	if err := inst.policy.ValidatePassword(ctx, login, password); err != nil {
+		return err
+	}
+
+	crypPswd, err := inst.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	invite, err := inst.inviteRepo.RedeemInvite(ctx, hashToken(code), &model.User{
+		UUID:     uuid.NewString(),
+		Login:    login,
+		Password: crypPswd,
+	})
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return fmt.Errorf("%w: unknown, used up, expired or revoked invite, or one for another login", utils.ErrorInvalidInvite)
+		}
+		return err
+	}
+	inviteUUID = invite.UUID
+
+	return nil
+}
+
+func (inst *Registration) validateInvite(invite *model.Invite, now time.Time) error {
+	if !model.ValidRole(invite.Role) {
+		return utils.ErrorInvalidRole
+	}
+
+	if invite.MaxUses < 1 || invite.MaxUses > inviteMaxUses {
+		return fmt.Errorf("%w: max_uses must be from 1 to %d", utils.ErrorInvalidInvite, inviteMaxUses)
+	}
+
+	if !invite.ExpiresAt.After(now) {
+		return fmt.Errorf("%w: expires_at must be in the future", utils.ErrorInvalidInvite)
+	}
+
+	if invite.Login != "" {
+		if err := inst.policy.ValidateLogin(invite.Login); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+
+	jwtLeeway = 30 * time.Second
+)
+
+var errInvalidJWT = errors.New("invalid jwt")
+
+type JWTOptions struct {
+	Algorithm  string
+	Issuer     string
+	Secret     string
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+}
+
+type jwtClaims struct {
+	ID        string `json:"jti"`
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	Login     string `json:"login"`
+	Role      string `json:"role"`
+	Scope     string `json:"scope"`
+	Family    string `json:"fam,omitempty"`
+}
+
+// JWT signs and verifies compact JWS access tokens with HS256 or EdDSA.
+// Only the configured algorithm is accepted on verify.
+type JWT struct {
+	algorithm  string
+	issuer     string
+	secret     []byte
+	privateKey ed25519.PrivateKey
+	publicKey  ed25519.PublicKey
+}
+
+func NewJWT(options JWTOptions) (*JWT, error) {
+	inst := &JWT{
+		algorithm:  options.Algorithm,
+		issuer:     options.Issuer,
+		secret:     []byte(options.Secret),
+		privateKey: options.PrivateKey,
+		publicKey:  options.PublicKey,
+	}
+
+	switch inst.algorithm {
+	case JWTAlgorithmHS256:
+		if len(inst.secret) == 0 {
+			return nil, errors.New("jwt: HS256 needs secret_key")
+		}
+	case JWTAlgorithmEdDSA:
+		if inst.publicKey == nil && inst.privateKey != nil {
+			inst.publicKey = inst.privateKey.Public().(ed25519.PublicKey)
+		}
+		if inst.publicKey == nil {
+			return nil, errors.New("jwt: EdDSA needs a key pair")
+		}
+	default:
+		return nil, fmt.Errorf("jwt: unsupported algorithm %q", inst.algorithm)
+	}
+
+	return inst, nil
+}
+
+// LoadEd25519Keys reads a PKCS #8 private key and/or a PKIX public key from
+// PEM files, an empty path is skipped.
+func LoadEd25519Keys(privateFile, publicFile string) (ed25519.PrivateKey, ed25519.PublicKey, error) {
+	var (
+		privateKey ed25519.PrivateKey
+		publicKey  ed25519.PublicKey
+	)
+
+	if privateFile != "" {
+		der, err := readPEM(privateFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, nil, fmt.Errorf("jwt: parse private key: %w", err)
+		}
+
+		var ok bool
+		if privateKey, ok = key.(ed25519.PrivateKey); !ok {
+			return nil, nil, errors.New("jwt: private key is not ed25519")
+		}
+	}
+
+	if publicFile != "" {
+		der, err := readPEM(publicFile)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, nil, fmt.Errorf("jwt: parse public key: %w", err)
+		}
+
+		var ok bool
+		if publicKey, ok = key.(ed25519.PublicKey); !ok {
+			return nil, nil, errors.New("jwt: public key is not ed25519")
+		}
+	}
+
+	return privateKey, publicKey, nil
+}
+
+func (inst *JWT) Sign(claims *jwtClaims) (string, error) {
+	if inst.algorithm == JWTAlgorithmEdDSA && inst.privateKey == nil {
+		return "", errors.New("jwt: no private key to sign with")
+	}
+
+	header, err := json.Marshal(jwtHeader{Algorithm: inst.algorithm, Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims.Issuer = inst.issuer
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(inst.signature([]byte(signingInput))), nil
+}
+
+// Verify checks the signature, issuer and lifetime of the token and returns
+// its claims.
+func (inst *JWT) Verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidJWT
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInvalidJWT
+	}
+
+	header := &jwtHeader{}
+	if err := json.Unmarshal(headerJSON, header); err != nil || header.Algorithm != inst.algorithm {
+		return nil, errInvalidJWT
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidJWT
+	}
+
+	signingInput := []byte(parts[0] + "." + parts[1])
+	switch inst.algorithm {
+	case JWTAlgorithmHS256:
+		if !hmac.Equal(signature, inst.signature(signingInput)) {
+			return nil, errInvalidJWT
+		}
+	case JWTAlgorithmEdDSA:
+		if !ed25519.Verify(inst.publicKey, signingInput, signature) {
+			return nil, errInvalidJWT
+		}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidJWT
+	}
+
+	claims := &jwtClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, errInvalidJWT
+	}
+
+	now := time.Now()
+	if claims.Issuer != inst.issuer || claims.ID == "" ||
+		now.After(time.Unix(claims.ExpiresAt, 0).Add(jwtLeeway)) ||
+		now.Add(jwtLeeway).Before(time.Unix(claims.IssuedAt, 0)) {
+		return nil, errInvalidJWT
+	}
+
+	return claims, nil
+}
+
+func (inst *JWT) signature(signingInput []byte) []byte {
+	if inst.algorithm == JWTAlgorithmEdDSA {
+		return ed25519.Sign(inst.privateKey, signingInput)
+	}
+
+	mac := hmac.New(sha256.New, inst.secret)
+	mac.Write(signingInput)
+	return mac.Sum(nil)
+}
+
+// isJWT tells a JWT from a session UUID.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func readPEM(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: read key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwt: no PEM block in %s", path)
+	}
+
+	return block.Bytes, nil
+}
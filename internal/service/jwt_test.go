@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testIssuer = "docs"
+
+// newTestJWTs returns an HS256 and an EdDSA signer with the same issuer.
+func newTestJWTs(t *testing.T) map[string]*JWT {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signers := map[string]*JWT{}
+	for _, options := range []JWTOptions{
+		{Algorithm: JWTAlgorithmHS256, Issuer: testIssuer, Secret: "secret"},
+		{Algorithm: JWTAlgorithmEdDSA, Issuer: testIssuer, PrivateKey: privateKey},
+	} {
+		signer, err := NewJWT(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers[options.Algorithm] = signer
+	}
+
+	return signers
+}
+
+func testClaims() *jwtClaims {
+	now := time.Now()
+	return &jwtClaims{
+		ID:        "jti-1",
+		Subject:   "user-1",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Hour).Unix(),
+		Login:     "alice",
+		Role:      "user",
+		Scope:     "docs:read",
+	}
+}
+
+// encodeJWT builds a token with any header, sign gets the signing input.
+func encodeJWT(t *testing.T, algorithm string, claims *jwtClaims, sign func(signingInput []byte) []byte) string {
+	t.Helper()
+
+	header, err := json.Marshal(jwtHeader{Algorithm: algorithm, Type: "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signingInput)))
+}
+
+func hs256(key []byte) func([]byte) []byte {
+	return func(signingInput []byte) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(signingInput)
+		return mac.Sum(nil)
+	}
+}
+
+func TestJWTRoundTrip(t *testing.T) {
+	for algorithm, signer := range newTestJWTs(t) {
+		t.Run(algorithm, func(t *testing.T) {
+			token, err := signer.Sign(testClaims())
+			if err != nil {
+				t.Fatalf("sign: %v", err)
+			}
+
+			claims, err := signer.Verify(token)
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+
+			if claims.Issuer != testIssuer || claims.Login != "alice" || claims.ID != "jti-1" {
+				t.Errorf("claims = %+v, want alice, jti-1 from %s", claims, testIssuer)
+			}
+		})
+	}
+}
+
+func TestJWTVerifyRejects(t *testing.T) {
+	signers := newTestJWTs(t)
+
+	tests := []struct {
+		name  string
+		token func(t *testing.T, signer *JWT) string
+	}{
+		{
+			name: "other algorithm in the header",
+			token: func(t *testing.T, signer *JWT) string {
+				algorithm := JWTAlgorithmEdDSA
+				if signer.algorithm == JWTAlgorithmEdDSA {
+					algorithm = JWTAlgorithmHS256
+				}
+				claims := testClaims()
+				claims.Issuer = testIssuer
+				return encodeJWT(t, algorithm, claims, signer.signature)
+			},
+		},
+		{
+			// the public key where it is one, a guessed secret otherwise
+			name: "HS256 keyed with a known key",
+			token: func(t *testing.T, signer *JWT) string {
+				key := []byte("guess")
+				if signer.algorithm == JWTAlgorithmEdDSA {
+					key = signer.publicKey
+				}
+				claims := testClaims()
+				claims.Issuer = testIssuer
+				return encodeJWT(t, JWTAlgorithmHS256, claims, hs256(key))
+			},
+		},
+		{
+			name: "alg none",
+			token: func(t *testing.T, signer *JWT) string {
+				claims := testClaims()
+				claims.Issuer = testIssuer
+				return encodeJWT(t, "none", claims, func([]byte) []byte { return nil })
+			},
+		},
+		{
+			name: "wrong issuer",
+			token: func(t *testing.T, signer *JWT) string {
+				other := *signer
+				other.issuer = "other"
+				token, err := other.Sign(testClaims())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T, signer *JWT) string {
+				claims := testClaims()
+				claims.IssuedAt = time.Now().Add(-2 * time.Hour).Unix()
+				claims.ExpiresAt = time.Now().Add(-jwtLeeway - time.Minute).Unix()
+				token, err := signer.Sign(claims)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return token
+			},
+		},
+		{
+			name: "tampered claims",
+			token: func(t *testing.T, signer *JWT) string {
+				token, err := signer.Sign(testClaims())
+				if err != nil {
+					t.Fatal(err)
+				}
+				claims := testClaims()
+				claims.Issuer = testIssuer
+				claims.Role = "admin"
+				forged := encodeJWT(t, signer.algorithm, claims, signer.signature)
+				// the payload of forged with the signature of token
+				return forged[:strings.LastIndex(forged, ".")] + token[strings.LastIndex(token, "."):]
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		for algorithm, signer := range signers {
+			t.Run(tt.name+"/"+algorithm, func(t *testing.T) {
+				if _, err := signer.Verify(tt.token(t, signer)); !errors.Is(err, errInvalidJWT) {
+					t.Fatalf("err = %v, want %v", err, errInvalidJWT)
+				}
+			})
+		}
+	}
+}
+
+// stubRevocations is a session repository holding only the deny-list.
+type stubRevocations struct {
+	repository.SessionRepository
+	revoked map[string]bool
+}
+
+func (inst *stubRevocations) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	inst.revoked[jti] = true
+	return nil
+}
+
+func (inst *stubRevocations) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	return inst.revoked[jti], nil
+}
+
+// stubCache keeps values without expiry.
+type stubCache map[string]any
+
+func (inst stubCache) Get(key string) (any, bool) {
+	value, ok := inst[key]
+	return value, ok
+}
+
+func (inst stubCache) Put(key string, value any, ttl time.Duration, tags []string) {
+	inst[key] = value
+}
+
+func (inst stubCache) Invalidate(key string) {
+	delete(inst, key)
+}
+
+func (inst stubCache) InvalidateByTag(tag string) {
+	clear(inst)
+}
+
+func (inst stubCache) InvalidateByTags(tags []string) {
+	clear(inst)
+}
+
+func (inst stubCache) CleanExpired() {}
+
+func TestJWTDenyList(t *testing.T) {
+	for algorithm, signer := range newTestJWTs(t) {
+		t.Run(algorithm, func(t *testing.T) {
+			ctx := context.Background()
+			sessions := NewSessions(&stubRevocations{revoked: map[string]bool{}}, signer, stubCache{}, time.Minute)
+
+			token, err := signer.Sign(testClaims())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			session, err := sessions.GetSessionByUUID(ctx, token)
+			if err != nil {
+				t.Fatalf("before revoke: %v", err)
+			}
+			if session.UUID != "jti-1" || session.UserLogin != "alice" {
+				t.Errorf("session = %+v, want jti-1 of alice", session)
+			}
+
+			// the cached answer is dropped by the revoke
+			if err := sessions.DeleteSession(ctx, token); err != nil {
+				t.Fatalf("revoke: %v", err)
+			}
+
+			if _, err := sessions.GetSessionByUUID(ctx, token); !errors.Is(err, utils.ErrorNotFound) {
+				t.Fatalf("err = %v, want %v", err, utils.ErrorNotFound)
+			}
+		})
+	}
+}
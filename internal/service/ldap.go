@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"docs/pkg/ldap"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// LDAPOptions locate users in the directory, see config.LDAP. GroupMapping
+// keys are group DNs, compared without case.
+type LDAPOptions struct {
+	URL            string
+	StartTLS       bool
+	TLSConfig      *tls.Config
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	ObjectClass    string
+	LoginAttribute string
+	GroupAttribute string
+	GroupMapping   map[string]string
+	Timeout        time.Duration
+}
+
+// LDAPAuthenticator checks passwords against an LDAP or Active Directory
+// server: it searches the user entry with the service account, then binds
+// as the user. Users are created on their first login and, with a group
+// mapping, get the role of their directory groups on every login. A login
+// that belongs to a local or single sign-on account is refused, the
+// directory never takes over an account it didn't create.
+//
+// The group mapping only picks the admin or user role, there are no groups
+// of documents to map directory groups onto.
+type LDAPAuthenticator struct {
+	log      *zap.Logger
+	userRepo repository.UserRepository
+	options  LDAPOptions
+}
+
+func NewLDAPAuthenticator(log *zap.Logger, userRepo repository.UserRepository, options LDAPOptions) *LDAPAuthenticator {
+	mapping := make(map[string]string, len(options.GroupMapping))
+	for group, role := range options.GroupMapping {
+		mapping[strings.ToLower(group)] = role
+	}
+	options.GroupMapping = mapping
+
+	return &LDAPAuthenticator{
+		log:      log,
+		userRepo: userRepo,
+		options:  options,
+	}
+}
+
+func (inst *LDAPAuthenticator) Authenticate(ctx context.Context, login, password string) (*model.User, error) {
+	if login == "" || password == "" || utf8.RuneCountInString(login) > loginMaxLen {
+		return nil, utils.ErrorAuthFailed
+	}
+
+	entry, err := inst.bind(ctx, login, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// the directory matches without case, keep the login as it stores it
+	for _, value := range entry.Values(inst.options.LoginAttribute) {
+		if strings.EqualFold(value, login) {
+			login = value
+			break
+		}
+	}
+
+	groups := entry.Values(inst.options.GroupAttribute)
+	for i, group := range groups {
+		groups[i] = strings.ToLower(group)
+	}
+
+	return inst.localUser(ctx, login, groups)
+}
+
+// bind finds the entry of the login and checks the password by binding as
+// it.
+func (inst *LDAPAuthenticator) bind(ctx context.Context, login, password string) (*ldap.Entry, error) {
+	ctx, cancel := context.WithTimeout(ctx, inst.options.Timeout)
+	defer cancel()
+
+	conn, err := ldap.Dial(ctx, inst.options.URL, inst.options.TLSConfig)
+	if err != nil {
+		inst.log.Error("ldap dial", zap.Error(err))
+		return nil, utils.ErrorIdentityProvider
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if inst.options.StartTLS {
+		if err := conn.StartTLS(inst.options.TLSConfig); err != nil {
+			inst.log.Error("ldap starttls", zap.Error(err))
+			return nil, utils.ErrorIdentityProvider
+		}
+	}
+
+	if inst.options.BindDN != "" {
+		if err := conn.Bind(inst.options.BindDN, inst.options.BindPassword); err != nil {
+			inst.log.Error("ldap service bind", zap.Error(err))
+			return nil, utils.ErrorIdentityProvider
+		}
+	}
+
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN: inst.options.BaseDN,
+		Scope:  ldap.ScopeWholeSubtree,
+		Filter: ldap.And(
+			ldap.Equal("objectClass", inst.options.ObjectClass),
+			ldap.Equal(inst.options.LoginAttribute, login),
+		),
+		Attributes: []string{inst.options.LoginAttribute, inst.options.GroupAttribute},
+		SizeLimit:  2,
+	})
+	if err != nil && !ldap.IsResult(err, ldap.ResultNoSuchObject) {
+		inst.log.Error("ldap search", zap.String("login", login), zap.Error(err))
+		return nil, utils.ErrorIdentityProvider
+	}
+
+	if len(entries) != 1 {
+		return nil, utils.ErrorAuthFailed
+	}
+
+	if err := conn.Bind(entries[0].DN, password); err != nil {
+		if ldap.IsResult(err, ldap.ResultInvalidCredentials) {
+			return nil, utils.ErrorAuthFailed
+		}
+		inst.log.Error("ldap user bind", zap.String("login", login), zap.Error(err))
+		return nil, utils.ErrorIdentityProvider
+	}
+
+	return &entries[0], nil
+}
+
+// localUser returns the user of a directory login, creating it on first
+// login. Accounts of other sources are left alone.
+func (inst *LDAPAuthenticator) localUser(ctx context.Context, login string, groups []string) (*model.User, error) {
+	role := mapRole(groups, inst.options.GroupMapping)
+
+	user, err := inst.userRepo.GetUserByLogin(ctx, login)
+	switch {
+	case errors.Is(err, utils.ErrorNotFound):
+		// no local password, the directory checks it
+		user = &model.User{
+			UUID:   uuid.NewString(),
+			Login:  login,
+			Role:   role,
+			Source: model.UserSourceLDAP,
+		}
+		if err := inst.userRepo.CreateUser(ctx, user); err != nil {
+			return nil, err
+		}
+		inst.log.Info("provisioned ldap user", zap.String("login", login))
+		return user, nil
+	case err != nil:
+		return nil, err
+	case user.Source != model.UserSourceLDAP:
+		inst.log.Warn("ldap login matches a non ldap account", zap.String("login", login), zap.String("source", user.Source))
+		return nil, utils.ErrorAuthFailed
+	}
+
+	if len(inst.options.GroupMapping) == 0 {
+		return user, nil
+	}
+
+	if err := syncRole(ctx, inst.log, inst.userRepo, user, role); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
@@ -0,0 +1,514 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	oidcTimeout = 10 * time.Second
+	// oidcJWKSRefresh bounds how often an unknown kid refetches the JWKS.
+	oidcJWKSRefresh = time.Minute
+	// oidcMaxResponse bounds what is read from the provider.
+	oidcMaxResponse = 1 << 20
+)
+
+var errInvalidIDToken = errors.New("invalid id token")
+
+type OIDCOptions struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// HTTPClient talks to the provider, a stub IdP can be plugged in here.
+	HTTPClient *http.Client
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcJWK struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	Curve   string `json:"crv"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// OIDC is the relying party side of an OpenID Connect provider: the
+// authorization code flow with PKCE and ID token validation against the
+// provider's JWKS. The provider configuration is discovered on first use and
+// the keys are refetched when a token names an unknown one.
+type OIDC struct {
+	options OIDCOptions
+	client  *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+}
+
+func NewOIDC(options OIDCOptions) *OIDC {
+	options.Issuer = strings.TrimSuffix(options.Issuer, "/")
+	if len(options.Scopes) == 0 {
+		options.Scopes = []string{"openid"}
+	}
+	if !slices.Contains(options.Scopes, "openid") {
+		options.Scopes = append([]string{"openid"}, options.Scopes...)
+	}
+
+	client := options.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: oidcTimeout}
+	}
+
+	return &OIDC{
+		options: options,
+		client:  client,
+	}
+}
+
+// AuthCodeURL returns where to send the user to log in. The code challenge
+// is the S256 of the verifier passed later to Exchange.
+func (inst *OIDC) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	discovery, err := inst.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("oidc: authorization endpoint: %w", err)
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := endpoint.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", inst.options.ClientID)
+	query.Set("redirect_uri", inst.options.RedirectURL)
+	query.Set("scope", strings.Join(inst.options.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+	endpoint.RawQuery = query.Encode()
+
+	return endpoint.String(), nil
+}
+
+// Exchange redeems the authorization code and returns the claims of the
+// validated ID token.
+func (inst *OIDC) Exchange(ctx context.Context, code, verifier, nonce string) (map[string]any, error) {
+	discovery, err := inst.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", inst.options.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", inst.options.ClientID)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	if inst.options.ClientSecret != "" {
+		request.SetBasicAuth(url.QueryEscape(inst.options.ClientID), url.QueryEscape(inst.options.ClientSecret))
+	}
+
+	token := &oidcTokenResponse{}
+	status, err := inst.do(request, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.Error != "" {
+		return nil, fmt.Errorf("%w: %s %s", errInvalidIDToken, token.Error, token.ErrorDescription)
+	}
+
+	if status != http.StatusOK || token.IDToken == "" {
+		return nil, fmt.Errorf("oidc: token endpoint answered %d without an id token", status)
+	}
+
+	return inst.VerifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature of the ID token against the provider
+// keys, its issuer, audience, lifetime and nonce, and returns its claims.
+func (inst *OIDC) VerifyIDToken(ctx context.Context, token, nonce string) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidIDToken
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errInvalidIDToken
+	}
+
+	header := &struct {
+		Algorithm string `json:"alg"`
+		KeyID     string `json:"kid"`
+	}{}
+	if err := json.Unmarshal(headerJSON, header); err != nil {
+		return nil, errInvalidIDToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidIDToken
+	}
+
+	key, err := inst.key(ctx, header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := verifyJWS(header.Algorithm, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errInvalidIDToken
+	}
+
+	claims := map[string]any{}
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, errInvalidIDToken
+	}
+
+	if err := inst.validateClaims(claims, nonce); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (inst *OIDC) validateClaims(claims map[string]any, nonce string) error {
+	if issuer, _ := claims["iss"].(string); issuer != inst.options.Issuer {
+		return fmt.Errorf("%w: issuer %q", errInvalidIDToken, issuer)
+	}
+
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return fmt.Errorf("%w: no subject", errInvalidIDToken)
+	}
+
+	audience := claimStrings(claims, "aud")
+	if !slices.Contains(audience, inst.options.ClientID) {
+		return fmt.Errorf("%w: audience", errInvalidIDToken)
+	}
+
+	if party, ok := claims["azp"].(string); ok && party != inst.options.ClientID {
+		return fmt.Errorf("%w: authorized party %q", errInvalidIDToken, party)
+	}
+
+	now := time.Now()
+	expiresAt, ok := claimTime(claims, "exp")
+	if !ok || now.After(expiresAt.Add(jwtLeeway)) {
+		return fmt.Errorf("%w: expired", errInvalidIDToken)
+	}
+
+	if issuedAt, ok := claimTime(claims, "iat"); ok && now.Add(jwtLeeway).Before(issuedAt) {
+		return fmt.Errorf("%w: issued in the future", errInvalidIDToken)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return fmt.Errorf("%w: nonce", errInvalidIDToken)
+	}
+
+	return nil
+}
+
+func (inst *OIDC) discover(ctx context.Context) (*oidcDiscovery, error) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	if inst.discovery != nil {
+		return inst.discovery, nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, inst.options.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	discovery := &oidcDiscovery{}
+	status, err := inst.do(request, discovery)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery answered %d", status)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != inst.options.Issuer {
+		return nil, fmt.Errorf("oidc: discovered issuer %q does not match %q", discovery.Issuer, inst.options.Issuer)
+	}
+
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("oidc: discovery document lacks an endpoint")
+	}
+
+	inst.discovery = discovery
+
+	return discovery, nil
+}
+
+// key returns the provider key by kid, refetching the JWKS at most once per
+// oidcJWKSRefresh when it is not known. An empty kid matches a single key.
+func (inst *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	discovery, err := inst.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	if key, ok := inst.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	if time.Since(inst.keysAt) < oidcJWKSRefresh {
+		return nil, fmt.Errorf("%w: unknown key %q", errInvalidIDToken, kid)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &struct {
+		Keys []oidcJWK `json:"keys"`
+	}{}
+	status, err := inst.do(request, set)
+	if err != nil {
+		return nil, err
+	}
+
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("oidc: jwks answered %d", status)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.KeyID] = key
+		}
+	}
+	inst.keys, inst.keysAt = keys, time.Now()
+
+	if key, ok := inst.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown key %q", errInvalidIDToken, kid)
+}
+
+func (inst *OIDC) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if key, ok := inst.keys[kid]; ok {
+		return key, true
+	}
+
+	if kid == "" && len(inst.keys) == 1 {
+		for _, key := range inst.keys {
+			return key, true
+		}
+	}
+
+	return nil, false
+}
+
+// do sends the request and decodes a JSON answer into out, the status is
+// returned for the caller to judge.
+func (inst *OIDC) do(request *http.Request, out any) (int, error) {
+	response, err := inst.client.Do(request)
+	if err != nil {
+		return 0, fmt.Errorf("oidc: %w", err)
+	}
+	defer response.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(response.Body, oidcMaxResponse)).Decode(out); err != nil {
+		return response.StatusCode, fmt.Errorf("oidc: decode %s: %w", request.URL.Path, err)
+	}
+
+	return response.StatusCode, nil
+}
+
+func (inst *oidcJWK) publicKey() (crypto.PublicKey, error) {
+	switch inst.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(inst.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(inst.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("oidc: bad rsa exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch inst.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("oidc: unsupported curve %q", inst.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(inst.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(inst.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("oidc: ec point is not on the curve")
+		}
+		return key, nil
+	case "OKP":
+		if inst.Curve != "Ed25519" {
+			return nil, fmt.Errorf("oidc: unsupported curve %q", inst.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(inst.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("oidc: bad ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("oidc: unsupported key type %q", inst.KeyType)
+	}
+}
+
+// verifyJWS checks a signature made with one of the asymmetric algorithms an
+// OpenID provider signs ID tokens with. The key type must fit the algorithm.
+func verifyJWS(algorithm string, key crypto.PublicKey, signingInput, signature []byte) error {
+	var (
+		newHash func() hash.Hash
+		hashID  crypto.Hash
+	)
+	switch algorithm {
+	case "RS256", "ES256":
+		newHash, hashID = sha256.New, crypto.SHA256
+	case "RS384", "ES384":
+		newHash, hashID = sha512.New384, crypto.SHA384
+	case "RS512":
+		newHash, hashID = sha512.New, crypto.SHA512
+	case JWTAlgorithmEdDSA:
+		if key, ok := key.(ed25519.PublicKey); ok && ed25519.Verify(key, signingInput, signature) {
+			return nil
+		}
+		return errInvalidIDToken
+	default:
+		return fmt.Errorf("%w: algorithm %q", errInvalidIDToken, algorithm)
+	}
+
+	digest := newHash()
+	digest.Write(signingInput)
+	sum := digest.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if algorithm[0] == 'R' && rsa.VerifyPKCS1v15(key, hashID, sum, signature) == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if algorithm[0] == 'E' && len(signature) == 2*size && key.Curve.Params().BitSize == hashID.Size()*8 {
+			r := new(big.Int).SetBytes(signature[:size])
+			s := new(big.Int).SetBytes(signature[size:])
+			if ecdsa.Verify(key, sum, r, s) {
+				return nil
+			}
+		}
+	}
+
+	return errInvalidIDToken
+}
+
+// claimStrings reads a claim holding a string or a list of strings, like
+// aud or a groups claim.
+func claimStrings(claims map[string]any, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []any:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			if item, ok := item.(string); ok {
+				values = append(values, item)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func claimTime(claims map[string]any, name string) (time.Time, bool) {
+	number, ok := claims[name].(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(seconds), 0), true
+}
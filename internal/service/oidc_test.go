@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	stubClientID = "docs"
+	stubKeyID    = "rsa-1"
+	stubNonce    = "nonce-1"
+	stubCode     = "code-1"
+	stubVerifier = "verifier-1"
+)
+
+// stubIdP is a local OpenID provider: discovery, a token endpoint answering
+// with idToken and a JWKS holding one RSA and one Ed25519 key.
+type stubIdP struct {
+	server     *httptest.Server
+	rsaKey     *rsa.PrivateKey
+	edKey      ed25519.PrivateKey
+	idToken    string
+	jwksHits   atomic.Int32
+	tokenForms chan url.Values
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &stubIdP{rsaKey: rsaKey, edKey: edKey, tokenForms: make(chan url.Values, 1)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeStubJSON(w, map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.jwksHits.Add(1)
+		writeStubJSON(w, map[string]any{"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"kid": stubKeyID,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "OKP",
+				"kid": "ed-1",
+				"crv": "Ed25519",
+				"x":   base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey)),
+			},
+		}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		idp.tokenForms <- r.PostForm
+		if r.PostForm.Get("code") != stubCode {
+			w.WriteHeader(http.StatusBadRequest)
+			writeStubJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		writeStubJSON(w, map[string]string{"id_token": idp.idToken, "token_type": "Bearer"})
+	})
+
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (inst *stubIdP) provider() *OIDC {
+	return NewOIDC(OIDCOptions{
+		Issuer:      inst.server.URL,
+		ClientID:    stubClientID,
+		RedirectURL: "https://docs.example/api/auth/oidc/callback",
+		HTTPClient:  inst.server.Client(),
+	})
+}
+
+// claims returns the claims of a valid ID token, cases change them.
+func (inst *stubIdP) claims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":   inst.server.URL,
+		"sub":   "subject-1",
+		"aud":   stubClientID,
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": stubNonce,
+	}
+}
+
+// sign makes a compact JWS with the header algorithm and kid. RS* signs
+// with the RSA key, EdDSA with the Ed25519 key, anything else gets an
+// empty signature.
+func (inst *stubIdP) sign(t *testing.T, algorithm, kid string, claims map[string]any) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	var signature []byte
+	switch algorithm {
+	case "RS256":
+		sum := sha256.Sum256([]byte(input))
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, inst.rsaKey, crypto.SHA256, sum[:]); err != nil {
+			t.Fatal(err)
+		}
+	case JWTAlgorithmEdDSA:
+		signature = ed25519.Sign(inst.edKey, []byte(input))
+	}
+
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeStubJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func TestOIDCExchange(t *testing.T) {
+	idp := newStubIdP(t)
+	idp.idToken = idp.sign(t, "RS256", stubKeyID, idp.claims())
+	provider := idp.provider()
+
+	redirect, err := provider.AuthCodeURL(context.Background(), "state-1", stubNonce, stubVerifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authURL, err := url.Parse(redirect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := sha256.Sum256([]byte(stubVerifier))
+	query := authURL.Query()
+	if query.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) || query.Get("code_challenge_method") != "S256" {
+		t.Errorf("authorization url lacks the S256 challenge: %s", redirect)
+	}
+	if query.Get("nonce") != stubNonce || query.Get("state") != "state-1" || query.Get("client_id") != stubClientID {
+		t.Errorf("authorization url lacks state, nonce or client: %s", redirect)
+	}
+
+	claims, err := provider.Exchange(context.Background(), stubCode, stubVerifier, stubNonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims["sub"] != "subject-1" {
+		t.Errorf("sub = %v, want subject-1", claims["sub"])
+	}
+
+	if form := <-idp.tokenForms; form.Get("code_verifier") != stubVerifier || form.Get("grant_type") != "authorization_code" {
+		t.Errorf("token request form = %v", form)
+	}
+}
+
+func TestOIDCExchangeRejectsProviderError(t *testing.T) {
+	idp := newStubIdP(t)
+
+	_, err := idp.provider().Exchange(context.Background(), "wrong", stubVerifier, stubNonce)
+	if !errors.Is(err, errInvalidIDToken) {
+		t.Fatalf("err = %v, want %v", err, errInvalidIDToken)
+	}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	idp := newStubIdP(t)
+
+	with := func(change func(claims map[string]any)) map[string]any {
+		claims := idp.claims()
+		change(claims)
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   func() string
+		nonce   string
+		wantErr bool
+	}{
+		{
+			name:  "rs256",
+			token: func() string { return idp.sign(t, "RS256", stubKeyID, idp.claims()) },
+		},
+		{
+			name:  "eddsa",
+			token: func() string { return idp.sign(t, JWTAlgorithmEdDSA, "ed-1", idp.claims()) },
+		},
+		{
+			name: "audience list",
+			token: func() string {
+				return idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { c["aud"] = []string{"other", stubClientID} }))
+			},
+		},
+		{
+			name:    "alg none",
+			token:   func() string { return idp.sign(t, "none", stubKeyID, idp.claims()) },
+			wantErr: true,
+		},
+		{
+			name:    "alg hs256",
+			token:   func() string { return idp.sign(t, "HS256", stubKeyID, idp.claims()) },
+			wantErr: true,
+		},
+		{
+			name: "alg of another key",
+			token: func() string {
+				// an Ed25519 signature presented under the RSA kid
+				return idp.sign(t, JWTAlgorithmEdDSA, stubKeyID, idp.claims())
+			},
+			wantErr: true,
+		},
+		{
+			name:    "unknown kid",
+			token:   func() string { return idp.sign(t, "RS256", "rotated", idp.claims()) },
+			wantErr: true,
+		},
+		{
+			name: "tampered payload",
+			token: func() string {
+				token := idp.sign(t, "RS256", stubKeyID, idp.claims())
+				other := idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { c["sub"] = "admin" }))
+				return other[:strings.LastIndex(other, ".")] + token[strings.LastIndex(token, "."):]
+			},
+			wantErr: true,
+		},
+		{
+			name: "other audience",
+			token: func() string {
+				return idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { c["aud"] = "other" }))
+			},
+			wantErr: true,
+		},
+		{
+			name: "other authorized party",
+			token: func() string {
+				return idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { c["azp"] = "other" }))
+			},
+			wantErr: true,
+		},
+		{
+			name: "other issuer",
+			token: func() string {
+				return idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { c["iss"] = "https://idp.example" }))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "other nonce",
+			token:   func() string { return idp.sign(t, "RS256", stubKeyID, idp.claims()) },
+			nonce:   "nonce-2",
+			wantErr: true,
+		},
+		{
+			name: "no nonce",
+			token: func() string {
+				return idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { delete(c, "nonce") }))
+			},
+			wantErr: true,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				return idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { c["exp"] = time.Now().Add(-jwtLeeway - time.Minute).Unix() }))
+			},
+			wantErr: true,
+		},
+		{
+			name: "no expiry",
+			token: func() string {
+				return idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { delete(c, "exp") }))
+			},
+			wantErr: true,
+		},
+		{
+			name: "issued in the future",
+			token: func() string {
+				return idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { c["iat"] = time.Now().Add(jwtLeeway + time.Hour).Unix() }))
+			},
+			wantErr: true,
+		},
+		{
+			name: "no subject",
+			token: func() string {
+				return idp.sign(t, "RS256", stubKeyID, with(func(c map[string]any) { delete(c, "sub") }))
+			},
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			token:   func() string { return "not.a-token" },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nonce := tt.nonce
+			if nonce == "" {
+				nonce = stubNonce
+			}
+
+			claims, err := idp.provider().VerifyIDToken(context.Background(), tt.token(), nonce)
+			if tt.wantErr {
+				if !errors.Is(err, errInvalidIDToken) {
+					t.Fatalf("err = %v, want %v", err, errInvalidIDToken)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims["sub"] != "subject-1" {
+				t.Errorf("sub = %v, want subject-1", claims["sub"])
+			}
+		})
+	}
+}
+
+func TestOIDCUnknownKidRefetchIsBounded(t *testing.T) {
+	idp := newStubIdP(t)
+	provider := idp.provider()
+
+	if _, err := provider.VerifyIDToken(context.Background(), idp.sign(t, "RS256", stubKeyID, idp.claims()), stubNonce); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		_, err := provider.VerifyIDToken(context.Background(), idp.sign(t, "RS256", "rotated", idp.claims()), stubNonce)
+		if !errors.Is(err, errInvalidIDToken) {
+			t.Fatalf("err = %v, want %v", err, errInvalidIDToken)
+		}
+	}
+
+	if hits := idp.jwksHits.Load(); hits != 1 {
+		t.Errorf("jwks fetched %d times, want 1", hits)
+	}
+}
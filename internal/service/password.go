@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ChangePassword sets a new password after checking the current one, every
+// other session of the user is logged out.
+func (inst *Registration) ChangePassword(ctx context.Context, principal *model.Principal, oldPassword, newPassword string) (err error) {
+	defer func() {
+		event := newAuditEvent(model.AuditPasswordChange, principal.Login, principal.SessionUUID, "", err)
+		event.Target = principal.Login
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	user, err := inst.userRepo.GetUserByUUID(ctx, principal.UserUUID)
+	if err != nil {
+		return err
+	}
+
+	if err := inst.hasher.Compare(user.Password, oldPassword); err != nil {
+		return fmt.Errorf("%w: current password does not match", utils.ErrorInvalidPassword)
+	}
+
+	if err := inst.policy.ValidatePassword(ctx, user.Login, newPassword); err != nil {
+		return err
+	}
+
+	crypPswd, err := inst.hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := inst.userRepo.UpdatePassword(ctx, user.UUID, crypPswd); err != nil {
+		return err
+	}
+
+	if _, err := inst.sessionRepo.RevokeUserFamilies(ctx, user.Login, principal.FamilyUUID); err != nil {
+		inst.log.Error("revoke sessions after password change", zap.String("login", user.Login), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// IssuePasswordReset creates a single-use reset token for the login, admin
+// only. The plain token is returned once and handed to the user out of band.
+func (inst *Registration) IssuePasswordReset(ctx context.Context, principal *model.Principal, login string) (_ *model.PasswordReset, err error) {
+	defer func() {
+		event := newAuditEvent(model.AuditPasswordIssue, principal.Login, principal.SessionUUID, "", err)
+		event.Target = login
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if !principal.IsAdmin() {
+		return nil, utils.ErrorNoAccess
+	}
+
+	user, err := inst.userRepo.GetUserByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	reset := &model.PasswordReset{
+		Hash:      hashToken(token),
+		Token:     token,
+		UserUUID:  user.UUID,
+		UserLogin: user.Login,
+		CreateBy:  principal.Login,
+		ExpiresAt: now.Add(inst.options.ResetTTL),
+		CreateAt:  now,
+	}
+
+	if err := inst.resetRepo.CreatePasswordReset(ctx, reset); err != nil {
+		return nil, err
+	}
+
+	return reset, nil
+}
+
+// ResetPassword sets the password with a reset token and logs the user out
+// of every session.
+func (inst *Registration) ResetPassword(ctx context.Context, token, password string) (err error) {
+	var login string
+	defer func() {
+		event := newAuditEvent(model.AuditPasswordReset, login, "", "", err)
+		event.Target = login
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if token == "" {
+		return utils.ErrorInvalidResetToken
+	}
+
+	// the login is needed to check the password, ConsumePasswordReset
+	// checks the token again
+	pending, err := inst.resetRepo.GetPasswordReset(ctx, hashToken(token))
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return utils.ErrorInvalidResetToken
+		}
+		return err
+	}
+	login = pending.UserLogin
+
+	if err := inst.policy.ValidatePassword(ctx, pending.UserLogin, password); err != nil {
+		return err
+	}
+
+	crypPswd, err := inst.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	reset, err := inst.resetRepo.ConsumePasswordReset(ctx, hashToken(token), crypPswd)
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return utils.ErrorInvalidResetToken
+		}
+		return err
+	}
+	login = reset.UserLogin
+
+	if _, err := inst.sessionRepo.RevokeUserFamilies(ctx, reset.UserLogin, ""); err != nil {
+		inst.log.Error("revoke sessions after password reset", zap.String("login", reset.UserLogin), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2idID names argon2id hashes in the PHC string format.
+const argon2idID = "argon2id"
+
+var errPasswordMismatch = errors.New("password does not match")
+
+// Argon2Options are the argon2id parameters of new hashes, see
+// config.Argon2. Memory is in KiB.
+type Argon2Options struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordHasher hashes passwords with argon2id in the PHC string format,
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<key>.
+// Older bcrypt hashes are still checked, NeedsRehash tells which stored
+// hashes to replace.
+type PasswordHasher struct {
+	options Argon2Options
+}
+
+func NewPasswordHasher(options Argon2Options) *PasswordHasher {
+	return &PasswordHasher{
+		options: options,
+	}
+}
+
+func (inst *PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, inst.options.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, inst.options.Iterations, inst.options.Memory, inst.options.Parallelism, inst.options.KeyLength)
+
+	return fmt.Sprintf(
+		"$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idID,
+		argon2.Version,
+		inst.options.Memory,
+		inst.options.Iterations,
+		inst.options.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Compare returns nil when password matches the argon2id or bcrypt hash.
+func (inst *PasswordHasher) Compare(hash, password string) error {
+	if !strings.HasPrefix(hash, "$"+argon2idID+"$") {
+		if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+			return errPasswordMismatch
+		}
+		return nil
+	}
+
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	key := argon2.IDKey([]byte(password), params.salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(params.key)))
+	if subtle.ConstantTimeCompare(key, params.key) != 1 {
+		return errPasswordMismatch
+	}
+
+	return nil
+}
+
+// NeedsRehash reports whether a stored hash is bcrypt or argon2id with other
+// parameters than new hashes get. Users without a password never do.
+func (inst *PasswordHasher) NeedsRehash(hash string) bool {
+	if hash == "" {
+		return false
+	}
+
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Argon2Options != inst.options
+}
+
+type argon2idHash struct {
+	Argon2Options
+	salt []byte
+	key  []byte
+}
+
+func parseArgon2id(hash string) (*argon2idHash, error) {
+	// "", "argon2id", "v=19", "m=..,t=..,p=..", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != argon2idID {
+		return nil, fmt.Errorf("%w: not an argon2id hash", errPasswordMismatch)
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("%w: unsupported argon2 version", errPasswordMismatch)
+	}
+
+	params := &argon2idHash{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return nil, fmt.Errorf("%w: malformed argon2id parameters", errPasswordMismatch)
+	}
+
+	var err error
+	if params.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("%w: malformed argon2id salt", errPasswordMismatch)
+	}
+
+	if params.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("%w: malformed argon2id key", errPasswordMismatch)
+	}
+
+	if params.Memory == 0 || params.Iterations == 0 || params.Parallelism == 0 || len(params.key) == 0 {
+		return nil, fmt.Errorf("%w: malformed argon2id parameters", errPasswordMismatch)
+	}
+	params.SaltLength, params.KeyLength = uint32(len(params.salt)), uint32(len(params.key))
+
+	return params, nil
+}
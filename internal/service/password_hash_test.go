@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testArgon2 are cheap parameters, the tests hash a lot.
+var testArgon2 = Argon2Options{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHashRoundTrip(t *testing.T) {
+	hasher := NewPasswordHasher(testArgon2)
+
+	hash, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("hash = %s, want the PHC string of the options", hash)
+	}
+
+	if err := hasher.Compare(hash, "correct horse"); err != nil {
+		t.Errorf("compare the password: %v", err)
+	}
+
+	if err := hasher.Compare(hash, "correct horse "); !errors.Is(err, errPasswordMismatch) {
+		t.Errorf("compare another password: err = %v, want %v", err, errPasswordMismatch)
+	}
+
+	if hasher.NeedsRehash(hash) {
+		t.Errorf("a hash with the current options needs a rehash")
+	}
+
+	params, err := parseArgon2id(hash)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if params.Argon2Options != testArgon2 {
+		t.Errorf("parsed options = %+v, want %+v", params.Argon2Options, testArgon2)
+	}
+
+	// a fresh salt every time
+	again, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == hash {
+		t.Errorf("two hashes of one password are equal")
+	}
+}
+
+func TestPasswordHashOtherParameters(t *testing.T) {
+	old := NewPasswordHasher(Argon2Options{Memory: 32, Iterations: 2, Parallelism: 1, SaltLength: 8, KeyLength: 16})
+	hash, err := old.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasher := NewPasswordHasher(testArgon2)
+
+	// the stored parameters are used to check, not the current ones
+	if err := hasher.Compare(hash, "correct horse"); err != nil {
+		t.Errorf("compare: %v", err)
+	}
+
+	if !hasher.NeedsRehash(hash) {
+		t.Errorf("a hash with other options needs no rehash")
+	}
+}
+
+func TestPasswordHashMalformed(t *testing.T) {
+	const (
+		salt = "c2FsdHNhbHRzYWx0c2FsdA"
+		key  = "a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2V5a2U"
+	)
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "argon2i", hash: "$argon2i$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "version 16", hash: "$argon2id$v=16$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "no version", hash: "$argon2id$m=64,t=1,p=1$" + salt + "$" + key},
+		{name: "parameters out of order", hash: "$argon2id$v=19$t=1,m=64,p=1$" + salt + "$" + key},
+		{name: "parameter not a number", hash: "$argon2id$v=19$m=x,t=1,p=1$" + salt + "$" + key},
+		{name: "zero memory", hash: "$argon2id$v=19$m=0,t=1,p=1$" + salt + "$" + key},
+		{name: "zero iterations", hash: "$argon2id$v=19$m=64,t=0,p=1$" + salt + "$" + key},
+		{name: "zero parallelism", hash: "$argon2id$v=19$m=64,t=1,p=0$" + salt + "$" + key},
+		{name: "parallelism over 255", hash: "$argon2id$v=19$m=64,t=1,p=256$" + salt + "$" + key},
+		{name: "salt not base64", hash: "$argon2id$v=19$m=64,t=1,p=1$!!!$" + key},
+		{name: "padded key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key + "="},
+		{name: "empty key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$"},
+		{name: "no key", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt},
+		{name: "extra field", hash: "$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key + "$x"},
+		{name: "leading text", hash: "x$argon2id$v=19$m=64,t=1,p=1$" + salt + "$" + key},
+	}
+
+	hasher := NewPasswordHasher(testArgon2)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseArgon2id(tt.hash); !errors.Is(err, errPasswordMismatch) {
+				t.Fatalf("parse: err = %v, want %v", err, errPasswordMismatch)
+			}
+
+			if err := hasher.Compare(tt.hash, "password"); !errors.Is(err, errPasswordMismatch) {
+				t.Errorf("compare: err = %v, want %v", err, errPasswordMismatch)
+			}
+
+			if !hasher.NeedsRehash(tt.hash) {
+				t.Errorf("a malformed hash needs no rehash")
+			}
+		})
+	}
+}
+
+func TestPasswordHashNoPassword(t *testing.T) {
+	hasher := NewPasswordHasher(testArgon2)
+
+	if hasher.NeedsRehash("") {
+		t.Errorf("a user without a password needs a rehash")
+	}
+
+	if err := hasher.Compare("", ""); !errors.Is(err, errPasswordMismatch) {
+		t.Errorf("err = %v, want %v", err, errPasswordMismatch)
+	}
+}
+
+// stubPasswordUsers holds one user and records password updates.
+type stubPasswordUsers struct {
+	repository.UserRepository
+	user    *model.User
+	updates int
+}
+
+func (inst *stubPasswordUsers) GetUserByLogin(ctx context.Context, login string) (*model.User, error) {
+	if login != inst.user.Login {
+		return nil, utils.ErrorNotFound
+	}
+
+	user := *inst.user
+	return &user, nil
+}
+
+func (inst *stubPasswordUsers) UpdatePassword(ctx context.Context, uuid, password string) error {
+	inst.user.Password = password
+	inst.updates++
+	return nil
+}
+
+func TestLegacyHashUpgrade(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hasher := NewPasswordHasher(testArgon2)
+	if !hasher.NeedsRehash(string(legacy)) {
+		t.Fatalf("a bcrypt hash needs no rehash")
+	}
+
+	ctx := context.Background()
+	users := &stubPasswordUsers{user: &model.User{UUID: "user-1", Login: "alice", Password: string(legacy)}}
+	authenticator := NewPasswordAuthenticator(zap.NewNop(), users, hasher)
+
+	if _, err := authenticator.Authenticate(ctx, "alice", "wrong horse"); err == nil {
+		t.Fatalf("a wrong password against the bcrypt hash was accepted")
+	}
+	if users.updates != 0 {
+		t.Fatalf("a wrong password rehashed the user")
+	}
+
+	if _, err := authenticator.Authenticate(ctx, "alice", "correct horse"); err != nil {
+		t.Fatalf("bcrypt login: %v", err)
+	}
+
+	if users.updates != 1 || !strings.HasPrefix(users.user.Password, "$argon2id$") || hasher.NeedsRehash(users.user.Password) {
+		t.Fatalf("after login the hash is %s with %d updates, want one argon2id rehash", users.user.Password, users.updates)
+	}
+
+	// the upgraded hash works and is not replaced again
+	if _, err := authenticator.Authenticate(ctx, "alice", "correct horse"); err != nil {
+		t.Fatalf("argon2id login: %v", err)
+	}
+	if users.updates != 1 {
+		t.Errorf("a current hash was rehashed, %d updates", users.updates)
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"docs/internal/utils"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LoginPolicy is what a login may look like, see config.LoginPolicy. Logins
+// are letters and digits plus the AllowedSpecials.
+type LoginPolicy struct {
+	MinLength           int
+	MaxLength           int
+	AllowedSpecials     string
+	ForbiddenSubstrings []string
+}
+
+// PasswordPolicy is what a password must look like, see
+// config.PasswordPolicy. Specials are anything but letters and digits.
+type PasswordPolicy struct {
+	MinLength           int
+	MaxLength           int
+	MinLetters          int
+	MinUpper            int
+	MinLower            int
+	MinDigits           int
+	MinSpecials         int
+	ForbidLogin         bool
+	ForbiddenSubstrings []string
+}
+
+// BreachChecker tells whether a password is known from data breaches.
+type BreachChecker interface {
+	Breached(ctx context.Context, password string) (bool, error)
+}
+
+// Policy checks logins and passwords of new users and new passwords. A
+// failed check is a utils.PolicyError listing every rule that failed.
+type Policy struct {
+	login    LoginPolicy
+	password PasswordPolicy
+	breached BreachChecker
+}
+
+// NewPolicy checks passwords against breached unless it is nil.
+func NewPolicy(login LoginPolicy, password PasswordPolicy, breached BreachChecker) *Policy {
+	return &Policy{
+		login:    login,
+		password: password,
+		breached: breached,
+	}
+}
+
+func (inst *Policy) ValidateLogin(login string) error {
+	var violations []utils.PolicyViolation
+	add := func(rule, format string, args ...any) {
+		violations = append(violations, utils.PolicyViolation{Rule: rule, Text: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(login)
+	if length < inst.login.MinLength {
+		add("min_length", "login must be at least %d characters", inst.login.MinLength)
+	}
+	if length > inst.login.MaxLength {
+		add("max_length", "login must be at most %d characters", inst.login.MaxLength)
+	}
+
+	for _, r := range login {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(inst.login.AllowedSpecials, r) {
+			add("charset", "login contains an inadmissible character %q", r)
+			break
+		}
+	}
+
+	if substring := containsAny(login, inst.login.ForbiddenSubstrings); substring != "" {
+		add("forbidden_substring", "login must not contain %q", substring)
+	}
+
+	if len(violations) > 0 {
+		return &utils.PolicyError{Err: utils.ErrorInvalidLogin, Violations: violations}
+	}
+
+	return nil
+}
+
+// ValidatePassword checks the password of login.
+func (inst *Policy) ValidatePassword(ctx context.Context, login, password string) error {
+	var violations []utils.PolicyViolation
+	add := func(rule, format string, args ...any) {
+		violations = append(violations, utils.PolicyViolation{Rule: rule, Text: fmt.Sprintf(format, args...)})
+	}
+
+	length := utf8.RuneCountInString(password)
+	if length < inst.password.MinLength {
+		add("min_length", "password must be at least %d characters", inst.password.MinLength)
+	}
+	if length > inst.password.MaxLength {
+		add("max_length", "password must be at most %d characters", inst.password.MaxLength)
+	}
+
+	var letters, upper, lower, digits, specials int
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+			if unicode.IsLower(r) {
+				lower++
+			}
+		case unicode.IsDigit(r):
+			digits++
+		default:
+			specials++
+		}
+	}
+
+	if letters < inst.password.MinLetters {
+		add("min_letters", "password must contain at least %d letters", inst.password.MinLetters)
+	}
+	if upper < inst.password.MinUpper {
+		add("min_upper", "password must contain at least %d uppercase letters", inst.password.MinUpper)
+	}
+	if lower < inst.password.MinLower {
+		add("min_lower", "password must contain at least %d lowercase letters", inst.password.MinLower)
+	}
+	if digits < inst.password.MinDigits {
+		add("min_digits", "password must contain at least %d digits", inst.password.MinDigits)
+	}
+	if specials < inst.password.MinSpecials {
+		add("min_specials", "password must contain at least %d special characters", inst.password.MinSpecials)
+	}
+
+	if inst.password.ForbidLogin && login != "" && strings.Contains(strings.ToLower(password), strings.ToLower(login)) {
+		add("contains_login", "password must not contain the login")
+	}
+
+	if substring := containsAny(password, inst.password.ForbiddenSubstrings); substring != "" {
+		add("forbidden_substring", "password must not contain %q", substring)
+	}
+
+	if inst.breached != nil {
+		breached, err := inst.breached.Breached(ctx, password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			add("breached", "password is known from a data breach")
+		}
+	}
+
+	if len(violations) > 0 {
+		return &utils.PolicyError{Err: utils.ErrorInvalidPassword, Violations: violations}
+	}
+
+	return nil
+}
+
+// containsAny returns the first of substrings that value contains, compared
+// without case, or an empty string.
+func containsAny(value string, substrings []string) string {
+	value = strings.ToLower(value)
+	for _, substring := range substrings {
+		if substring != "" && strings.Contains(value, strings.ToLower(substring)) {
+			return substring
+		}
+	}
+
+	return ""
+}
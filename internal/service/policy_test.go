@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"docs/internal/utils"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// stubBreached knows one breached password.
+type stubBreached struct {
+	password string
+	err      error
+}
+
+func (inst *stubBreached) Breached(ctx context.Context, password string) (bool, error) {
+	return password == inst.password, inst.err
+}
+
+// violatedRules returns the rules of a PolicyError wrapping want.
+func violatedRules(t *testing.T, err, want error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+
+	var policyErr *utils.PolicyError
+	if !errors.As(err, &policyErr) || !errors.Is(err, want) {
+		t.Fatalf("err = %v, want a policy error of %v", err, want)
+	}
+
+	rules := make([]string, 0, len(policyErr.Violations))
+	for _, violation := range policyErr.Violations {
+		rules = append(rules, violation.Rule)
+	}
+
+	return rules
+}
+
+func TestValidateLogin(t *testing.T) {
+	policy := NewPolicy(LoginPolicy{
+		MinLength:           3,
+		MaxLength:           10,
+		AllowedSpecials:     "._",
+		ForbiddenSubstrings: []string{"admin"},
+	}, PasswordPolicy{}, nil)
+
+	tests := []struct {
+		name  string
+		login string
+		want  []string
+	}{
+		{name: "valid", login: "alice.b_2"},
+		{name: "letters of any script", login: "юлия"},
+		{name: "too short", login: "al", want: []string{"min_length"}},
+		{name: "too long", login: "alexandrina", want: []string{"max_length"}},
+		{name: "length in characters", login: "ёжикёжик"},
+		{name: "special not allowed", login: "alice-b", want: []string{"charset"}},
+		{name: "space", login: "alice b", want: []string{"charset"}},
+		{name: "forbidden substring in any case", login: "myAdmin", want: []string{"forbidden_substring"}},
+		{name: "every failed rule", login: "a-", want: []string{"min_length", "charset"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violatedRules(t, policy.ValidateLogin(tt.login), utils.ErrorInvalidLogin)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	breached := &stubBreached{password: "Passw0rd!"}
+	policy := NewPolicy(LoginPolicy{}, PasswordPolicy{
+		MinLength:           8,
+		MaxLength:           16,
+		MinLetters:          2,
+		MinUpper:            1,
+		MinLower:            1,
+		MinDigits:           1,
+		MinSpecials:         1,
+		ForbidLogin:         true,
+		ForbiddenSubstrings: []string{"docs"},
+	}, breached)
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		want     []string
+	}{
+		{name: "valid", login: "alice", password: "Tr0ub4dor&3"},
+		{name: "too short", login: "alice", password: "Tr0u&b", want: []string{"min_length"}},
+		{name: "too long", login: "alice", password: "Tr0ub4dor&3Tr0ub4dor&3", want: []string{"max_length"}},
+		{name: "too few letters", login: "alice", password: "1234567A&", want: []string{"min_letters", "min_lower"}},
+		{name: "no uppercase", login: "alice", password: "tr0ub4dor&3", want: []string{"min_upper"}},
+		{name: "no lowercase", login: "alice", password: "TR0UB4DOR&3", want: []string{"min_lower"}},
+		{name: "no digit", login: "alice", password: "Troubador&!", want: []string{"min_digits"}},
+		{name: "no special", login: "alice", password: "Tr0ub4dor33", want: []string{"min_specials"}},
+		{name: "non-ASCII letters count", login: "alice", password: "Пароль1!"},
+		{name: "contains the login in any case", login: "alice", password: "xALICEx1!", want: []string{"contains_login"}},
+		{name: "no login to contain", password: "xALICEx1!"},
+		{name: "forbidden substring", login: "alice", password: "MyDocs&123", want: []string{"forbidden_substring"}},
+		{name: "breached", login: "alice", password: "Passw0rd!", want: []string{"breached"}},
+		{name: "every failed rule", login: "alice", password: "alice", want: []string{"min_length", "min_upper", "min_digits", "min_specials", "contains_login"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violatedRules(t, policy.ValidatePassword(context.Background(), tt.login, tt.password), utils.ErrorInvalidPassword)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("violations = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidatePasswordBreachError(t *testing.T) {
+	failure := errors.New("breached list unavailable")
+	policy := NewPolicy(LoginPolicy{}, PasswordPolicy{MaxLength: 64}, &stubBreached{err: failure})
+
+	// a password can't pass because the list could not be read
+	if err := policy.ValidatePassword(context.Background(), "alice", "Tr0ub4dor&3"); !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	displayNameMaxLength = 100
+	emailMaxLength       = 254
+	localeMaxLength      = 35
+)
+
+// localeRegexp accepts BCP 47 like tags, en, pt-BR or zh_Hant_TW.
+var localeRegexp = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{2,8})*$`)
+
+// avatarMimes are the raster images an avatar can be. Browsers run scripts
+// in svg or html, and the mime of a document can be changed after it was
+// made an avatar.
+var avatarMimes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// Profile keeps the display name, email, locale and avatar of users. The
+// avatar is an image document only the user has a grant on, every signed in
+// user can see it while that holds.
+type Profile struct {
+	log       *zap.Logger
+	userRepo  repository.UserRepository
+	docsRepo  repository.DocumentRepository
+	grantRepo repository.GrantRepository
+	auditor   Auditor
+}
+
+func NewProfile(log *zap.Logger, userRepo repository.UserRepository, docsRepo repository.DocumentRepository, grantRepo repository.GrantRepository, auditor Auditor) *Profile {
+	return &Profile{
+		log:       log,
+		userRepo:  userRepo,
+		docsRepo:  docsRepo,
+		grantRepo: grantRepo,
+		auditor:   auditor,
+	}
+}
+
+// GetProfile returns the user of principal.
+func (inst *Profile) GetProfile(ctx context.Context, principal *model.Principal) (*model.User, error) {
+	return inst.userRepo.GetUserByUUID(ctx, principal.UserUUID)
+}
+
+// UpdateProfile changes the profile fields of principal that patch sets,
+// empty values clear them.
+func (inst *Profile) UpdateProfile(ctx context.Context, principal *model.Principal, patch *model.ProfilePatch) (_ *model.User, err error) {
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditProfileUpdate, principal.Login, principal.SessionUUID, "", err)))
+	}()
+
+	user, err := inst.userRepo.GetUserByUUID(ctx, principal.UserUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if patch.DisplayName != nil {
+		if user.DisplayName, err = inst.validateDisplayName(*patch.DisplayName); err != nil {
+			return nil, err
+		}
+	}
+
+	if patch.Email != nil {
+		if user.Email, err = inst.validateEmail(*patch.Email); err != nil {
+			return nil, err
+		}
+	}
+
+	if patch.Locale != nil {
+		if user.Locale, err = inst.validateLocale(*patch.Locale); err != nil {
+			return nil, err
+		}
+	}
+
+	if patch.AvatarUUID != nil && *patch.AvatarUUID != user.AvatarUUID {
+		if err := inst.validateAvatar(ctx, principal, *patch.AvatarUUID); err != nil {
+			return nil, err
+		}
+		user.AvatarUUID = *patch.AvatarUUID
+	}
+
+	if err := inst.userRepo.UpdateProfile(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetAvatar returns the avatar document of login, its Mime the bare media
+// type to serve it with. The document is checked again as when it was set,
+// an avatar shared or changed since is not shown.
+func (inst *Profile) GetAvatar(ctx context.Context, login string) (*model.Document, error) {
+	user, err := inst.userRepo.GetUserByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.AvatarUUID == "" {
+		return nil, utils.ErrorNotFound
+	}
+
+	document, err := inst.docsRepo.GetDocumentWithGrantByUUID(ctx, user.AvatarUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if document.Mime, err = inst.checkAvatar(user.Login, document); err != nil {
+		return nil, utils.ErrorNotFound
+	}
+
+	return document, nil
+}
+
+// ListProfiles returns the users of the logins by login, logins without a
+// user are left out.
+func (inst *Profile) ListProfiles(ctx context.Context, logins []string) (map[string]model.User, error) {
+	profiles := make(map[string]model.User, len(logins))
+	if len(logins) == 0 {
+		return profiles, nil
+	}
+
+	users, err := inst.userRepo.GetUsersByLogins(ctx, logins)
+	if err != nil {
+		inst.log.Error("list profiles", zap.Int("logins", len(logins)), zap.Error(err))
+		return nil, err
+	}
+
+	for _, user := range users {
+		profiles[user.Login] = user
+	}
+
+	return profiles, nil
+}
+
+func (inst *Profile) validateDisplayName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if utf8.RuneCountInString(name) > displayNameMaxLength {
+		return "", fmt.Errorf("%w: display_name must be at most %d characters", utils.ErrorInvalidProfile, displayNameMaxLength)
+	}
+
+	if strings.ContainsFunc(name, unicode.IsControl) {
+		return "", fmt.Errorf("%w: display_name contains control characters", utils.ErrorInvalidProfile)
+	}
+
+	return name, nil
+}
+
+func (inst *Profile) validateEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", nil
+	}
+
+	if len(email) > emailMaxLength {
+		return "", fmt.Errorf("%w: email must be at most %d characters", utils.ErrorInvalidProfile, emailMaxLength)
+	}
+
+	// a bare address only, no display name or comments
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", fmt.Errorf("%w: malformed email", utils.ErrorInvalidProfile)
+	}
+
+	return email, nil
+}
+
+func (inst *Profile) validateLocale(locale string) (string, error) {
+	if locale == "" {
+		return "", nil
+	}
+
+	if len(locale) > localeMaxLength || !localeRegexp.MatchString(locale) {
+		return "", fmt.Errorf("%w: malformed locale, expected a tag like en or pt-BR", utils.ErrorInvalidProfile)
+	}
+
+	return locale, nil
+}
+
+// validateAvatar checks that the document is a raster image file only
+// principal has a grant on. Every signed in user sees the avatar, so a
+// document shared with principal, or by it, can't become one.
+func (inst *Profile) validateAvatar(ctx context.Context, principal *model.Principal, documentUUID string) error {
+	if documentUUID == "" {
+		return nil
+	}
+
+	if err := uuid.Validate(documentUUID); err != nil {
+		return fmt.Errorf("%w: avatar document not found", utils.ErrorInvalidProfile)
+	}
+
+	if _, err := inst.grantRepo.GetGrantByLoginAndDocUUID(ctx, documentUUID, principal.Login); err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return fmt.Errorf("%w: avatar document not found", utils.ErrorInvalidProfile)
+		}
+		return err
+	}
+
+	document, err := inst.docsRepo.GetDocumentWithGrantByUUID(ctx, documentUUID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := inst.checkAvatar(principal.Login, document); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// checkAvatar returns the media type of the document when it can be the
+// avatar of login: a png, jpeg, gif or webp file login is the only grantee
+// of.
+func (inst *Profile) checkAvatar(login string, document *model.Document) (string, error) {
+	if len(document.Grant) != 1 || document.Grant[0] != login {
+		return "", fmt.Errorf("%w: avatar must be a document only you have access to", utils.ErrorInvalidProfile)
+	}
+
+	mediaType, _, err := mime.ParseMediaType(document.Mime)
+	if err != nil || !document.File || !slices.Contains(avatarMimes, mediaType) {
+		return "", fmt.Errorf("%w: avatar must be a png, jpeg, gif or webp file", utils.ErrorInvalidProfile)
+	}
+
+	return mediaType, nil
+}
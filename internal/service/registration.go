@@ -2,112 +2,103 @@ package service
 
 import (
 	"context"
+	"crypto/subtle"
 	"docs/internal/model"
 	"docs/internal/repository"
 	"docs/internal/utils"
-	"fmt"
-	"unicode"
+	"time"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// RegistrationOptions hold how long password reset tokens and, unless set
+// otherwise, invites stay valid.
+type RegistrationOptions struct {
+	ResetTTL  time.Duration
+	InviteTTL time.Duration
+}
+
+// Registration creates accounts and manages their passwords. The admin
+// token only creates the first admin, admins create every other user or
+// invite people to register.
 type Registration struct {
-	log        *zap.Logger
-	adminToken string
-	userRepo   repository.UserRepository
+	log         *zap.Logger
+	adminToken  string
+	userRepo    repository.UserRepository
+	sessionRepo repository.SessionRepository
+	resetRepo   repository.PasswordResetRepository
+	inviteRepo  repository.InviteRepository
+	hasher      *PasswordHasher
+	policy      *Policy
+	cache       Cacher
+	stream      *Stream
+	auditor     Auditor
+	options     RegistrationOptions
 }
 
-func NewRegistration(log *zap.Logger, adminToken string, userRepo repository.UserRepository) *Registration {
+func NewRegistration(log *zap.Logger, adminToken string, userRepo repository.UserRepository, sessionRepo repository.SessionRepository, resetRepo repository.PasswordResetRepository, inviteRepo repository.InviteRepository, hasher *PasswordHasher, policy *Policy, cache Cacher, stream *Stream, auditor Auditor, options RegistrationOptions) *Registration {
 	return &Registration{
-		log:        log,
-		adminToken: adminToken,
-		userRepo:   userRepo,
+		log:         log,
+		adminToken:  adminToken,
+		userRepo:    userRepo,
+		sessionRepo: sessionRepo,
+		resetRepo:   resetRepo,
+		inviteRepo:  inviteRepo,
+		hasher:      hasher,
+		policy:      policy,
+		cache:       cache,
+		stream:      stream,
+		auditor:     auditor,
+		options:     options,
 	}
 }
 
-func (inst *Registration) Register(ctx context.Context, token, login, password string) error {
-	if inst.adminToken != token {
-		inst.log.Error("unxpected admin token", zap.String("token", token))
+// Register creates the first admin with the admin token. Once an admin
+// exists it fails with ErrorAdminExists.
+func (inst *Registration) Register(ctx context.Context, token, login, password string) (err error) {
+	defer func() {
+		event := newAuditEvent(model.AuditRegister, "", "", "", err)
+		event.Target = login
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if inst.adminToken == "" || subtle.ConstantTimeCompare([]byte(inst.adminToken), []byte(token)) != 1 {
+		inst.log.Warn("unxpected admin token", zap.String("login", login))
 		return utils.ErrorInvalidAdminToken
 	}
 
-	if err := inst.validateLogin(login); err != nil {
+	if err := inst.policy.ValidateLogin(login); err != nil {
 		return err
 	}
 
-	if err := inst.validatePassword(password); err != nil {
+	if err := inst.policy.ValidatePassword(ctx, login, password); err != nil {
 		return err
 	}
 
-	crypPswd, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	crypPswd, err := inst.hashPassword(password)
 	if err != nil {
-		inst.log.Error("failed generate password", zap.Error(err))
 		return err
 	}
 
-	return inst.userRepo.CreateUser(ctx, &model.User{
+	if err := inst.userRepo.CreateFirstAdmin(ctx, &model.User{
 		UUID:     uuid.NewString(),
 		Login:    login,
-		Password: string(crypPswd),
-	})
-}
-
-func (inst *Registration) validateLogin(login string) error {
-	for _, r := range login {
-		switch {
-		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
-			inst.log.Error("invalid login for registration, password contains inadmissible symbols")
-			return fmt.Errorf("%w: login contains inadmissible symbols: %q", utils.ErrorInvalidLogin, r)
-		}
-	}
-
-	if len(login) < 8 {
-		inst.log.Error("invalid login for registration, inadmissible length of the login")
-		return fmt.Errorf("%w: login cannot be less than 8 characters", utils.ErrorInvalidLogin)
+		Password: crypPswd,
+	}); err != nil {
+		return err
 	}
+	inst.log.Info("first admin registered", zap.String("login", login))
 
 	return nil
 }
 
-func (inst *Registration) validatePassword(password string) error {
-	if len(password) < 8 {
-		inst.log.Error("invalid password for registration, inadmissible length of the login")
-		return fmt.Errorf("%w: The password should be no less than 8 characters", utils.ErrorInvalidLogin)
-	}
-
-	var (
-		letters  = 0
-		digits   = 0
-		specials = 0
-	)
-
-	for _, r := range password {
-		switch {
-		case unicode.IsLetter(r):
-			letters++
-		case unicode.IsDigit(r):
-			digits++
-		default:
-			specials++
-		}
-	}
-
-	if letters < 2 {
-		inst.log.Error("invalid password, the password does not contain a sufficient amount")
-		return fmt.Errorf("%w: The password should contain two letters as a minimum", utils.ErrorInvalidPassword)
-	}
-
-	if digits < 1 {
-		inst.log.Error("invalid password, the password does not contain a sufficient number of digits")
-		return fmt.Errorf("%w: The password should contain at least the bottom the number", utils.ErrorInvalidPassword)
-	}
-
-	if specials < 1 {
-		inst.log.Error("invalid password, the password does not contain a sufficient number of special characters")
-		return fmt.Errorf("%w: The password should be no less than 1 special characters", utils.ErrorInvalidPassword)
+func (inst *Registration) hashPassword(password string) (string, error) {
+	crypPswd, err := inst.hasher.Hash(password)
+	if err != nil {
+		inst.log.Error("failed generate password", zap.Error(err))
+		return "", err
 	}
 
-	return nil
+	return crypPswd, nil
 }
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"strings"
+	"time"
+)
+
+const revokedTokenTag = "revoked_tokens"
+
+// Sessions resolves access tokens for the services. Signed JWTs are verified
+// without a session lookup, only their jti is checked against the deny-list,
+// whose answers are cached for a short while. Every other token is looked up
+// in the repository.
+type Sessions struct {
+	repository.SessionRepository
+	jwt      *JWT
+	cache    Cacher
+	cacheTTL time.Duration
+}
+
+func NewSessions(sessionRepo repository.SessionRepository, jwt *JWT, cache Cacher, cacheTTL time.Duration) *Sessions {
+	return &Sessions{
+		SessionRepository: sessionRepo,
+		jwt:               jwt,
+		cache:             cache,
+		cacheTTL:          cacheTTL,
+	}
+}
+
+func (inst *Sessions) GetSessionByUUID(ctx context.Context, token string) (*model.Session, error) {
+	if inst.jwt == nil || !isJWT(token) {
+		return inst.SessionRepository.GetSessionByUUID(ctx, token)
+	}
+
+	claims, err := inst.jwt.Verify(token)
+	if err != nil {
+		return nil, utils.ErrorNotFound
+	}
+
+	revoked, err := inst.isRevoked(ctx, claims.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if revoked {
+		return nil, utils.ErrorNotFound
+	}
+
+	return claims.session(), nil
+}
+
+// DeleteSession of a JWT puts its jti on the deny-list.
+func (inst *Sessions) DeleteSession(ctx context.Context, token string) error {
+	if inst.jwt == nil || !isJWT(token) {
+		return inst.SessionRepository.DeleteSession(ctx, token)
+	}
+
+	claims, err := inst.jwt.Verify(token)
+	if err != nil {
+		return utils.ErrorNotFound
+	}
+
+	return inst.RevokeToken(ctx, claims.ID, time.Unix(claims.ExpiresAt, 0))
+}
+
+func (inst *Sessions) RevokeFamily(ctx context.Context, familyUUID string) error {
+	defer inst.cache.InvalidateByTag(revokedTokenTag)
+	return inst.SessionRepository.RevokeFamily(ctx, familyUUID)
+}
+
+func (inst *Sessions) RevokeUserFamilies(ctx context.Context, login, keepFamilyUUID string) (int64, error) {
+	defer inst.cache.InvalidateByTag(revokedTokenTag)
+	return inst.SessionRepository.RevokeUserFamilies(ctx, login, keepFamilyUUID)
+}
+
+func (inst *Sessions) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	defer inst.cache.Invalidate(inst.cacheKey(jti))
+	return inst.SessionRepository.RevokeToken(ctx, jti, expiresAt)
+}
+
+func (inst *Sessions) isRevoked(ctx context.Context, jti string) (bool, error) {
+	key := inst.cacheKey(jti)
+	if revoked, ok := inst.cache.Get(key); ok {
+		return revoked.(bool), nil
+	}
+
+	revoked, err := inst.SessionRepository.IsTokenRevoked(ctx, jti)
+	if err != nil {
+		return false, err
+	}
+
+	inst.cache.Put(key, revoked, inst.cacheTTL, []string{revokedTokenTag})
+
+	return revoked, nil
+}
+
+func (inst *Sessions) cacheKey(jti string) string {
+	return "jti:" + jti
+}
+
+func (inst *jwtClaims) session() *model.Session {
+	return &model.Session{
+		UUID:         inst.ID,
+		UserUUID:     inst.Subject,
+		UserLogin:    inst.Login,
+		UserRole:     inst.Role,
+		FamilyUUID:   inst.Family,
+		ExpiresAt:    time.Unix(inst.ExpiresAt, 0),
+		MaxExpiresAt: time.Unix(inst.ExpiresAt, 0),
+		CreateAt:     time.Unix(inst.IssuedAt, 0),
+		Scopes:       strings.Fields(inst.Scope),
+	}
+}
@@ -0,0 +1,299 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// loginMaxLen matches users.login.
+const loginMaxLen = 50
+
+// SSOOptions say how identity provider users become local users, see
+// config.OIDC.
+type SSOOptions struct {
+	LoginClaim        string
+	GroupsClaim       string
+	RoleMapping       map[string]string
+	AutoProvision     bool
+	LinkClaim         string
+	LinkVerifiedClaim string
+	StateTTL          time.Duration
+}
+
+// SSO logs users in through an OpenID Connect provider. The provider subject
+// is linked to a user on first login: one created for it, or an account the
+// provider created before whose link was lost. Local and LDAP accounts are
+// not linked by the login claim, a provider user can pick it freely; with
+// LinkClaim set they are linked by the email of the account when the
+// provider vouches for the claim with LinkVerifiedClaim.
+type SSO struct {
+	log      *zap.Logger
+	auth     *Auth
+	provider *OIDC
+	userRepo repository.UserRepository
+	oidcRepo repository.OIDCRepository
+	policy   *Policy
+	auditor  Auditor
+	options  SSOOptions
+}
+
+// NewSSO returns a disabled SSO when provider is nil, its methods are then
+// not found.
+func NewSSO(log *zap.Logger, auth *Auth, provider *OIDC, userRepo repository.UserRepository, oidcRepo repository.OIDCRepository, policy *Policy, auditor Auditor, options SSOOptions) *SSO {
+	return &SSO{
+		log:      log,
+		auth:     auth,
+		provider: provider,
+		userRepo: userRepo,
+		oidcRepo: oidcRepo,
+		policy:   policy,
+		auditor:  auditor,
+		options:  options,
+	}
+}
+
+// StartOIDC remembers a new login and returns the provider URL to send the
+// user to, with the state the browser must keep for the callback.
+func (inst *SSO) StartOIDC(ctx context.Context) (*model.OIDCRedirect, error) {
+	if inst.provider == nil {
+		return nil, utils.ErrorNotFound
+	}
+
+	state, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	verifier, err := generateToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	oidcState := &model.OIDCState{
+		Hash:         hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    now.Add(inst.options.StateTTL),
+		CreateAt:     now,
+	}
+
+	url, err := inst.provider.AuthCodeURL(ctx, state, oidcState.Nonce, oidcState.CodeVerifier)
+	if err != nil {
+		inst.log.Error("oidc authorization url", zap.Error(err))
+		return nil, utils.ErrorIdentityProvider
+	}
+
+	if err := inst.oidcRepo.CreateOIDCState(ctx, oidcState); err != nil {
+		return nil, err
+	}
+
+	return &model.OIDCRedirect{
+		URL:       url,
+		State:     state,
+		ExpiresAt: oidcState.ExpiresAt,
+	}, nil
+}
+
+// LoginOIDC finishes a login the provider redirected back with. The state
+// must match browserState, the one kept by the browser that started the
+// login, so nobody can finish a login in someone else's browser. Like Login,
+// users with TOTP get a challenge instead of a session.
+func (inst *SSO) LoginOIDC(ctx context.Context, code, state, browserState string) (token *model.AuthToken, err error) {
+	var actor string
+	defer func() {
+		var sessionUUID string
+		if token != nil {
+			sessionUUID = token.AccessToken
+		}
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditLoginOIDC, actor, sessionUUID, "", err)))
+	}()
+
+	if inst.provider == nil {
+		return nil, utils.ErrorNotFound
+	}
+
+	if code == "" || state == "" {
+		return nil, utils.ErrorAuthFailed
+	}
+
+	if subtle.ConstantTimeCompare([]byte(state), []byte(browserState)) != 1 {
+		return nil, fmt.Errorf("%w: state was not started in this browser", utils.ErrorAuthFailed)
+	}
+
+	oidcState, err := inst.oidcRepo.ConsumeOIDCState(ctx, hashToken(state))
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return nil, fmt.Errorf("%w: unknown or expired state", utils.ErrorAuthFailed)
+		}
+		return nil, err
+	}
+
+	claims, err := inst.provider.Exchange(ctx, code, oidcState.CodeVerifier, oidcState.Nonce)
+	if err != nil {
+		if errors.Is(err, errInvalidIDToken) {
+			return nil, fmt.Errorf("%w: %w", utils.ErrorAuthFailed, err)
+		}
+		inst.log.Error("oidc code exchange", zap.Error(err))
+		return nil, utils.ErrorIdentityProvider
+	}
+
+	user, err := inst.resolveUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	actor = user.Login
+
+	if err := inst.syncRole(ctx, user, claims); err != nil {
+		return nil, err
+	}
+
+	return inst.auth.loginUser(ctx, user)
+}
+
+// resolveUser finds the user of the provider subject, creating it on first
+// login. An existing login is only linked when the provider created it and
+// no subject is linked to it yet, or through linkedUser.
+func (inst *SSO) resolveUser(ctx context.Context, claims map[string]any) (*model.User, error) {
+	issuer, _ := claims["iss"].(string)
+	subject, _ := claims["sub"].(string)
+
+	identity, err := inst.oidcRepo.GetIdentity(ctx, issuer, subject)
+	switch {
+	case err == nil:
+		return inst.userRepo.GetUserByUUID(ctx, identity.UserUUID)
+	case !errors.Is(err, utils.ErrorNotFound):
+		return nil, err
+	}
+
+	user, err := inst.linkedUser(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if user == nil {
+		if user, err = inst.loginClaimUser(ctx, claims); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := inst.oidcRepo.CreateIdentity(ctx, &model.Identity{
+		Issuer:   issuer,
+		Subject:  subject,
+		UserUUID: user.UUID,
+		CreateAt: time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// linkedUser returns the account whose email is the LinkClaim value, nil
+// when linking is off, the provider didn't verify the claim or no account
+// has that email. An account already linked to another subject is refused.
+func (inst *SSO) linkedUser(ctx context.Context, claims map[string]any) (*model.User, error) {
+	if inst.options.LinkClaim == "" {
+		return nil, nil
+	}
+
+	email, _ := claims[inst.options.LinkClaim].(string)
+	if verified, _ := claims[inst.options.LinkVerifiedClaim].(bool); email == "" || !verified {
+		return nil, nil
+	}
+
+	user, err := inst.userRepo.GetUserByEmail(ctx, email)
+	switch {
+	case errors.Is(err, utils.ErrorNotFound):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+
+	linked, err := inst.oidcRepo.HasIdentity(ctx, user.UUID)
+	if err != nil {
+		return nil, err
+	}
+	if linked {
+		return nil, fmt.Errorf("%w: the account of %s is linked to another subject", utils.ErrorAuthFailed, email)
+	}
+
+	inst.log.Info("linked oidc subject by verified claim", zap.String("login", user.Login), zap.String("claim", inst.options.LinkClaim))
+
+	return user, nil
+}
+
+// loginClaimUser returns the account named by the LoginClaim, provisioning
+// it when missing.
+func (inst *SSO) loginClaimUser(ctx context.Context, claims map[string]any) (*model.User, error) {
+	login, _ := claims[inst.options.LoginClaim].(string)
+	if login == "" || utf8.RuneCountInString(login) > loginMaxLen {
+		return nil, fmt.Errorf("%w: claim %s is not a usable login", utils.ErrorAuthFailed, inst.options.LoginClaim)
+	}
+
+	user, err := inst.userRepo.GetUserByLogin(ctx, login)
+	switch {
+	case errors.Is(err, utils.ErrorNotFound) && inst.options.AutoProvision:
+		// a provisioned login obeys the policy like a registered one
+		if err := inst.policy.ValidateLogin(login); err != nil {
+			return nil, fmt.Errorf("%w: claim %s: %v", utils.ErrorAuthFailed, inst.options.LoginClaim, err)
+		}
+
+		// no local password, the user logs in through the provider only
+		user = &model.User{
+			UUID:   uuid.NewString(),
+			Login:  login,
+			Role:   mapRole(claimStrings(claims, inst.options.GroupsClaim), inst.options.RoleMapping),
+			Source: model.UserSourceOIDC,
+		}
+		if err := inst.userRepo.CreateUser(ctx, user); err != nil {
+			return nil, err
+		}
+		inst.log.Info("provisioned oidc user", zap.String("login", login))
+	case errors.Is(err, utils.ErrorNotFound):
+		return nil, fmt.Errorf("%w: no user %s", utils.ErrorAuthFailed, login)
+	case err != nil:
+		return nil, err
+	case user.Source != model.UserSourceOIDC:
+		inst.log.Warn("oidc login matches a non oidc account", zap.String("login", login), zap.String("source", user.Source))
+		return nil, fmt.Errorf("%w: login %s belongs to another account", utils.ErrorAuthFailed, login)
+	default:
+		// left over when linking failed after provisioning, never taken
+		// over by a second subject
+		linked, err := inst.oidcRepo.HasIdentity(ctx, user.UUID)
+		if err != nil {
+			return nil, err
+		}
+		if linked {
+			return nil, fmt.Errorf("%w: login %s belongs to another account", utils.ErrorAuthFailed, login)
+		}
+	}
+
+	return user, nil
+}
+
+// syncRole applies the role mapping to the groups of the login. Only
+// accounts the provider created follow it, one linked by hand keeps the role
+// an admin gave it.
+func (inst *SSO) syncRole(ctx context.Context, user *model.User, claims map[string]any) error {
+	if len(inst.options.RoleMapping) == 0 || user.Source != model.UserSourceOIDC {
+		return nil
+	}
+
+	return syncRole(ctx, inst.log, inst.userRepo, user, mapRole(claimStrings(claims, inst.options.GroupsClaim), inst.options.RoleMapping))
+}
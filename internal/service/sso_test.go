@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// stubSSOUsers finds users by login and case-insensitive email.
+type stubSSOUsers struct {
+	repository.UserRepository
+	users []*model.User
+}
+
+func (inst *stubSSOUsers) GetUserByLogin(ctx context.Context, login string) (*model.User, error) {
+	for _, user := range inst.users {
+		if user.Login == login {
+			return user, nil
+		}
+	}
+	return nil, utils.ErrorNotFound
+}
+
+func (inst *stubSSOUsers) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	for _, user := range inst.users {
+		if user.Email != "" && strings.EqualFold(user.Email, email) {
+			return user, nil
+		}
+	}
+	return nil, utils.ErrorNotFound
+}
+
+func (inst *stubSSOUsers) CreateUser(ctx context.Context, user *model.User) error {
+	inst.users = append(inst.users, user)
+	return nil
+}
+
+// stubIdentities links subjects to user UUIDs.
+type stubIdentities struct {
+	repository.OIDCRepository
+	identities []model.Identity
+}
+
+func (inst *stubIdentities) GetIdentity(ctx context.Context, issuer, subject string) (*model.Identity, error) {
+	for _, identity := range inst.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return &identity, nil
+		}
+	}
+	return nil, utils.ErrorNotFound
+}
+
+func (inst *stubIdentities) HasIdentity(ctx context.Context, userUUID string) (bool, error) {
+	for _, identity := range inst.identities {
+		if identity.UserUUID == userUUID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (inst *stubIdentities) CreateIdentity(ctx context.Context, identity *model.Identity) error {
+	inst.identities = append(inst.identities, *identity)
+	return nil
+}
+
+func TestSSOResolveUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		linkClaim string
+		claims    map[string]any
+		linked    string // UUID already linked to another subject
+		want      string // login resolved, empty when refused
+	}{
+		{
+			name:      "verified email links a local account",
+			linkClaim: "email",
+			claims:    map[string]any{"preferred_username": "alice", "email": "Alice@Example.org", "email_verified": true},
+			want:      "alice",
+		},
+		{
+			name:      "verified email links an LDAP account",
+			linkClaim: "email",
+			claims:    map[string]any{"preferred_username": "whoever", "email": "bob@example.org", "email_verified": true},
+			want:      "bob",
+		},
+		{
+			name:      "unverified email falls back to the login claim",
+			linkClaim: "email",
+			claims:    map[string]any{"preferred_username": "alice", "email": "alice@example.org", "email_verified": false},
+		},
+		{
+			name:      "verified as a string is not verified",
+			linkClaim: "email",
+			claims:    map[string]any{"preferred_username": "alice", "email": "alice@example.org", "email_verified": "true"},
+		},
+		{
+			name:   "without link mode a local account is refused",
+			claims: map[string]any{"preferred_username": "alice", "email": "alice@example.org", "email_verified": true},
+		},
+		{
+			name:      "an account linked to another subject is refused",
+			linkClaim: "email",
+			claims:    map[string]any{"preferred_username": "alice", "email": "alice@example.org", "email_verified": true},
+			linked:    "uuid-alice",
+		},
+		{
+			name:      "unknown email provisions by the login claim",
+			linkClaim: "email",
+			claims:    map[string]any{"preferred_username": "carol.k", "email": "carol@example.org", "email_verified": true},
+			want:      "carol.k",
+		},
+		{
+			name:   "provisioned login obeys the policy",
+			claims: map[string]any{"preferred_username": "carol k"},
+		},
+		{
+			name:   "provisioned login too short for the policy",
+			claims: map[string]any{"preferred_username": "cj"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := &stubSSOUsers{users: []*model.User{
+				{UUID: "uuid-alice", Login: "alice", Email: "alice@example.org", Source: model.UserSourceLocal},
+				{UUID: "uuid-bob", Login: "bob", Email: "bob@example.org", Source: model.UserSourceLDAP},
+			}}
+			identities := &stubIdentities{}
+			if tt.linked != "" {
+				identities.identities = append(identities.identities, model.Identity{Issuer: "https://idp", Subject: "other", UserUUID: tt.linked})
+			}
+
+			policy := NewPolicy(LoginPolicy{MinLength: 3, MaxLength: 50, AllowedSpecials: "."}, PasswordPolicy{}, nil)
+			sso := NewSSO(zap.NewNop(), nil, nil, users, identities, policy, nil, SSOOptions{
+				LoginClaim:        "preferred_username",
+				AutoProvision:     true,
+				LinkClaim:         tt.linkClaim,
+				LinkVerifiedClaim: "email_verified",
+			})
+
+			claims := map[string]any{"iss": "https://idp", "sub": "subject-1"}
+			for name, value := range tt.claims {
+				claims[name] = value
+			}
+
+			user, err := sso.resolveUser(context.Background(), claims)
+			if tt.want == "" {
+				if !errors.Is(err, utils.ErrorAuthFailed) {
+					t.Fatalf("err = %v, want %v", err, utils.ErrorAuthFailed)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("resolve: %v", err)
+			}
+
+			if user.Login != tt.want {
+				t.Fatalf("login = %s, want %s", user.Login, tt.want)
+			}
+
+			if identity, err := identities.GetIdentity(context.Background(), "https://idp", "subject-1"); err != nil || identity.UserUUID != user.UUID {
+				t.Errorf("subject linked to %+v, %v, want %s", identity, err, user.UUID)
+			}
+		})
+	}
+}
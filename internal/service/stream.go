@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	streamBuffer       = 64
+	streamPageSize     = 500
+	streamRetryDelay   = 5 * time.Second
+	streamPollInterval = 2 * time.Second
+)
+
+// Stream broadcasts the events of the event log to the live subscriptions
+// and wakes the relay. Events reach the subscribers only through the
+// database notification, so every replica sees the changes made on any of
+// them. The log is read in (txid, id) order like the change log, an event is
+// broadcast once no older transaction can still add one before it.
+// Subscriptions are authenticated again before each page of events goes out.
+type Stream struct {
+	log         *zap.Logger
+	eventRepo   repository.EventRepository
+	relay       EventRelay
+	authService AuthService
+
+	mu          sync.Mutex
+	subscribers map[*Subscription]struct{}
+
+	// dispatchMu serializes dispatch between notifications and polling
+	dispatchMu sync.Mutex
+	last       model.ChangeCursor
+}
+
+// Subscription receives the events visible to one session. Backlog holds the
+// stored events after the requested cursor, Events the live ones, which may
+// repeat the tail of the backlog. Events is closed when the subscriber falls
+// behind, the client is expected to reconnect from the last cursor it got.
+type Subscription struct {
+	Backlog []model.Event
+	Events  <-chan *model.Event
+
+	stream *Stream
+	events chan *model.Event
+	token  string
+	client model.Client
+	login  string
+	admin  bool
+	closed bool
+}
+
+func NewStream(log *zap.Logger, eventRepo repository.EventRepository, relay EventRelay, authService AuthService) *Stream {
+	return &Stream{
+		log:         log,
+		eventRepo:   eventRepo,
+		relay:       relay,
+		authService: authService,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Subscribe registers a subscription for the session login, token is the
+// access token principal was authenticated with. With a non zero cursor the
+// visible events stored after it are loaded into the backlog.
+func (inst *Stream) Subscribe(ctx context.Context, principal *model.Principal, token string, after model.ChangeCursor) (*Subscription, error) {
+	events := make(chan *model.Event, streamBuffer)
+	subscription := &Subscription{
+		Events: events,
+		stream: inst,
+		events: events,
+		token:  token,
+		client: utils.ClientFromContext(ctx),
+		login:  principal.Login,
+		admin:  principal.IsAdmin(),
+	}
+
+	inst.mu.Lock()
+	inst.subscribers[subscription] = struct{}{}
+	inst.mu.Unlock()
+
+	if after == (model.ChangeCursor{}) {
+		return subscription, nil
+	}
+
+	login := subscription.login
+	if subscription.admin {
+		login = ""
+	}
+
+	from := after
+	for {
+		page, err := inst.eventRepo.ListEvents(ctx, after, login, streamPageSize)
+		if err != nil {
+			subscription.Close()
+			return nil, err
+		}
+
+		subscription.Backlog = append(subscription.Backlog, page...)
+		if len(page) < streamPageSize {
+			break
+		}
+
+		after = page[len(page)-1].Cursor()
+	}
+
+	// the replay would silently skip events purged past the cursor
+	horizon, err := inst.eventRepo.PurgeHorizon(ctx)
+	if err != nil {
+		subscription.Close()
+		return nil, err
+	}
+
+	if horizon.After(from) {
+		subscription.Close()
+		return nil, utils.ErrorCursorExpired
+	}
+
+	return subscription, nil
+}
+
+// Close unregisters the subscription.
+func (inst *Subscription) Close() {
+	inst.stream.mu.Lock()
+	defer inst.stream.mu.Unlock()
+
+	inst.stream.remove(inst)
+}
+
+// Run listens for new events and broadcasts them until ctx is done. The log
+// is also polled, events held back behind a running transaction are not
+// signalled again once it ends.
+func (inst *Stream) Run(ctx context.Context) {
+	for {
+		head, err := inst.eventRepo.ChangeHead(ctx)
+		if err == nil {
+			inst.last = head
+			break
+		}
+
+		inst.log.Error("fetch event log head", zap.Error(err))
+		if !inst.wait(ctx) {
+			return
+		}
+	}
+
+	go inst.poll(ctx)
+
+	for {
+		err := inst.eventRepo.Listen(ctx, func() {
+			inst.dispatch(ctx)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		inst.log.Error("listen for events", zap.Error(err))
+		if !inst.wait(ctx) {
+			return
+		}
+	}
+}
+
+func (inst *Stream) poll(ctx context.Context) {
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			inst.dispatch(ctx)
+		}
+	}
+}
+
+// dispatch broadcasts every visible event after the last broadcasted one, so
+// events are not lost when notifications are missed while reconnecting.
+func (inst *Stream) dispatch(ctx context.Context) {
+	inst.dispatchMu.Lock()
+	defer inst.dispatchMu.Unlock()
+
+	for {
+		events, err := inst.eventRepo.ListEvents(ctx, inst.last, "", streamPageSize)
+		if err != nil {
+			inst.log.Error("list events", zap.Error(err))
+			return
+		}
+
+		if len(events) > 0 {
+			inst.recheck(ctx)
+		}
+
+		for i := range events {
+			inst.broadcast(&events[i])
+			inst.last = events[i].Cursor()
+		}
+
+		if len(events) > 0 {
+			inst.relay.Wake()
+		}
+
+		if len(events) < streamPageSize {
+			return
+		}
+	}
+}
+
+func (inst *Stream) broadcast(event *model.Event) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	for subscription := range inst.subscribers {
+		if !subscription.admin && !slices.Contains(event.Grant, subscription.login) {
+			continue
+		}
+
+		select {
+		case subscription.events <- event:
+		default:
+			inst.log.Warn("drop slow event subscriber", zap.String("login", subscription.login))
+			inst.remove(subscription)
+		}
+	}
+}
+
+// recheck authenticates every subscription again with its token, so a
+// logout, a revoked session family or a disabled user ends the stream on the
+// next event, on any replica, and a role change applies to it. Grant changes
+// need no check, an event only lists the logins holding a grant when it was
+// logged.
+func (inst *Stream) recheck(ctx context.Context) {
+	inst.mu.Lock()
+	subscriptions := make([]*Subscription, 0, len(inst.subscribers))
+	for subscription := range inst.subscribers {
+		subscriptions = append(subscriptions, subscription)
+	}
+	inst.mu.Unlock()
+
+	principals := make([]*model.Principal, len(subscriptions))
+	for i, subscription := range subscriptions {
+		principal, err := inst.authService.Authenticate(utils.WithClient(ctx, subscription.client), subscription.token)
+		if err != nil {
+			inst.log.Debug("event subscriber no longer authenticated", zap.String("login", subscription.login), zap.Error(err))
+			continue
+		}
+		principals[i] = principal
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	for i, subscription := range subscriptions {
+		principal := principals[i]
+		if principal == nil || principal.Login != subscription.login || !principal.HasScope(model.ScopeDocsRead) {
+			inst.remove(subscription)
+			continue
+		}
+		subscription.admin = principal.IsAdmin()
+	}
+}
+
+// CloseUser ends the subscriptions of login on this replica at once, the
+// other replicas end theirs on the recheck before their next event.
+func (inst *Stream) CloseUser(login string) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	for subscription := range inst.subscribers {
+		if subscription.login == login {
+			inst.remove(subscription)
+		}
+	}
+}
+
+// remove must be called with mu held.
+func (inst *Stream) remove(subscription *Subscription) {
+	if subscription.closed {
+		return
+	}
+
+	subscription.closed = true
+	delete(inst.subscribers, subscription)
+	close(subscription.events)
+}
+
+func (inst *Stream) wait(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(streamRetryDelay):
+		return true
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultSyncLimit = 500
+	MaxSyncLimit     = 1000
+)
+
+// SyncOptions is how long events are kept once relayed and how often the
+// older ones are purged.
+type SyncOptions struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+}
+
+// Sync serves the change log to sync clients. Without a cursor the caller
+// gets a snapshot of its document set, in pages, and a cursor to follow the
+// changes from.
+type Sync struct {
+	log       *zap.Logger
+	eventRepo repository.EventRepository
+	docsRepo  repository.DocumentRepository
+	auditor   Auditor
+	options   SyncOptions
+}
+
+func NewSync(log *zap.Logger, eventRepo repository.EventRepository, docsRepo repository.DocumentRepository, auditor Auditor, options SyncOptions) *Sync {
+	return &Sync{
+		log:       log,
+		eventRepo: eventRepo,
+		docsRepo:  docsRepo,
+		auditor:   auditor,
+		options:   options,
+	}
+}
+
+// Run purges the events past the retention until ctx is done.
+func (inst *Sync) Run(ctx context.Context) {
+	ticker := time.NewTicker(inst.options.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		events, err := inst.eventRepo.PurgeEvents(ctx, time.Now().Add(-inst.options.Retention))
+		if err != nil {
+			inst.log.Error("purge events", zap.Error(err))
+			continue
+		}
+
+		inst.log.Debug("purged events", zap.Int64("events", events))
+	}
+}
+
+func (inst *Sync) Changes(ctx context.Context, principal *model.Principal, cursor string, limit int) (_ *model.ChangeSet, err error) {
+	var actor string
+	defer func() {
+		err = auditResult(err, inst.auditor.Record(ctx, newAuditEvent(model.AuditDocumentSync, actor, principal.SessionUUID, "", err)))
+	}()
+
+	actor = principal.Login
+
+	if limit <= 0 || limit > MaxSyncLimit {
+		return nil, utils.ErrorLimitFormat
+	}
+
+	if cursor == "" {
+		return inst.snapshot(ctx, principal.Login, model.ChangeCursor{}, limit)
+	}
+
+	position, err := model.ParseChangeCursor(cursor)
+	if err != nil {
+		return nil, utils.ErrorInvalidCursor
+	}
+
+	if position.Document != "" {
+		if _, err := uuid.Parse(position.Document); err != nil {
+			return nil, utils.ErrorInvalidCursor
+		}
+
+		return inst.snapshot(ctx, principal.Login, position, limit)
+	}
+
+	events, err := inst.eventRepo.ListChanges(ctx, position, principal.Login, limit)
+	if err != nil {
+		inst.log.Error("list changes", zap.String("login", principal.Login), zap.Error(err))
+		return nil, err
+	}
+
+	// taken after the listing, a purge racing it is caught
+	horizon, err := inst.eventRepo.PurgeHorizon(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if horizon.After(position) {
+		return nil, utils.ErrorCursorExpired
+	}
+
+	changes := make([]model.Change, 0, len(events))
+	for _, event := range events {
+		change, err := inst.change(&event, principal.Login)
+		if err != nil {
+			inst.log.Error("decode change", zap.Int64("id", event.ID), zap.Error(err))
+			return nil, err
+		}
+
+		changes = append(changes, *change)
+		position = model.ChangeCursor{TxID: event.TxID, ID: event.ID}
+	}
+
+	return &model.ChangeSet{
+		Changes: inst.compact(changes),
+		Cursor:  position,
+		HasMore: len(events) == limit,
+	}, nil
+}
+
+// snapshot lists a page of the documents of login after the document of
+// from. The log position is taken before the first page and carried through
+// the rest, so a change racing the listing is replayed rather than lost.
+func (inst *Sync) snapshot(ctx context.Context, login string, from model.ChangeCursor, limit int) (_ *model.ChangeSet, err error) {
+	head := from
+	if from.Document == "" {
+		if head, err = inst.eventRepo.ChangeHead(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	documents, err := inst.docsRepo.ListDocumentsByLogin(ctx, login, from.Document, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]model.Change, 0, len(documents))
+	for i := range documents {
+		changes = append(changes, model.Change{
+			Type:         model.ChangeUpsert,
+			DocumentUUID: documents[i].UUID,
+			Document:     &documents[i],
+			CreateAt:     documents[i].CreateAt,
+		})
+	}
+
+	head.Document = ""
+	hasMore := len(documents) == limit
+	if hasMore {
+		head.Document = documents[len(documents)-1].UUID
+	}
+
+	return &model.ChangeSet{
+		Changes:  changes,
+		Cursor:   head,
+		HasMore:  hasMore,
+		Snapshot: true,
+	}, nil
+}
+
+// change turns an event into a change for login. Deletes and shares that
+// removed login become tombstones.
+func (inst *Sync) change(event *model.Event, login string) (*model.Change, error) {
+	payload := &eventPayload{}
+	if err := json.Unmarshal(event.Payload, payload); err != nil {
+		return nil, err
+	}
+
+	change := &model.Change{
+		Type:         model.ChangeUpsert,
+		Event:        event.Type,
+		Actor:        event.Actor,
+		DocumentUUID: payload.Document.ID,
+		CreateAt:     event.CreateAt,
+	}
+
+	if event.Type == model.EventDocumentDeleted || !slices.Contains(payload.Document.Grant, login) {
+		change.Type = model.ChangeDelete
+		return change, nil
+	}
+
+	change.Document = &model.Document{
+		UUID:     payload.Document.ID,
+		Name:     payload.Document.Name,
+		Mime:     payload.Document.Mime,
+		File:     payload.Document.File,
+		Public:   payload.Document.Public,
+		CreateAt: payload.Document.CreateAt,
+		Grant:    payload.Document.Grant,
+		Version:  payload.Document.Version,
+		JSON:     payload.Document.JSON,
+		Size:     payload.Document.Size,
+		Hash:     payload.Document.Hash,
+	}
+
+	return change, nil
+}
+
+// compact keeps only the last change of every document, in log order.
+func (inst *Sync) compact(changes []model.Change) []model.Change {
+	last := make(map[string]int, len(changes))
+	for i, change := range changes {
+		last[change.DocumentUUID] = i
+	}
+
+	compacted := make([]model.Change, 0, len(last))
+	for i, change := range changes {
+		if last[change.DocumentUUID] == i {
+			compacted = append(compacted, change)
+		}
+	}
+
+	return compacted
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the ASCII "12345678901234567890" the RFC test vectors use.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+// TestHOTP runs the vectors of RFC 4226 Appendix D.
+func TestHOTP(t *testing.T) {
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+
+	for counter, code := range want {
+		if got := hotp([]byte("12345678901234567890"), int64(counter)); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+// TestMatchTOTP runs the SHA-1 vectors of RFC 6238 Appendix B, cut to the
+// six digits apps use.
+func TestMatchTOTP(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			at := time.Unix(tt.unix, 0)
+
+			step, ok := matchTOTP(rfcSecret, tt.code, at)
+			if !ok || step != totpStep(at) {
+				t.Fatalf("matchTOTP = %d, %v, want %d, true", step, ok, totpStep(at))
+			}
+
+			// secrets are typed in either case
+			if _, ok := matchTOTP(strings.ToLower(rfcSecret), tt.code, at); !ok {
+				t.Errorf("lowercase secret refused")
+			}
+		})
+	}
+}
+
+func TestMatchTOTPSkew(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1234567890, 0)
+	current := totpStep(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		want   bool
+	}{
+		{name: "two steps behind", offset: -2, want: false},
+		{name: "one step behind", offset: -1, want: true},
+		{name: "current step", offset: 0, want: true},
+		{name: "one step ahead", offset: 1, want: true},
+		{name: "two steps ahead", offset: 2, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := matchTOTP(rfcSecret, hotp(key, current+tt.offset), now)
+			if ok != tt.want {
+				t.Fatalf("matched = %v, want %v", ok, tt.want)
+			}
+
+			if ok && step != current+tt.offset {
+				t.Errorf("step = %d, want %d", step, current+tt.offset)
+			}
+		})
+	}
+}
+
+func TestMatchTOTPMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	for _, tt := range []struct{ name, secret, code string }{
+		{name: "eight digits", secret: rfcSecret, code: "94287082"},
+		{name: "five digits", secret: rfcSecret, code: "87082"},
+		{name: "empty code", secret: rfcSecret, code: ""},
+		{name: "secret not base32", secret: "not-base32!", code: "287082"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ok := matchTOTP(tt.secret, tt.code, now); ok {
+				t.Errorf("matchTOTP(%q, %q) matched", tt.secret, tt.code)
+			}
+		})
+	}
+}
+
+// stubTOTPRepo keeps one enabled secret and refuses steps not after the
+// last used one, like user_totp.last_step.
+type stubTOTPRepo struct {
+	repository.TOTPRepository
+	totp *model.TOTP
+}
+
+func (inst *stubTOTPRepo) GetTOTP(ctx context.Context, userUUID string) (*model.TOTP, error) {
+	return inst.totp, nil
+}
+
+func (inst *stubTOTPRepo) UseTOTPStep(ctx context.Context, userUUID string, step int64) (bool, error) {
+	if step <= inst.totp.LastStep {
+		return false, nil
+	}
+
+	inst.totp.LastStep = step
+	return true, nil
+}
+
+func (inst *stubTOTPRepo) UseRecoveryCode(ctx context.Context, userUUID, hash string) (bool, error) {
+	return false, nil
+}
+
+func TestSecondFactorReplay(t *testing.T) {
+	key, err := totpEncoding.DecodeString(rfcSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	auth := &Auth{totpRepo: &stubTOTPRepo{totp: &model.TOTP{UserUUID: "user-1", Secret: rfcSecret, Enabled: true}}}
+	current := totpStep(time.Now())
+
+	tests := []struct {
+		name string
+		step int64
+		want bool
+	}{
+		{name: "current code", step: current, want: true},
+		{name: "same code again", step: current, want: false},
+		{name: "code of the step before", step: current - 1, want: false},
+		{name: "code of the next step", step: current + 1, want: true},
+	}
+
+	for _, tt := range tests {
+		ok, err := auth.checkSecondFactor(ctx, "user-1", hotp(key, tt.step))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if ok != tt.want {
+			t.Errorf("%s: accepted = %v, want %v", tt.name, ok, tt.want)
+		}
+	}
+}
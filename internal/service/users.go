@@ -0,0 +1,366 @@
+package service
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/utils"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ListUsers returns the users matching the filter, admin only.
+func (inst *Registration) ListUsers(ctx context.Context, principal *model.Principal, filter *model.UserFilter) ([]model.User, error) {
+	if !principal.IsAdmin() {
+		return nil, utils.ErrorNoAccess
+	}
+
+	if filter.Role != "" && !model.ValidRole(filter.Role) {
+		return nil, utils.ErrorInvalidRole
+	}
+
+	return inst.userRepo.ListUsers(ctx, filter)
+}
+
+// GetUser returns the user of the login, admin only.
+func (inst *Registration) GetUser(ctx context.Context, principal *model.Principal, login string) (*model.User, error) {
+	if !principal.IsAdmin() {
+		return nil, utils.ErrorNoAccess
+	}
+
+	return inst.userRepo.GetUserByLogin(ctx, login)
+}
+
+// CreateUser creates a user with the role, admin only. The login and
+// password follow the policy.
+func (inst *Registration) CreateUser(ctx context.Context, principal *model.Principal, login, password, role string) (_ *model.User, err error) {
+	defer func() {
+		event := newAuditEvent(model.AuditUserCreate, principal.Login, principal.SessionUUID, "", err)
+		event.Target = login
+		err = auditResult(err, inst.auditor.Record(ctx, event))
+	}()
+
+	if !principal.IsAdmin() {
+		return nil, utils.ErrorNoAccess
+	}
+
+	if role == "" {
+		role = model.RoleUser
+	}
+
+	if !model.ValidRole(role) {
+		return nil, utils.ErrorInvalidRole
+	}
+
+	if err := inst.policy.ValidateLogin(login); err != nil {
+		return nil, err
+	}
+
+	if err := inst.policy.ValidatePassword(ctx, login, password); err != nil {
+		return nil, err
+	}
+
+	crypPswd, err := inst.hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &model.User{
+		UUID:     uuid.NewString(),
+		Login:    login,
+		Password: crypPswd,
+		Role:     role,
+	}
+
+	if err := inst.userRepo.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// ListSoleDocuments returns the documents only the login has a grant on,
+// admin only. Deleting the user needs them handed over.
+func (inst *Registration) ListSoleDocuments(ctx context.Context, principal *model.Principal, login string) ([]model.Document, error) {
+	if !principal.IsAdmin() {
+		return nil, utils.ErrorNoAccess
+	}
+
+	if _, err := inst.userRepo.GetUserByLogin(ctx, login); err != nil {
+		return nil, err
+	}
+
+	return inst.userRepo.ListSoleDocuments(ctx, login)
+}
+
+// SetUserDisabled disables or enables the login, admin only. Disabling logs
+// the user out of every session, closes their event streams and deactivates
+// their webhooks, API keys stop working until it is enabled again. The documents only the user has a grant on must be handed over
+// when disabling, otherwise it fails with ErrorSoleDocuments: nobody could
+// reach them while the user is disabled.
+func (inst *Registration) SetUserDisabled(ctx context.Context, principal *model.Principal, login string, disabled bool, handover model.DocumentHandover) (err error) {
+	action := model.AuditUserEnable
+	if disabled {
+		action = model.AuditUserDisable
+	}
+
+	defer func() {
+		if err != nil {
+			event := newAuditEvent(action, principal.Login, principal.SessionUUID, "", err)
+			event.Target = login
+			inst.auditor.Record(ctx, event)
+		}
+	}()
+
+	if !disabled && handover.Set() {
+		return fmt.Errorf("%w: documents are handed over only when disabling", utils.ErrorInvalidHandover)
+	}
+
+	user, err := inst.managedUser(ctx, principal, login)
+	if err != nil {
+		return err
+	}
+
+	if err := inst.validateHandover(ctx, user, handover); err != nil {
+		return err
+	}
+
+	documents, err := inst.userRepo.SetUserDisabled(ctx, user.UUID, disabled, handover, inst.announceHandover(ctx, principal, action, user.Login, handover))
+	if err != nil {
+		return err
+	}
+	inst.handedOver(user.Login, handover, documents)
+
+	if disabled {
+		inst.stream.CloseUser(user.Login)
+		return inst.revokeUserSessions(ctx, user.Login)
+	}
+
+	return nil
+}
+
+// DeleteUser removes the login with its sessions, API keys, grants and
+// webhooks and closes their event streams, admin only. The documents only the user has a grant on must be handed
+// over, otherwise it fails with ErrorSoleDocuments.
+func (inst *Registration) DeleteUser(ctx context.Context, principal *model.Principal, login string, handover model.DocumentHandover) (err error) {
+	defer func() {
+		if err != nil {
+			event := newAuditEvent(model.AuditUserDelete, principal.Login, principal.SessionUUID, "", err)
+			event.Target = login
+			inst.auditor.Record(ctx, event)
+		}
+	}()
+
+	user, err := inst.managedUser(ctx, principal, login)
+	if err != nil {
+		return err
+	}
+
+	if err := inst.validateHandover(ctx, user, handover); err != nil {
+		return err
+	}
+
+	// fail before logging the user out, the delete checks it again
+	if !handover.Set() {
+		sole, err := inst.userRepo.ListSoleDocuments(ctx, user.Login)
+		if err != nil {
+			return err
+		}
+		if len(sole) > 0 {
+			return fmt.Errorf("%w: %d documents", utils.ErrorSoleDocuments, len(sole))
+		}
+	}
+
+	// signed access tokens outlive the session rows, deny them first
+	if err := inst.revokeUserSessions(ctx, user.Login); err != nil {
+		return err
+	}
+
+	documents, err := inst.userRepo.DeleteUser(ctx, user.UUID, handover, inst.announceHandover(ctx, principal, model.AuditUserDelete, user.Login, handover))
+	if err != nil {
+		return err
+	}
+	inst.handedOver(user.Login, handover, documents)
+	inst.stream.CloseUser(user.Login)
+
+	return nil
+}
+
+// ChangeRole sets the role of the login, admin only. The user is logged out
+// so that no token keeps the old role.
+func (inst *Registration) ChangeRole(ctx context.Context, principal *model.Principal, login, role string) (err error) {
+	defer func() {
+		if err != nil {
+			event := newAuditEvent(model.AuditUserRole, principal.Login, principal.SessionUUID, "", err)
+			event.Target = login
+			inst.auditor.Record(ctx, event)
+		}
+	}()
+
+	if !model.ValidRole(role) {
+		return utils.ErrorInvalidRole
+	}
+
+	user, err := inst.managedUser(ctx, principal, login)
+	if err != nil {
+		return err
+	}
+
+	if user.Role == role {
+		return nil
+	}
+
+	audit := newAuditEvent(model.AuditUserRole, principal.Login, principal.SessionUUID, "", nil)
+	audit.Target = login
+	audit.Detail = role
+	if err := inst.userRepo.UpdateRole(ctx, user.UUID, role, inst.auditor.Stamp(ctx, audit)); err != nil {
+		return err
+	}
+
+	return inst.revokeUserSessions(ctx, user.Login)
+}
+
+// managedUser returns the user an admin changes. Admins can not change
+// themselves, so there is always an admin left.
+func (inst *Registration) managedUser(ctx context.Context, principal *model.Principal, login string) (*model.User, error) {
+	if !principal.IsAdmin() {
+		return nil, utils.ErrorNoAccess
+	}
+
+	user, err := inst.userRepo.GetUserByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.UUID == principal.UserUUID {
+		return nil, utils.ErrorSelfManagement
+	}
+
+	return user, nil
+}
+
+func (inst *Registration) validateHandover(ctx context.Context, user *model.User, handover model.DocumentHandover) error {
+	if handover.TransferTo == "" {
+		return nil
+	}
+
+	if handover.Delete {
+		return fmt.Errorf("%w: choose either transfer_to or delete_documents", utils.ErrorInvalidHandover)
+	}
+
+	if handover.TransferTo == user.Login {
+		return fmt.Errorf("%w: transfer_to is the user itself", utils.ErrorInvalidHandover)
+	}
+
+	target, err := inst.userRepo.GetUserByLogin(ctx, handover.TransferTo)
+	if err != nil {
+		if errors.Is(err, utils.ErrorNotFound) {
+			return fmt.Errorf("%w: transfer_to user not found", utils.ErrorInvalidHandover)
+		}
+		return err
+	}
+
+	if target.Disabled() {
+		return fmt.Errorf("%w: transfer_to user is disabled", utils.ErrorInvalidHandover)
+	}
+
+	return nil
+}
+
+// announceHandover builds the events and the audit events of a user change
+// with its handed over documents, logged in the transaction of the change.
+// Deleted documents are announced as such, transferred ones as shared to the
+// logins that gained or lost them. Each document is audited, the change
+// itself under action with a summary of the handover.
+func (inst *Registration) announceHandover(ctx context.Context, principal *model.Principal, action, login string, handover model.DocumentHandover) func([]model.Document) ([]*model.Event, []*model.AuditEvent, error) {
+	return func(documents []model.Document) ([]*model.Event, []*model.AuditEvent, error) {
+		events := make([]*model.Event, 0, len(documents))
+		audits := make([]*model.AuditEvent, 0, len(documents)+1)
+		for i := range documents {
+			document := &documents[i]
+
+			var (
+				event *model.Event
+				err   error
+			)
+			if handover.Delete {
+				event, err = newEvent(model.EventDocumentDeleted, principal.Login, document, document.Grant, nil)
+			} else {
+				event, err = newEvent(model.EventDocumentShared, principal.Login, document, []string{handover.TransferTo, login}, map[string]any{
+					"added":   []string{handover.TransferTo},
+					"removed": []string{login},
+				})
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			events = append(events, event)
+
+			audit := newAuditEvent(model.AuditDocumentTransfer, principal.Login, principal.SessionUUID, document.UUID, nil)
+			audit.Target = login
+			if handover.Delete {
+				audit.Action = model.AuditDocumentDelete
+			} else {
+				audit.Detail = "to " + handover.TransferTo
+			}
+			audits = append(audits, inst.auditor.Stamp(ctx, audit))
+		}
+
+		audit := newAuditEvent(action, principal.Login, principal.SessionUUID, "", nil)
+		audit.Target = login
+		audit.Detail = inst.handoverDetail(handover, documents)
+		audits = append(audits, inst.auditor.Stamp(ctx, audit))
+
+		return events, audits, nil
+	}
+}
+
+// handedOver finishes a handover committed with the user change: deleted
+// documents lose their files and every document is dropped from the cache.
+func (inst *Registration) handedOver(login string, handover model.DocumentHandover, documents []model.Document) {
+	if len(documents) == 0 {
+		return
+	}
+
+	tags := []string{fmt.Sprintf(TagUserLoginFormat, login)}
+	if handover.TransferTo != "" {
+		tags = append(tags, fmt.Sprintf(TagUserLoginFormat, handover.TransferTo))
+	}
+
+	for i := range documents {
+		document := &documents[i]
+		tags = append(tags, fmt.Sprintf(TagDocFormat, document.UUID))
+
+		if handover.Delete && document.File {
+			if err := os.Remove(document.Path); err != nil {
+				inst.log.Error("remove file", zap.String("path", document.Path), zap.Error(err))
+			}
+		}
+	}
+
+	inst.cache.InvalidateByTags(tags)
+}
+
+// handoverDetail sums a handover up for the audit log.
+func (inst *Registration) handoverDetail(handover model.DocumentHandover, documents []model.Document) string {
+	switch {
+	case len(documents) == 0:
+		return ""
+	case handover.Delete:
+		return fmt.Sprintf("deleted %d documents", len(documents))
+	default:
+		return fmt.Sprintf("transferred %d documents to %s", len(documents), handover.TransferTo)
+	}
+}
+
+func (inst *Registration) revokeUserSessions(ctx context.Context, login string) error {
+	if _, err := inst.sessionRepo.RevokeUserFamilies(ctx, login, ""); err != nil {
+		inst.log.Error("revoke sessions of user", zap.String("login", login), zap.Error(err))
+		return err
+	}
+
+	return nil
+}
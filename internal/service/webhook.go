@@ -0,0 +1,417 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"docs/internal/model"
+	"docs/internal/repository"
+	"docs/internal/utils"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	WebhookSignatureHeader = "X-Docs-Signature"
+	WebhookTimestampHeader = "X-Docs-Timestamp"
+	WebhookEventHeader     = "X-Docs-Event"
+	WebhookDeliveryHeader  = "X-Docs-Delivery"
+
+	webhookMaxAttempts  = 8
+	webhookBaseBackoff  = 10 * time.Second
+	webhookMaxBackoff   = time.Hour
+	webhookPollInterval = 5 * time.Second
+	webhookBatchSize    = 20
+	webhookRelayBatch   = 500
+	webhookTimeout      = 10 * time.Second
+	// webhookLease outlasts a claimed batch sent one after another at the full
+	// timeout each, so no other instance claims a delivery still in flight
+	webhookLease = webhookBatchSize*webhookTimeout + time.Minute
+)
+
+var WebhookEvents = []string{
+	model.EventDocumentCreated,
+	model.EventDocumentUpdated,
+	model.EventDocumentDeleted,
+	model.EventDocumentShared,
+	model.EventCommentCreated,
+	model.EventCommentUpdated,
+	model.EventCommentDeleted,
+	model.EventCommentResolved,
+}
+
+// Webhook manages webhook endpoints and delivers document events to them.
+// Run reads the event log, queues one delivery per subscribed endpoint and
+// sends them with exponential backoff, moving the ones that keep failing to
+// the dead letters.
+type Webhook struct {
+	log         *zap.Logger
+	webhookRepo repository.WebhookRepository
+	client      *http.Client
+	wake        chan struct{}
+}
+
+func NewWebhook(log *zap.Logger, webhookRepo repository.WebhookRepository) *Webhook {
+	return &Webhook{
+		log:         log,
+		webhookRepo: webhookRepo,
+		client:      newWebhookClient(),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// errWebhookAddress refuses to connect to an address of the server's own
+// networks.
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// newWebhookClient connects only to public addresses. The check runs on the
+// address actually dialed, so hosts that resolve differently after the
+// webhook was registered and redirects are covered too. Proxies from the
+// environment are not used, the check would see the proxy instead.
+func newWebhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			addr, err := netip.ParseAddr(host)
+			if err != nil || !publicAddr(addr) {
+				return fmt.Errorf("%w: %s", errWebhookAddress, host)
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: webhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: webhookTimeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// publicAddr reports whether addr is outside loopback, private, link-local,
+// unspecified and multicast ranges.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified()
+}
+
+func (inst *Webhook) CreateWebhook(ctx context.Context, principal *model.Principal, webhook *model.Webhook) error {
+	if err := inst.validateWebhook(ctx, webhook); err != nil {
+		return err
+	}
+
+	if webhook.Secret == "" {
+		secret, err := inst.generateSecret()
+		if err != nil {
+			return err
+		}
+		webhook.Secret = secret
+	}
+
+	webhook.UUID = uuid.NewString()
+	webhook.UserLogin = principal.Login
+	webhook.Active = true
+	webhook.CreateAt = time.Now()
+
+	return inst.webhookRepo.CreateWebhook(ctx, webhook)
+}
+
+// ListWebhooks returns the webhooks of the session login, admins see all of them.
+func (inst *Webhook) ListWebhooks(ctx context.Context, principal *model.Principal) ([]model.Webhook, error) {
+	login := principal.Login
+	if principal.IsAdmin() {
+		login = ""
+	}
+
+	return inst.webhookRepo.ListWebhooks(ctx, login)
+}
+
+func (inst *Webhook) DeleteWebhook(ctx context.Context, principal *model.Principal, webhookUUID string) error {
+	if _, err := inst.ownedWebhook(ctx, principal, webhookUUID); err != nil {
+		return err
+	}
+
+	return inst.webhookRepo.DeleteWebhook(ctx, webhookUUID)
+}
+
+func (inst *Webhook) ListDeliveries(ctx context.Context, principal *model.Principal, webhookUUID, status string, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := inst.ownedWebhook(ctx, principal, webhookUUID); err != nil {
+		return nil, err
+	}
+
+	return inst.webhookRepo.ListDeliveries(ctx, webhookUUID, status, limit)
+}
+
+// ReplayDelivery queues the payload of a past delivery again as a new
+// delivery. Inactive webhooks, those of disabled users, deliver nothing.
+func (inst *Webhook) ReplayDelivery(ctx context.Context, principal *model.Principal, webhookUUID, deliveryUUID string) (*model.WebhookDelivery, error) {
+	webhook, err := inst.ownedWebhook(ctx, principal, webhookUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !webhook.Active {
+		return nil, utils.ErrorWebhookInactive
+	}
+
+	delivery, err := inst.webhookRepo.GetDeliveryByUUID(ctx, deliveryUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if delivery.WebhookUUID != webhookUUID {
+		return nil, utils.ErrorNotFound
+	}
+
+	replay := inst.newDelivery(webhookUUID, delivery.EventUUID, delivery.Event, delivery.Payload)
+	if err := inst.webhookRepo.CreateDeliveries(ctx, []model.WebhookDelivery{replay}); err != nil {
+		return nil, err
+	}
+
+	inst.Wake()
+
+	return &replay, nil
+}
+
+// Run queues and delivers logged events until ctx is done.
+func (inst *Webhook) Run(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		inst.queueEvents(ctx)
+		inst.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-inst.wake:
+		}
+	}
+}
+
+// Wake makes Run look for new events and due deliveries now.
+func (inst *Webhook) Wake() {
+	select {
+	case inst.wake <- struct{}{}:
+	default:
+	}
+}
+
+// queueEvents turns the events logged since the last call into deliveries.
+func (inst *Webhook) queueEvents(ctx context.Context) {
+	for {
+		count, err := inst.webhookRepo.QueueEventDeliveries(ctx, webhookRelayBatch)
+		if err != nil {
+			inst.log.Error("queue webhook deliveries", zap.Error(err))
+			return
+		}
+
+		if count < webhookRelayBatch {
+			return
+		}
+	}
+}
+
+func (inst *Webhook) deliverDue(ctx context.Context) {
+	for {
+		deliveries, err := inst.webhookRepo.ClaimDueDeliveries(ctx, webhookBatchSize, webhookLease)
+		if err != nil {
+			inst.log.Error("claim webhook deliveries", zap.Error(err))
+			return
+		}
+
+		for _, delivery := range deliveries {
+			inst.deliver(ctx, &delivery)
+		}
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+func (inst *Webhook) deliver(ctx context.Context, delivery *model.WebhookDelivery) {
+	code, err := inst.send(ctx, delivery)
+
+	now := time.Now()
+	delivery.Attempts++
+	if code != 0 {
+		delivery.ResponseCode = &code
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = model.DeliveryDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = nil
+	case delivery.Attempts >= webhookMaxAttempts:
+		delivery.Status = model.DeliveryDead
+		delivery.LastError = inst.errorText(err)
+		inst.log.Warn("webhook delivery dead", zap.String("delivery", delivery.UUID), zap.String("url", delivery.URL), zap.Error(err))
+	default:
+		delivery.LastError = inst.errorText(err)
+		delivery.NextAttemptAt = now.Add(inst.backoff(delivery.Attempts))
+	}
+
+	if err := inst.webhookRepo.UpdateDelivery(ctx, delivery); err != nil {
+		inst.log.Error("update webhook delivery", zap.String("delivery", delivery.UUID), zap.Error(err))
+	}
+}
+
+func (inst *Webhook) send(ctx context.Context, delivery *model.WebhookDelivery) (int, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookEventHeader, delivery.Event)
+	request.Header.Set(WebhookDeliveryHeader, delivery.UUID)
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(WebhookSignatureHeader, "sha256="+Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	response, err := inst.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("unexpected response status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of "timestamp.payload" keyed by secret.
+// Receivers recompute it to check the X-Docs-Signature header.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (inst *Webhook) backoff(attempts int) time.Duration {
+	delay := webhookBaseBackoff << (attempts - 1)
+	if delay <= 0 || delay > webhookMaxBackoff {
+		return webhookMaxBackoff
+	}
+
+	return delay
+}
+
+func (inst *Webhook) ownedWebhook(ctx context.Context, principal *model.Principal, webhookUUID string) (*model.Webhook, error) {
+	webhook, err := inst.webhookRepo.GetWebhookByUUID(ctx, webhookUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if webhook.UserLogin != principal.Login && !principal.IsAdmin() {
+		return nil, utils.ErrorNoAccess
+	}
+
+	return webhook, nil
+}
+
+func (inst *Webhook) validateWebhook(ctx context.Context, webhook *model.Webhook) error {
+	target, err := url.Parse(webhook.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Hostname() == "" {
+		return fmt.Errorf("%w: url should be an absolute http(s) url", utils.ErrorInvalidWebhook)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", target.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: host %s can't be resolved", utils.ErrorInvalidWebhook, target.Hostname())
+	}
+
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return fmt.Errorf("%w: host %s is not a public address", utils.ErrorInvalidWebhook, target.Hostname())
+		}
+	}
+
+	if len(webhook.Events) == 0 {
+		return fmt.Errorf("%w: at least one event is required", utils.ErrorInvalidWebhook)
+	}
+
+	for _, event := range webhook.Events {
+		if !slices.Contains(WebhookEvents, event) {
+			return fmt.Errorf("%w: unknown event %q", utils.ErrorInvalidWebhook, event)
+		}
+	}
+
+	return nil
+}
+
+func (inst *Webhook) newDelivery(webhookUUID, eventUUID, event string, payload []byte) model.WebhookDelivery {
+	now := time.Now()
+	return model.WebhookDelivery{
+		UUID:          uuid.NewString(),
+		WebhookUUID:   webhookUUID,
+		EventUUID:     eventUUID,
+		Event:         event,
+		Payload:       payload,
+		Status:        model.DeliveryPending,
+		NextAttemptAt: now,
+		CreateAt:      now,
+	}
+}
+
+func (inst *Webhook) generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+func (inst *Webhook) errorText(err error) *string {
+	var text string
+	if errors.Is(err, context.DeadlineExceeded) {
+		text = "timeout"
+	} else {
+		text = err.Error()
+	}
+
+	return &text
+}
@@ -0,0 +1,26 @@
+package dto
+
+import "time"
+
+type AuditEvent struct {
+	ID         int64     `json:"id"`
+	UUID       string    `json:"uuid"`
+	Actor      string    `json:"actor"`
+	Session    string    `json:"session"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Action     string    `json:"action"`
+	Target     string    `json:"target,omitempty"`
+	DocumentID string    `json:"document_id,omitempty"`
+	Outcome    string    `json:"outcome"`
+	Detail     string    `json:"detail,omitempty"`
+	CreateAt   time.Time `json:"create_at"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash"`
+}
+
+type AuditVerification struct {
+	Checked  int64 `json:"checked"`
+	Valid    bool  `json:"valid"`
+	BrokenID int64 `json:"broken_id,omitempty"`
+}
@@ -0,0 +1,35 @@
+package dto
+
+import "time"
+
+type CommentAnchor struct {
+	Page  *int   `json:"page,omitempty"`
+	Start *int   `json:"start,omitempty"`
+	End   *int   `json:"end,omitempty"`
+	Quote string `json:"quote,omitempty"`
+}
+
+type CommentCreate struct {
+	Body     string         `json:"body"`
+	ParentID *string        `json:"parent_id,omitempty"`
+	Anchor   *CommentAnchor `json:"anchor,omitempty"`
+}
+
+type CommentUpdate struct {
+	Body   *string        `json:"body,omitempty"`
+	Anchor *CommentAnchor `json:"anchor,omitempty"`
+}
+
+type Comment struct {
+	ID         string         `json:"id"`
+	ParentID   *string        `json:"parent_id,omitempty"`
+	Login      string         `json:"login"`
+	Body       string         `json:"body"`
+	Anchor     *CommentAnchor `json:"anchor,omitempty"`
+	Resolved   bool           `json:"resolved"`
+	ResolvedBy *string        `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time     `json:"resolved_at,omitempty"`
+	CreateAt   time.Time      `json:"create_at"`
+	UpdateAt   time.Time      `json:"update_at"`
+	Replies    []Comment      `json:"replies,omitempty"`
+}
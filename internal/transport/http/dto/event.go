@@ -0,0 +1,11 @@
+package dto
+
+import "encoding/json"
+
+// StreamMessage is an event as sent over the WebSocket stream, the fields
+// mirror the id, event and data lines of the Server-Sent Events stream.
+type StreamMessage struct {
+	ID    string          `json:"id"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data" swaggertype:"object"`
+}
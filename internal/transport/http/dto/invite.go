@@ -0,0 +1,29 @@
+package dto
+
+import "time"
+
+type InviteData struct {
+	Login     string     `json:"login,omitempty"`
+	Role      string     `json:"role,omitempty"`
+	MaxUses   int        `json:"max_uses,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type Invite struct {
+	ID          string             `json:"id"`
+	Code        string             `json:"code,omitempty"`
+	Login       string             `json:"login,omitempty"`
+	Role        string             `json:"role"`
+	MaxUses     int                `json:"max_uses"`
+	Uses        int                `json:"uses"`
+	CreateBy    string             `json:"create_by"`
+	ExpiresAt   time.Time          `json:"expires_at"`
+	RevokedAt   *time.Time         `json:"revoked_at,omitempty"`
+	CreateAt    time.Time          `json:"create_at"`
+	Redemptions []InviteRedemption `json:"redemptions"`
+}
+
+type InviteRedemption struct {
+	Login    string    `json:"login"`
+	CreateAt time.Time `json:"create_at"`
+}
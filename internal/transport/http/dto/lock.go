@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+type Lock struct {
+	Login     string    `json:"login"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreateAt  time.Time `json:"create_at"`
+}
@@ -3,12 +3,18 @@ package dto
 import "time"
 
 type Meta struct {
-	ID       string    `json:"id"`
-	Name     string    `json:"name"`
-	File     bool      `json:"file"`
-	Public   bool      `json:"public"`
-	Token    string    `json:"token,omitempty"`
-	CreateAt time.Time `json:"create_at,omitempty"`
-	Mime     string    `json:"mime"`
-	Grant    []string  `json:"grant"`
+	ID         string         `json:"id"`
+	Name       string         `json:"name"`
+	File       bool           `json:"file"`
+	Public     bool           `json:"public"`
+	Token      string         `json:"token,omitempty"`
+	CreateAt   time.Time      `json:"create_at,omitempty"`
+	Mime       string         `json:"mime"`
+	Grant      []string       `json:"grant"`
+	Version    int            `json:"version,omitempty"`
+	JSON       map[string]any `json:"json,omitempty"`
+	Size       int64          `json:"size,omitempty"`
+	Hash       string         `json:"hash,omitempty"`
+	Lock       *Lock          `json:"lock,omitempty"`
+	GrantUsers []UserSummary  `json:"grant_users,omitempty"`
 }
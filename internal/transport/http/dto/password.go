@@ -0,0 +1,18 @@
+package dto
+
+import "time"
+
+type PasswordChange struct {
+	OldPassword string `json:"old_pswd"`
+	NewPassword string `json:"new_pswd"`
+}
+
+type PasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"pswd"`
+}
+
+type PasswordResetToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
@@ -1,7 +1,8 @@
 package dto
 
 type Registration struct {
-	Token    string `json:"token"`
+	Token    string `json:"token,omitempty"`
+	Invite   string `json:"invite,omitempty"`
 	Login    string `json:"login"`
 	Password string `json:"pswd"`
 }
@@ -13,7 +13,14 @@ type DataResponse struct {
 }
 
 type Error struct {
-	Code int    `json:"code"`
+	Code       int         `json:"code"`
+	Text       string      `json:"text"`
+	Violations []Violation `json:"violations,omitempty"`
+}
+
+// Violation is a login or password rule the request failed.
+type Violation struct {
+	Rule string `json:"rule"`
 	Text string `json:"text"`
 }
 
@@ -0,0 +1,17 @@
+package dto
+
+import "time"
+
+type Session struct {
+	ID         string    `json:"id"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	CreateAt   time.Time `json:"create_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type SessionsRevoked struct {
+	Revoked int `json:"revoked"`
+}
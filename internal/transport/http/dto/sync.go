@@ -0,0 +1,19 @@
+package dto
+
+import "time"
+
+type SyncChanges struct {
+	Changes  []SyncChange `json:"changes"`
+	Cursor   string       `json:"cursor"`
+	HasMore  bool         `json:"has_more"`
+	Snapshot bool         `json:"snapshot"`
+}
+
+type SyncChange struct {
+	Type       string    `json:"type"`
+	Event      string    `json:"event,omitempty"`
+	Actor      string    `json:"actor,omitempty"`
+	DocumentID string    `json:"document_id"`
+	Document   *Meta     `json:"document,omitempty"`
+	At         time.Time `json:"at"`
+}
@@ -1,5 +1,19 @@
 package dto
 
+import "time"
+
 type Token struct {
-	Token string `json:"token"`
+	Token        string     `json:"token,omitempty"`
+	RefreshToken string     `json:"refresh_token,omitempty"`
+	Challenge    string     `json:"challenge,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+type TOTPLogin struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
+
+type RefreshData struct {
+	RefreshToken string `json:"refresh_token"`
 }
@@ -1,7 +1,65 @@
 package dto
 
+import "time"
+
 type User struct {
 	UUID     string `json:"uuid"`
 	Login    string `json:"login"`
 	Password string `json:"pswd"`
 }
+
+type UserData struct {
+	Login    string `json:"login"`
+	Password string `json:"pswd"`
+	Role     string `json:"role,omitempty"`
+}
+
+type UserRole struct {
+	Role string `json:"role"`
+}
+
+// AdminUser is a user as admins see it, without the password hash.
+type AdminUser struct {
+	UUID       string     `json:"uuid"`
+	Login      string     `json:"login"`
+	Role       string     `json:"role"`
+	Disabled   bool       `json:"disabled"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreateAt   time.Time  `json:"create_at"`
+
+	DisplayName string `json:"display_name,omitempty"`
+	Email       string `json:"email,omitempty"`
+	Locale      string `json:"locale,omitempty"`
+	Avatar      string `json:"avatar,omitempty"`
+}
+
+// UserDocument is a document only one user has a grant on.
+type UserDocument struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Mime     string    `json:"mime"`
+	File     bool      `json:"file"`
+	Size     int64     `json:"size,omitempty"`
+	CreateAt time.Time `json:"create_at"`
+}
+
+// Profile is the own account of a user. Avatar is the id of the image
+// document, served for everyone at /users/{login}/avatar.
+type Profile struct {
+	UUID        string    `json:"uuid"`
+	Login       string    `json:"login"`
+	Role        string    `json:"role"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Email       string    `json:"email,omitempty"`
+	Locale      string    `json:"locale,omitempty"`
+	Avatar      string    `json:"avatar,omitempty"`
+	CreateAt    time.Time `json:"create_at"`
+}
+
+// UserSummary is what others see of a user, for showing names next to
+// logins.
+type UserSummary struct {
+	Login       string `json:"login"`
+	DisplayName string `json:"display_name,omitempty"`
+	Avatar      string `json:"avatar,omitempty"`
+}
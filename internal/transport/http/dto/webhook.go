@@ -0,0 +1,37 @@
+package dto
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type WebhookCreate struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret,omitempty"`
+	Events []string `json:"events"`
+}
+
+type Webhook struct {
+	ID       string    `json:"id"`
+	Login    string    `json:"login"`
+	URL      string    `json:"url"`
+	Secret   string    `json:"secret,omitempty"`
+	Events   []string  `json:"events"`
+	Active   bool      `json:"active"`
+	CreateAt time.Time `json:"create_at"`
+}
+
+type WebhookDelivery struct {
+	ID            string          `json:"id"`
+	WebhookID     string          `json:"webhook_id"`
+	EventID       string          `json:"event_id"`
+	Event         string          `json:"event"`
+	Payload       json.RawMessage `json:"payload" swaggertype:"object"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	ResponseCode  *int            `json:"response_code,omitempty"`
+	LastError     *string         `json:"last_error,omitempty"`
+	NextAttemptAt time.Time       `json:"next_attempt_at"`
+	CreateAt      time.Time       `json:"create_at"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+}
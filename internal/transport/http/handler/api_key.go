@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKey manages the API keys of the user, long-lived tokens for service
+// accounts that are accepted wherever an access token is.
+type APIKey struct {
+	apiKeyService service.APIKeyService
+}
+
+func NewAPIKey(apiKeyService service.APIKeyService) *APIKey {
+	return &APIKey{
+		apiKeyService: apiKeyService,
+	}
+}
+
+// CreateAPIKey godoc
+// @Summary Create API key
+// @Description Issue a key limited to scopes (docs:read, docs:write, docs:delete, admin), none beyond those of the user. allowed_ips takes addresses and CIDRs, empty allows any. The key is returned only once, send it like an access token or as the WebDAV password
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param data body dto.APIKeyData true "Key settings"
+// @Success 201 {object} dto.DataResponse{data=dto.APIKey}
+// @Router /me/keys [post]
+func (inst *APIKey) CreateAPIKey(ctx *gin.Context) {
+	data := &dto.APIKeyData{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidAPIKey)
+		return
+	}
+
+	key, err := inst.apiKeyService.CreateAPIKey(ctx, utils.PrincipalFromContext(ctx), &model.APIKey{
+		Name:       data.Name,
+		Scopes:     data.Scopes,
+		AllowedIPs: data.AllowedIPs,
+		ExpiresAt:  data.ExpiresAt,
+	})
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.DataResponse{Data: inst.transformAPIKey(key)})
+}
+
+// ListAPIKeys godoc
+// @Summary List API keys
+// @Description Keys of the user, newest first, expired ones included. Only the prefix of a key is shown
+// @Tags APIKey
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.DataResponse{data=[]dto.APIKey}
+// @Router /me/keys [get]
+func (inst *APIKey) ListAPIKeys(ctx *gin.Context) {
+	keys, err := inst.apiKeyService.ListAPIKeys(ctx, utils.PrincipalFromContext(ctx))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	result := make([]dto.APIKey, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, inst.transformAPIKey(&key))
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: result})
+}
+
+// RevokeAPIKey godoc
+// @Summary Revoke API key
+// @Description Delete a key, it stops working at once
+// @Tags APIKey
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param id path string true "Key ID"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /me/keys/{id} [delete]
+func (inst *APIKey) RevokeAPIKey(ctx *gin.Context) {
+	if err := inst.apiKeyService.RevokeAPIKey(ctx, utils.PrincipalFromContext(ctx), ctx.Param("id")); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "api key revoked"})
+}
+
+func (inst *APIKey) transformAPIKey(key *model.APIKey) dto.APIKey {
+	return dto.APIKey{
+		ID:         key.UUID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Key:        key.Token,
+		Scopes:     key.Scopes,
+		AllowedIPs: key.AllowedIPs,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		CreateAt:   key.CreateAt,
+	}
+}
@@ -0,0 +1,261 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	auditDefaultLimit = 100
+	auditMaxLimit     = 1000
+)
+
+type Audit struct {
+	log          *zap.Logger
+	auditService service.AuditService
+}
+
+func NewAudit(log *zap.Logger, auditService service.AuditService) *Audit {
+	return &Audit{
+		log:          log,
+		auditService: auditService,
+	}
+}
+
+// ListAuditEvents godoc
+// @Summary Audit log
+// @Description Audit events in log order, admin only. Page with after set to the last id received. Reads (document.read, document.list, document.sync, comment.list) are a separate log without hashes, listed with reads=true or a read action
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param actor query string false "Actor login"
+// @Param action query string false "Action, e.g. document.read"
+// @Param document query string false "Document ID"
+// @Param outcome query string false "success or failure"
+// @Param reads query string false "true for the log of reads"
+// @Param from query string false "From time, RFC 3339"
+// @Param to query string false "To time, RFC 3339"
+// @Param after query string false "Return events after this id"
+// @Param limit query string false "Limit, default 100, max 1000"
+// @Success 200 {object} dto.DataResponse{data=[]dto.AuditEvent}
+// @Router /admin/audit [get]
+func (inst *Audit) ListAuditEvents(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	filter, err := inst.parseFilter(ctx)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	events, err := inst.auditService.ListAuditEvents(ctx, principal, filter)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	response := make([]dto.AuditEvent, 0, len(events))
+	for _, event := range events {
+		response = append(response, inst.transformAuditEvent(&event))
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: response})
+}
+
+// ExportAuditEvents godoc
+// @Summary Export audit log
+// @Description Every audit event matching the filters, admin only, as CSV or JSON lines. Reads are exported with reads=true or a read action
+// @Tags Admin
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param format query string false "csv (default) or jsonl"
+// @Param actor query string false "Actor login"
+// @Param action query string false "Action, e.g. document.read"
+// @Param document query string false "Document ID"
+// @Param outcome query string false "success or failure"
+// @Param reads query string false "true for the log of reads"
+// @Param from query string false "From time, RFC 3339"
+// @Param to query string false "To time, RFC 3339"
+// @Success 200 {string} string
+// @Router /admin/audit/export [get]
+func (inst *Audit) ExportAuditEvents(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	filter, err := inst.parseFilter(ctx)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+	filter.After = 0
+	filter.Limit = auditMaxLimit
+
+	format := ctx.DefaultQuery("format", "csv")
+	if format != "csv" && format != "jsonl" {
+		utils.CaseError(ctx, utils.ErrorFilterFormat)
+		return
+	}
+
+	// fetch the first page before writing so errors still get a status
+	events, err := inst.auditService.ListAuditEvents(ctx, principal, filter)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	var write func(event *model.AuditEvent) error
+	switch format {
+	case "csv":
+		ctx.Header("Content-Type", "text/csv")
+		writer := csv.NewWriter(ctx.Writer)
+		defer writer.Flush()
+
+		writer.Write([]string{"id", "uuid", "create_at", "actor", "session", "ip", "user_agent", "action", "target", "document_id", "outcome", "detail", "prev_hash", "hash"})
+		write = func(event *model.AuditEvent) error {
+			return writer.Write([]string{
+				strconv.FormatInt(event.ID, 10),
+				event.UUID,
+				event.CreateAt.UTC().Format(time.RFC3339Nano),
+				event.Actor,
+				event.Session,
+				event.IP,
+				event.UserAgent,
+				event.Action,
+				event.Target,
+				event.DocumentUUID,
+				event.Outcome,
+				event.Detail,
+				event.PrevHash,
+				event.Hash,
+			})
+		}
+	case "jsonl":
+		ctx.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(ctx.Writer)
+		write = func(event *model.AuditEvent) error {
+			return encoder.Encode(inst.transformAuditEvent(event))
+		}
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="audit.%s"`, format))
+	ctx.Status(http.StatusOK)
+
+	for {
+		for i := range events {
+			if err := write(&events[i]); err != nil {
+				return
+			}
+			filter.After = events[i].ID
+		}
+
+		if len(events) < filter.Limit {
+			return
+		}
+
+		if events, err = inst.auditService.ListAuditEvents(ctx, principal, filter); err != nil {
+			inst.log.Error("export audit events", zap.Error(err))
+			return
+		}
+	}
+}
+
+// VerifyAuditLog godoc
+// @Summary Verify audit log
+// @Description Walk the audit hash chain and report the first tampered row, admin only. Reads are not chained
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.DataResponse{data=dto.AuditVerification}
+// @Router /admin/audit/verify [get]
+func (inst *Audit) VerifyAuditLog(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	result, err := inst.auditService.VerifyAuditLog(ctx, principal)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: dto.AuditVerification{
+		Checked:  result.Checked,
+		Valid:    result.Valid,
+		BrokenID: result.BrokenID,
+	}})
+}
+
+func (inst *Audit) parseFilter(ctx *gin.Context) (*model.AuditFilter, error) {
+	filter := &model.AuditFilter{
+		Actor:        ctx.Query("actor"),
+		Action:       ctx.Query("action"),
+		DocumentUUID: ctx.Query("document"),
+		Outcome:      ctx.Query("outcome"),
+		Limit:        auditDefaultLimit,
+		Reads:        ctx.Query("reads") == "true" || model.IsAuditRead(ctx.Query("action")),
+	}
+
+	var err error
+	if filter.From, err = inst.parseTime(ctx.Query("from")); err != nil {
+		return nil, err
+	}
+
+	if filter.To, err = inst.parseTime(ctx.Query("to")); err != nil {
+		return nil, err
+	}
+
+	if after := ctx.Query("after"); after != "" {
+		if filter.After, err = strconv.ParseInt(after, 10, 64); err != nil || filter.After < 0 {
+			return nil, utils.ErrorFilterFormat
+		}
+	}
+
+	if limit := ctx.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 || filter.Limit > auditMaxLimit {
+			return nil, utils.ErrorLimitFormat
+		}
+	}
+
+	return filter, nil
+}
+
+func (inst *Audit) parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, utils.ErrorFilterFormat
+	}
+
+	return &t, nil
+}
+
+func (inst *Audit) transformAuditEvent(event *model.AuditEvent) dto.AuditEvent {
+	return dto.AuditEvent{
+		ID:         event.ID,
+		UUID:       event.UUID,
+		Actor:      event.Actor,
+		Session:    event.Session,
+		IP:         event.IP,
+		UserAgent:  event.UserAgent,
+		Action:     event.Action,
+		Target:     event.Target,
+		DocumentID: event.DocumentUUID,
+		Outcome:    event.Outcome,
+		Detail:     event.Detail,
+		CreateAt:   event.CreateAt,
+		PrevHash:   event.PrevHash,
+		Hash:       event.Hash,
+	}
+}
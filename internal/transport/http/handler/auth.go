@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"docs/internal/model"
 	"docs/internal/service"
 	"docs/internal/transport/http/dto"
 	"docs/internal/utils"
@@ -21,7 +22,7 @@ func NewAuth(docsService service.AuthService) *Auth {
 
 // Login godoc
 // @Summary      Login
-// @Description  Login with login & password
+// @Description  Login with login & password. The token expires after access_ttl of inactivity, every use extends it up to max_ttl. When the user has two-factor authentication only challenge is returned, pass it with a code to /auth/totp. With jwt.enabled the token is a signed JWT valid until expires_at, carrying login, role and scope claims. Use refresh_token with /auth/refresh for a new pair. Failed passwords delay the next attempt, repeated ones lock the login out: 429 with Retry-After
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
@@ -41,21 +42,76 @@ func (inst *Auth) Login(ctx *gin.Context) {
 		return
 	}
 
-	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: dto.Token{Token: token.AccessToken}})
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: transformToken(token)})
 
 }
 
+// LoginTOTP godoc
+// @Summary      Login second step
+// @Description  Exchange the challenge of a login and a TOTP or recovery code for a token and refresh token. A challenge expires after totp.challenge_ttl and a few wrong codes
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        data body dto.TOTPLogin true "Challenge and code"
+// @Success      200  	{object}  dto.SuccessResponse{response=dto.Token}  "desc"
+// @Router       /auth/totp [post]
+func (inst *Auth) LoginTOTP(ctx *gin.Context) {
+	data := &dto.TOTPLogin{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		ctx.JSON(http.StatusBadRequest, dto.SuccessResponse{Response: "bad request"})
+		return
+	}
+
+	token, err := inst.docsService.LoginTOTP(ctx, data.Challenge, data.Code)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: transformToken(token)})
+}
+
+// Refresh godoc
+// @Summary      Refresh
+// @Description  Exchange a refresh token for a new token and refresh token. A refresh token works once, presenting it again revokes every token issued from the same login
+// @Tags         Auth
+// @Accept       json
+// @Produce      json
+// @Param        data body dto.RefreshData true "Refresh token"
+// @Success      200  	{object}  dto.SuccessResponse{response=dto.Token}  "desc"
+// @Router       /auth/refresh [post]
+func (inst *Auth) Refresh(ctx *gin.Context) {
+	data := &dto.RefreshData{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		ctx.JSON(http.StatusBadRequest, dto.SuccessResponse{Response: "bad request"})
+		return
+	}
+
+	token, err := inst.docsService.Refresh(ctx, data.RefreshToken)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: transformToken(token)})
+}
+
 // Logout godoc
 // @Summary      Logout
-// @Description  Logout
+// @Description  Logout. Without the path parameter the token of the request is ended
 // @Tags         Auth
 // @Accept       json
 // @Produce      json
 // @Param token path string true "Access Token"
 // @Success      200  	{object}  dto.SuccessResponse{response=string}  "desc"
 // @Router       /auth/{token} [delete]
+// @Router       /auth [delete]
 func (inst *Auth) Logout(ctx *gin.Context) {
 	token := ctx.Param("token")
+	if token == "" {
+		token = requestToken(ctx)
+	}
+
 	if token == "" {
 		utils.CaseError(ctx, utils.ErrorInvalidToken)
 		return
@@ -70,3 +126,12 @@ func (inst *Auth) Logout(ctx *gin.Context) {
 		token: true,
 	}})
 }
+
+func transformToken(token *model.AuthToken) dto.Token {
+	return dto.Token{
+		Token:        token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		Challenge:    token.Challenge,
+		ExpiresAt:    &token.ExpiresAt,
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"docs/internal/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenCookie is the cookie an access token may be sent in, on safe methods
+// only.
+const TokenCookie = "token"
+
+// Authenticate resolves the access token of the request once and stores the
+// principal in the request context, requests without a valid token are
+// rejected.
+func (inst *Auth) Authenticate(ctx *gin.Context) {
+	principal, err := inst.docsService.Authenticate(ctx, requestToken(ctx))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		ctx.Abort()
+		return
+	}
+
+	ctx.Request = ctx.Request.WithContext(utils.WithPrincipal(ctx.Request.Context(), principal))
+
+	ctx.Next()
+}
+
+// RequireScope rejects requests whose credential lacks the scope.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if !utils.PrincipalFromContext(ctx).HasScope(scope) {
+			utils.CaseError(ctx, fmt.Errorf("%w: %s scope required", utils.ErrorNoAccess, scope))
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// RequireSession rejects requests made with an API key, for routes that
+// manage the account itself.
+func RequireSession(ctx *gin.Context) {
+	if utils.PrincipalFromContext(ctx).APIKey {
+		utils.CaseError(ctx, fmt.Errorf("%w: not available to api keys", utils.ErrorNoAccess))
+		ctx.Abort()
+		return
+	}
+
+	ctx.Next()
+}
+
+// requestToken returns the access token from the Authorization: Bearer
+// header, the token cookie or, for older clients, the token query parameter.
+func requestToken(ctx *gin.Context) string {
+	if token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+
+	if cookieAllowed(ctx.Request) {
+		if token, err := ctx.Cookie(TokenCookie); err == nil && token != "" {
+			return token
+		}
+	}
+
+	return ctx.Query("token")
+}
+
+// cookieAllowed tells whether the token cookie may authenticate request. The
+// browser sends the cookie along with requests other sites make, so it is
+// only taken where a forged request changes nothing: on safe methods, and
+// not for a WebSocket handshake from another origin, whose reply the other
+// site could read.
+func cookieAllowed(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return false
+	}
+
+	origin := request.Header.Get("Origin")
+	if origin == "" || !strings.EqualFold(request.Header.Get("Upgrade"), "websocket") {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	return err == nil && parsed.Host == request.Host
+}
@@ -0,0 +1,19 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Client stores the caller address and user agent in the request context so
+// services can record them.
+func Client(ctx *gin.Context) {
+	ctx.Request = ctx.Request.WithContext(utils.WithClient(ctx.Request.Context(), model.Client{
+		IP:        ctx.ClientIP(),
+		UserAgent: ctx.Request.UserAgent(),
+	}))
+
+	ctx.Next()
+}
@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Comment struct {
+	commentService service.CommentService
+}
+
+func NewComment(commentService service.CommentService) *Comment {
+	return &Comment{
+		commentService: commentService,
+	}
+}
+
+// ListComments godoc
+// @Summary List comments
+// @Description Comment threads of the document, oldest first, replies nested under their parent
+// @Tags Comment
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.DataResponse{data=[]dto.Comment}
+// @Router /docs/{uuid}/comments [get]
+func (inst *Comment) ListComments(ctx *gin.Context) {
+	uuid, ok := inst.params(ctx)
+	if !ok {
+		return
+	}
+
+	comments, err := inst.commentService.ListComments(ctx, uuid, utils.PrincipalFromContext(ctx))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: inst.threads(comments)})
+}
+
+// CreateComment godoc
+// @Summary Add comment
+// @Description Add a comment or, with parent_id, a reply. The anchor optionally points to a page and/or a character range
+// @Tags Comment
+// @Accept json
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param data body dto.CommentCreate true "Comment"
+// @Success 201 {object} dto.DataResponse{data=dto.Comment}
+// @Router /docs/{uuid}/comments [post]
+func (inst *Comment) CreateComment(ctx *gin.Context) {
+	uuid, ok := inst.params(ctx)
+	if !ok {
+		return
+	}
+
+	data := &dto.CommentCreate{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidComment)
+		return
+	}
+
+	comment := &model.Comment{
+		ParentUUID: data.ParentID,
+		Body:       data.Body,
+		Anchor:     inst.transformAnchor(data.Anchor),
+	}
+
+	if err := inst.commentService.CreateComment(ctx, uuid, utils.PrincipalFromContext(ctx), comment); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.DataResponse{Data: inst.transformComment(comment)})
+}
+
+// UpdateComment godoc
+// @Summary Edit comment
+// @Description Change the body and/or the anchor of an own comment, an empty anchor object removes it
+// @Tags Comment
+// @Accept json
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param comment path string true "Comment ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param data body dto.CommentUpdate true "Changes"
+// @Success 200 {object} dto.DataResponse{data=dto.Comment}
+// @Router /docs/{uuid}/comments/{comment} [patch]
+func (inst *Comment) UpdateComment(ctx *gin.Context) {
+	uuid, ok := inst.params(ctx)
+	if !ok {
+		return
+	}
+
+	data := &dto.CommentUpdate{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidComment)
+		return
+	}
+
+	comment, err := inst.commentService.UpdateComment(ctx, uuid, ctx.Param("comment"), utils.PrincipalFromContext(ctx), &model.CommentPatch{
+		Body:   data.Body,
+		Anchor: inst.transformAnchor(data.Anchor),
+	})
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: inst.transformComment(comment)})
+}
+
+// DeleteComment godoc
+// @Summary Delete comment
+// @Description Delete an own comment with its replies, admins can delete any comment
+// @Tags Comment
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param comment path string true "Comment ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /docs/{uuid}/comments/{comment} [delete]
+func (inst *Comment) DeleteComment(ctx *gin.Context) {
+	uuid, ok := inst.params(ctx)
+	if !ok {
+		return
+	}
+
+	commentUUID := ctx.Param("comment")
+	if err := inst.commentService.DeleteComment(ctx, uuid, commentUUID, utils.PrincipalFromContext(ctx)); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: map[string]bool{
+		commentUUID: true,
+	}})
+}
+
+// ResolveComment godoc
+// @Summary Resolve thread
+// @Description Mark a thread as resolved
+// @Tags Comment
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param comment path string true "Thread root comment ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.DataResponse{data=dto.Comment}
+// @Router /docs/{uuid}/comments/{comment}/resolve [post]
+func (inst *Comment) ResolveComment(ctx *gin.Context) {
+	inst.resolve(ctx, true)
+}
+
+// ReopenComment godoc
+// @Summary Reopen thread
+// @Description Mark a resolved thread as open again
+// @Tags Comment
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param comment path string true "Thread root comment ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.DataResponse{data=dto.Comment}
+// @Router /docs/{uuid}/comments/{comment}/resolve [delete]
+func (inst *Comment) ReopenComment(ctx *gin.Context) {
+	inst.resolve(ctx, false)
+}
+
+func (inst *Comment) resolve(ctx *gin.Context, resolved bool) {
+	uuid, ok := inst.params(ctx)
+	if !ok {
+		return
+	}
+
+	comment, err := inst.commentService.ResolveComment(ctx, uuid, ctx.Param("comment"), utils.PrincipalFromContext(ctx), resolved)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: inst.transformComment(comment)})
+}
+
+func (inst *Comment) params(ctx *gin.Context) (string, bool) {
+	uuid := ctx.Param("uuid")
+	if uuid == "" {
+		utils.CaseError(ctx, utils.ErrorEmptyUUID)
+		return "", false
+	}
+
+	return uuid, true
+}
+
+// threads nests the replies under their parents, comments come oldest first.
+func (inst *Comment) threads(comments []model.Comment) []dto.Comment {
+	children := make(map[string][]model.Comment)
+	roots := make([]model.Comment, 0)
+
+	for _, comment := range comments {
+		if comment.ParentUUID == nil {
+			roots = append(roots, comment)
+			continue
+		}
+		children[*comment.ParentUUID] = append(children[*comment.ParentUUID], comment)
+	}
+
+	var build func(comment *model.Comment) dto.Comment
+	build = func(comment *model.Comment) dto.Comment {
+		node := inst.transformComment(comment)
+		for _, child := range children[comment.UUID] {
+			node.Replies = append(node.Replies, build(&child))
+		}
+		return node
+	}
+
+	response := make([]dto.Comment, 0, len(roots))
+	for _, root := range roots {
+		response = append(response, build(&root))
+	}
+
+	return response
+}
+
+func (inst *Comment) transformAnchor(anchor *dto.CommentAnchor) *model.CommentAnchor {
+	if anchor == nil {
+		return nil
+	}
+
+	return &model.CommentAnchor{
+		Page:  anchor.Page,
+		Start: anchor.Start,
+		End:   anchor.End,
+		Quote: anchor.Quote,
+	}
+}
+
+func (inst *Comment) transformComment(comment *model.Comment) dto.Comment {
+	response := dto.Comment{
+		ID:         comment.UUID,
+		ParentID:   comment.ParentUUID,
+		Login:      comment.UserLogin,
+		Body:       comment.Body,
+		Resolved:   comment.Resolved,
+		ResolvedBy: comment.ResolvedBy,
+		ResolvedAt: comment.ResolvedAt,
+		CreateAt:   comment.CreateAt,
+		UpdateAt:   comment.UpdateAt,
+	}
+
+	if anchor := comment.Anchor; anchor != nil {
+		response.Anchor = &dto.CommentAnchor{
+			Page:  anchor.Page,
+			Start: anchor.Start,
+			End:   anchor.End,
+			Quote: anchor.Quote,
+		}
+	}
+
+	return response
+}
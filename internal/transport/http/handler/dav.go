@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/net/webdav"
+)
+
+const DavPrefix = "/dav"
+
+// Dav serves the documents of the authenticated user over WebDAV.
+type Dav struct {
+	log         *zap.Logger
+	authService service.AuthService
+	fs          *davFileSystem
+}
+
+func NewDav(log *zap.Logger, authService service.AuthService, docService service.DocumentService) *Dav {
+	return &Dav{
+		log:         log,
+		authService: authService,
+		fs:          newDavFileSystem(docService),
+	}
+}
+
+// ServeDAV authenticates the request with an API key or an access token and
+// hands it to the WebDAV handler. The handler is built per request, its lock
+// system works on document_locks as the request principal.
+func (inst *Dav) ServeDAV(ctx *gin.Context) {
+	principal, err := inst.authenticate(ctx)
+	if err != nil {
+		if retryAfter := utils.RetryAfterSeconds(err); retryAfter != "" {
+			ctx.Header("Retry-After", retryAfter)
+			ctx.AbortWithStatus(http.StatusTooManyRequests)
+			return
+		}
+		ctx.Header("WWW-Authenticate", `Basic realm="docs"`)
+		ctx.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+
+	if !principal.HasScope(davScope(ctx.Request.Method)) {
+		ctx.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+
+	request := ctx.Request.WithContext(utils.WithPrincipal(ctx.Request.Context(), principal))
+
+	dav := &webdav.Handler{
+		Prefix:     DavPrefix,
+		FileSystem: inst.fs,
+		LockSystem: newDavLockSystem(request, inst.fs),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				inst.log.Debug("webdav", zap.String("method", r.Method), zap.String("path", r.URL.Path), zap.Error(err))
+			}
+		},
+	}
+	dav.ServeHTTP(ctx.Writer, request)
+}
+
+// authenticate accepts basic auth with an API key as the password, the login
+// is ignored. Passwords are refused: a login per client connection would
+// start a new session family each time, and accounts with a second factor
+// couldn't connect at all.
+func (inst *Dav) authenticate(ctx *gin.Context) (*model.Principal, error) {
+	if _, password, ok := ctx.Request.BasicAuth(); ok {
+		if !service.IsAPIKey(password) {
+			return nil, utils.ErrorAuthFailed
+		}
+		return inst.authenticateToken(ctx, password)
+	}
+
+	return inst.authenticateToken(ctx, requestToken(ctx))
+}
+
+// davScope is the scope a WebDAV method needs.
+func davScope(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		return model.ScopeDocsRead
+	case http.MethodDelete:
+		return model.ScopeDocsDelete
+	default:
+		return model.ScopeDocsWrite
+	}
+}
+
+func (inst *Dav) authenticateToken(ctx context.Context, token string) (*model.Principal, error) {
+	return inst.authService.Authenticate(ctx, token)
+}
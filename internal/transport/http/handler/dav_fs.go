@@ -0,0 +1,474 @@
+package handler
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/utils"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+// davListLimit bounds the documents listed in one WebDAV directory.
+const davListLimit = 10000
+
+// davFileSystem exposes the documents granted to the request principal as a
+// webdav.FileSystem. Document names are paths: "a/b.pdf" is shown as file
+// b.pdf in directory a. Every call goes through DocumentService, so WebDAV
+// gets the same grant, lock and version checks as the REST API.
+type davFileSystem struct {
+	docService service.DocumentService
+}
+
+func newDavFileSystem(docService service.DocumentService) *davFileSystem {
+	return &davFileSystem{docService: docService}
+}
+
+func (inst *davFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if _, _, err := inst.lookup(ctx, name); err == nil {
+		return os.ErrExist
+	}
+
+	// directories only exist as prefixes of document names
+	return os.ErrPermission
+}
+
+func (inst *davFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	principal, err := inst.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	document, dir, err := inst.lookup(ctx, name)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0 {
+		if dir {
+			return nil, os.ErrPermission
+		}
+		if document == nil && flag&os.O_CREATE == 0 {
+			return nil, os.ErrNotExist
+		}
+		return inst.openWriter(ctx, principal, inst.key(name), document)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if dir {
+		children, err := inst.readDir(ctx, inst.key(name))
+		if err != nil {
+			return nil, err
+		}
+		return &davDir{info: inst.dirInfo(name), children: children}, nil
+	}
+
+	document, err = inst.docService.GetDocument(ctx, document.UUID, principal)
+	if err != nil {
+		return nil, inst.fsError(err)
+	}
+
+	file, err := os.Open(document.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &davFile{File: file, info: inst.fileInfo(document)}, nil
+}
+
+func (inst *davFileSystem) RemoveAll(ctx context.Context, name string) error {
+	principal, err := inst.principal(ctx)
+	if err != nil {
+		return err
+	}
+
+	if inst.key(name) == "" {
+		return os.ErrPermission
+	}
+
+	document, dir, err := inst.lookup(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if !dir {
+		return inst.fsError(inst.docService.DeleteDocument(ctx, document.UUID, principal))
+	}
+
+	documents, err := inst.documents(ctx, &model.DocumentFilterData{
+		NamePrefix: inst.key(name) + "/",
+		Limit:      davListLimit,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		if err := inst.docService.DeleteDocument(ctx, document.UUID, principal); err != nil {
+			return inst.fsError(err)
+		}
+	}
+
+	return nil
+}
+
+func (inst *davFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	principal, err := inst.principal(ctx)
+	if err != nil {
+		return err
+	}
+
+	oldKey, newKey := inst.key(oldName), inst.key(newName)
+	if oldKey == "" || newKey == "" {
+		return os.ErrPermission
+	}
+
+	if _, _, err := inst.lookup(ctx, newName); err == nil {
+		return os.ErrExist
+	}
+
+	document, dir, err := inst.lookup(ctx, oldName)
+	if err != nil {
+		return err
+	}
+
+	if !dir {
+		return inst.rename(ctx, principal, document, newKey)
+	}
+
+	documents, err := inst.documents(ctx, &model.DocumentFilterData{
+		NamePrefix: oldKey + "/",
+		Limit:      davListLimit,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		if err := inst.rename(ctx, principal, &document, newKey+strings.TrimPrefix(document.Name, oldKey)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (inst *davFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	document, dir, err := inst.lookup(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if dir {
+		return inst.dirInfo(name), nil
+	}
+
+	return inst.fileInfo(document), nil
+}
+
+func (inst *davFileSystem) rename(ctx context.Context, principal *model.Principal, document *model.Document, name string) error {
+	_, err := inst.docService.UpdateDocument(ctx, document.UUID, principal, document.Version, &model.DocumentPatch{
+		Name: &name,
+	})
+
+	return inst.fsError(err)
+}
+
+func (inst *davFileSystem) openWriter(ctx context.Context, principal *model.Principal, name string, document *model.Document) (webdav.File, error) {
+	tmp, err := os.CreateTemp("", "dav-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &davWriter{
+		File:       tmp,
+		ctx:        ctx,
+		docService: inst.docService,
+		principal:  principal,
+		name:       name,
+		document:   document,
+	}, nil
+}
+
+// lookup resolves a path into a document or a directory. The root and every
+// prefix of a document name are directories.
+func (inst *davFileSystem) lookup(ctx context.Context, name string) (*model.Document, bool, error) {
+	key := inst.key(name)
+	if key == "" {
+		return nil, true, nil
+	}
+
+	documents, err := inst.documents(ctx, &model.DocumentFilterData{
+		FiltredField: "name",
+		FiltredValue: key,
+		Limit:        1,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(documents) > 0 {
+		return &documents[0], false, nil
+	}
+
+	documents, err = inst.documents(ctx, &model.DocumentFilterData{
+		NamePrefix: key + "/",
+		Limit:      1,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(documents) > 0 {
+		return nil, true, nil
+	}
+
+	return nil, false, os.ErrNotExist
+}
+
+func (inst *davFileSystem) readDir(ctx context.Context, key string) ([]fs.FileInfo, error) {
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+
+	documents, err := inst.documents(ctx, &model.DocumentFilterData{
+		NamePrefix: prefix,
+		Limit:      davListLimit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]struct{}{}
+	children := make([]fs.FileInfo, 0)
+	for _, document := range documents {
+		if !strings.HasPrefix(document.Name, prefix) {
+			continue
+		}
+
+		rest := strings.TrimPrefix(document.Name, prefix)
+		child, _, isDir := strings.Cut(rest, "/")
+		if _, ok := seen[child]; ok || child == "" {
+			continue
+		}
+		seen[child] = struct{}{}
+
+		if isDir {
+			children = append(children, inst.dirInfo(child))
+		} else {
+			children = append(children, inst.fileInfo(&document))
+		}
+	}
+
+	sort.Slice(children, func(i, j int) bool { return children[i].Name() < children[j].Name() })
+
+	return children, nil
+}
+
+// documents lists the file documents granted to the principal that match
+// filter.
+func (inst *davFileSystem) documents(ctx context.Context, filter *model.DocumentFilterData) ([]model.Document, error) {
+	principal, err := inst.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	filter.Login = principal.Login
+	filter.FileOnly = true
+
+	documents, err := inst.docService.ListDocuments(ctx, principal, filter)
+	if err != nil {
+		return nil, inst.fsError(err)
+	}
+
+	return documents, nil
+}
+
+func (inst *davFileSystem) principal(ctx context.Context) (*model.Principal, error) {
+	principal := utils.PrincipalFromContext(ctx)
+	if principal == nil {
+		return nil, os.ErrPermission
+	}
+
+	return principal, nil
+}
+
+func (inst *davFileSystem) key(name string) string {
+	return strings.Trim(path.Clean("/"+name), "/")
+}
+
+func (inst *davFileSystem) fileInfo(document *model.Document) *davFileInfo {
+	return &davFileInfo{
+		name:    path.Base(document.Name),
+		size:    document.Size,
+		modTime: document.CreateAt,
+		mime:    document.Mime,
+		etag:    strconv.Quote(strconv.Itoa(document.Version)),
+	}
+}
+
+func (inst *davFileSystem) dirInfo(name string) *davFileInfo {
+	return &davFileInfo{name: path.Base("/" + name), dir: true}
+}
+
+// fsError maps service errors onto the errors webdav.Handler understands.
+func (inst *davFileSystem) fsError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, utils.ErrorNotFound):
+		return os.ErrNotExist
+	case errors.Is(err, utils.ErrorNoAccess), errors.Is(err, utils.ErrorAuthFailed), errors.Is(err, utils.ErrorLocked):
+		return errors.Join(os.ErrPermission, err)
+	}
+
+	return err
+}
+
+type davFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+	mime    string
+	etag    string
+}
+
+func (inst *davFileInfo) Name() string       { return inst.name }
+func (inst *davFileInfo) Size() int64        { return inst.size }
+func (inst *davFileInfo) ModTime() time.Time { return inst.modTime }
+func (inst *davFileInfo) IsDir() bool        { return inst.dir }
+func (inst *davFileInfo) Sys() any           { return nil }
+
+func (inst *davFileInfo) Mode() os.FileMode {
+	if inst.dir {
+		return os.ModeDir | 0750
+	}
+	return 0640
+}
+
+func (inst *davFileInfo) ContentType(ctx context.Context) (string, error) {
+	if inst.mime == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return inst.mime, nil
+}
+
+func (inst *davFileInfo) ETag(ctx context.Context) (string, error) {
+	if inst.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return inst.etag, nil
+}
+
+// davFile serves the stored file of a document.
+type davFile struct {
+	*os.File
+	info *davFileInfo
+}
+
+func (inst *davFile) Stat() (os.FileInfo, error) {
+	return inst.info, nil
+}
+
+func (inst *davFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (inst *davFile) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+// davDir is a directory listing.
+type davDir struct {
+	info     *davFileInfo
+	children []fs.FileInfo
+	offset   int
+}
+
+func (inst *davDir) Close() error                                 { return nil }
+func (inst *davDir) Read(p []byte) (int, error)                   { return 0, os.ErrInvalid }
+func (inst *davDir) Write(p []byte) (int, error)                  { return 0, os.ErrPermission }
+func (inst *davDir) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+func (inst *davDir) Stat() (os.FileInfo, error)                   { return inst.info, nil }
+
+func (inst *davDir) Readdir(count int) ([]fs.FileInfo, error) {
+	rest := inst.children[inst.offset:]
+	if count <= 0 {
+		inst.offset = len(inst.children)
+		return rest, nil
+	}
+
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(rest) {
+		count = len(rest)
+	}
+	inst.offset += count
+
+	return rest[:count], nil
+}
+
+// davWriter buffers an upload in a temporary file and stores it as the
+// document content on Close.
+type davWriter struct {
+	*os.File
+	ctx        context.Context
+	docService service.DocumentService
+	principal  *model.Principal
+	name       string
+	document   *model.Document
+}
+
+func (inst *davWriter) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, os.ErrInvalid
+}
+
+func (inst *davWriter) Stat() (os.FileInfo, error) {
+	info, err := inst.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return &davFileInfo{name: path.Base(inst.name), size: info.Size(), modTime: info.ModTime()}, nil
+}
+
+func (inst *davWriter) Close() error {
+	defer os.Remove(inst.File.Name())
+
+	if _, err := inst.File.Seek(0, io.SeekStart); err != nil {
+		inst.File.Close()
+		return err
+	}
+	defer inst.File.Close()
+
+	contentType := mime.TypeByExtension(path.Ext(inst.name))
+
+	if inst.document != nil {
+		_, err := inst.docService.ReplaceContent(inst.ctx, inst.document.UUID, inst.principal, inst.document.Version, contentType, inst.File)
+		return err
+	}
+
+	return inst.docService.AddDocument(inst.ctx, inst.principal, &model.Document{
+		Name:  inst.name,
+		Mime:  contentType,
+		File:  true,
+		Grant: []string{inst.principal.Login},
+	}, inst.File)
+}
@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"context"
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/utils"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/webdav"
+)
+
+const davLockTokenPrefix = "opaquelocktoken:"
+
+// davLockSystem is a webdav.LockSystem over document_locks, so a WebDAV LOCK
+// blocks REST writes and a REST lock blocks WebDAV writes. A lock belongs to
+// a login and a document: the token only names the document, and directories
+// can't be locked. It serves one request as the principal of ctx.
+type davLockSystem struct {
+	ctx  context.Context
+	lock bool
+	fs   *davFileSystem
+}
+
+func newDavLockSystem(request *http.Request, fs *davFileSystem) *davLockSystem {
+	return &davLockSystem{
+		ctx:  request.Context(),
+		lock: request.Method == "LOCK",
+		fs:   fs,
+	}
+}
+
+// Confirm accepts the request if every lock token in conditions names a
+// document the principal holds. The writes themselves check document_locks.
+func (inst *davLockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (func(), error) {
+	for _, condition := range conditions {
+		if condition.Token == "" {
+			continue
+		}
+
+		held := false
+		if document, err := inst.document(condition.Token); err == nil {
+			held = document.Lock != nil
+		}
+
+		if held == condition.Not {
+			return nil, webdav.ErrConfirmationFailed
+		}
+	}
+
+	return func() {}, nil
+}
+
+// Create locks the document at details.Root. Outside of a LOCK request
+// webdav.Handler only asks for a temporary lock to guard the write, which
+// document_locks already does; the empty token tells it there is nothing to
+// release.
+func (inst *davLockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	if !inst.lock {
+		return "", nil
+	}
+
+	principal, err := inst.fs.principal(inst.ctx)
+	if err != nil {
+		return "", webdav.ErrForbidden
+	}
+
+	document, dir, err := inst.fs.lookup(inst.ctx, details.Root)
+	if err != nil || dir {
+		return "", webdav.ErrForbidden
+	}
+
+	if _, err := inst.fs.docService.LockDocument(inst.ctx, document.UUID, principal, davLockTTL(details.Duration)); err != nil {
+		return "", inst.lockError(err)
+	}
+
+	return davLockTokenPrefix + document.UUID, nil
+}
+
+// Refresh extends a lock the principal holds.
+func (inst *davLockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	principal, err := inst.fs.principal(inst.ctx)
+	if err != nil {
+		return webdav.LockDetails{}, webdav.ErrForbidden
+	}
+
+	document, err := inst.document(token)
+	if err != nil || document.Lock == nil {
+		return webdav.LockDetails{}, webdav.ErrNoSuchLock
+	}
+
+	ttl := davLockTTL(duration)
+	if _, err := inst.fs.docService.LockDocument(inst.ctx, document.UUID, principal, ttl); err != nil {
+		return webdav.LockDetails{}, inst.lockError(err)
+	}
+
+	return webdav.LockDetails{Root: "/" + document.Name, Duration: ttl, ZeroDepth: true}, nil
+}
+
+func (inst *davLockSystem) Unlock(now time.Time, token string) error {
+	principal, err := inst.fs.principal(inst.ctx)
+	if err != nil {
+		return webdav.ErrForbidden
+	}
+
+	uuid, ok := strings.CutPrefix(token, davLockTokenPrefix)
+	if !ok {
+		return webdav.ErrNoSuchLock
+	}
+
+	return inst.lockError(inst.fs.docService.UnlockDocument(inst.ctx, uuid, principal, false))
+}
+
+// document returns the document token names, with its lock only if the
+// principal holds it.
+func (inst *davLockSystem) document(token string) (*model.Document, error) {
+	principal, err := inst.fs.principal(inst.ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	uuid, ok := strings.CutPrefix(token, davLockTokenPrefix)
+	if !ok {
+		return nil, webdav.ErrNoSuchLock
+	}
+
+	document, err := inst.fs.docService.GetDocument(inst.ctx, uuid, principal)
+	if err != nil {
+		return nil, err
+	}
+
+	if document.Lock != nil && document.Lock.UserLogin != principal.Login {
+		unlocked := *document
+		unlocked.Lock = nil
+		document = &unlocked
+	}
+
+	return document, nil
+}
+
+// lockError maps lock errors onto the errors webdav.Handler understands.
+func (inst *davLockSystem) lockError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, utils.ErrorLocked):
+		return webdav.ErrLocked
+	case errors.Is(err, utils.ErrorNotFound):
+		return webdav.ErrNoSuchLock
+	case errors.Is(err, utils.ErrorNoAccess):
+		return webdav.ErrForbidden
+	}
+
+	return err
+}
+
+// davLockTTL turns a LOCK timeout into a lock ttl, an infinite timeout gets
+// the default.
+func davLockTTL(duration time.Duration) time.Duration {
+	if duration <= 0 {
+		return service.DefaultLockTTL
+	}
+
+	return min(duration, service.MaxLockTTL)
+}
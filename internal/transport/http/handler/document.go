@@ -7,21 +7,29 @@ import (
 	"docs/internal/utils"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// expandGrant asks for the profiles of the granted logins.
+const expandGrant = "grant"
+
 type Document struct {
-	log        *zap.Logger
-	docService service.DocumentService
+	log            *zap.Logger
+	docService     service.DocumentService
+	profileService service.ProfileService
 }
 
-func NewDocuments(log *zap.Logger, docService service.DocumentService) *Document {
-	return &Document{log, docService}
+func NewDocuments(log *zap.Logger, docService service.DocumentService, profileService service.ProfileService) *Document {
+	return &Document{log, docService, profileService}
 }
 
 // AddDocument godoc
@@ -30,7 +38,8 @@ func NewDocuments(log *zap.Logger, docService service.DocumentService) *Document
 // @Tags Document
 // @Produce json
 // @Accept mpfd
-// @Param meta formData string true "Document meta data (JSON)" example({"name":"photo.jpg","file":true,"public":false,"token":"sfuqwejqjoiu93e29","mime":"image/jpg","grant":["login1","login2"]})
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param meta formData string true "Document meta data (JSON)" example({"name":"photo.jpg","file":true,"public":false,"mime":"image/jpg","grant":["login1","login2"]})
 // @Param json formData string false "Extantion data for document (JSON)" example({"key":"value"})
 // @Param file formData file false "Document file"
 // @Success 200 {object} dto.DataResponse{data=dto.DocsResponse}
@@ -62,13 +71,25 @@ func (inst *Document) AddDocument(ctx *gin.Context) {
 		}
 	}
 
-	if err := inst.docService.AddDocument(ctx, &model.Document{
+	var content io.Reader
+	if files := form.File["file"]; len(files) > 0 {
+		file, err := files[0].Open()
+		if err != nil {
+			utils.CaseError(ctx, err)
+			return
+		}
+		defer file.Close()
+		content = file
+	}
+
+	if err := inst.docService.AddDocument(ctx, utils.PrincipalFromContext(ctx), &model.Document{
 		Name:   meta.Name,
 		Mime:   meta.Mime,
 		File:   meta.File,
 		Public: meta.Public,
 		Grant:  meta.Grant,
-	}, form.File["file"][0]); err != nil {
+		JSON:   jsonData,
+	}, content); err != nil {
 		utils.CaseError(ctx, err)
 		return
 	}
@@ -88,7 +109,8 @@ func (inst *Document) AddDocument(ctx *gin.Context) {
 // @Produce json
 // @Produce mpfd
 // @Param uuid path string true "Document ID"
-// @Param token query string true "docsorization token"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param expand query string false "grant adds grant_users, the profiles of the granted logins"
 // @Success 200 {file} file "File content"
 // @Success 200 {object} dto.DataResponse{data=dto.Meta} "File data"
 // @Router /docs/{uuid} [get]
@@ -100,18 +122,22 @@ func (inst *Document) GetDocument(ctx *gin.Context) {
 		return
 	}
 
-	token := ctx.Query("token")
-	if token == "" {
-		utils.CaseError(ctx, utils.ErrorAuthFailed)
+	expand, err := inst.parseExpand(ctx.Query("expand"))
+	if err != nil {
+		utils.CaseError(ctx, err)
 		return
 	}
 
-	document, err := inst.docService.GetDocument(ctx, uuid, token)
+	principal := utils.PrincipalFromContext(ctx)
+
+	document, err := inst.docService.GetDocument(ctx, uuid, principal)
 	if err != nil {
 		utils.CaseError(ctx, err)
 		return
 	}
 
+	ctx.Header("ETag", inst.etag(document.Version))
+
 	if document.File {
 		inst.sendFile(ctx, document)
 		return
@@ -123,16 +149,16 @@ func (inst *Document) GetDocument(ctx *gin.Context) {
 		return
 	}
 
+	metas := []dto.Meta{inst.transformDocument2Meta(document)}
+	if expand {
+		if err := inst.expandGrants(ctx, metas); err != nil {
+			utils.CaseError(ctx, err)
+			return
+		}
+	}
+
 	ctx.JSON(http.StatusOK, dto.DataResponse{
-		Data: dto.Meta{
-			ID:       document.UUID,
-			Name:     document.Name,
-			Mime:     document.Mime,
-			File:     document.File,
-			Public:   document.Public,
-			CreateAt: document.CreateAt,
-			Grant:    document.Grant,
-		},
+		Data: metas[0],
 	})
 }
 
@@ -142,21 +168,18 @@ func (inst *Document) GetDocument(ctx *gin.Context) {
 // @Tags Document
 // @Accept json
 // @Produce json
-// @Param token query string true "docsorization token"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
 // @Param login query string false "Filter by grant login"
 // @Param key query string false "Filter field key"
 // @Param value query string false "Value of filter"
 // @Param limit query string false "Limit, default 10"
+// @Param expand query string false "grant adds grant_users, the profiles of the granted logins"
 // @Success 200 {file} file "File content"
 // @Success 200 {object} dto.DataResponse{data=[]dto.Meta} "File data"
 // @Router /docs [get]
 // @Router /docs [head]
 func (inst *Document) ListDocuments(ctx *gin.Context) {
-	token := ctx.Query("token")
-	if token == "" {
-		utils.CaseError(ctx, utils.ErrorAuthFailed)
-		return
-	}
+	principal := utils.PrincipalFromContext(ctx)
 
 	listData := &model.DocumentFilterData{
 		Login:        ctx.Query("login"),
@@ -169,7 +192,13 @@ func (inst *Document) ListDocuments(ctx *gin.Context) {
 		return
 	}
 
-	documents, err := inst.docService.ListDocuments(ctx, token, listData)
+	expand, err := inst.parseExpand(ctx.Query("expand"))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	documents, err := inst.docService.ListDocuments(ctx, principal, listData)
 	if err != nil {
 		utils.CaseError(ctx, err)
 		return
@@ -181,8 +210,106 @@ func (inst *Document) ListDocuments(ctx *gin.Context) {
 		return
 	}
 
+	metas := inst.transformDocuments2Metas(documents)
+	if expand {
+		if err := inst.expandGrants(ctx, metas); err != nil {
+			utils.CaseError(ctx, err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{
+		Data: metas,
+	})
+}
+
+// UpdateDocument godoc
+// @Summary Update document
+// @Description Update document metadata with a JSON merge patch (RFC 7396) over name, mime, public, grant and json. Responds 412 when If-Match does not match the current version
+// @Tags Document
+// @Accept json
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param If-Match header string true "Document version from ETag"
+// @Param patch body object true "JSON merge patch" example({"name":"contract.pdf","public":true,"json":{"key":null}})
+// @Success 200 {object} dto.DataResponse{data=dto.Meta} "File data"
+// @Router /docs/{uuid} [patch]
+func (inst *Document) UpdateDocument(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	uuid := ctx.Param("uuid")
+	if uuid == "" {
+		utils.CaseError(ctx, utils.ErrorEmptyUUID)
+		return
+	}
+
+	version, err := inst.parseIfMatch(ctx.GetHeader("If-Match"))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	patch, err := inst.parsePatch(body)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	document, err := inst.docService.UpdateDocument(ctx, uuid, principal, version, patch)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.Header("ETag", inst.etag(document.Version))
+	ctx.JSON(http.StatusOK, dto.DataResponse{
+		Data: inst.transformDocument2Meta(document),
+	})
+}
+
+// ReplaceContent godoc
+// @Summary Replace document content
+// @Description Replace the file of a document keeping its id, grants and links. The body is the raw file, Content-Type becomes the document mime (detected when missing). Responds 412 when If-Match does not match the current version
+// @Tags Document
+// @Accept octet-stream
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param If-Match header string true "Document version from ETag"
+// @Param content body string true "File content"
+// @Success 200 {object} dto.DataResponse{data=dto.Meta} "File data"
+// @Router /docs/{uuid}/content [put]
+func (inst *Document) ReplaceContent(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	uuid := ctx.Param("uuid")
+	if uuid == "" {
+		utils.CaseError(ctx, utils.ErrorEmptyUUID)
+		return
+	}
+
+	version, err := inst.parseIfMatch(ctx.GetHeader("If-Match"))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	document, err := inst.docService.ReplaceContent(ctx, uuid, principal, version, ctx.ContentType(), ctx.Request.Body)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.Header("ETag", inst.etag(document.Version))
 	ctx.JSON(http.StatusOK, dto.DataResponse{
-		Data: inst.transformDocuments2Metas(documents),
+		Data: inst.transformDocument2Meta(document),
 	})
 }
 
@@ -193,32 +320,97 @@ func (inst *Document) ListDocuments(ctx *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param uuid path string true "Document ID"
-// @Param token query string true "docsorization token"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
 // @Success 200 {file} file "File content"
 // @Success 200 {object} dto.SuccessResponse{response=string} "File data"
 // @Router /docs/{uuid} [delete]
 func (inst *Document) DeleteDocument(ctx *gin.Context) {
-	token := ctx.Query("token")
-	if token == "" {
-		utils.CaseError(ctx, utils.ErrorAuthFailed)
+	principal := utils.PrincipalFromContext(ctx)
+
+	uuid := ctx.Param("uuid")
+	if uuid == "" {
+		utils.CaseError(ctx, utils.ErrorEmptyUUID)
 		return
 	}
 
+	if err := inst.docService.DeleteDocument(ctx, uuid, principal); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: map[string]bool{
+		uuid: true,
+	}})
+
+}
+
+// LockDocument godoc
+// @Summary Lock document
+// @Description Check the document out. Writes from other logins are rejected with 423 until the lock is released or expires. Locking again extends the lock
+// @Tags Document
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param ttl query int false "Lock TTL in seconds, default 900"
+// @Success 200 {object} dto.DataResponse{data=dto.Lock} "Lock"
+// @Router /docs/{uuid}/lock [post]
+func (inst *Document) LockDocument(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
 	uuid := ctx.Param("uuid")
 	if uuid == "" {
 		utils.CaseError(ctx, utils.ErrorEmptyUUID)
 		return
 	}
 
-	if err := inst.docService.DeleteDocument(ctx, uuid, token); err != nil {
+	var ttl time.Duration
+	if ttlStr := ctx.Query("ttl"); ttlStr != "" {
+		seconds, err := strconv.Atoi(ttlStr)
+		if err != nil || seconds <= 0 {
+			utils.CaseError(ctx, utils.ErrorInvalidTTL)
+			return
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	lock, err := inst.docService.LockDocument(ctx, uuid, principal, ttl)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: inst.transformLock(lock)})
+}
+
+// UnlockDocument godoc
+// @Summary Unlock document
+// @Description Check the document in. Only the lock holder can unlock, admins can force it
+// @Tags Document
+// @Produce json
+// @Param uuid path string true "Document ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param force query bool false "Force unlock (admin only)"
+// @Success 200 {object} dto.SuccessResponse{response=string} "desc"
+// @Router /docs/{uuid}/lock [delete]
+func (inst *Document) UnlockDocument(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	uuid := ctx.Param("uuid")
+	if uuid == "" {
+		utils.CaseError(ctx, utils.ErrorEmptyUUID)
+		return
+	}
+
+	force, _ := strconv.ParseBool(ctx.Query("force"))
+
+	if err := inst.docService.UnlockDocument(ctx, uuid, principal, force); err != nil {
 		utils.CaseError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: map[string]bool{
-		token: true,
+		uuid: true,
 	}})
-
 }
 
 func (inst *Document) validateListData(limit string, listData *model.DocumentFilterData) error {
@@ -244,22 +436,143 @@ func (inst *Document) validateListData(limit string, listData *model.DocumentFil
 	return nil
 }
 
+func (inst *Document) parseExpand(expand string) (bool, error) {
+	switch expand {
+	case "":
+		return false, nil
+	case expandGrant:
+		return true, nil
+	}
+
+	return false, fmt.Errorf("%w: expand can only be %s", utils.ErrorFilterFormat, expandGrant)
+}
+
+// expandGrants fills GrantUsers of the metas. Logins without a user left
+// get a summary with the login only.
+func (inst *Document) expandGrants(ctx *gin.Context, metas []dto.Meta) error {
+	var logins []string
+	for _, meta := range metas {
+		logins = append(logins, meta.Grant...)
+	}
+	slices.Sort(logins)
+
+	profiles, err := inst.profileService.ListProfiles(ctx, slices.Compact(logins))
+	if err != nil {
+		return err
+	}
+
+	for i := range metas {
+		metas[i].GrantUsers = make([]dto.UserSummary, 0, len(metas[i].Grant))
+		for _, login := range metas[i].Grant {
+			profile := profiles[login]
+			metas[i].GrantUsers = append(metas[i].GrantUsers, dto.UserSummary{
+				Login:       login,
+				DisplayName: profile.DisplayName,
+				Avatar:      profile.AvatarUUID,
+			})
+		}
+	}
+
+	return nil
+}
+
 func (inst *Document) transformDocuments2Metas(documents []model.Document) []dto.Meta {
 	metas := make([]dto.Meta, 0)
 	for _, document := range documents {
-		metas = append(metas, dto.Meta{
-			ID:       document.UUID,
-			Name:     document.Name,
-			Mime:     document.Mime,
-			File:     document.File,
-			Public:   document.Public,
-			CreateAt: document.CreateAt,
-			Grant:    document.Grant,
-		})
+		metas = append(metas, inst.transformDocument2Meta(&document))
 	}
 	return metas
 }
 
+func (inst *Document) transformDocument2Meta(document *model.Document) dto.Meta {
+	var lock *dto.Lock
+	if document.Lock != nil {
+		lock = inst.transformLock(document.Lock)
+	}
+
+	return dto.Meta{
+		ID:       document.UUID,
+		Name:     document.Name,
+		Mime:     document.Mime,
+		File:     document.File,
+		Public:   document.Public,
+		CreateAt: document.CreateAt,
+		Grant:    document.Grant,
+		Version:  document.Version,
+		JSON:     document.JSON,
+		Size:     document.Size,
+		Hash:     document.Hash,
+		Lock:     lock,
+	}
+}
+
+func (inst *Document) transformLock(lock *model.Lock) *dto.Lock {
+	return &dto.Lock{
+		Login:     lock.UserLogin,
+		ExpiresAt: lock.ExpiresAt,
+		CreateAt:  lock.CreateAt,
+	}
+}
+
+func (inst *Document) etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+func (inst *Document) parseIfMatch(header string) (int, error) {
+	if header == "" {
+		return 0, utils.ErrorVersionRequired
+	}
+
+	header = strings.TrimPrefix(strings.TrimSpace(header), "W/")
+	version, err := strconv.Atoi(strings.Trim(header, `"`))
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed if-match header", utils.ErrorVersionRequired)
+	}
+
+	return version, nil
+}
+
+func (inst *Document) parsePatch(body []byte) (*model.DocumentPatch, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("%w: %s", utils.ErrorInvalidPatch, err.Error())
+	}
+
+	patch := &model.DocumentPatch{}
+	for field, value := range fields {
+		var target any
+		switch field {
+		case "name":
+			patch.Name = new(string)
+			target = patch.Name
+		case "mime":
+			patch.Mime = new(string)
+			target = patch.Mime
+		case "public":
+			patch.Public = new(bool)
+			target = patch.Public
+		case "grant":
+			patch.Grant = new([]string)
+			target = patch.Grant
+		case "json":
+			patch.JSON = new(map[string]any)
+			target = patch.JSON
+		default:
+			return nil, fmt.Errorf("%w: field %q can't be changed", utils.ErrorInvalidPatch, field)
+		}
+
+		if string(value) == "null" && field != "json" {
+			return nil, fmt.Errorf("%w: field %q can't be null", utils.ErrorInvalidPatch, field)
+		}
+
+		if err := json.Unmarshal(value, target); err != nil {
+			return nil, fmt.Errorf("%w: field %q: %s", utils.ErrorInvalidPatch, field, err.Error())
+		}
+	}
+
+	return patch, nil
+}
+
 func (inst *Document) sendFile(ctx *gin.Context, document *model.Document) {
 	_, err := os.OpenFile(document.Path, os.O_WRONLY, 0666)
 	if err != nil {
@@ -267,15 +580,7 @@ func (inst *Document) sendFile(ctx *gin.Context, document *model.Document) {
 		inst.log.Error("open file", zap.String("file", document.Path), zap.Error(err))
 
 		ctx.JSON(http.StatusOK, dto.DataResponse{
-			Data: dto.Meta{
-				ID:       document.UUID,
-				Name:     document.Name,
-				Mime:     document.Mime,
-				File:     document.File,
-				Public:   document.Public,
-				CreateAt: document.CreateAt,
-				Grant:    document.Grant,
-			},
+			Data: inst.transformDocument2Meta(document),
 		})
 		return
 	}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	LastEventIDHeader = "Last-Event-ID"
+
+	streamHeartbeat = 25 * time.Second
+)
+
+type Event struct {
+	log           *zap.Logger
+	streamService service.StreamService
+}
+
+func NewEvent(log *zap.Logger, streamService service.StreamService) *Event {
+	return &Event{
+		log:           log,
+		streamService: streamService,
+	}
+}
+
+// Stream godoc
+// @Summary Document event stream
+// @Description Live document.created, document.updated, document.deleted and document.shared events of the documents the session login can see, admins get every event. Served as Server-Sent Events, or as WebSocket with JSON messages when the request is a WebSocket upgrade. Pass the last received id, an opaque cursor, in Last-Event-ID or last_event_id to resume, an id older than the purged events gets 410 Gone. The token is checked again before events go out, the stream ends once it expires or is revoked
+// @Tags Event
+// @Produce text/event-stream
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param Last-Event-ID header string false "Resume after this event id"
+// @Param last_event_id query string false "Resume after this event id"
+// @Success 200 {object} dto.StreamMessage
+// @Router /events [get]
+func (inst *Event) Stream(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	after, err := inst.parseLastEventID(ctx)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	subscription, err := inst.streamService.Subscribe(ctx, principal, requestToken(ctx), after)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+	defer subscription.Close()
+
+	if strings.EqualFold(ctx.GetHeader("Upgrade"), "websocket") {
+		inst.serveWebSocket(ctx, subscription)
+		return
+	}
+
+	inst.serveSSE(ctx, subscription)
+}
+
+func (inst *Event) serveSSE(ctx *gin.Context, subscription *service.Subscription) {
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+	ctx.Status(http.StatusOK)
+
+	write := func(event *model.Event) bool {
+		_, err := fmt.Fprintf(ctx.Writer, "id: %s\nevent: %s\ndata: %s\n\n", event.Cursor(), event.Type, event.Payload)
+		return err == nil
+	}
+
+	inst.forward(ctx, subscription, write, func() bool {
+		_, err := io.WriteString(ctx.Writer, ": ping\n\n")
+		return err == nil
+	}, ctx.Writer.Flush)
+}
+
+func (inst *Event) serveWebSocket(ctx *gin.Context, subscription *service.Subscription) {
+	websocket.Server{Handler: func(conn *websocket.Conn) {
+		defer conn.Close()
+
+		// the stream is one way, reading only notices the client going away
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			io.Copy(io.Discard, conn)
+		}()
+
+		write := func(event *model.Event) bool {
+			return websocket.JSON.Send(conn, dto.StreamMessage{
+				ID:    event.Cursor().String(),
+				Event: event.Type,
+				Data:  event.Payload,
+			}) == nil
+		}
+
+		inst.forward(ctx, subscription, write, func() bool {
+			select {
+			case <-closed:
+				return false
+			default:
+				return true
+			}
+		}, func() {})
+	}}.ServeHTTP(ctx.Writer, ctx.Request)
+}
+
+// forward writes the backlog and then the live events, skipping the ones
+// already sent, until the client goes away or the subscription is dropped.
+func (inst *Event) forward(ctx *gin.Context, subscription *service.Subscription, write func(*model.Event) bool, heartbeat func() bool, flush func()) {
+	var last model.ChangeCursor
+	for i := range subscription.Backlog {
+		if !write(&subscription.Backlog[i]) {
+			return
+		}
+		last = subscription.Backlog[i].Cursor()
+	}
+	flush()
+
+	ticker := time.NewTicker(streamHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Request.Context().Done():
+			return
+		case <-ticker.C:
+			if !heartbeat() {
+				return
+			}
+			flush()
+		case event, ok := <-subscription.Events:
+			if !ok {
+				inst.log.Debug("event subscription dropped")
+				return
+			}
+			if !event.Cursor().After(last) {
+				continue
+			}
+			if !write(event) {
+				return
+			}
+			last = event.Cursor()
+			flush()
+		}
+	}
+}
+
+func (inst *Event) parseLastEventID(ctx *gin.Context) (model.ChangeCursor, error) {
+	value := ctx.GetHeader(LastEventIDHeader)
+	if value == "" {
+		value = ctx.Query("last_event_id")
+	}
+
+	if value == "" {
+		return model.ChangeCursor{}, nil
+	}
+
+	// event ids never name a snapshot document
+	cursor, err := model.ParseChangeCursor(value)
+	if err != nil || cursor.Document != "" {
+		return model.ChangeCursor{}, utils.ErrorInvalidEventID
+	}
+
+	return cursor, nil
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Invite lets admins invite people to register themselves.
+type Invite struct {
+	inviteService service.InviteService
+}
+
+func NewInvite(inviteService service.InviteService) *Invite {
+	return &Invite{
+		inviteService: inviteService,
+	}
+}
+
+// CreateInvite godoc
+// @Summary Create invite
+// @Description Issue an invite code, admin only. role defaults to user, max_uses to 1 and expires_at to invite.ttl of the config; with login set only that login can register. There are no user groups, so an invite assigns no groups. The code is returned only once, send it as invite to /register
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param data body dto.InviteData true "Invite settings"
+// @Success 201 {object} dto.DataResponse{data=dto.Invite}
+// @Router /admin/invites [post]
+func (inst *Invite) CreateInvite(ctx *gin.Context) {
+	data := &dto.InviteData{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidInvite)
+		return
+	}
+
+	invite := &model.Invite{
+		Login:   data.Login,
+		Role:    data.Role,
+		MaxUses: data.MaxUses,
+	}
+	if data.ExpiresAt != nil {
+		invite.ExpiresAt = *data.ExpiresAt
+	}
+
+	invite, err := inst.inviteService.CreateInvite(ctx, utils.PrincipalFromContext(ctx), invite)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.DataResponse{Data: inst.transformInvite(invite)})
+}
+
+// ListInvites godoc
+// @Summary List invites
+// @Description Invites newest first, revoked and expired ones included, with the users who registered with them, admin only
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.DataResponse{data=[]dto.Invite}
+// @Router /admin/invites [get]
+func (inst *Invite) ListInvites(ctx *gin.Context) {
+	invites, err := inst.inviteService.ListInvites(ctx, utils.PrincipalFromContext(ctx))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	result := make([]dto.Invite, 0, len(invites))
+	for _, invite := range invites {
+		result = append(result, inst.transformInvite(&invite))
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: result})
+}
+
+// RevokeInvite godoc
+// @Summary Revoke invite
+// @Description Stop an invite from registering anyone else, admin only. Users who already registered keep their accounts
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param id path string true "Invite ID"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /admin/invites/{id} [delete]
+func (inst *Invite) RevokeInvite(ctx *gin.Context) {
+	if err := inst.inviteService.RevokeInvite(ctx, utils.PrincipalFromContext(ctx), ctx.Param("id")); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "invite revoked"})
+}
+
+func (inst *Invite) transformInvite(invite *model.Invite) dto.Invite {
+	redemptions := make([]dto.InviteRedemption, 0, len(invite.Redemptions))
+	for _, redemption := range invite.Redemptions {
+		redemptions = append(redemptions, dto.InviteRedemption{
+			Login:    redemption.UserLogin,
+			CreateAt: redemption.CreateAt,
+		})
+	}
+
+	return dto.Invite{
+		ID:          invite.UUID,
+		Code:        invite.Code,
+		Login:       invite.Login,
+		Role:        invite.Role,
+		MaxUses:     invite.MaxUses,
+		Uses:        invite.Uses,
+		CreateBy:    invite.CreateBy,
+		ExpiresAt:   invite.ExpiresAt,
+		RevokedAt:   invite.RevokedAt,
+		CreateAt:    invite.CreateAt,
+		Redemptions: redemptions,
+	}
+}
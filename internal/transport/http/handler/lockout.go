@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Lockout struct {
+	lockoutService service.LockoutService
+}
+
+func NewLockout(lockoutService service.LockoutService) *Lockout {
+	return &Lockout{
+		lockoutService: lockoutService,
+	}
+}
+
+// UnlockLogin godoc
+// @Summary Unlock login
+// @Description Lift the lockout or login delay after failed passwords of the user, admin only. Lockouts of client addresses expire on their own
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /admin/users/{login}/lockout [delete]
+func (inst *Lockout) UnlockLogin(ctx *gin.Context) {
+	if err := inst.lockoutService.UnlockLogin(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login")); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "login unlocked"})
+}
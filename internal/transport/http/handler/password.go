@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Password struct {
+	passwordService service.PasswordService
+}
+
+func NewPassword(passwordService service.PasswordService) *Password {
+	return &Password{
+		passwordService: passwordService,
+	}
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Set a new password, the current one is required. The new password follows the registration policy, every other session is logged out
+// @Tags Password
+// @Accept json
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param data body dto.PasswordChange true "Passwords"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /me/password [post]
+func (inst *Password) ChangePassword(ctx *gin.Context) {
+	data := &dto.PasswordChange{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidAuthData)
+		return
+	}
+
+	if err := inst.passwordService.ChangePassword(ctx, utils.PrincipalFromContext(ctx), data.OldPassword, data.NewPassword); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "password changed"})
+}
+
+// IssuePasswordReset godoc
+// @Summary Issue password reset token
+// @Description Create a single-use token the user sets a new password with at /password/reset, admin only. The token is shown once, issuing a new one invalidates the previous
+// @Tags Password
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login"
+// @Success 201 {object} dto.DataResponse{data=dto.PasswordResetToken}
+// @Router /admin/users/{login}/password-reset [post]
+func (inst *Password) IssuePasswordReset(ctx *gin.Context) {
+	reset, err := inst.passwordService.IssuePasswordReset(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login"))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.DataResponse{Data: dto.PasswordResetToken{
+		Token:     reset.Token,
+		ExpiresAt: reset.ExpiresAt,
+	}})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password with a reset token. The token works once, every session of the user is logged out
+// @Tags Password
+// @Accept json
+// @Produce json
+// @Param data body dto.PasswordReset true "Reset token and new password"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /password/reset [post]
+func (inst *Password) ResetPassword(ctx *gin.Context) {
+	data := &dto.PasswordReset{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidAuthData)
+		return
+	}
+
+	if err := inst.passwordService.ResetPassword(ctx, data.Token, data.Password); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "password changed"})
+}
@@ -0,0 +1,152 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Profile struct {
+	profileService service.ProfileService
+}
+
+func NewProfile(profileService service.ProfileService) *Profile {
+	return &Profile{
+		profileService: profileService,
+	}
+}
+
+// GetProfile godoc
+// @Summary Get profile
+// @Description Own account with display name, email, locale and avatar document id
+// @Tags Profile
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.DataResponse{data=dto.Profile}
+// @Router /me [get]
+func (inst *Profile) GetProfile(ctx *gin.Context) {
+	user, err := inst.profileService.GetProfile(ctx, utils.PrincipalFromContext(ctx))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: inst.transformProfile(user)})
+}
+
+// UpdateProfile godoc
+// @Summary Update profile
+// @Description Change display_name, email, locale or avatar, fields left out are kept and null or "" clears them. The avatar is the id of a png, jpeg, gif or webp file document only you have a grant on, every signed in user can see it
+// @Tags Profile
+// @Accept json
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param patch body object true "Profile fields" example({"display_name":"Jane Doe","email":"jane@example.com","locale":"en-GB","avatar":null})
+// @Success 200 {object} dto.DataResponse{data=dto.Profile}
+// @Router /me [patch]
+func (inst *Profile) UpdateProfile(ctx *gin.Context) {
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	patch, err := inst.parsePatch(body)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	user, err := inst.profileService.UpdateProfile(ctx, utils.PrincipalFromContext(ctx), patch)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: inst.transformProfile(user)})
+}
+
+// GetAvatar godoc
+// @Summary Get avatar
+// @Description Avatar image of the user, not found once its document is shared with someone else or is no longer a png, jpeg, gif or webp file
+// @Tags Profile
+// @Produce image/png
+// @Produce image/jpeg
+// @Produce image/gif
+// @Produce image/webp
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login"
+// @Success 200 {file} file "Image"
+// @Router /users/{login}/avatar [get]
+func (inst *Profile) GetAvatar(ctx *gin.Context) {
+	document, err := inst.profileService.GetAvatar(ctx, ctx.Param("login"))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	if !document.File {
+		utils.CaseError(ctx, utils.ErrorNotFound)
+		return
+	}
+
+	ctx.Header("Content-Type", document.Mime)
+	ctx.Header("X-Content-Type-Options", "nosniff")
+	ctx.Header("Content-Disposition", `inline; filename="avatar"`)
+	ctx.File(document.Path)
+}
+
+func (inst *Profile) parsePatch(body []byte) (*model.ProfilePatch, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("%w: %s", utils.ErrorInvalidPatch, err.Error())
+	}
+
+	patch := &model.ProfilePatch{}
+	for field, value := range fields {
+		target := new(string)
+		switch field {
+		case "display_name":
+			patch.DisplayName = target
+		case "email":
+			patch.Email = target
+		case "locale":
+			patch.Locale = target
+		case "avatar":
+			patch.AvatarUUID = target
+		default:
+			return nil, fmt.Errorf("%w: field %q can't be changed", utils.ErrorInvalidPatch, field)
+		}
+
+		// null clears the field as "" does
+		if string(value) == "null" {
+			continue
+		}
+
+		if err := json.Unmarshal(value, target); err != nil {
+			return nil, fmt.Errorf("%w: field %q: %s", utils.ErrorInvalidPatch, field, err.Error())
+		}
+	}
+
+	return patch, nil
+}
+
+func (inst *Profile) transformProfile(user *model.User) dto.Profile {
+	return dto.Profile{
+		UUID:        user.UUID,
+		Login:       user.Login,
+		Role:        user.Role,
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Locale:      user.Locale,
+		Avatar:      user.AvatarUUID,
+		CreateAt:    user.CreateAt,
+	}
+}
@@ -20,8 +20,8 @@ func NewRegistration(registerService service.RegistrationService) *Registration
 }
 
 // Register godoc
-// @Summary Registration new user
-// @Description Registration new user
+// @Summary Register
+// @Description Register with an invite code in invite, the user gets the role of the invite. Without one, token is the admin token of the config and creates the first admin; once an admin exists that fails with 409
 // @Tags Registration
 // @Accept json
 // @Produce json
@@ -35,10 +35,20 @@ func (inst *Registration) Register(ctx *gin.Context) {
 		return
 	}
 
+	if regData.Invite != "" {
+		if err := inst.registerService.RegisterInvite(ctx, regData.Invite, regData.Login, regData.Password); err != nil {
+			utils.CaseError(ctx, err)
+			return
+		}
+
+		ctx.JSON(http.StatusCreated, &dto.SuccessResponse{Response: "user registered"})
+		return
+	}
+
 	if err := inst.registerService.Register(ctx, regData.Token, regData.Login, regData.Password); err != nil {
 		utils.CaseError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusCreated, &dto.SuccessResponse{Response: "test"})
+	ctx.JSON(http.StatusCreated, &dto.SuccessResponse{Response: "admin registered"})
 }
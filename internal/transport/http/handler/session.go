@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Session manages the logins of a user. Under /me the principal's own, under
+// /admin/users/:login those of any user.
+type Session struct {
+	sessionService service.SessionService
+}
+
+func NewSession(sessionService service.SessionService) *Session {
+	return &Session{
+		sessionService: sessionService,
+	}
+}
+
+// ListSessions godoc
+// @Summary List sessions
+// @Description Where the user is logged in, one entry per login with the IP and user agent it was last used from, most recently seen first. current marks the session of the request. With JWT access tokens last_seen_at is updated on refresh only
+// @Tags Session
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login (admin only)"
+// @Success 200 {object} dto.DataResponse{data=[]dto.Session}
+// @Router /me/sessions [get]
+// @Router /admin/users/{login}/sessions [get]
+func (inst *Session) ListSessions(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	sessions, err := inst.sessionService.ListSessions(ctx, principal, ctx.Param("login"))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	result := make([]dto.Session, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, inst.transformSession(&session, principal))
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: result})
+}
+
+// RevokeSession godoc
+// @Summary Revoke session
+// @Description Log the user out of one session, its access and refresh tokens stop working
+// @Tags Session
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login (admin only)"
+// @Param id path string true "Session ID"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /me/sessions/{id} [delete]
+// @Router /admin/users/{login}/sessions/{id} [delete]
+func (inst *Session) RevokeSession(ctx *gin.Context) {
+	id := ctx.Param("id")
+	if id == "" {
+		utils.CaseError(ctx, utils.ErrorEmptyUUID)
+		return
+	}
+
+	if err := inst.sessionService.RevokeSession(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login"), id); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: map[string]bool{
+		id: true,
+	}})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Log out everywhere else
+// @Description End every session of the user except the one of the request
+// @Tags Session
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login (admin only)"
+// @Success 200 {object} dto.SuccessResponse{response=dto.SessionsRevoked}
+// @Router /me/sessions [delete]
+// @Router /admin/users/{login}/sessions [delete]
+func (inst *Session) RevokeOtherSessions(ctx *gin.Context) {
+	revoked, err := inst.sessionService.RevokeOtherSessions(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login"))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: dto.SessionsRevoked{Revoked: revoked}})
+}
+
+func (inst *Session) transformSession(session *model.Session, principal *model.Principal) dto.Session {
+	return dto.Session{
+		ID:         session.FamilyUUID,
+		IP:         session.IP,
+		UserAgent:  session.UserAgent,
+		CreateAt:   session.CreateAt,
+		LastSeenAt: session.LastSeenAt,
+		ExpiresAt:  session.ExpiresAt,
+		Current:    session.FamilyUUID == principal.FamilyUUID,
+	}
+}
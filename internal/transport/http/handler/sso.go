@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCStateCookie keeps the state of a started login in the browser until
+// the provider redirects back.
+const OIDCStateCookie = "oidc_state"
+
+// oidcStatePath scopes the state cookie to the login and callback routes.
+const oidcStatePath = "/api/auth/oidc"
+
+// SSO logs users in through the OpenID Connect provider of config.OIDC.
+type SSO struct {
+	ssoService service.SSOService
+}
+
+func NewSSO(ssoService service.SSOService) *SSO {
+	return &SSO{
+		ssoService: ssoService,
+	}
+}
+
+// StartOIDC godoc
+// @Summary      Single sign-on
+// @Description  Redirect to the identity provider to log in, it sends the user back to /auth/oidc/callback. Sets the short-lived oidc_state cookie the callback requires. Not found unless oidc.enabled
+// @Tags         Auth
+// @Success      302
+// @Router       /auth/oidc [get]
+func (inst *SSO) StartOIDC(ctx *gin.Context) {
+	redirect, err := inst.ssoService.StartOIDC(ctx)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	// lax, the provider sends the browser back with a top-level GET
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(OIDCStateCookie, redirect.State, int(time.Until(redirect.ExpiresAt).Seconds()), oidcStatePath, "", ctx.Request.TLS != nil, true)
+	ctx.Redirect(http.StatusFound, redirect.URL)
+}
+
+// OIDCCallback godoc
+// @Summary      Single sign-on callback
+// @Description  Where the identity provider redirects back to, the state must match the oidc_state cookie set by /auth/oidc. Returns the same token as /auth and sets it as the token cookie, which authenticates GET requests only; users with two-factor authentication get only a challenge for /auth/totp
+// @Tags         Auth
+// @Produce      json
+// @Param        code query string true "Authorization code"
+// @Param        state query string true "State of the login"
+// @Success      200  	{object}  dto.SuccessResponse{response=dto.Token}  "desc"
+// @Router       /auth/oidc/callback [get]
+func (inst *SSO) OIDCCallback(ctx *gin.Context) {
+	// the state is good for one callback, whatever its outcome
+	browserState, _ := ctx.Cookie(OIDCStateCookie)
+	ctx.SetSameSite(http.SameSiteLaxMode)
+	ctx.SetCookie(OIDCStateCookie, "", -1, oidcStatePath, "", ctx.Request.TLS != nil, true)
+
+	// the provider reports a denied or failed login in the error parameter
+	if ctx.Query("error") != "" {
+		utils.CaseError(ctx, utils.ErrorAuthFailed)
+		return
+	}
+
+	token, err := inst.ssoService.LoginOIDC(ctx, ctx.Query("code"), ctx.Query("state"), browserState)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	if token.AccessToken != "" {
+		ctx.SetSameSite(http.SameSiteLaxMode)
+		ctx.SetCookie(TokenCookie, token.AccessToken, 0, "/", "", ctx.Request.TLS != nil, true)
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: transformToken(token)})
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Sync struct {
+	syncService service.SyncService
+}
+
+func NewSync(syncService service.SyncService) *Sync {
+	return &Sync{
+		syncService: syncService,
+	}
+}
+
+// Changes godoc
+// @Summary Delta sync
+// @Description Changes of the documents visible to the session login since the cursor. Without a cursor the full document set is returned with snapshot=true, replace the local mirror with it. Type delete is a tombstone: the document was deleted or is no longer shared. Keep calling with the returned cursor while has_more is true, the snapshot comes in pages of limit documents too. Events are purged after the retention, an older cursor gets 410 Gone: sync again without a cursor
+// @Tags Sync
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param cursor query string false "Opaque cursor from the previous response"
+// @Param limit query string false "Limit, default 500, max 1000"
+// @Success 200 {object} dto.DataResponse{data=dto.SyncChanges}
+// @Router /sync/changes [get]
+func (inst *Sync) Changes(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	limit := service.DefaultSyncLimit
+	if limitStr := ctx.Query("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil {
+			utils.CaseError(ctx, utils.ErrorLimitFormat)
+			return
+		}
+	}
+
+	changeSet, err := inst.syncService.Changes(ctx, principal, ctx.Query("cursor"), limit)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	response := dto.SyncChanges{
+		Changes:  make([]dto.SyncChange, 0, len(changeSet.Changes)),
+		Cursor:   changeSet.Cursor.String(),
+		HasMore:  changeSet.HasMore,
+		Snapshot: changeSet.Snapshot,
+	}
+
+	for _, change := range changeSet.Changes {
+		response.Changes = append(response.Changes, inst.transformChange(&change))
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: response})
+}
+
+func (inst *Sync) transformChange(change *model.Change) dto.SyncChange {
+	syncChange := dto.SyncChange{
+		Type:       change.Type,
+		Event:      change.Event,
+		Actor:      change.Actor,
+		DocumentID: change.DocumentUUID,
+		At:         change.CreateAt,
+	}
+
+	if document := change.Document; document != nil {
+		syncChange.Document = &dto.Meta{
+			ID:       document.UUID,
+			Name:     document.Name,
+			Mime:     document.Mime,
+			File:     document.File,
+			Public:   document.Public,
+			CreateAt: document.CreateAt,
+			Grant:    document.Grant,
+			Version:  document.Version,
+			JSON:     document.JSON,
+			Size:     document.Size,
+			Hash:     document.Hash,
+		}
+	}
+
+	return syncChange
+}
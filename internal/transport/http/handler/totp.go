@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TOTP struct {
+	totpService service.TOTPService
+}
+
+func NewTOTP(totpService service.TOTPService) *TOTP {
+	return &TOTP{
+		totpService: totpService,
+	}
+}
+
+// EnrollTOTP godoc
+// @Summary Enroll TOTP
+// @Description Create a TOTP secret (RFC 6238, SHA1, 6 digits, 30s) for an authenticator app, uri is the otpauth:// provisioning URI to show as a QR code. The second factor is off until confirmed at /me/totp/verify
+// @Tags TOTP
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 201 {object} dto.DataResponse{data=dto.TOTPEnrollment}
+// @Router /me/totp [post]
+func (inst *TOTP) EnrollTOTP(ctx *gin.Context) {
+	enrollment, err := inst.totpService.EnrollTOTP(ctx, utils.PrincipalFromContext(ctx))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.DataResponse{Data: dto.TOTPEnrollment{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	}})
+}
+
+// VerifyTOTP godoc
+// @Summary Turn TOTP on
+// @Description Confirm the enrolled secret with a current code. Returns single-use recovery codes, they are shown only once
+// @Tags TOTP
+// @Accept json
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param data body dto.TOTPCode true "Code from the authenticator app"
+// @Success 200 {object} dto.DataResponse{data=dto.RecoveryCodes}
+// @Router /me/totp/verify [post]
+func (inst *TOTP) VerifyTOTP(ctx *gin.Context) {
+	data := &dto.TOTPCode{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidOTP)
+		return
+	}
+
+	codes, err := inst.totpService.VerifyTOTP(ctx, utils.PrincipalFromContext(ctx), data.Code)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: dto.RecoveryCodes{RecoveryCodes: codes}})
+}
+
+// DisableTOTP godoc
+// @Summary Turn TOTP off
+// @Description Remove the second factor and its recovery codes, a current TOTP or recovery code is required
+// @Tags TOTP
+// @Accept json
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param data body dto.TOTPCode true "TOTP or recovery code"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /me/totp [delete]
+func (inst *TOTP) DisableTOTP(ctx *gin.Context) {
+	data := &dto.TOTPCode{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidOTP)
+		return
+	}
+
+	if err := inst.totpService.DisableTOTP(ctx, utils.PrincipalFromContext(ctx), data.Code); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "two-factor authentication disabled"})
+}
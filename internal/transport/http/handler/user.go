@@ -0,0 +1,296 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	userDefaultLimit = 100
+	userMaxLimit     = 1000
+)
+
+// User lets admins manage the accounts.
+type User struct {
+	userService service.UserService
+}
+
+func NewUser(userService service.UserService) *User {
+	return &User{
+		userService: userService,
+	}
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description Users ordered by login, admin only
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param search query string false "Part of the login"
+// @Param role query string false "user or admin"
+// @Param disabled query bool false "Only disabled or only enabled users"
+// @Param limit query string false "Limit, default 100, max 1000"
+// @Param offset query string false "Users to skip"
+// @Success 200 {object} dto.DataResponse{data=[]dto.AdminUser}
+// @Router /admin/users [get]
+func (inst *User) ListUsers(ctx *gin.Context) {
+	filter, err := inst.parseFilter(ctx)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	users, err := inst.userService.ListUsers(ctx, utils.PrincipalFromContext(ctx), filter)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	result := make([]dto.AdminUser, 0, len(users))
+	for _, user := range users {
+		result = append(result, inst.transformUser(&user))
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: result})
+}
+
+// GetUser godoc
+// @Summary Get user
+// @Description User of the login, admin only
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login"
+// @Success 200 {object} dto.DataResponse{data=dto.AdminUser}
+// @Router /admin/users/{login} [get]
+func (inst *User) GetUser(ctx *gin.Context) {
+	user, err := inst.userService.GetUser(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login"))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: inst.transformUser(user)})
+}
+
+// CreateUser godoc
+// @Summary Create user
+// @Description Create a user, admin only. The role defaults to user, login and password follow the registration rules
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param data body dto.UserData true "User data"
+// @Success 201 {object} dto.DataResponse{data=dto.AdminUser}
+// @Router /admin/users [post]
+func (inst *User) CreateUser(ctx *gin.Context) {
+	data := &dto.UserData{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidAuthData)
+		return
+	}
+
+	user, err := inst.userService.CreateUser(ctx, utils.PrincipalFromContext(ctx), data.Login, data.Password, data.Role)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, dto.DataResponse{Data: inst.transformUser(user)})
+}
+
+// ListSoleDocuments godoc
+// @Summary List documents only the user can access
+// @Description Documents nobody but the user has a grant on, admin only. Deleting the user needs them transferred or deleted
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login"
+// @Success 200 {object} dto.DataResponse{data=[]dto.UserDocument}
+// @Router /admin/users/{login}/documents [get]
+func (inst *User) ListSoleDocuments(ctx *gin.Context) {
+	documents, err := inst.userService.ListSoleDocuments(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login"))
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	result := make([]dto.UserDocument, 0, len(documents))
+	for _, document := range documents {
+		result = append(result, dto.UserDocument{
+			ID:       document.UUID,
+			Name:     document.Name,
+			Mime:     document.Mime,
+			File:     document.File,
+			Size:     document.Size,
+			CreateAt: document.CreateAt,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: result})
+}
+
+// DisableUser godoc
+// @Summary Disable user
+// @Description Disable the user, admin only. The user is logged out everywhere, its event streams are closed, its webhooks are deactivated, it can not log in and its API keys are refused until enabled. When documents only the user can access are left, see /admin/users/{login}/documents, either transfer_to or delete_documents is required, otherwise it responds 409
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login"
+// @Param transfer_to query string false "Login that takes over the documents only the user can access"
+// @Param delete_documents query bool false "Delete the documents only the user can access"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /admin/users/{login}/disable [post]
+func (inst *User) DisableUser(ctx *gin.Context) {
+	handover, err := inst.parseHandover(ctx)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	if err := inst.userService.SetUserDisabled(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login"), true, handover); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "user disabled"})
+}
+
+// EnableUser godoc
+// @Summary Enable user
+// @Description Enable a disabled user, admin only
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /admin/users/{login}/enable [post]
+func (inst *User) EnableUser(ctx *gin.Context) {
+	if err := inst.userService.SetUserDisabled(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login"), false, model.DocumentHandover{}); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "user enabled"})
+}
+
+// DeleteUser godoc
+// @Summary Delete user
+// @Description Delete the user with its sessions, API keys, webhooks and grants and close its event streams, admin only. When documents only the user can access are left, see /admin/users/{login}/documents, either transfer_to or delete_documents is required, otherwise it responds 409
+// @Tags Admin
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login"
+// @Param transfer_to query string false "Login that takes over the documents only the user can access"
+// @Param delete_documents query bool false "Delete the documents only the user can access"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /admin/users/{login} [delete]
+func (inst *User) DeleteUser(ctx *gin.Context) {
+	handover, err := inst.parseHandover(ctx)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	if err := inst.userService.DeleteUser(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login"), handover); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "user deleted"})
+}
+
+// ChangeRole godoc
+// @Summary Change role
+// @Description Set the role of the user to user or admin, admin only. The user is logged out everywhere
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param login path string true "User login"
+// @Param data body dto.UserRole true "New role"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /admin/users/{login}/role [put]
+func (inst *User) ChangeRole(ctx *gin.Context) {
+	data := &dto.UserRole{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidRole)
+		return
+	}
+
+	if err := inst.userService.ChangeRole(ctx, utils.PrincipalFromContext(ctx), ctx.Param("login"), data.Role); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: "role changed"})
+}
+
+func (inst *User) parseFilter(ctx *gin.Context) (*model.UserFilter, error) {
+	filter := &model.UserFilter{
+		Search: ctx.Query("search"),
+		Role:   ctx.Query("role"),
+		Limit:  userDefaultLimit,
+	}
+
+	var err error
+	if disabled := ctx.Query("disabled"); disabled != "" {
+		value, err := strconv.ParseBool(disabled)
+		if err != nil {
+			return nil, utils.ErrorFilterFormat
+		}
+		filter.Disabled = &value
+	}
+
+	if limit := ctx.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit <= 0 || filter.Limit > userMaxLimit {
+			return nil, utils.ErrorLimitFormat
+		}
+	}
+
+	if offset := ctx.Query("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			return nil, utils.ErrorFilterFormat
+		}
+	}
+
+	return filter, nil
+}
+
+func (inst *User) parseHandover(ctx *gin.Context) (model.DocumentHandover, error) {
+	handover := model.DocumentHandover{
+		TransferTo: ctx.Query("transfer_to"),
+	}
+
+	if remove := ctx.Query("delete_documents"); remove != "" {
+		var err error
+		if handover.Delete, err = strconv.ParseBool(remove); err != nil {
+			return handover, utils.ErrorInvalidHandover
+		}
+	}
+
+	return handover, nil
+}
+
+func (inst *User) transformUser(user *model.User) dto.AdminUser {
+	return dto.AdminUser{
+		UUID:       user.UUID,
+		Login:      user.Login,
+		Role:       user.Role,
+		Disabled:   user.Disabled(),
+		DisabledAt: user.DisabledAt,
+		CreateAt:   user.CreateAt,
+
+		DisplayName: user.DisplayName,
+		Email:       user.Email,
+		Locale:      user.Locale,
+		Avatar:      user.AvatarUUID,
+	}
+}
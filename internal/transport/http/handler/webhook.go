@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"docs/internal/model"
+	"docs/internal/service"
+	"docs/internal/transport/http/dto"
+	"docs/internal/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Webhook struct {
+	webhookService service.WebhookService
+}
+
+func NewWebhook(webhookService service.WebhookService) *Webhook {
+	return &Webhook{
+		webhookService: webhookService,
+	}
+}
+
+// CreateWebhook godoc
+// @Summary Register webhook
+// @Description Register an endpoint for document.created, document.updated, document.deleted and document.shared events. Payloads are signed with HMAC-SHA256 of "timestamp.body" in X-Docs-Signature, the secret is generated when omitted and only returned here. Admin webhooks receive events of every document
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param data body dto.WebhookCreate true "Webhook"
+// @Success 201 {object} dto.DataResponse{data=dto.Webhook}
+// @Router /webhooks [post]
+func (inst *Webhook) CreateWebhook(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	data := &dto.WebhookCreate{}
+	if err := ctx.ShouldBindBodyWithJSON(data); err != nil {
+		utils.CaseError(ctx, utils.ErrorInvalidWebhook)
+		return
+	}
+
+	webhook := &model.Webhook{
+		URL:    data.URL,
+		Secret: data.Secret,
+		Events: data.Events,
+	}
+
+	if err := inst.webhookService.CreateWebhook(ctx, principal, webhook); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	response := inst.transformWebhook(webhook)
+	response.Secret = webhook.Secret
+
+	ctx.JSON(http.StatusCreated, dto.DataResponse{Data: response})
+}
+
+// ListWebhooks godoc
+// @Summary List webhooks
+// @Description List own webhooks, admins get every webhook
+// @Tags Webhook
+// @Produce json
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.DataResponse{data=[]dto.Webhook}
+// @Router /webhooks [get]
+func (inst *Webhook) ListWebhooks(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	webhooks, err := inst.webhookService.ListWebhooks(ctx, principal)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	response := make([]dto.Webhook, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		response = append(response, inst.transformWebhook(&webhook))
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: response})
+}
+
+// DeleteWebhook godoc
+// @Summary Delete webhook
+// @Description Delete webhook with its delivery log
+// @Tags Webhook
+// @Produce json
+// @Param uuid path string true "Webhook ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 200 {object} dto.SuccessResponse{response=string}
+// @Router /webhooks/{uuid} [delete]
+func (inst *Webhook) DeleteWebhook(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	uuid := ctx.Param("uuid")
+	if uuid == "" {
+		utils.CaseError(ctx, utils.ErrorEmptyUUID)
+		return
+	}
+
+	if err := inst.webhookService.DeleteWebhook(ctx, principal, uuid); err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, dto.SuccessResponse{Response: map[string]bool{
+		uuid: true,
+	}})
+}
+
+// ListDeliveries godoc
+// @Summary Webhook delivery log
+// @Description Deliveries of a webhook, newest first. status=dead lists the dead letters
+// @Tags Webhook
+// @Produce json
+// @Param uuid path string true "Webhook ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Param status query string false "pending, delivered or dead"
+// @Param limit query string false "Limit, default 50"
+// @Success 200 {object} dto.DataResponse{data=[]dto.WebhookDelivery}
+// @Router /webhooks/{uuid}/deliveries [get]
+func (inst *Webhook) ListDeliveries(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	uuid := ctx.Param("uuid")
+	if uuid == "" {
+		utils.CaseError(ctx, utils.ErrorEmptyUUID)
+		return
+	}
+
+	limit := 50
+	if limitStr := ctx.Query("limit"); limitStr != "" {
+		var err error
+		if limit, err = strconv.Atoi(limitStr); err != nil || limit <= 0 {
+			utils.CaseError(ctx, utils.ErrorLimitFormat)
+			return
+		}
+	}
+
+	deliveries, err := inst.webhookService.ListDeliveries(ctx, principal, uuid, ctx.Query("status"), limit)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	response := make([]dto.WebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		response = append(response, inst.transformDelivery(&delivery))
+	}
+
+	ctx.JSON(http.StatusOK, dto.DataResponse{Data: response})
+}
+
+// ReplayDelivery godoc
+// @Summary Replay webhook delivery
+// @Description Queue the payload of a past delivery again, an inactive webhook responds 409
+// @Tags Webhook
+// @Produce json
+// @Param uuid path string true "Webhook ID"
+// @Param delivery path string true "Delivery ID"
+// @Param token query string false "Access token, prefer the Authorization: Bearer header"
+// @Success 202 {object} dto.DataResponse{data=dto.WebhookDelivery}
+// @Router /webhooks/{uuid}/deliveries/{delivery}/replay [post]
+func (inst *Webhook) ReplayDelivery(ctx *gin.Context) {
+	principal := utils.PrincipalFromContext(ctx)
+
+	uuid, deliveryUUID := ctx.Param("uuid"), ctx.Param("delivery")
+	if uuid == "" || deliveryUUID == "" {
+		utils.CaseError(ctx, utils.ErrorEmptyUUID)
+		return
+	}
+
+	delivery, err := inst.webhookService.ReplayDelivery(ctx, principal, uuid, deliveryUUID)
+	if err != nil {
+		utils.CaseError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, dto.DataResponse{Data: inst.transformDelivery(delivery)})
+}
+
+func (inst *Webhook) transformWebhook(webhook *model.Webhook) dto.Webhook {
+	return dto.Webhook{
+		ID:       webhook.UUID,
+		Login:    webhook.UserLogin,
+		URL:      webhook.URL,
+		Events:   webhook.Events,
+		Active:   webhook.Active,
+		CreateAt: webhook.CreateAt,
+	}
+}
+
+func (inst *Webhook) transformDelivery(delivery *model.WebhookDelivery) dto.WebhookDelivery {
+	return dto.WebhookDelivery{
+		ID:            delivery.UUID,
+		WebhookID:     delivery.WebhookUUID,
+		EventID:       delivery.EventUUID,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        delivery.Status,
+		Attempts:      delivery.Attempts,
+		ResponseCode:  delivery.ResponseCode,
+		LastError:     delivery.LastError,
+		NextAttemptAt: delivery.NextAttemptAt,
+		CreateAt:      delivery.CreateAt,
+		DeliveredAt:   delivery.DeliveredAt,
+	}
+}
@@ -4,7 +4,43 @@ import "github.com/gin-gonic/gin"
 
 type AuthHandler interface {
 	Login(*gin.Context)
+	LoginTOTP(*gin.Context)
+	Refresh(*gin.Context)
 	Logout(*gin.Context)
+	Authenticate(*gin.Context)
+}
+
+type SSOHandler interface {
+	StartOIDC(ctx *gin.Context)
+	OIDCCallback(ctx *gin.Context)
+}
+
+type TOTPHandler interface {
+	EnrollTOTP(ctx *gin.Context)
+	VerifyTOTP(ctx *gin.Context)
+	DisableTOTP(ctx *gin.Context)
+}
+
+type APIKeyHandler interface {
+	CreateAPIKey(ctx *gin.Context)
+	ListAPIKeys(ctx *gin.Context)
+	RevokeAPIKey(ctx *gin.Context)
+}
+
+type LockoutHandler interface {
+	UnlockLogin(ctx *gin.Context)
+}
+
+type SessionHandler interface {
+	ListSessions(ctx *gin.Context)
+	RevokeSession(ctx *gin.Context)
+	RevokeOtherSessions(ctx *gin.Context)
+}
+
+type PasswordHandler interface {
+	ChangePassword(ctx *gin.Context)
+	IssuePasswordReset(ctx *gin.Context)
+	ResetPassword(ctx *gin.Context)
 }
 
 type RegistrationHandler interface{ Register(*gin.Context) }
@@ -13,5 +49,67 @@ type DocumentHandler interface {
 	AddDocument(*gin.Context)
 	GetDocument(ctx *gin.Context)
 	ListDocuments(ctx *gin.Context)
+	UpdateDocument(ctx *gin.Context)
+	ReplaceContent(ctx *gin.Context)
 	DeleteDocument(ctx *gin.Context)
+	LockDocument(ctx *gin.Context)
+	UnlockDocument(ctx *gin.Context)
+}
+
+type DavHandler interface {
+	ServeDAV(ctx *gin.Context)
+}
+
+type WebhookHandler interface {
+	CreateWebhook(ctx *gin.Context)
+	ListWebhooks(ctx *gin.Context)
+	DeleteWebhook(ctx *gin.Context)
+	ListDeliveries(ctx *gin.Context)
+	ReplayDelivery(ctx *gin.Context)
+}
+
+type EventHandler interface {
+	Stream(ctx *gin.Context)
+}
+
+type UserHandler interface {
+	ListUsers(ctx *gin.Context)
+	GetUser(ctx *gin.Context)
+	CreateUser(ctx *gin.Context)
+	ListSoleDocuments(ctx *gin.Context)
+	DisableUser(ctx *gin.Context)
+	EnableUser(ctx *gin.Context)
+	DeleteUser(ctx *gin.Context)
+	ChangeRole(ctx *gin.Context)
+}
+
+type ProfileHandler interface {
+	GetProfile(ctx *gin.Context)
+	UpdateProfile(ctx *gin.Context)
+	GetAvatar(ctx *gin.Context)
+}
+
+type InviteHandler interface {
+	CreateInvite(ctx *gin.Context)
+	ListInvites(ctx *gin.Context)
+	RevokeInvite(ctx *gin.Context)
+}
+
+type AuditHandler interface {
+	ListAuditEvents(ctx *gin.Context)
+	ExportAuditEvents(ctx *gin.Context)
+	VerifyAuditLog(ctx *gin.Context)
+}
+
+type SyncHandler interface {
+	Changes(ctx *gin.Context)
+}
+
+type CommentHandler interface {
+	ListComments(ctx *gin.Context)
+	CreateComment(ctx *gin.Context)
+	UpdateComment(ctx *gin.Context)
+	DeleteComment(ctx *gin.Context)
+	ResolveComment(ctx *gin.Context)
+	ReopenComment(ctx *gin.Context)
 }
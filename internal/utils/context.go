@@ -0,0 +1,33 @@
+package utils
+
+import (
+	"context"
+	"docs/internal/model"
+)
+
+type clientKey struct{}
+
+// WithClient returns a copy of ctx carrying the request client.
+func WithClient(ctx context.Context, client model.Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// ClientFromContext returns the client stored by WithClient, if any.
+func ClientFromContext(ctx context.Context) model.Client {
+	client, _ := ctx.Value(clientKey{}).(model.Client)
+	return client
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated caller.
+func WithPrincipal(ctx context.Context, principal *model.Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored by WithPrincipal, nil
+// for anonymous requests.
+func PrincipalFromContext(ctx context.Context) *model.Principal {
+	principal, _ := ctx.Value(principalKey{}).(*model.Principal)
+	return principal
+}
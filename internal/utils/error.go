@@ -3,7 +3,11 @@ package utils
 import (
 	"docs/internal/transport/http/dto"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,6 +28,35 @@ var (
 	ErrorCacheValue        = errors.New("unxpected type from cache")
 	ErrorLoginAlradyExists = errors.New("user with such a login already has")
 	ErrorNoAccess          = errors.New("access denied")
+	ErrorVersionRequired   = errors.New("if-match header with document version is required")
+	ErrorVersionMismatch   = errors.New("document version mismatch")
+	ErrorInvalidPatch      = errors.New("invalid patch")
+	ErrorLocked            = errors.New("document is locked")
+	ErrorInvalidTTL        = errors.New("invalid ttl")
+	ErrorInvalidWebhook    = errors.New("invalid webhook")
+	ErrorWebhookInactive   = errors.New("webhook is inactive")
+	ErrorInvalidEventID    = errors.New("invalid last event id")
+	ErrorInvalidCursor     = errors.New("invalid cursor")
+	ErrorCursorExpired     = errors.New("cursor is past the event retention, sync again without a cursor")
+	ErrorInvalidComment    = errors.New("invalid comment")
+	ErrorRefreshReused     = errors.New("refresh token reused, session family revoked")
+	ErrorInvalidResetToken = errors.New("invalid or expired reset token")
+	ErrorInvalidOTP        = errors.New("invalid one-time code")
+	ErrorTOTPEnabled       = errors.New("two-factor authentication is already enabled")
+	ErrorTOTPNotEnrolled   = errors.New("two-factor authentication is not enrolled")
+	ErrorInvalidAPIKey     = errors.New("invalid api key")
+	ErrorIdentityProvider  = errors.New("identity provider unavailable")
+	ErrorTooManyAttempts   = errors.New("too many failed logins, try again later")
+	ErrorAdminExists       = errors.New("an admin already exists, ask one to create the account")
+	ErrorUserDisabled      = errors.New("user is disabled")
+	ErrorInvalidRole       = errors.New("invalid role")
+	ErrorSelfManagement    = errors.New("admins can not disable, delete or demote themselves")
+	ErrorInvalidInvite     = errors.New("invalid invite")
+	ErrorInvalidProfile    = errors.New("invalid profile")
+	ErrorEmailExists       = errors.New("email is used by another user")
+	ErrorSoleDocuments     = errors.New("user is the only one with access to documents, transfer or delete them")
+	ErrorInvalidHandover   = errors.New("invalid document handover")
+	ErrorAuditUnavailable  = errors.New("audit log unavailable")
 )
 
 var errorStatusMap = map[error]int{
@@ -40,14 +73,113 @@ var errorStatusMap = map[error]int{
 	ErrorNotFound:          http.StatusNotFound,
 	ErrorLoginAlradyExists: http.StatusConflict,
 	ErrorNoAccess:          http.StatusForbidden,
+	ErrorVersionRequired:   http.StatusPreconditionRequired,
+	ErrorVersionMismatch:   http.StatusPreconditionFailed,
+	ErrorInvalidPatch:      http.StatusBadRequest,
+	ErrorLocked:            http.StatusLocked,
+	ErrorInvalidTTL:        http.StatusBadRequest,
+	ErrorInvalidWebhook:    http.StatusBadRequest,
+	ErrorWebhookInactive:   http.StatusConflict,
+	ErrorInvalidEventID:    http.StatusBadRequest,
+	ErrorInvalidCursor:     http.StatusBadRequest,
+	ErrorCursorExpired:     http.StatusGone,
+	ErrorInvalidComment:    http.StatusBadRequest,
+	ErrorRefreshReused:     http.StatusUnauthorized,
+	ErrorInvalidResetToken: http.StatusBadRequest,
+	ErrorInvalidOTP:        http.StatusBadRequest,
+	ErrorTOTPEnabled:       http.StatusConflict,
+	ErrorTOTPNotEnrolled:   http.StatusBadRequest,
+	ErrorInvalidAPIKey:     http.StatusBadRequest,
+	ErrorIdentityProvider:  http.StatusBadGateway,
+	ErrorTooManyAttempts:   http.StatusTooManyRequests,
+	ErrorAdminExists:       http.StatusConflict,
+	ErrorUserDisabled:      http.StatusForbidden,
+	ErrorInvalidRole:       http.StatusBadRequest,
+	ErrorSelfManagement:    http.StatusConflict,
+	ErrorInvalidInvite:     http.StatusBadRequest,
+	ErrorInvalidProfile:    http.StatusBadRequest,
+	ErrorEmailExists:       http.StatusConflict,
+	ErrorSoleDocuments:     http.StatusConflict,
+	ErrorInvalidHandover:   http.StatusBadRequest,
+	ErrorAuditUnavailable:  http.StatusServiceUnavailable,
+}
+
+// RetryAfterError tells the client when to try again, CaseError sends it in
+// the Retry-After header.
+type RetryAfterError struct {
+	Err   error
+	After time.Duration
+}
+
+func (inst *RetryAfterError) Error() string {
+	return inst.Err.Error()
+}
+
+func (inst *RetryAfterError) Unwrap() error {
+	return inst.Err
+}
+
+// RetryAfterSeconds is the Retry-After value of err, empty when it has none.
+func RetryAfterSeconds(err error) string {
+	var retry *RetryAfterError
+	if !errors.As(err, &retry) {
+		return ""
+	}
+
+	return strconv.Itoa(int(math.Ceil(retry.After.Seconds())))
+}
+
+// PolicyViolation is a login or password rule a value failed.
+type PolicyViolation struct {
+	Rule string
+	Text string
+}
+
+// PolicyError lists every rule a login or password failed, CaseError sends
+// them along with the error. Err is ErrorInvalidLogin or ErrorInvalidPassword.
+type PolicyError struct {
+	Err        error
+	Violations []PolicyViolation
+}
+
+func (inst *PolicyError) Error() string {
+	texts := make([]string, 0, len(inst.Violations))
+	for _, violation := range inst.Violations {
+		texts = append(texts, violation.Text)
+	}
+
+	return inst.Err.Error() + ": " + strings.Join(texts, "; ")
+}
+
+func (inst *PolicyError) Unwrap() error {
+	return inst.Err
+}
+
+func violations(err error) []dto.Violation {
+	var policyErr *PolicyError
+	if !errors.As(err, &policyErr) {
+		return nil
+	}
+
+	result := make([]dto.Violation, 0, len(policyErr.Violations))
+	for _, violation := range policyErr.Violations {
+		result = append(result, dto.Violation{Rule: violation.Rule, Text: violation.Text})
+	}
+
+	return result
 }
 
 func CaseError(ctx *gin.Context, err error) {
+	if retryAfter := RetryAfterSeconds(err); retryAfter != "" {
+		ctx.Header("Retry-After", retryAfter)
+	}
+
 	for target, status := range errorStatusMap {
 		if errors.Is(err, target) {
 			ctx.JSON(status, dto.ErrorResponse{Error: dto.Error{
-				Code: status,
-				Text: err.Error(),
+				Code:       status,
+				Text:       err.Error(),
+				Violations: violations(err),
 			}})
 			return
 		}
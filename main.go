@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"docs/internal/config"
 	"docs/internal/logging"
 	"docs/pkg/database"
@@ -31,9 +32,14 @@ func main() {
 		os.Exit(1)
 	}
 
-	serviceCollector := service.NewServiceCollector(log, config.UploadPath, config.AdminToken, repo)
+	serviceCollector, err := service.NewServiceCollector(log, config, repo)
+	if err != nil {
+		log.Error("failed init services", zap.Error(err))
+		os.Exit(1)
+	}
+	serviceCollector.Start(context.Background())
 
-	if err := http.NewServer(log, serviceCollector).Start(config.Addresss, config.Port); err != nil {
+	if err := http.NewServer(log, serviceCollector).Start(config.Addresss, config.Port, config.TrustedProxies); err != nil {
 		log.Error("failed start listening", zap.Error(err))
 		os.Exit(1)
 	}
@@ -0,0 +1,2 @@
+ALTER TABLE documents ADD COLUMN size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE documents ADD COLUMN hash VARCHAR(64) NOT NULL DEFAULT '';
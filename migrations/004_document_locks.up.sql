@@ -0,0 +1,9 @@
+ALTER TABLE users ADD COLUMN role VARCHAR(20) NOT NULL DEFAULT 'user';
+
+CREATE TABLE document_locks (
+    document_uuid UUID PRIMARY KEY REFERENCES documents(uuid) ON DELETE CASCADE,
+    user_login VARCHAR(50) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    create_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_document_locks_user ON document_locks(user_login);
@@ -0,0 +1,27 @@
+CREATE TABLE webhooks (
+    uuid UUID PRIMARY KEY,
+    user_login VARCHAR(50) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    create_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webhooks_user ON webhooks(user_login);
+
+CREATE TABLE webhook_deliveries (
+    uuid UUID PRIMARY KEY,
+    webhook_uuid UUID NOT NULL REFERENCES webhooks(uuid) ON DELETE CASCADE,
+    event_uuid UUID NOT NULL,
+    event VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    response_code INTEGER NULL,
+    last_error TEXT NULL,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    create_at TIMESTAMPTZ NOT NULL,
+    delivered_at TIMESTAMPTZ NULL
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_uuid, create_at);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
@@ -0,0 +1,21 @@
+CREATE TABLE events (
+    id BIGSERIAL PRIMARY KEY,
+    uuid UUID NOT NULL UNIQUE,
+    type VARCHAR(50) NOT NULL,
+    actor VARCHAR(50) NULL,
+    document_uuid UUID NULL,
+    visibility TEXT[] NOT NULL DEFAULT '{}',
+    payload JSONB NOT NULL,
+    create_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_events_visibility ON events USING GIN (visibility);
+
+CREATE OR REPLACE FUNCTION notify_event() RETURNS trigger AS $$
+BEGIN
+    PERFORM pg_notify('docs_events', NEW.id::text);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER events_notify AFTER INSERT ON events
+    FOR EACH ROW EXECUTE FUNCTION notify_event();
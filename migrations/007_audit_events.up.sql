@@ -0,0 +1,30 @@
+CREATE TABLE audit_events (
+    id BIGSERIAL PRIMARY KEY,
+    uuid UUID NOT NULL UNIQUE,
+    actor VARCHAR(50) NOT NULL DEFAULT '',
+    session VARCHAR(64) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    action VARCHAR(50) NOT NULL,
+    target VARCHAR(50) NOT NULL DEFAULT '',
+    document_uuid VARCHAR(36) NOT NULL DEFAULT '',
+    outcome VARCHAR(20) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    create_at TIMESTAMPTZ NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_document ON audit_events(document_uuid, id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_create_at ON audit_events(create_at);
+
+CREATE OR REPLACE FUNCTION audit_events_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_no_update BEFORE UPDATE OR DELETE ON audit_events
+    FOR EACH ROW EXECUTE FUNCTION audit_events_immutable();
+CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_immutable();
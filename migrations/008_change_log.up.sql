@@ -0,0 +1,4 @@
+-- transaction id of the insert, changes are read in (txid, id) order up to
+-- the oldest running transaction so no commit can land behind a cursor
+ALTER TABLE events ADD COLUMN txid xid8 NOT NULL DEFAULT pg_current_xact_id();
+CREATE INDEX IF NOT EXISTS idx_events_txid ON events(txid, id);
@@ -0,0 +1,15 @@
+CREATE TABLE comments (
+    uuid UUID PRIMARY KEY,
+    document_uuid UUID NOT NULL REFERENCES documents(uuid) ON DELETE CASCADE,
+    parent_uuid UUID NULL REFERENCES comments(uuid) ON DELETE CASCADE,
+    user_login VARCHAR(50) NOT NULL,
+    body TEXT NOT NULL,
+    anchor JSONB NULL,
+    resolved BOOLEAN NOT NULL DEFAULT FALSE,
+    resolved_by VARCHAR(50) NULL,
+    resolved_at TIMESTAMPTZ NULL,
+    create_at TIMESTAMPTZ NOT NULL,
+    update_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_comments_document ON comments(document_uuid, create_at);
+CREATE INDEX IF NOT EXISTS idx_comments_parent ON comments(parent_uuid);
@@ -0,0 +1,22 @@
+DELETE FROM sessions WHERE expires_at <= now();
+
+ALTER TABLE sessions ADD COLUMN family_uuid UUID NULL;
+ALTER TABLE sessions ADD COLUMN idle_ttl INTERVAL NOT NULL DEFAULT interval '30 minutes';
+ALTER TABLE sessions ADD COLUMN max_expires_at TIMESTAMPTZ NOT NULL DEFAULT now() + interval '1 day';
+ALTER TABLE sessions ADD COLUMN create_at TIMESTAMPTZ NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
+CREATE INDEX IF NOT EXISTS idx_sessions_family ON sessions(family_uuid);
+
+CREATE TABLE refresh_tokens (
+    hash VARCHAR(64) PRIMARY KEY,
+    family_uuid UUID NOT NULL,
+    session_uuid UUID NULL,
+    user_uuid UUID NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    user_login VARCHAR(50) NOT NULL REFERENCES users(login) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    create_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE
+);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family_uuid);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_expires_at ON refresh_tokens(expires_at);
@@ -0,0 +1,19 @@
+CREATE TABLE session_families (
+    uuid UUID PRIMARY KEY,
+    user_uuid UUID NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    user_login VARCHAR(50) NOT NULL,
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    create_at TIMESTAMPTZ NOT NULL,
+    last_seen_at TIMESTAMPTZ NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_session_families_user_login ON session_families(user_login);
+CREATE INDEX IF NOT EXISTS idx_session_families_expires_at ON session_families(expires_at);
+
+INSERT INTO session_families (uuid, user_uuid, user_login, create_at, last_seen_at, expires_at)
+SELECT family_uuid, user_uuid, user_login, MIN(create_at), MAX(create_at), MAX(expires_at)
+FROM refresh_tokens
+WHERE NOT revoked
+GROUP BY family_uuid, user_uuid, user_login
+HAVING MAX(expires_at) > now();
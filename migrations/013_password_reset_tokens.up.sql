@@ -0,0 +1,11 @@
+CREATE TABLE password_reset_tokens (
+    hash VARCHAR(64) PRIMARY KEY,
+    user_uuid UUID NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    user_login VARCHAR(50) NOT NULL,
+    create_by VARCHAR(50) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    create_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ NULL
+);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_user ON password_reset_tokens(user_uuid);
+CREATE INDEX IF NOT EXISTS idx_password_reset_tokens_expires_at ON password_reset_tokens(expires_at);
@@ -0,0 +1,24 @@
+CREATE TABLE user_totp (
+    user_uuid UUID PRIMARY KEY REFERENCES users(uuid) ON DELETE CASCADE,
+    secret TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    last_step BIGINT NOT NULL DEFAULT 0,
+    create_at TIMESTAMPTZ NOT NULL,
+    enabled_at TIMESTAMPTZ NULL
+);
+
+CREATE TABLE totp_recovery_codes (
+    hash VARCHAR(64) PRIMARY KEY,
+    user_uuid UUID NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    used_at TIMESTAMPTZ NULL
+);
+CREATE INDEX IF NOT EXISTS idx_totp_recovery_codes_user ON totp_recovery_codes(user_uuid);
+
+CREATE TABLE login_challenges (
+    hash VARCHAR(64) PRIMARY KEY,
+    user_uuid UUID NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    create_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_login_challenges_expires_at ON login_challenges(expires_at);
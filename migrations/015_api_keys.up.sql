@@ -0,0 +1,13 @@
+CREATE TABLE api_keys (
+    uuid UUID PRIMARY KEY,
+    hash VARCHAR(64) UNIQUE NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    user_uuid UUID NOT NULL REFERENCES users(uuid) ON DELETE CASCADE,
+    scopes TEXT[] NOT NULL,
+    allowed_ips TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMPTZ NULL,
+    last_used_at TIMESTAMPTZ NULL,
+    create_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_uuid ON api_keys(user_uuid);
@@ -0,0 +1,10 @@
+CREATE TABLE login_failures (
+    kind VARCHAR(10) NOT NULL,
+    key TEXT NOT NULL,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    blocked_until TIMESTAMPTZ NULL,
+    locked BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (kind, key)
+);
+CREATE INDEX IF NOT EXISTS idx_login_failures_last_failure_at ON login_failures(last_failure_at);
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMPTZ NULL;
+ALTER TABLE users ADD COLUMN create_at TIMESTAMPTZ NOT NULL DEFAULT now();
+CREATE INDEX IF NOT EXISTS idx_users_role ON users(role);
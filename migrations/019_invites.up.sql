@@ -0,0 +1,23 @@
+CREATE TABLE invites (
+    uuid UUID PRIMARY KEY,
+    hash VARCHAR(64) UNIQUE NOT NULL,
+    login VARCHAR(50) NULL,
+    role TEXT NOT NULL,
+    max_uses INTEGER NOT NULL,
+    uses INTEGER NOT NULL DEFAULT 0,
+    create_by VARCHAR(50) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NULL,
+    create_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_invites_create_at ON invites(create_at);
+
+-- redemptions outlive the users, they are the record of who joined through
+-- an invite
+CREATE TABLE invite_redemptions (
+    invite_uuid UUID NOT NULL REFERENCES invites(uuid) ON DELETE CASCADE,
+    user_uuid UUID NOT NULL,
+    user_login VARCHAR(50) NOT NULL,
+    create_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_invite_redemptions_invite ON invite_redemptions(invite_uuid);
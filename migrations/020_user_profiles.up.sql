@@ -0,0 +1,5 @@
+ALTER TABLE users ADD COLUMN display_name VARCHAR(100) NULL;
+ALTER TABLE users ADD COLUMN email VARCHAR(254) NULL;
+ALTER TABLE users ADD COLUMN locale VARCHAR(35) NULL;
+ALTER TABLE users ADD COLUMN avatar_uuid UUID NULL REFERENCES documents(uuid) ON DELETE SET NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email ON users(lower(email)) WHERE email IS NOT NULL;
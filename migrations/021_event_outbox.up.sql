@@ -0,0 +1,12 @@
+-- events are written in the transaction of the change they announce, the
+-- log is the outbox. Each relay hands the log on to one consumer and keeps
+-- its (txid, id) cursor here, the row lock lets one instance relay at a time.
+CREATE TABLE event_relays (
+    name VARCHAR(50) PRIMARY KEY,
+    txid xid8 NOT NULL,
+    id BIGINT NOT NULL
+);
+
+-- events logged before were queued for webhooks when they were published
+INSERT INTO event_relays (name, txid, id)
+VALUES ('webhooks', pg_snapshot_xmin(pg_current_snapshot()), 0);
@@ -0,0 +1,7 @@
+-- the backend that created the account and checks its password: local,
+-- oidc or ldap. Logins through a provider only reuse accounts it created.
+ALTER TABLE users ADD COLUMN source VARCHAR(10) NOT NULL DEFAULT 'local';
+
+-- provisioned on first single sign-on, without a local password
+UPDATE users SET source = 'oidc'
+WHERE password = '' AND uuid IN (SELECT user_uuid FROM user_identities);
@@ -0,0 +1,3 @@
+-- provisioned on first directory login, without a local password and not
+-- linked to a single sign-on subject by 022
+UPDATE users SET source = 'ldap' WHERE source = 'local' AND password = '';
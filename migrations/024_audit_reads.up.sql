@@ -0,0 +1,30 @@
+-- reads are logged outside of the audit_events hash chain, appending them
+-- takes no lock
+CREATE TABLE audit_reads (
+    id BIGSERIAL PRIMARY KEY,
+    uuid UUID NOT NULL UNIQUE,
+    actor VARCHAR(50) NOT NULL DEFAULT '',
+    session VARCHAR(64) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    action VARCHAR(50) NOT NULL,
+    target VARCHAR(50) NOT NULL DEFAULT '',
+    document_uuid VARCHAR(36) NOT NULL DEFAULT '',
+    outcome VARCHAR(20) NOT NULL,
+    detail TEXT NOT NULL DEFAULT '',
+    create_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_audit_reads_actor ON audit_reads(actor, id);
+CREATE INDEX IF NOT EXISTS idx_audit_reads_document ON audit_reads(document_uuid, id);
+CREATE INDEX IF NOT EXISTS idx_audit_reads_create_at ON audit_reads(create_at);
+
+CREATE OR REPLACE FUNCTION audit_reads_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_reads is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_reads_no_update BEFORE UPDATE OR DELETE ON audit_reads
+    FOR EACH ROW EXECUTE FUNCTION audit_reads_immutable();
+CREATE TRIGGER audit_reads_no_truncate BEFORE TRUNCATE ON audit_reads
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_reads_immutable();
@@ -0,0 +1,11 @@
+-- relayed events older than the retention are purged, the horizon is the
+-- last purged (txid, id): a sync cursor before it may have missed changes
+CREATE TABLE event_purges (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    txid xid8 NOT NULL,
+    event_id BIGINT NOT NULL
+);
+
+INSERT INTO event_purges (txid, event_id) VALUES ('0', 0);
+
+CREATE INDEX IF NOT EXISTS idx_events_create_at ON events(create_at);
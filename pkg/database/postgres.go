@@ -12,8 +12,19 @@ import (
 type PostgresRepository struct {
 	SessionRepository  repository.SessionRepository
 	UserRepository     repository.UserRepository
+	PasswordRepository repository.PasswordResetRepository
+	InviteRepository   repository.InviteRepository
+	TOTPRepository     repository.TOTPRepository
+	APIKeyRepository   repository.APIKeyRepository
+	OIDCRepository     repository.OIDCRepository
+	FailureRepository  repository.LoginFailureRepository
 	DocumentRepository repository.DocumentRepository
 	GrantRepository    repository.GrantRepository
+	LockRepository     repository.LockRepository
+	WebhookRepository  repository.WebhookRepository
+	EventRepository    repository.EventRepository
+	AuditRepository    repository.AuditRepository
+	CommentRepository  repository.CommentRepository
 }
 
 func NewPostresRepository(log *zap.Logger, dsn string) (*PostgresRepository, error) {
@@ -24,7 +35,18 @@ func NewPostresRepository(log *zap.Logger, dsn string) (*PostgresRepository, err
 	return &PostgresRepository{
 		SessionRepository:  postgres.NewSession(pool),
 		UserRepository:     postgres.NewUser(pool),
+		PasswordRepository: postgres.NewPasswordReset(pool),
+		InviteRepository:   postgres.NewInvite(pool),
+		TOTPRepository:     postgres.NewTOTP(pool),
+		APIKeyRepository:   postgres.NewAPIKey(pool),
+		OIDCRepository:     postgres.NewOIDC(pool),
+		FailureRepository:  postgres.NewLoginFailure(pool),
 		DocumentRepository: postgres.NewDocument(log, pool),
 		GrantRepository:    postgres.NewGrant(pool),
+		LockRepository:     postgres.NewLock(pool),
+		WebhookRepository:  postgres.NewWebhook(pool),
+		EventRepository:    postgres.NewEvent(pool),
+		AuditRepository:    postgres.NewAudit(pool),
+		CommentRepository:  postgres.NewComment(pool),
 	}, nil
 }
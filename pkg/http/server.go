@@ -2,9 +2,11 @@ package http
 
 import (
 	"docs/docs"
+	"docs/internal/model"
 	"docs/internal/transport"
 	"docs/internal/transport/http/handler"
 	"docs/pkg/service"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -15,8 +17,38 @@ import (
 type Server struct {
 	eng             *gin.Engine
 	authHandler     transport.AuthHandler
+	ssoHandler      transport.SSOHandler
 	registerHandler transport.RegistrationHandler
+	sessionHandler  transport.SessionHandler
+	lockoutHandler  transport.LockoutHandler
+	passwordHandler transport.PasswordHandler
+	userHandler     transport.UserHandler
+	profileHandler  transport.ProfileHandler
+	inviteHandler   transport.InviteHandler
+	totpHandler     transport.TOTPHandler
+	apiKeyHandler   transport.APIKeyHandler
 	documentHandler transport.DocumentHandler
+	davHandler      transport.DavHandler
+	webhookHandler  transport.WebhookHandler
+	eventHandler    transport.EventHandler
+	auditHandler    transport.AuditHandler
+	syncHandler     transport.SyncHandler
+	commentHandler  transport.CommentHandler
+}
+
+var davMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPut,
+	http.MethodDelete,
+	http.MethodOptions,
+	"PROPFIND",
+	"PROPPATCH",
+	"MKCOL",
+	"COPY",
+	"MOVE",
+	"LOCK",
+	"UNLOCK",
 }
 
 func NewServer(log *zap.Logger, serviceCollector *service.ServiceCollector) *Server {
@@ -24,36 +56,150 @@ func NewServer(log *zap.Logger, serviceCollector *service.ServiceCollector) *Ser
 	return &Server{
 		eng:             gin.New(),
 		authHandler:     handler.NewAuth(serviceCollector.AuthService),
+		ssoHandler:      handler.NewSSO(serviceCollector.SSOService),
 		registerHandler: handler.NewRegistration(serviceCollector.RegistrationService),
-		documentHandler: handler.NewDocuments(log, serviceCollector.DocumentService),
+		sessionHandler:  handler.NewSession(serviceCollector.SessionService),
+		lockoutHandler:  handler.NewLockout(serviceCollector.LockoutService),
+		passwordHandler: handler.NewPassword(serviceCollector.PasswordService),
+		userHandler:     handler.NewUser(serviceCollector.UserService),
+		profileHandler:  handler.NewProfile(serviceCollector.ProfileService),
+		inviteHandler:   handler.NewInvite(serviceCollector.InviteService),
+		totpHandler:     handler.NewTOTP(serviceCollector.TOTPService),
+		apiKeyHandler:   handler.NewAPIKey(serviceCollector.APIKeyService),
+		documentHandler: handler.NewDocuments(log, serviceCollector.DocumentService, serviceCollector.ProfileService),
+		davHandler:      handler.NewDav(log, serviceCollector.AuthService, serviceCollector.DocumentService),
+		webhookHandler:  handler.NewWebhook(serviceCollector.WebhookService),
+		eventHandler:    handler.NewEvent(log, serviceCollector.StreamService),
+		auditHandler:    handler.NewAudit(log, serviceCollector.AuditService),
+		syncHandler:     handler.NewSync(serviceCollector.SyncService),
+		commentHandler:  handler.NewComment(serviceCollector.CommentService),
 	}
 }
 
-func (inst *Server) Start(address, port string) error {
+// Start serves the API. Only the trustedProxies may set the client address
+// with forwarding headers, it is what API key allowlists and the login
+// lockout see.
+func (inst *Server) Start(address, port string, trustedProxies []string) error {
 	docs.SwaggerInfo.Title = "API Swagger"
 	docs.SwaggerInfo.Version = "1.0"
 	docs.SwaggerInfo.Host = "127.0.0.1" + ":" + port
 	docs.SwaggerInfo.BasePath = "/api"
 	docs.SwaggerInfo.Schemes = []string{"http"}
 
+	if err := inst.eng.SetTrustedProxies(trustedProxies); err != nil {
+		return err
+	}
+
+	// let services reach the request context values set by middlewares
+	inst.eng.ContextWithFallback = true
+	inst.eng.Use(handler.Client)
+
 	inst.eng.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
 	apiGroup := inst.eng.Group("/api")
 
 	// auth routes
 	apiGroup.POST("/auth", inst.authHandler.Login)
+	apiGroup.POST("/auth/totp", inst.authHandler.LoginTOTP)
+	apiGroup.POST("/auth/refresh", inst.authHandler.Refresh)
 	apiGroup.DELETE("/auth/:token", inst.authHandler.Logout)
+	apiGroup.DELETE("/auth", inst.authHandler.Logout)
+	apiGroup.GET("/auth/oidc", inst.ssoHandler.StartOIDC)
+	apiGroup.GET("/auth/oidc/callback", inst.ssoHandler.OIDCCallback)
 
-	// register routes
+	// register routes, with an invite code or, for the first admin, the
+	// admin token
 	apiGroup.POST("/register", inst.registerHandler.Register)
 
+	// password reset routes
+	apiGroup.POST("/password/reset", inst.passwordHandler.ResetPassword)
+
+	// routes below need an access token, see handler.Auth.Authenticate. API
+	// keys reach only the routes their scopes allow
+	authGroup := apiGroup.Group("", inst.authHandler.Authenticate)
+	accountGroup := authGroup.Group("", handler.RequireSession)
+	readGroup := authGroup.Group("", handler.RequireScope(model.ScopeDocsRead))
+	writeGroup := authGroup.Group("", handler.RequireScope(model.ScopeDocsWrite))
+	deleteGroup := authGroup.Group("", handler.RequireScope(model.ScopeDocsDelete))
+	adminGroup := authGroup.Group("", handler.RequireScope(model.ScopeAdmin))
+
+	// profile routes, avatars are seen by every signed in user
+	accountGroup.GET("/me", inst.profileHandler.GetProfile)
+	accountGroup.PATCH("/me", inst.profileHandler.UpdateProfile)
+	readGroup.GET("/users/:login/avatar", inst.profileHandler.GetAvatar)
+
+	// session routes
+	accountGroup.GET("/me/sessions", inst.sessionHandler.ListSessions)
+	accountGroup.DELETE("/me/sessions", inst.sessionHandler.RevokeOtherSessions)
+	accountGroup.DELETE("/me/sessions/:id", inst.sessionHandler.RevokeSession)
+	accountGroup.POST("/me/password", inst.passwordHandler.ChangePassword)
+	accountGroup.POST("/me/totp", inst.totpHandler.EnrollTOTP)
+	accountGroup.POST("/me/totp/verify", inst.totpHandler.VerifyTOTP)
+	accountGroup.DELETE("/me/totp", inst.totpHandler.DisableTOTP)
+
+	// api key routes
+	accountGroup.POST("/me/keys", inst.apiKeyHandler.CreateAPIKey)
+	accountGroup.GET("/me/keys", inst.apiKeyHandler.ListAPIKeys)
+	accountGroup.DELETE("/me/keys/:id", inst.apiKeyHandler.RevokeAPIKey)
+
 	// documents routes
-	apiGroup.POST("/docs", inst.documentHandler.AddDocument)
-	apiGroup.GET("/docs/:uuid", inst.documentHandler.GetDocument)
-	apiGroup.HEAD("/docs/:uuid", inst.documentHandler.GetDocument)
-	apiGroup.GET("/docs", inst.documentHandler.ListDocuments)
-	apiGroup.HEAD("/docs", inst.documentHandler.ListDocuments)
-	apiGroup.DELETE("/docs/:uuid", inst.documentHandler.DeleteDocument)
+	writeGroup.POST("/docs", inst.documentHandler.AddDocument)
+	readGroup.GET("/docs/:uuid", inst.documentHandler.GetDocument)
+	readGroup.HEAD("/docs/:uuid", inst.documentHandler.GetDocument)
+	readGroup.GET("/docs", inst.documentHandler.ListDocuments)
+	readGroup.HEAD("/docs", inst.documentHandler.ListDocuments)
+	writeGroup.PATCH("/docs/:uuid", inst.documentHandler.UpdateDocument)
+	writeGroup.PUT("/docs/:uuid/content", inst.documentHandler.ReplaceContent)
+	deleteGroup.DELETE("/docs/:uuid", inst.documentHandler.DeleteDocument)
+	writeGroup.POST("/docs/:uuid/lock", inst.documentHandler.LockDocument)
+	writeGroup.DELETE("/docs/:uuid/lock", inst.documentHandler.UnlockDocument)
+
+	// comment routes
+	readGroup.GET("/docs/:uuid/comments", inst.commentHandler.ListComments)
+	writeGroup.POST("/docs/:uuid/comments", inst.commentHandler.CreateComment)
+	writeGroup.PATCH("/docs/:uuid/comments/:comment", inst.commentHandler.UpdateComment)
+	writeGroup.DELETE("/docs/:uuid/comments/:comment", inst.commentHandler.DeleteComment)
+	writeGroup.POST("/docs/:uuid/comments/:comment/resolve", inst.commentHandler.ResolveComment)
+	writeGroup.DELETE("/docs/:uuid/comments/:comment/resolve", inst.commentHandler.ReopenComment)
+
+	// webhook routes, webhooks deliver document events so they need read
+	readGroup.POST("/webhooks", inst.webhookHandler.CreateWebhook)
+	readGroup.GET("/webhooks", inst.webhookHandler.ListWebhooks)
+	readGroup.DELETE("/webhooks/:uuid", inst.webhookHandler.DeleteWebhook)
+	readGroup.GET("/webhooks/:uuid/deliveries", inst.webhookHandler.ListDeliveries)
+	readGroup.POST("/webhooks/:uuid/deliveries/:delivery/replay", inst.webhookHandler.ReplayDelivery)
+
+	// event stream routes
+	readGroup.GET("/events", inst.eventHandler.Stream)
+
+	// sync routes
+	readGroup.GET("/sync/changes", inst.syncHandler.Changes)
+
+	// admin routes
+	adminGroup.GET("/admin/audit", inst.auditHandler.ListAuditEvents)
+	adminGroup.GET("/admin/audit/export", inst.auditHandler.ExportAuditEvents)
+	adminGroup.GET("/admin/audit/verify", inst.auditHandler.VerifyAuditLog)
+	adminGroup.GET("/admin/users", inst.userHandler.ListUsers)
+	adminGroup.POST("/admin/users", inst.userHandler.CreateUser)
+	adminGroup.GET("/admin/users/:login", inst.userHandler.GetUser)
+	adminGroup.DELETE("/admin/users/:login", inst.userHandler.DeleteUser)
+	adminGroup.GET("/admin/users/:login/documents", inst.userHandler.ListSoleDocuments)
+	adminGroup.POST("/admin/users/:login/disable", inst.userHandler.DisableUser)
+	adminGroup.POST("/admin/users/:login/enable", inst.userHandler.EnableUser)
+	adminGroup.PUT("/admin/users/:login/role", inst.userHandler.ChangeRole)
+	adminGroup.GET("/admin/users/:login/sessions", inst.sessionHandler.ListSessions)
+	adminGroup.DELETE("/admin/users/:login/sessions", inst.sessionHandler.RevokeOtherSessions)
+	adminGroup.DELETE("/admin/users/:login/sessions/:id", inst.sessionHandler.RevokeSession)
+	adminGroup.POST("/admin/users/:login/password-reset", inst.passwordHandler.IssuePasswordReset)
+	adminGroup.DELETE("/admin/users/:login/lockout", inst.lockoutHandler.UnlockLogin)
+	adminGroup.POST("/admin/invites", inst.inviteHandler.CreateInvite)
+	adminGroup.GET("/admin/invites", inst.inviteHandler.ListInvites)
+	adminGroup.DELETE("/admin/invites/:id", inst.inviteHandler.RevokeInvite)
+
+	// webdav routes
+	for _, method := range davMethods {
+		inst.eng.Handle(method, handler.DavPrefix+"/*path", inst.davHandler.ServeDAV)
+	}
 
 	return inst.eng.Run(address + ":" + port)
 }
@@ -0,0 +1,217 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER classes and the constructed bit of an identifier octet.
+const (
+	classApplication = 0x40
+	classContext     = 0x80
+	constructed      = 0x20
+)
+
+// Universal tags used by LDAP.
+const (
+	tagBoolean     = 0x01
+	tagInteger     = 0x02
+	tagOctetString = 0x04
+	tagEnumerated  = 0x0a
+	tagSequence    = 0x10 | constructed
+)
+
+// maxPacket bounds a message read from the server.
+const maxPacket = 1 << 24
+
+var errMalformed = errors.New("ldap: malformed packet")
+
+// packet is a BER element, a primitive value or the children of a
+// constructed one. Only the single octet tags LDAP needs are supported.
+type packet struct {
+	tag      byte
+	value    []byte
+	children []*packet
+}
+
+func newPrimitive(tag byte, value []byte) *packet {
+	return &packet{tag: tag, value: value}
+}
+
+func newConstructed(tag byte, children ...*packet) *packet {
+	return &packet{tag: tag | constructed, children: children}
+}
+
+func newString(tag byte, value string) *packet {
+	return newPrimitive(tag, []byte(value))
+}
+
+func newInteger(tag byte, value int64) *packet {
+	buf := []byte{byte(value)}
+	for v := value >> 8; ; v >>= 8 {
+		// stop once the sign bit of the leading octet is right
+		if (v == 0 && buf[0]&0x80 == 0) || (v == -1 && buf[0]&0x80 != 0) {
+			break
+		}
+		buf = append([]byte{byte(v)}, buf...)
+	}
+
+	return newPrimitive(tag, buf)
+}
+
+func newBoolean(value bool) *packet {
+	if value {
+		return newPrimitive(tagBoolean, []byte{0xff})
+	}
+	return newPrimitive(tagBoolean, []byte{0x00})
+}
+
+func (inst *packet) isConstructed() bool {
+	return inst.tag&constructed != 0
+}
+
+func (inst *packet) encode() []byte {
+	value := inst.value
+	if inst.isConstructed() {
+		value = nil
+		for _, child := range inst.children {
+			value = append(value, child.encode()...)
+		}
+	}
+
+	out := append([]byte{inst.tag}, encodeLength(len(value))...)
+	return append(out, value...)
+}
+
+func (inst *packet) string() string {
+	return string(inst.value)
+}
+
+func (inst *packet) integer() (int64, error) {
+	if len(inst.value) == 0 || len(inst.value) > 8 {
+		return 0, errMalformed
+	}
+
+	value := int64(int8(inst.value[0]))
+	for _, b := range inst.value[1:] {
+		value = value<<8 | int64(b)
+	}
+
+	return value, nil
+}
+
+// child returns the i-th child or an error for a packet too short.
+func (inst *packet) child(i int) (*packet, error) {
+	if i >= len(inst.children) {
+		return nil, errMalformed
+	}
+	return inst.children[i], nil
+}
+
+func encodeLength(length int) []byte {
+	if length < 0x80 {
+		return []byte{byte(length)}
+	}
+
+	var buf []byte
+	for l := length; l > 0; l >>= 8 {
+		buf = append([]byte{byte(l)}, buf...)
+	}
+
+	return append([]byte{0x80 | byte(len(buf))}, buf...)
+}
+
+// readPacket reads one element from r.
+func readPacket(r *bufio.Reader) (*packet, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(r, value); err != nil {
+		return nil, err
+	}
+
+	return decodePacket(tag, value)
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	if first&0x80 == 0 {
+		return int(first), nil
+	}
+
+	octets := int(first & 0x7f)
+	if octets == 0 || octets > 4 {
+		return 0, fmt.Errorf("%w: length of %d octets", errMalformed, octets)
+	}
+
+	length := 0
+	for range octets {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | int(b)
+	}
+
+	if length > maxPacket {
+		return 0, fmt.Errorf("%w: %d bytes", errMalformed, length)
+	}
+
+	return length, nil
+}
+
+// decodePacket parses the value of an element, splitting constructed ones
+// into their children.
+func decodePacket(tag byte, value []byte) (*packet, error) {
+	result := &packet{tag: tag}
+	if tag&constructed == 0 {
+		result.value = value
+		return result, nil
+	}
+
+	for len(value) > 0 {
+		if len(value) < 2 {
+			return nil, errMalformed
+		}
+
+		childTag, length, header := value[0], int(value[1]), 2
+		if length&0x80 != 0 {
+			octets := length & 0x7f
+			if octets == 0 || octets > 4 || len(value) < 2+octets {
+				return nil, errMalformed
+			}
+			length = 0
+			for _, b := range value[2 : 2+octets] {
+				length = length<<8 | int(b)
+			}
+			header += octets
+		}
+
+		if length > len(value)-header {
+			return nil, errMalformed
+		}
+
+		child, err := decodePacket(childTag, value[header:header+length])
+		if err != nil {
+			return nil, err
+		}
+		result.children = append(result.children, child)
+		value = value[header+length:]
+	}
+
+	return result, nil
+}
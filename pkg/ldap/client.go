@@ -0,0 +1,410 @@
+// Package ldap is a small LDAPv3 client (RFC 4511): simple bind, StartTLS and
+// subtree search with equality and presence filters, enough to check a
+// password and read the groups of a user.
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol operations, application class tags of RFC 4511.
+const (
+	opBindRequest       = classApplication | constructed | 0
+	opBindResponse      = classApplication | constructed | 1
+	opUnbindRequest     = classApplication | 2
+	opSearchRequest     = classApplication | constructed | 3
+	opSearchEntry       = classApplication | constructed | 4
+	opSearchDone        = classApplication | constructed | 5
+	opSearchReference   = classApplication | constructed | 19
+	opExtendedRequest   = classApplication | constructed | 23
+	opExtendedResponse  = classApplication | constructed | 24
+	startTLSRequestName = "1.3.6.1.4.1.1466.20037"
+)
+
+// Result codes callers look at.
+const (
+	ResultSuccess            = 0
+	ResultNoSuchObject       = 32
+	ResultInvalidCredentials = 49
+)
+
+// Search scopes.
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+// Error is a non-success LDAPResult.
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (inst *Error) Error() string {
+	return fmt.Sprintf("ldap: result %d: %s", inst.Code, inst.Message)
+}
+
+// IsResult reports whether err is an LDAP result with the code.
+func IsResult(err error, code int) bool {
+	var ldapErr *Error
+	return errors.As(err, &ldapErr) && ldapErr.Code == code
+}
+
+// Filter is an encoded search filter, build it with Equal, Present and And.
+// Values are never parsed, so user input can not change the filter.
+type Filter struct {
+	packet *packet
+}
+
+// Equal matches entries whose attribute has the value.
+func Equal(attribute, value string) Filter {
+	return Filter{newConstructed(classContext|3, newString(tagOctetString, attribute), newString(tagOctetString, value))}
+}
+
+// Present matches entries that have the attribute.
+func Present(attribute string) Filter {
+	return Filter{newString(classContext|7, attribute)}
+}
+
+// And matches entries every filter matches.
+func And(filters ...Filter) Filter {
+	children := make([]*packet, 0, len(filters))
+	for _, filter := range filters {
+		children = append(children, filter.packet)
+	}
+	return Filter{newConstructed(classContext|0, children...)}
+}
+
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     Filter
+	Attributes []string
+	SizeLimit  int
+}
+
+// Entry is a search result. Attribute names are kept as the server sent them,
+// use Values to read them case-insensitively.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Values returns the values of the attribute, its name compared without
+// case.
+func (inst *Entry) Values(attribute string) []string {
+	for name, values := range inst.Attributes {
+		if strings.EqualFold(name, attribute) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Conn is a connection to an LDAP server. Operations run one at a time.
+type Conn struct {
+	mu        sync.Mutex
+	conn      net.Conn
+	reader    *bufio.Reader
+	messageID int64
+	host      string
+}
+
+// Dial connects to an ldap:// or ldaps:// URL, ldaps uses tlsConfig or a
+// default one for the host.
+func Dial(ctx context.Context, rawURL string, tlsConfig *tls.Config) (*Conn, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: %w", err)
+	}
+
+	host, port := target.Hostname(), target.Port()
+	var dialer interface {
+		DialContext(ctx context.Context, network, address string) (net.Conn, error)
+	}
+	switch target.Scheme {
+	case "ldap":
+		if port == "" {
+			port = "389"
+		}
+		dialer = &net.Dialer{}
+	case "ldaps":
+		if port == "" {
+			port = "636"
+		}
+		dialer = &tls.Dialer{Config: withServerName(tlsConfig, host)}
+	default:
+		return nil, fmt.Errorf("ldap: unsupported scheme %q", target.Scheme)
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, fmt.Errorf("ldap: %w", err)
+	}
+
+	return NewConn(conn, host), nil
+}
+
+// NewConn speaks LDAP over an established connection, host is the name
+// StartTLS verifies.
+func NewConn(conn net.Conn, host string) *Conn {
+	return &Conn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		host:   host,
+	}
+}
+
+// SetDeadline bounds the operations that follow.
+func (inst *Conn) SetDeadline(deadline time.Time) error {
+	return inst.conn.SetDeadline(deadline)
+}
+
+// StartTLS upgrades the connection to TLS.
+func (inst *Conn) StartTLS(tlsConfig *tls.Config) error {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	request := newConstructed(opExtendedRequest, newString(classContext|0, startTLSRequestName))
+	response, err := inst.roundTrip(request, opExtendedResponse)
+	if err != nil {
+		return err
+	}
+
+	if err := resultError(response); err != nil {
+		return err
+	}
+
+	conn := tls.Client(inst.conn, withServerName(tlsConfig, inst.host))
+	if err := conn.Handshake(); err != nil {
+		return fmt.Errorf("ldap: starttls: %w", err)
+	}
+	inst.conn, inst.reader = conn, bufio.NewReader(conn)
+
+	return nil
+}
+
+// Bind authenticates the connection with a simple bind. An empty password
+// is refused, servers take it as an anonymous bind that always succeeds.
+func (inst *Conn) Bind(dn, password string) error {
+	if password == "" {
+		return &Error{Code: ResultInvalidCredentials, Message: "empty password"}
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	request := newConstructed(opBindRequest,
+		newInteger(tagInteger, 3),
+		newString(tagOctetString, dn),
+		newString(classContext|0, password),
+	)
+
+	response, err := inst.roundTrip(request, opBindResponse)
+	if err != nil {
+		return err
+	}
+
+	return resultError(response)
+}
+
+// Search returns the entries matching the request, referrals are skipped.
+func (inst *Conn) Search(request *SearchRequest) ([]Entry, error) {
+	if request.Filter.packet == nil {
+		return nil, errors.New("ldap: search without a filter")
+	}
+
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	attributes := make([]*packet, 0, len(request.Attributes))
+	for _, attribute := range request.Attributes {
+		attributes = append(attributes, newString(tagOctetString, attribute))
+	}
+
+	messageID, err := inst.send(newConstructed(opSearchRequest,
+		newString(tagOctetString, request.BaseDN),
+		newInteger(tagEnumerated, int64(request.Scope)),
+		newInteger(tagEnumerated, 0),
+		newInteger(tagInteger, int64(request.SizeLimit)),
+		newInteger(tagInteger, 0),
+		newBoolean(false),
+		request.Filter.packet,
+		newConstructed(tagSequence, attributes...),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for {
+		op, err := inst.receive(messageID)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op.tag {
+		case opSearchEntry:
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, *entry)
+		case opSearchReference:
+			// referrals are not followed
+		case opSearchDone:
+			return entries, resultError(op)
+		default:
+			return nil, fmt.Errorf("%w: unexpected operation %#x", errMalformed, op.tag)
+		}
+	}
+}
+
+// Close sends an unbind and closes the connection.
+func (inst *Conn) Close() error {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+
+	inst.send(newPrimitive(opUnbindRequest, nil))
+
+	return inst.conn.Close()
+}
+
+func (inst *Conn) roundTrip(request *packet, responseTag byte) (*packet, error) {
+	messageID, err := inst.send(request)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := inst.receive(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.tag != responseTag {
+		return nil, fmt.Errorf("%w: unexpected operation %#x", errMalformed, response.tag)
+	}
+
+	return response, nil
+}
+
+func (inst *Conn) send(op *packet) (int64, error) {
+	inst.messageID++
+	message := newConstructed(tagSequence, newInteger(tagInteger, inst.messageID), op)
+
+	if _, err := inst.conn.Write(message.encode()); err != nil {
+		return 0, fmt.Errorf("ldap: %w", err)
+	}
+
+	return inst.messageID, nil
+}
+
+// receive reads the next message and returns its protocol operation. A
+// notice of disconnection, message ID 0, ends the exchange.
+func (inst *Conn) receive(messageID int64) (*packet, error) {
+	message, err := readPacket(inst.reader)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: %w", err)
+	}
+
+	if message.tag != tagSequence || len(message.children) < 2 {
+		return nil, errMalformed
+	}
+
+	id, err := message.children[0].integer()
+	if err != nil {
+		return nil, err
+	}
+
+	op := message.children[1]
+	if id == 0 {
+		return nil, resultError(op)
+	}
+
+	if id != messageID {
+		return nil, fmt.Errorf("%w: message id %d, want %d", errMalformed, id, messageID)
+	}
+
+	return op, nil
+}
+
+// resultError turns the LDAPResult of a response into an error, nil on
+// success.
+func resultError(op *packet) error {
+	codePacket, err := op.child(0)
+	if err != nil {
+		return err
+	}
+
+	code, err := codePacket.integer()
+	if err != nil {
+		return err
+	}
+
+	if code == ResultSuccess {
+		return nil
+	}
+
+	message := ""
+	if diagnostic, err := op.child(2); err == nil {
+		message = diagnostic.string()
+	}
+
+	return &Error{Code: int(code), Message: message}
+}
+
+func parseEntry(op *packet) (*Entry, error) {
+	dn, err := op.child(0)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := op.child(1)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{DN: dn.string(), Attributes: map[string][]string{}}
+	for _, attribute := range list.children {
+		name, err := attribute.child(0)
+		if err != nil {
+			return nil, err
+		}
+
+		set, err := attribute.child(1)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]string, 0, len(set.children))
+		for _, value := range set.children {
+			values = append(values, value.string())
+		}
+		entry.Attributes[name.string()] = values
+	}
+
+	return entry, nil
+}
+
+func withServerName(tlsConfig *tls.Config, host string) *tls.Config {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+
+	return tlsConfig
+}
@@ -0,0 +1,357 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	serviceDN = "cn=service,dc=example,dc=org"
+	aliceDN   = "uid=alice,ou=people,dc=example,dc=org"
+	peopleDN  = "ou=people,dc=example,dc=org"
+)
+
+// fakeServer answers binds against passwords by DN and searches against
+// entries under peopleDN, in process over one side of a net.Pipe.
+type fakeServer struct {
+	passwords map[string]string
+	entries   []Entry
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		passwords: map[string]string{
+			serviceDN: "service-secret",
+			aliceDN:   "alice-secret",
+		},
+		entries: []Entry{{
+			DN: aliceDN,
+			Attributes: map[string][]string{
+				"objectClass": {"inetOrgPerson"},
+				"uid":         {"Alice"},
+				"memberOf":    {"cn=admins,ou=groups,dc=example,dc=org", "cn=staff,ou=groups,dc=example,dc=org"},
+			},
+		}},
+	}
+}
+
+// dial returns a client connected to a goroutine serving with handle.
+func dial(t *testing.T, handle func(conn net.Conn)) *Conn {
+	t.Helper()
+
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		handle(server)
+	}()
+
+	conn := NewConn(client, "ldap.example.org")
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func (inst *fakeServer) serve(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	for {
+		message, err := readPacket(reader)
+		if err != nil || len(message.children) < 2 {
+			return
+		}
+		id, op := message.children[0], message.children[1]
+
+		switch op.tag {
+		case opBindRequest:
+			code := ResultInvalidCredentials
+			if len(op.children) == 3 {
+				dn, password := op.children[1].string(), op.children[2].string()
+				if expected, ok := inst.passwords[dn]; ok && expected == password {
+					code = ResultSuccess
+				}
+			}
+			writeMessage(conn, id, newConstructed(opBindResponse, result(code)...))
+		case opSearchRequest:
+			base, filter := op.children[0].string(), op.children[6]
+			if !strings.HasSuffix(base, "dc=example,dc=org") {
+				writeMessage(conn, id, newConstructed(opSearchDone, result(ResultNoSuchObject)...))
+				continue
+			}
+			for _, entry := range inst.entries {
+				if strings.HasSuffix(entry.DN, base) && matches(filter, &entry) {
+					writeMessage(conn, id, encodeEntry(&entry))
+				}
+			}
+			writeMessage(conn, id, newConstructed(opSearchDone, result(ResultSuccess)...))
+		default:
+			return
+		}
+	}
+}
+
+// matches evaluates the And, Equal and Present filters the client builds.
+func matches(filter *packet, entry *Entry) bool {
+	switch filter.tag {
+	case classContext | constructed | 0:
+		for _, child := range filter.children {
+			if !matches(child, entry) {
+				return false
+			}
+		}
+		return true
+	case classContext | constructed | 3:
+		for _, value := range entry.Values(filter.children[0].string()) {
+			if strings.EqualFold(value, filter.children[1].string()) {
+				return true
+			}
+		}
+		return false
+	case classContext | 7:
+		return entry.Values(filter.string()) != nil
+	default:
+		return false
+	}
+}
+
+func result(code int) []*packet {
+	return []*packet{
+		newInteger(tagEnumerated, int64(code)),
+		newString(tagOctetString, ""),
+		newString(tagOctetString, "diagnostic"),
+	}
+}
+
+func encodeEntry(entry *Entry) *packet {
+	attributes := make([]*packet, 0, len(entry.Attributes))
+	for name, values := range entry.Attributes {
+		set := make([]*packet, 0, len(values))
+		for _, value := range values {
+			set = append(set, newString(tagOctetString, value))
+		}
+		attributes = append(attributes, newConstructed(tagSequence,
+			newString(tagOctetString, name),
+			newConstructed(0x11, set...),
+		))
+	}
+
+	return newConstructed(opSearchEntry,
+		newString(tagOctetString, entry.DN),
+		newConstructed(tagSequence, attributes...),
+	)
+}
+
+func writeMessage(conn net.Conn, id *packet, op *packet) {
+	conn.Write(newConstructed(tagSequence, id, op).encode())
+}
+
+func TestBindAndSearch(t *testing.T) {
+	conn := dial(t, newFakeServer().serve)
+
+	if err := conn.Bind(serviceDN, "service-secret"); err != nil {
+		t.Fatalf("service bind: %v", err)
+	}
+
+	entries, err := conn.Search(&SearchRequest{
+		BaseDN:     peopleDN,
+		Scope:      ScopeWholeSubtree,
+		Filter:     And(Equal("objectClass", "inetOrgPerson"), Equal("uid", "alice"), Present("memberOf")),
+		Attributes: []string{"uid", "memberOf"},
+		SizeLimit:  2,
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].DN != aliceDN {
+		t.Fatalf("entries = %+v, want %s", entries, aliceDN)
+	}
+
+	if got := entries[0].Values("UID"); len(got) != 1 || got[0] != "Alice" {
+		t.Errorf("uid = %v, want [Alice]", got)
+	}
+
+	if got := entries[0].Values("memberof"); len(got) != 2 {
+		t.Errorf("memberOf = %v, want two groups", got)
+	}
+
+	if err := conn.Bind(entries[0].DN, "alice-secret"); err != nil {
+		t.Errorf("user bind: %v", err)
+	}
+}
+
+func TestSearchValuesAreNotParsed(t *testing.T) {
+	conn := dial(t, newFakeServer().serve)
+
+	entries, err := conn.Search(&SearchRequest{
+		BaseDN: peopleDN,
+		Scope:  ScopeWholeSubtree,
+		Filter: Equal("uid", "*)(uid=*"),
+	})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+
+	if len(entries) != 0 {
+		t.Errorf("entries = %+v, want none", entries)
+	}
+}
+
+func TestSearchNoSuchObject(t *testing.T) {
+	conn := dial(t, newFakeServer().serve)
+
+	_, err := conn.Search(&SearchRequest{BaseDN: "dc=other", Filter: Present("uid")})
+	if !IsResult(err, ResultNoSuchObject) {
+		t.Fatalf("err = %v, want result %d", err, ResultNoSuchObject)
+	}
+}
+
+func TestBindInvalidCredentials(t *testing.T) {
+	tests := []struct {
+		name     string
+		dn       string
+		password string
+	}{
+		{name: "wrong password", dn: aliceDN, password: "guess"},
+		{name: "unknown dn", dn: "uid=mallory,ou=people,dc=example,dc=org", password: "alice-secret"},
+		// refused by the client, an unauthenticated bind would succeed
+		{name: "empty password", dn: aliceDN, password: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dial(t, newFakeServer().serve)
+
+			err := conn.Bind(tt.dn, tt.password)
+			if !IsResult(err, ResultInvalidCredentials) {
+				t.Fatalf("err = %v, want result %d", err, ResultInvalidCredentials)
+			}
+
+			// the connection stays usable after a failed bind
+			if err := conn.Bind(serviceDN, "service-secret"); err != nil {
+				t.Errorf("bind after failure: %v", err)
+			}
+		})
+	}
+}
+
+func TestMalformedResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		response []byte
+		want     error
+	}{
+		{
+			name:     "length of five octets",
+			response: []byte{0x30, 0x85, 0x00, 0x00, 0x00, 0x00, 0x07},
+			want:     errMalformed,
+		},
+		{
+			name:     "indefinite length",
+			response: []byte{0x30, 0x80, 0x00, 0x00},
+			want:     errMalformed,
+		},
+		{
+			name:     "length over the limit",
+			response: []byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff},
+			want:     errMalformed,
+		},
+		{
+			name:     "child longer than its parent",
+			response: []byte{0x30, 0x05, 0x02, 0x01, 0x01, 0x61, 0x10},
+			want:     errMalformed,
+		},
+		{
+			name:     "child length octets cut off",
+			response: []byte{0x30, 0x05, 0x02, 0x01, 0x01, 0x61, 0x84},
+			want:     errMalformed,
+		},
+		{
+			name:     "truncated value",
+			response: []byte{0x30, 0x0c, 0x02, 0x01, 0x01},
+			want:     io.ErrUnexpectedEOF,
+		},
+		{
+			name:     "not a sequence",
+			response: []byte{0x04, 0x00},
+			want:     errMalformed,
+		},
+		{
+			name:     "message id too long",
+			response: newConstructed(tagSequence, newPrimitive(tagInteger, make([]byte, 9)), newConstructed(opBindResponse, result(0)...)).encode(),
+			want:     errMalformed,
+		},
+		{
+			name:     "other message id",
+			response: newConstructed(tagSequence, newInteger(tagInteger, 7), newConstructed(opBindResponse, result(0)...)).encode(),
+			want:     errMalformed,
+		},
+		{
+			name:     "other operation",
+			response: newConstructed(tagSequence, newInteger(tagInteger, 1), newConstructed(opSearchDone, result(0)...)).encode(),
+			want:     errMalformed,
+		},
+		{
+			name:     "result without a code",
+			response: newConstructed(tagSequence, newInteger(tagInteger, 1), newConstructed(opBindResponse)).encode(),
+			want:     errMalformed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := dial(t, func(conn net.Conn) {
+				if _, err := readPacket(bufio.NewReader(conn)); err != nil {
+					return
+				}
+				conn.Write(tt.response)
+			})
+
+			err := conn.Bind(aliceDN, "alice-secret")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoticeOfDisconnection(t *testing.T) {
+	conn := dial(t, func(conn net.Conn) {
+		if _, err := readPacket(bufio.NewReader(conn)); err != nil {
+			return
+		}
+		notice := newConstructed(opExtendedResponse, newInteger(tagEnumerated, 52), newString(tagOctetString, ""), newString(tagOctetString, "shutting down"))
+		writeMessage(conn, newInteger(tagInteger, 0), notice)
+	})
+
+	if err := conn.Bind(aliceDN, "alice-secret"); !IsResult(err, 52) {
+		t.Fatalf("err = %v, want result 52", err)
+	}
+}
+
+func TestIntegerRoundTrip(t *testing.T) {
+	for _, value := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 31, -(1 << 40)} {
+		decoded, err := newInteger(tagInteger, value).integer()
+		if err != nil || decoded != value {
+			t.Errorf("integer %d decoded as %d, %v", value, decoded, err)
+		}
+	}
+}
+
+func TestLongLengthRoundTrip(t *testing.T) {
+	value := strings.Repeat("x", 300)
+	encoded := newConstructed(tagSequence, newString(tagOctetString, value)).encode()
+
+	decoded, err := readPacket(bufio.NewReader(strings.NewReader(string(encoded))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded.children) != 1 || decoded.children[0].string() != value {
+		t.Errorf("decoded %d children, want the 300 byte string back", len(decoded.children))
+	}
+}
@@ -1,27 +1,216 @@
 package service
 
 import (
+	"context"
+	"crypto/tls"
+	"docs/internal/config"
 	"docs/internal/service"
 	"docs/pkg/database"
 
 	"go.uber.org/zap"
 )
 
+// runner is a background worker started with the server.
+type runner interface {
+	Run(ctx context.Context)
+}
+
 type ServiceCollector struct {
 	AuthService         service.AuthService
+	SSOService          service.SSOService
+	SessionService      service.SessionService
+	LockoutService      service.LockoutService
+	TOTPService         service.TOTPService
+	APIKeyService       service.APIKeyService
 	RegistrationService service.RegistrationService
+	PasswordService     service.PasswordService
+	UserService         service.UserService
+	ProfileService      service.ProfileService
+	InviteService       service.InviteService
 	DocumentService     service.DocumentService
+	WebhookService      service.WebhookService
+	StreamService       service.StreamService
+	AuditService        service.AuditService
+	SyncService         service.SyncService
+	CommentService      service.CommentService
+	Cache               service.Cacher
+	runners             []runner
 }
 
-func NewServiceCollector(log *zap.Logger, uploadPath, adminToken string, repo *database.PostgresRepository) *ServiceCollector {
+func NewServiceCollector(log *zap.Logger, cfg *config.Config, repo *database.PostgresRepository) (*ServiceCollector, error) {
 	cache := NewInternalCache()
-	docsService := service.NewAuth(log, repo.SessionRepository, repo.UserRepository)
-	registrationService := service.NewRegistration(log, adminToken, repo.UserRepository)
-	documentService := service.NewDocument(log, uploadPath, repo.GrantRepository, repo.DocumentRepository, repo.SessionRepository, cache)
+
+	jwt, err := newJWT(cfg)
+	if err != nil {
+		return nil, err
+	}
+	sessions := service.NewSessions(repo.SessionRepository, jwt, cache, cfg.JWT.DenyCacheTTL)
+
+	auditService := service.NewAudit(log, repo.AuditRepository)
+	hasher := service.NewPasswordHasher(service.Argon2Options{
+		Memory:      cfg.Password.Argon2.Memory,
+		Iterations:  cfg.Password.Argon2.Iterations,
+		Parallelism: cfg.Password.Argon2.Parallelism,
+		SaltLength:  cfg.Password.Argon2.SaltLength,
+		KeyLength:   cfg.Password.Argon2.KeyLength,
+	})
+	policy, err := newPolicy(cfg)
+	if err != nil {
+		return nil, err
+	}
+	docsService := service.NewAuth(log, sessions, repo.UserRepository, repo.TOTPRepository, repo.APIKeyRepository, newAuthenticator(log, cfg, repo, hasher), repo.FailureRepository, auditService, service.SessionOptions{
+		AccessTTL:       cfg.Session.AccessTTL,
+		MaxTTL:          cfg.Session.MaxTTL,
+		RefreshTTL:      cfg.Session.RefreshTTL,
+		JanitorInterval: cfg.Session.JanitorInterval,
+		TOTPIssuer:      cfg.TOTP.Issuer,
+		ChallengeTTL:    cfg.TOTP.ChallengeTTL,
+		Lockout: service.LockoutOptions{
+			MaxFailures:   cfg.Lockout.MaxFailures,
+			IPMaxFailures: cfg.Lockout.IPMaxFailures,
+			BaseDelay:     cfg.Lockout.BaseDelay,
+			MaxDelay:      cfg.Lockout.MaxDelay,
+			Duration:      cfg.Lockout.Duration,
+			Window:        cfg.Lockout.Window,
+		},
+	}, jwt)
+	var provider *service.OIDC
+	if cfg.OIDC.Enabled {
+		provider = service.NewOIDC(service.OIDCOptions{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+		})
+	}
+	ssoService := service.NewSSO(log, docsService, provider, repo.UserRepository, repo.OIDCRepository, policy, auditService, service.SSOOptions{
+		LoginClaim:        cfg.OIDC.LoginClaim,
+		GroupsClaim:       cfg.OIDC.GroupsClaim,
+		RoleMapping:       cfg.OIDC.RoleMapping,
+		AutoProvision:     cfg.OIDC.AutoProvision,
+		LinkClaim:         cfg.OIDC.LinkClaim,
+		LinkVerifiedClaim: cfg.OIDC.LinkVerifiedClaim,
+		StateTTL:          cfg.OIDC.StateTTL,
+	})
+	profileService := service.NewProfile(log, repo.UserRepository, repo.DocumentRepository, repo.GrantRepository, auditService)
+	webhookService := service.NewWebhook(log, repo.WebhookRepository)
+	streamService := service.NewStream(log, repo.EventRepository, webhookService, docsService)
+	registrationService := service.NewRegistration(log, cfg.AdminToken, repo.UserRepository, sessions, repo.PasswordRepository, repo.InviteRepository, hasher, policy, cache, streamService, auditService, service.RegistrationOptions{
+		ResetTTL:  cfg.Password.ResetTTL,
+		InviteTTL: cfg.Invite.TTL,
+	})
+	syncService := service.NewSync(log, repo.EventRepository, repo.DocumentRepository, auditService, service.SyncOptions{
+		Retention:     cfg.Events.Retention,
+		PurgeInterval: cfg.Events.PurgeInterval,
+	})
+	commentService := service.NewComment(log, repo.CommentRepository, repo.DocumentRepository, repo.GrantRepository, auditService)
+	documentService := service.NewDocument(log, cfg.UploadPath, repo.GrantRepository, repo.DocumentRepository, repo.LockRepository, cache, auditService)
+	if err := documentService.MigrateFilePaths(context.Background()); err != nil {
+		return nil, err
+	}
 
 	return &ServiceCollector{
 		AuthService:         docsService,
+		SSOService:          ssoService,
+		SessionService:      docsService,
+		LockoutService:      docsService,
+		TOTPService:         docsService,
+		APIKeyService:       docsService,
 		RegistrationService: registrationService,
+		PasswordService:     registrationService,
+		UserService:         registrationService,
+		ProfileService:      profileService,
+		InviteService:       registrationService,
 		DocumentService:     documentService,
+		WebhookService:      webhookService,
+		StreamService:       streamService,
+		AuditService:        auditService,
+		SyncService:         syncService,
+		CommentService:      commentService,
+		Cache:               cache,
+		runners:             []runner{webhookService, streamService, docsService, syncService},
+	}, nil
+}
+
+// newPolicy checks passwords against the breached password list when one is
+// set.
+func newPolicy(cfg *config.Config) (*service.Policy, error) {
+	var breached service.BreachChecker
+	if cfg.Policy.Password.BreachedDir != "" {
+		list, err := service.NewBreachedPasswords(cfg.Policy.Password.BreachedDir)
+		if err != nil {
+			return nil, err
+		}
+		breached = list
+	}
+
+	return service.NewPolicy(service.LoginPolicy{
+		MinLength:           cfg.Policy.Login.MinLength,
+		MaxLength:           cfg.Policy.Login.MaxLength,
+		AllowedSpecials:     cfg.Policy.Login.AllowedSpecials,
+		ForbiddenSubstrings: cfg.Policy.Login.ForbiddenSubstrings,
+	}, service.PasswordPolicy{
+		MinLength:           cfg.Policy.Password.MinLength,
+		MaxLength:           cfg.Policy.Password.MaxLength,
+		MinLetters:          cfg.Policy.Password.MinLetters,
+		MinUpper:            cfg.Policy.Password.MinUpper,
+		MinLower:            cfg.Policy.Password.MinLower,
+		MinDigits:           cfg.Policy.Password.MinDigits,
+		MinSpecials:         cfg.Policy.Password.MinSpecials,
+		ForbidLogin:         cfg.Policy.Password.ForbidLogin,
+		ForbiddenSubstrings: cfg.Policy.Password.ForbiddenSubstrings,
+	}, breached), nil
+}
+
+// newAuthenticator checks local passwords and, when enabled, LDAP ones.
+func newAuthenticator(log *zap.Logger, cfg *config.Config, repo *database.PostgresRepository, hasher *service.PasswordHasher) service.Authenticator {
+	local := service.NewPasswordAuthenticator(log, repo.UserRepository, hasher)
+	if !cfg.LDAP.Enabled {
+		return local
+	}
+
+	return service.Authenticators{local, service.NewLDAPAuthenticator(log, repo.UserRepository, service.LDAPOptions{
+		URL:            cfg.LDAP.URL,
+		StartTLS:       cfg.LDAP.StartTLS,
+		TLSConfig:      &tls.Config{InsecureSkipVerify: cfg.LDAP.InsecureSkipVerify},
+		BindDN:         cfg.LDAP.BindDN,
+		BindPassword:   cfg.LDAP.BindPassword,
+		BaseDN:         cfg.LDAP.BaseDN,
+		ObjectClass:    cfg.LDAP.ObjectClass,
+		LoginAttribute: cfg.LDAP.LoginAttribute,
+		GroupAttribute: cfg.LDAP.GroupAttribute,
+		GroupMapping:   cfg.LDAP.GroupMapping,
+		Timeout:        cfg.LDAP.Timeout,
+	})}
+}
+
+// newJWT returns nil unless JWT access tokens are enabled.
+func newJWT(cfg *config.Config) (*service.JWT, error) {
+	if !cfg.JWT.Enabled {
+		return nil, nil
+	}
+
+	options := service.JWTOptions{
+		Algorithm: cfg.JWT.Algorithm,
+		Issuer:    cfg.JWT.Issuer,
+		Secret:    cfg.SecretKey,
+	}
+
+	if cfg.JWT.Algorithm == service.JWTAlgorithmEdDSA {
+		privateKey, publicKey, err := service.LoadEd25519Keys(cfg.JWT.PrivateKeyFile, cfg.JWT.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		options.PrivateKey, options.PublicKey = privateKey, publicKey
+	}
+
+	return service.NewJWT(options)
+}
+
+// Start launches the background workers, they stop when ctx is done.
+func (inst *ServiceCollector) Start(ctx context.Context) {
+	for _, r := range inst.runners {
+		go r.Run(ctx)
 	}
 }